@@ -7,10 +7,19 @@ import { useFormGeneration, FormData } from "@/hooks/forms/useFormGeneration";
 import { useTips } from "@/hooks/forms/useTips";
 import { SimpleFormField } from "@/components/forms/SimpleField";
 import { toast } from "sonner";
-import { createSheet } from "@/scripts/sheets";
-import { BookOpen, ClipboardList, Zap } from "lucide-react";
+import { createSheet, getModes } from "@/scripts/sheets";
+import { BookOpen, ClipboardList, Sparkles, Zap, type LucideIcon } from "lucide-react";
+
+type ModeOption = {
+  id: string;
+  label: string;
+  icon: LucideIcon;
+  color: string;
+  activeColor: string;
+  description: string;
+};
 
-const MODES = [
+const MODES: ModeOption[] = [
   {
     id: "notes",
     label: "Notes",
@@ -35,7 +44,14 @@ const MODES = [
     activeColor: "bg-purple-500 text-white border-purple-700",
     description: "Memory-optimized study guide using key points, mnemonics, and cheat sheets. Read it once, pass the exam.",
   },
-] as const;
+];
+
+// Styling for modes added to the registry on the server
+const CUSTOM_MODE_STYLE = {
+  icon: Sparkles,
+  color: "bg-green-100 border-green-500 text-green-800",
+  activeColor: "bg-green-500 text-white border-green-700",
+};
 
 type CreateSheetProps = {
   initialData?: Partial<FormData>;
@@ -53,9 +69,11 @@ export default function CreateSheet({ initialData }: CreateSheetProps) {
     mode: "notes",
     webSearchQuery: "",
     webSearchEnabled: false,
+    webSearchLimit: 3,
   });
 
   const [files, setFiles] = useState<File[]>([]);
+  const [modes, setModes] = useState<ModeOption[]>(MODES);
 
   const {
     loadingState,
@@ -68,6 +86,25 @@ export default function CreateSheet({ initialData }: CreateSheetProps) {
 
   const { showTips } = useTips(formData);
 
+  useEffect(() => {
+    getModes()
+      .then((registry) => {
+        if (!Array.isArray(registry) || registry.length === 0) return;
+        setModes(registry.map((mode) => {
+          const preset = MODES.find((m) => m.id === mode.name);
+          return {
+            ...(preset ?? CUSTOM_MODE_STYLE),
+            id: mode.name,
+            label: mode.label || preset?.label || mode.name,
+            description: preset?.description ?? mode.description,
+          };
+        }));
+      })
+      .catch(() => {
+        // Keep the built-in modes
+      });
+  }, []);
+
   useEffect(() => {
     if (!initialData) return;
     setFormData((prev) => ({
@@ -85,6 +122,10 @@ export default function CreateSheet({ initialData }: CreateSheetProps) {
     setFormData(prev => ({ ...prev, webSearchEnabled: !prev.webSearchEnabled }));
   };
 
+  const handleWebSearchLimit = (e: React.ChangeEvent<HTMLSelectElement>) => {
+    setFormData(prev => ({ ...prev, webSearchLimit: Number(e.target.value) }));
+  };
+
   const addFiles = (incoming: FileList | File[]) => {
     const list = Array.from(incoming);
     const next = [...files, ...list];
@@ -170,7 +211,7 @@ export default function CreateSheet({ initialData }: CreateSheetProps) {
         <div className="mb-6">
           <label className="block font-bold mb-2 text-xl">Generation Mode</label>
           <div className="grid grid-cols-1 sm:grid-cols-3 gap-3">
-            {MODES.map((mode) => {
+            {modes.map((mode) => {
               const isActive = formData.mode === mode.id;
               const Icon = mode.icon;
               return (
@@ -224,6 +265,20 @@ export default function CreateSheet({ initialData }: CreateSheetProps) {
             placeholder="Search query (e.g., 'Photosynthesis key concepts and diagrams')"
             className="w-full border-2 border-black rounded-lg px-3 py-2 text-sm shadow-[2px_2px_0_0_#000] focus:outline-none"
           />
+          <div className="flex items-center gap-2 mt-3">
+            <label htmlFor="webSearchLimit" className="text-sm font-bold">Sources</label>
+            <select
+              id="webSearchLimit"
+              name="webSearchLimit"
+              value={formData.webSearchLimit ?? 3}
+              onChange={handleWebSearchLimit}
+              className="border-2 border-black rounded-lg px-2 py-1 text-sm bg-white shadow-[2px_2px_0_0_#000] focus:outline-none"
+            >
+              {[1, 2, 3, 4, 5].map((n) => (
+                <option key={n} value={n}>{n}</option>
+              ))}
+            </select>
+          </div>
           <p className="text-xs text-gray-600 mt-2">
             When enabled, Vela will pull context from top web sources and include it in the generation.
           </p>
@@ -112,6 +112,7 @@ export default function SheetListCard() {
       if (prompt.mode) params.set("mode", String(prompt.mode));
       if (prompt.webSearchQuery) params.set("webSearchQuery", String(prompt.webSearchQuery));
       if (typeof prompt.webSearchEnabled === "boolean") params.set("webSearchEnabled", String(prompt.webSearchEnabled));
+      if (prompt.webSearchLimit) params.set("webSearchLimit", String(prompt.webSearchLimit));
       if (Array.isArray(prompt.tags)) params.set("tags", prompt.tags.join(","));
 
       const queryString = params.toString();
@@ -22,6 +22,7 @@ export function SheetsContainer() {
     mode: searchParams.get("mode") || "notes",
     webSearchQuery: searchParams.get("webSearchQuery") || "",
     webSearchEnabled: (searchParams.get("webSearchEnabled") || "").toLowerCase() === "true",
+    webSearchLimit: Number(searchParams.get("webSearchLimit")) || 3,
   };
 
 
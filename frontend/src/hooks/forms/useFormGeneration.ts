@@ -18,6 +18,7 @@ export interface FormData {
   mode: string;
   webSearchQuery?: string;
   webSearchEnabled?: boolean;
+  webSearchLimit?: number;
 }
 
 export interface LoadingState {
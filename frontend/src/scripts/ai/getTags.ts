@@ -18,4 +18,18 @@ export function getTagsQuery(params: { subject: string; course: string; descript
     queryFn: () => fetchTags(params),
     staleTime: 60 * 1000, // 1 minute
   });
-}
\ No newline at end of file
+}
+
+async function fetchSuggestedTags(text: string): Promise<string[]> {
+  const { data } = await http.post('/api/v1/sheets/suggest-tags', { text });
+  return data.tags ?? [];
+}
+
+// Live suggestions for a tag box; call on a debounce, the server rate limits per user
+export function suggestTagsQuery(text: string) {
+  return queryClient.fetchQuery({
+    queryKey: ['suggest-tags', text.trim()],
+    queryFn: () => fetchSuggestedTags(text),
+    staleTime: 5 * 60 * 1000, // 5 minutes
+  });
+}
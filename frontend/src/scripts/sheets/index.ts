@@ -12,6 +12,7 @@ export interface SheetCreateData {
   mode: string;
   webSearchQuery?: string;
   webSearchEnabled?: boolean;
+  webSearchLimit?: number;
 }
 
 export async function createSheet(data: SheetCreateData, files?: File[]) {
@@ -34,6 +35,19 @@ export async function createSheet(data: SheetCreateData, files?: File[]) {
   return res.data;
 }
 
+export interface GenerationMode {
+  name: string;
+  label: string;
+  description: string;
+  builtIn: boolean;
+  default: boolean;
+}
+
+export async function getModes(): Promise<GenerationMode[]> {
+  const res = await http.get("/api/v1/modes");
+  return res.data;
+}
+
 export async function getSheetQueue() {
   const res = await http.get("/api/v1/sheets/queue");
   return res.data;
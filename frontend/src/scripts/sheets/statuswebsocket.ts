@@ -1,6 +1,9 @@
 export function connectToJobWebSocket(jobId: string, sessionId: string, onUpdate: (data: any) => void) {
   const wsUrl = `${window.location.protocol === "https:" ? "wss" : "ws"}://${window.location.host}/api/v1/ws/job/${jobId}?session=${sessionId}`;
   const ws = new WebSocket(wsUrl);
+  // Pipeline updates are numbered per job; anything not newer than the
+  // last one seen arrived out of order and is dropped
+  let lastSeq = -1;
 
   ws.onopen = () => {
     console.log(`Connected to WebSocket for job ${jobId}`);
@@ -9,6 +12,12 @@ export function connectToJobWebSocket(jobId: string, sessionId: string, onUpdate
   ws.onmessage = (event) => {
     try {
       const data = JSON.parse(event.data);
+      if (typeof data.seq === "number") {
+        if (data.seq <= lastSeq && data.seq > 0) {
+          return;
+        }
+        lastSeq = Math.max(lastSeq, data.seq);
+      }
       console.log("WebSocket message received:", data);
       onUpdate(data);
     } catch (error) {
@@ -1,12 +1,56 @@
 package ai
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"strings"
 )
 
 const maxAttachmentPromptChars = 50000
 
+// Attachment roles
+const (
+	// AttachmentRoleReference is source material to draw content from
+	AttachmentRoleReference = "reference"
+	// AttachmentRoleTemplate is an example whose structure and layout the
+	// worksheet should follow
+	AttachmentRoleTemplate = "template"
+)
+
+// attachmentRoleGuidance tells the model how to treat each role
+var attachmentRoleGuidance = map[string]string{
+	AttachmentRoleReference: "REFERENCE MATERIAL: use it as a source of facts and content",
+	AttachmentRoleTemplate:  "TEMPLATE: follow its structure, layout and question style, but do not copy its content",
+}
+
+// NormalizeAttachmentRole trims and lower-cases role, rejecting unknown ones.
+// An empty role stays empty.
+func NormalizeAttachmentRole(role string) (string, error) {
+	role = strings.ToLower(strings.TrimSpace(role))
+	if role == "" {
+		return "", nil
+	}
+	if _, ok := attachmentRoleGuidance[role]; !ok {
+		return "", fmt.Errorf("unknown attachment role %q (use %q or %q)", role, AttachmentRoleReference, AttachmentRoleTemplate)
+	}
+	return role, nil
+}
+
+// Label describes the attachment's role and description for a prompt, or
+// returns "" when it has neither
+func (a Attachment) Label() string {
+	var parts []string
+	if guidance, ok := attachmentRoleGuidance[a.Role]; ok {
+		parts = append(parts, guidance)
+	}
+	if d := strings.TrimSpace(a.Description); d != "" {
+		parts = append(parts, "Description: "+d)
+	}
+	return strings.Join(parts, "\n")
+}
+
 // AppendAttachmentsToPrompt appends attachment content as raw text to the prompt.
 // This is the fallback for providers that don't support file attachments.
 func AppendAttachmentsToPrompt(prompt string, attachments []Attachment) string {
@@ -17,21 +61,35 @@ func AppendAttachmentsToPrompt(prompt string, attachments []Attachment) string {
 	var b strings.Builder
 	b.WriteString(prompt)
 	b.WriteString("\n\n[Attachments]\n")
+	b.WriteString(UntrustedAttachmentNotice + "\n")
 
-	for i, att := range attachments {
+	// Numbered by upload position, like the pipeline's attachment context
+	for _, i := range AttachmentPriorityOrder(attachments) {
+		att := attachments[i]
 		if att.Content == "" {
 			continue
 		}
 		b.WriteString(fmt.Sprintf("\nAttachment %d: %s (%s, %d bytes, %s)\n", i+1, att.Name, att.MimeType, att.Size, att.Encoding))
-		b.WriteString("---\n")
-
-		content := att.Content
-		if len(content) > maxAttachmentPromptChars {
-			content = content[:maxAttachmentPromptChars] + "\n[TRUNCATED]"
+		if label := att.Label(); label != "" {
+			b.WriteString(label + "\n")
 		}
-		b.WriteString(content)
-		b.WriteString("\n---\n")
+		b.WriteString(AttachmentPromptText(att, maxAttachmentPromptChars))
+		b.WriteString("\n")
 	}
 
 	return b.String()
 }
+
+// Data returns the attachment's raw bytes, decoding base64 content
+func (a Attachment) Data() ([]byte, error) {
+	if a.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(a.Content)
+	}
+	return []byte(a.Content), nil
+}
+
+// ContentHash returns the hex SHA-256 of data, which addresses stored attachments
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,134 @@
+package ai
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"nadhi.dev/sarvar/fun/config"
+)
+
+// MinAttachmentSlice is how many bytes of each attachment are kept
+// before any attachment gets more, budget permitting
+const MinAttachmentSlice = 2000
+
+// defaultAttachmentRolePriority puts templates, which shape the whole
+// sheet, ahead of reference material
+var defaultAttachmentRolePriority = []string{AttachmentRoleTemplate, AttachmentRoleReference}
+
+// attachmentRolePriority returns ATTACHMENT_ROLE_PRIORITY, the roles in the
+// order their attachments go in prompts. An empty list keeps the upload order.
+func attachmentRolePriority() []string {
+	raw, ok := config.GetConfigValue("ATTACHMENT_ROLE_PRIORITY").([]interface{})
+	if !ok {
+		return defaultAttachmentRolePriority
+	}
+	roles := []string{}
+	for _, v := range raw {
+		if s, ok := v.(string); ok {
+			roles = append(roles, strings.ToLower(strings.TrimSpace(s)))
+		}
+	}
+	return roles
+}
+
+// PrioritizeAttachments returns attachments in prompt order: explicit Order
+// first, then by role as ATTACHMENT_ROLE_PRIORITY lists them (no role counts
+// as reference), then as uploaded. The slice passed in is left as is.
+func PrioritizeAttachments(attachments []Attachment) []Attachment {
+	order := AttachmentPriorityOrder(attachments)
+	sorted := make([]Attachment, len(order))
+	for k, i := range order {
+		sorted[k] = attachments[i]
+	}
+	return sorted
+}
+
+// AttachmentPriorityOrder returns the indexes of attachments in the order
+// PrioritizeAttachments puts them, for callers that number attachments by
+// their upload position
+func AttachmentPriorityOrder(attachments []Attachment) []int {
+	order := make([]int, len(attachments))
+	for i := range order {
+		order[i] = i
+	}
+
+	roles := attachmentRolePriority()
+	rank := func(a Attachment) int {
+		role := a.Role
+		if role == "" {
+			role = AttachmentRoleReference
+		}
+		for i, r := range roles {
+			if r == role {
+				return i
+			}
+		}
+		return len(roles)
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := attachments[order[i]], attachments[order[j]]
+		if (a.Order > 0) != (b.Order > 0) {
+			return a.Order > 0
+		}
+		if a.Order != b.Order {
+			return a.Order < b.Order
+		}
+		return rank(a) < rank(b)
+	})
+	return order
+}
+
+// AllocateAttachmentBudget splits budget bytes across attachments, in
+// order, returning how many of each to keep. No attachment gets more than
+// perAttachment. Each first gets up to MinAttachmentSlice, earlier ones
+// first when the budget is tight; what's left is shared evenly, with
+// attachments that need less than an even share handing the rest on.
+func AllocateAttachmentBudget(attachments []Attachment, budget, perAttachment int) []int {
+	want := make([]int, len(attachments))
+	for i, att := range attachments {
+		want[i] = min(len(att.Content), perAttachment)
+	}
+
+	alloc := make([]int, len(attachments))
+	remaining := budget
+	for i := range attachments {
+		give := min(want[i], MinAttachmentSlice, remaining)
+		alloc[i] = give
+		remaining -= give
+	}
+
+	for remaining > 0 {
+		var active []int
+		for i := range attachments {
+			if alloc[i] < want[i] {
+				active = append(active, i)
+			}
+		}
+		if len(active) == 0 {
+			break
+		}
+		share := max(remaining/len(active), 1)
+		for _, i := range active {
+			give := min(share, want[i]-alloc[i], remaining)
+			alloc[i] += give
+			remaining -= give
+		}
+	}
+	return alloc
+}
+
+// TruncateAttachment cuts content to at most limit bytes on a character
+// boundary, noting how much was left out
+func TruncateAttachment(content string, limit int) string {
+	if len(content) <= limit {
+		return content
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	return content[:cut] + fmt.Sprintf("\n[TRUNCATED: kept %d of %d bytes]", cut, len(content))
+}
@@ -0,0 +1,267 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"nadhi.dev/sarvar/fun/config"
+	"nadhi.dev/sarvar/fun/httpclient"
+)
+
+// OpenRouterModelsEndpoint lists the models OpenRouter currently serves
+const OpenRouterModelsEndpoint = "https://openrouter.ai/api/v1/models"
+
+// openRouterCatalogTTL is how long a fetched model list is reused; a failed
+// fetch is retried after openRouterCatalogRetry
+const (
+	openRouterCatalogTTL   = time.Hour
+	openRouterCatalogRetry = 5 * time.Minute
+)
+
+// knownModels is the built-in catalog. It can't keep up with every release,
+// so a model missing from it is only warned about. Gemini names also match
+// their versioned and preview variants (gemini-2.0-flash-001).
+var knownModels = map[AIProvider][]string{
+	ProviderGemini: {
+		"gemini-2.5-pro",
+		"gemini-2.5-flash",
+		"gemini-2.5-flash-lite",
+		"gemini-2.0-flash",
+		"gemini-2.0-flash-exp",
+		"gemini-2.0-flash-lite",
+		"gemini-2.0-flash-thinking-exp",
+		"gemini-1.5-pro",
+		"gemini-1.5-flash",
+		"gemini-1.5-flash-8b",
+	},
+	ProviderOpenRouter: {
+		"google/gemini-2.5-pro",
+		"google/gemini-2.5-pro-exp-03-25",
+		"google/gemini-2.5-flash",
+		"google/gemini-2.0-flash-001",
+		"google/gemini-2.0-flash-exp",
+		"google/gemini-2.0-flash-lite-001",
+		"anthropic/claude-3.5-sonnet",
+		"anthropic/claude-3.7-sonnet",
+		"anthropic/claude-sonnet-4",
+		"openai/gpt-4o",
+		"openai/gpt-4o-mini",
+		"openai/gpt-4.1",
+		"openai/gpt-4.1-mini",
+		"deepseek/deepseek-chat",
+		"deepseek/deepseek-r1",
+		"meta-llama/llama-3.3-70b-instruct",
+		"mistralai/mistral-large",
+		"qwen/qwen-2.5-72b-instruct",
+	},
+}
+
+// ModelCheck is the result of looking up a configured model
+type ModelCheck struct {
+	Task     TaskType   `json:"task"`
+	Provider AIProvider `json:"provider"`
+	Model    string     `json:"model"`
+	Known    bool       `json:"known"`
+	// Source is the catalog checked: "openrouter" for the live list,
+	// "builtin" otherwise
+	Source     string `json:"source"`
+	Suggestion string `json:"suggestion,omitempty"`
+	Warning    string `json:"warning,omitempty"`
+}
+
+// NormalizeModelName cleans up a configured model name: surrounding space
+// and case are dropped, and Gemini's "models/" resource prefix is removed
+// since the request URL adds it
+func NormalizeModelName(provider AIProvider, model string) string {
+	model = strings.ToLower(strings.TrimSpace(model))
+	if provider == ProviderGemini {
+		model = strings.TrimPrefix(model, "models/")
+	}
+	return model
+}
+
+// CheckConfiguredModels looks up the main and utility models in the
+// provider's catalog. Models left empty use the built-in defaults and
+// aren't checked.
+func CheckConfiguredModels() ([]ModelCheck, error) {
+	aiConfig, err := GetAIConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	configured := []struct {
+		task    TaskType
+		setting string
+		model   string
+	}{
+		{TaskLaTeXGeneration, "AI_MAIN_MODEL", aiConfig.MainModel},
+		{TaskUtility, "AI_UTILITY_MODEL", aiConfig.UtilityModel},
+	}
+
+	checks := []ModelCheck{}
+	for _, c := range configured {
+		model := NormalizeModelName(aiConfig.Provider, c.model)
+		if model == "" {
+			continue
+		}
+		checks = append(checks, checkModel(aiConfig.Provider, c.task, c.setting, model))
+	}
+	return checks, nil
+}
+
+// ModelWarnings returns a warning for each configured model that isn't in
+// its provider's catalog
+func ModelWarnings() []string {
+	checks, err := CheckConfiguredModels()
+	if err != nil {
+		return nil
+	}
+	warnings := []string{}
+	for _, check := range checks {
+		if check.Warning != "" {
+			warnings = append(warnings, check.Warning)
+		}
+	}
+	return warnings
+}
+
+// checkModel looks up one normalized model name, configured as setting
+func checkModel(provider AIProvider, task TaskType, setting, model string) ModelCheck {
+	check := ModelCheck{Task: task, Provider: provider, Model: model, Source: "builtin"}
+
+	candidates := knownModels[provider]
+	if provider == ProviderOpenRouter {
+		if live, err := openRouterCatalog(); err == nil {
+			candidates = live
+			check.Source = "openrouter"
+		}
+	}
+
+	check.Known = modelInCatalog(provider, model, candidates, check.Source == "openrouter")
+	if check.Known {
+		return check
+	}
+
+	check.Suggestion = closestModel(model, candidates)
+	check.Warning = fmt.Sprintf("%s %q is not a known %s model", setting, model, provider)
+	if check.Suggestion != "" {
+		check.Warning += fmt.Sprintf("; did you mean %q?", check.Suggestion)
+	}
+	return check
+}
+
+// modelInCatalog reports whether model is one of candidates. Gemini names
+// also match versioned variants; built-in OpenRouter names match with a
+// variant suffix such as ":free". The live list has every variant already.
+func modelInCatalog(provider AIProvider, model string, candidates []string, live bool) bool {
+	base := model
+	if provider == ProviderOpenRouter && !live {
+		base, _, _ = strings.Cut(model, ":")
+	}
+	for _, known := range candidates {
+		if base == known {
+			return true
+		}
+		if provider == ProviderGemini && strings.HasPrefix(model, known+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// closestModel returns the candidate nearest to model by edit distance, if
+// it is close enough to be a likely typo
+func closestModel(model string, candidates []string) string {
+	best, bestDistance := "", 4
+	for _, candidate := range candidates {
+		if d := editDistance(model, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+var (
+	openRouterCatalogMu      sync.Mutex
+	openRouterCatalogModels  []string
+	openRouterCatalogErr     error
+	openRouterCatalogFetched time.Time
+)
+
+// openRouterCatalog returns the ids of OpenRouter's live model list, cached
+// for an hour. It is skipped when AI_MODEL_CATALOG_LIVE is off or remote AI
+// isn't allowed.
+func openRouterCatalog() ([]string, error) {
+	if !config.GetConfigBool("AI_MODEL_CATALOG_LIVE", true) || !config.AllowRemoteAI() {
+		return nil, fmt.Errorf("live model catalog disabled")
+	}
+
+	openRouterCatalogMu.Lock()
+	defer openRouterCatalogMu.Unlock()
+
+	ttl := openRouterCatalogTTL
+	if openRouterCatalogErr != nil {
+		ttl = openRouterCatalogRetry
+	}
+	if !openRouterCatalogFetched.IsZero() && time.Since(openRouterCatalogFetched) < ttl {
+		return openRouterCatalogModels, openRouterCatalogErr
+	}
+
+	openRouterCatalogModels, openRouterCatalogErr = fetchOpenRouterModels()
+	openRouterCatalogFetched = time.Now()
+	return openRouterCatalogModels, openRouterCatalogErr
+}
+
+// fetchOpenRouterModels downloads OpenRouter's model list
+func fetchOpenRouterModels() ([]string, error) {
+	resp, err := httpclient.New(10 * time.Second).Get(OpenRouterModelsEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch OpenRouter models: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch OpenRouter models: status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode OpenRouter models: %w", err)
+	}
+	models := make([]string, 0, len(body.Data))
+	for _, m := range body.Data {
+		models = append(models, strings.ToLower(m.ID))
+	}
+	if len(models) == 0 {
+		return nil, fmt.Errorf("OpenRouter returned no models")
+	}
+	return models, nil
+}
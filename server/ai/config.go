@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"nadhi.dev/sarvar/fun/config"
+	logg "nadhi.dev/sarvar/fun/logs"
 )
 
 // GetAIConfig retrieves the AI configuration from the config file
@@ -48,6 +49,11 @@ func GetModelConfig(taskType TaskType) (*ModelConfig, error) {
 		return nil, err
 	}
 
+	// Both built-in providers are hosted services
+	if !config.AllowRemoteAI() {
+		return nil, fmt.Errorf("AI provider %s is remote and LOCAL_ONLY is enabled; set LOCAL_ONLY_ALLOW_REMOTE_AI to allow it", aiConfig.Provider)
+	}
+
 	modelConfig := &ModelConfig{
 		Provider: aiConfig.Provider,
 	}
@@ -61,6 +67,7 @@ func GetModelConfig(taskType TaskType) (*ModelConfig, error) {
 	default:
 		modelConfig.Model = aiConfig.MainModel
 	}
+	modelConfig.Model = NormalizeModelName(aiConfig.Provider, modelConfig.Model)
 
 	// Select API key based on provider
 	switch aiConfig.Provider {
@@ -101,7 +108,9 @@ func GetModelConfig(taskType TaskType) (*ModelConfig, error) {
 	return modelConfig, nil
 }
 
-// ValidateAIConfig validates the AI configuration
+// ValidateAIConfig validates the AI configuration. Models missing from the
+// provider's catalog are logged as warnings rather than failing, since new
+// models appear faster than the catalog is updated.
 func ValidateAIConfig() error {
 	aiConfig, err := GetAIConfig()
 	if err != nil {
@@ -121,5 +130,9 @@ func ValidateAIConfig() error {
 		return fmt.Errorf("invalid AI provider: %s (must be 'gemini' or 'openrouter')", aiConfig.Provider)
 	}
 
+	for _, warning := range ModelWarnings() {
+		logg.Warning(warning)
+	}
+
 	return nil
 }
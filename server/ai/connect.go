@@ -2,29 +2,42 @@ package ai
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
 	"time"
+
+	"nadhi.dev/sarvar/fun/httpclient"
 )
 
 // GeminiRequest represents the request body for Gemini API
 type GeminiRequest struct {
-	Contents          []GeminiContent    `json:"contents"`
-	SystemInstruction *GeminiInstruction `json:"systemInstruction,omitempty"`
+	Contents          []GeminiContent         `json:"contents"`
+	SystemInstruction *GeminiInstruction      `json:"systemInstruction,omitempty"`
+	GenerationConfig  *GeminiGenerationConfig `json:"generationConfig,omitempty"`
 }
 
 // GeminiContent represents a content part
 type GeminiContent struct {
+	Role  string       `json:"role,omitempty"` // user or model
 	Parts []GeminiPart `json:"parts"`
 }
 
-// GeminiPart represents a content part (text or inline data)
+// GeminiGenerationConfig holds sampling settings for a request
+type GeminiGenerationConfig struct {
+	StopSequences   []string `json:"stopSequences,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	CandidateCount  int      `json:"candidateCount,omitempty"`
+}
+
+// GeminiPart represents a content part (text, inline data or an uploaded file)
 type GeminiPart struct {
 	Text       string            `json:"text,omitempty"`
 	InlineData *GeminiInlineData `json:"inlineData,omitempty"`
+	FileData   *GeminiFileData   `json:"fileData,omitempty"`
 }
 
 // GeminiInlineData represents inline file data
@@ -40,16 +53,77 @@ type GeminiInstruction struct {
 
 // GeminiResponse represents the response from Gemini API
 type GeminiResponse struct {
-	Candidates []GeminiCandidate `json:"candidates"`
+	Candidates    []GeminiCandidate    `json:"candidates"`
+	UsageMetadata *GeminiUsageMetadata `json:"usageMetadata,omitempty"`
+}
+
+// GeminiUsageMetadata reports the tokens consumed by a request
+type GeminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+// usage converts the response's usage metadata, if any
+func (r *GeminiResponse) usage() Usage {
+	if r.UsageMetadata == nil {
+		return Usage{}
+	}
+	return newUsage(r.UsageMetadata.PromptTokenCount, r.UsageMetadata.CandidatesTokenCount, r.UsageMetadata.TotalTokenCount)
 }
 
 // GeminiCandidate represents a candidate response
 type GeminiCandidate struct {
-	Content GeminiContent `json:"content"`
+	Content      GeminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
 }
 
-// GenerateResponse generates a response using Gemini API
-func GenerateResponse(apiKey, model, systemPrompt, userPrompt string, cooldownSec int) (string, error) {
+// result converts the response into a Result. Candidates without text,
+// e.g. ones blocked for safety, are skipped; the first one left becomes
+// Text, and all of them Candidates when more than one was returned.
+func (r *GeminiResponse) result(model string) (Result, error) {
+	result := Result{Usage: r.usage(), Provider: ProviderGemini, Model: model}
+	for _, candidate := range r.Candidates {
+		if len(candidate.Content.Parts) == 0 {
+			continue
+		}
+		if len(result.Candidates) == 0 {
+			result.Text = candidate.Content.Parts[0].Text
+			result.FinishReason = candidate.FinishReason
+		}
+		result.Candidates = append(result.Candidates, candidate.Content.Parts[0].Text)
+	}
+	if len(result.Candidates) == 0 {
+		return Result{}, fmt.Errorf("no response generated")
+	}
+	if len(result.Candidates) == 1 {
+		result.Candidates = nil
+	}
+	return result, nil
+}
+
+// applyOptions adds the stop sequences, token limit and response prefix to
+// the request
+func (r *GeminiRequest) applyOptions(opts requestOptions) {
+	if len(opts.Stop) > 0 || opts.MaxTokens > 0 || opts.Candidates > 1 {
+		r.GenerationConfig = &GeminiGenerationConfig{StopSequences: opts.Stop, MaxOutputTokens: opts.MaxTokens}
+		if opts.Candidates > 1 {
+			r.GenerationConfig.CandidateCount = opts.Candidates
+		}
+	}
+	if opts.Prefix != "" {
+		r.Contents[0].Role = "user"
+		r.Contents = append(r.Contents, GeminiContent{Role: "model", Parts: []GeminiPart{{Text: opts.Prefix}}})
+	}
+}
+
+// GenerateResponseWithUsage generates a response using Gemini API and reports token usage
+func GenerateResponseWithUsage(apiKey, model, systemPrompt, userPrompt string, cooldownSec int) (Result, error) {
+	return generateGemini(context.Background(), apiKey, model, systemPrompt, userPrompt, cooldownSec, requestOptions{})
+}
+
+// generateGemini is GenerateResponseWithUsage with request options
+func generateGemini(ctx context.Context, apiKey, model, systemPrompt, userPrompt string, cooldownSec int, opts requestOptions) (Result, error) {
 	// Apply cooldown if specified
 	if cooldownSec > 0 {
 		time.Sleep(time.Duration(cooldownSec) * time.Second)
@@ -76,48 +150,73 @@ func GenerateResponse(apiKey, model, systemPrompt, userPrompt string, cooldownSe
 		}
 	}
 
+	reqBody.applyOptions(opts)
+
 	// Marshal to JSON
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %v", err)
+		return Result{}, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
 	// Make HTTP request
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(requestContext(ctx), "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to make request: %v", err)
+		return Result{}, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpclient.New(0).Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to make request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// Read response
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %v", err)
+		return Result{}, fmt.Errorf("failed to read response: %v", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		if msg := formatGeminiQuotaError(body); msg != "" {
-			return "", fmt.Errorf("%s", msg)
+			return Result{}, fmt.Errorf("%s", msg)
 		}
-		return "", fmt.Errorf("API error: %s", string(body))
+		return Result{}, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
 	}
 
 	// Unmarshal response
 	var geminiResp GeminiResponse
 	if err := json.Unmarshal(body, &geminiResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %v", err)
+		return Result{}, fmt.Errorf("failed to unmarshal response: %v", err)
 	}
 
 	// Extract text from response
-	if len(geminiResp.Candidates) > 0 && len(geminiResp.Candidates[0].Content.Parts) > 0 {
-		return geminiResp.Candidates[0].Content.Parts[0].Text, nil
+	return geminiResp.result(model)
+}
+
+// GenerateResponse generates a response using Gemini API, returning the
+// first candidate
+func GenerateResponse(apiKey, model, systemPrompt, userPrompt string, cooldownSec int) (string, error) {
+	result, err := GenerateResponseWithUsage(apiKey, model, systemPrompt, userPrompt, cooldownSec)
+	return result.Text, err
+}
+
+// GenerateResponseCandidates asks Gemini for n alternative responses and
+// returns the text of each. The API may return fewer than n.
+func GenerateResponseCandidates(apiKey, model, systemPrompt, userPrompt string, n, cooldownSec int) ([]string, error) {
+	result, err := generateGemini(context.Background(), apiKey, model, systemPrompt, userPrompt, cooldownSec, requestOptions{Candidates: n})
+	if err != nil {
+		return nil, err
 	}
+	return result.Texts(), nil
+}
 
-	return "", fmt.Errorf("no response generated")
+// GenerateResponseWithAttachmentsUsage is GenerateResponseWithAttachments with token usage reported.
+func GenerateResponseWithAttachmentsUsage(apiKey, model, systemPrompt, userPrompt string, attachments []Attachment, cooldownSec int) (Result, error) {
+	return generateGeminiWithAttachments(context.Background(), apiKey, model, systemPrompt, userPrompt, attachments, cooldownSec, requestOptions{})
 }
 
-// GenerateResponseWithAttachments generates a response using Gemini API with inline attachments when available.
-func GenerateResponseWithAttachments(apiKey, model, systemPrompt, userPrompt string, attachments []Attachment, cooldownSec int) (string, error) {
+// generateGeminiWithAttachments is GenerateResponseWithAttachmentsUsage with request options
+func generateGeminiWithAttachments(ctx context.Context, apiKey, model, systemPrompt, userPrompt string, attachments []Attachment, cooldownSec int, opts requestOptions) (Result, error) {
 	if cooldownSec > 0 {
 		time.Sleep(time.Duration(cooldownSec) * time.Second)
 	}
@@ -125,11 +224,28 @@ func GenerateResponseWithAttachments(apiKey, model, systemPrompt, userPrompt str
 	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", model, apiKey)
 
 	parts := []GeminiPart{{Text: userPrompt}}
+	for _, att := range attachments {
+		if att.Content != "" && att.Encoding != "base64" {
+			parts = append(parts, GeminiPart{Text: UntrustedAttachmentNotice})
+			break
+		}
+	}
 	for _, att := range attachments {
 		if att.Content == "" {
 			continue
 		}
 
+		// Binary parts carry no name, so a role or description goes first as text
+		if label := att.Label(); label != "" && att.Encoding == "base64" && att.MimeType != "" {
+			parts = append(parts, GeminiPart{Text: fmt.Sprintf("Attachment (%s, %s):\n%s", att.Name, att.MimeType, label)})
+		}
+
+		// Large binary files are uploaded once and referenced by URI
+		if part, ok := geminiAttachmentPart(apiKey, att); ok {
+			parts = append(parts, part)
+			continue
+		}
+
 		// For base64 payloads, use inlineData. Otherwise, append as text.
 		if att.Encoding == "base64" && att.MimeType != "" {
 			parts = append(parts, GeminiPart{
@@ -139,7 +255,11 @@ func GenerateResponseWithAttachments(apiKey, model, systemPrompt, userPrompt str
 				},
 			})
 		} else {
-			parts = append(parts, GeminiPart{Text: fmt.Sprintf("Attachment (%s, %s):\n%s", att.Name, att.MimeType, att.Content)})
+			header := fmt.Sprintf("Attachment (%s, %s):", att.Name, att.MimeType)
+			if label := att.Label(); label != "" {
+				header += "\n" + label
+			}
+			parts = append(parts, GeminiPart{Text: header + "\n" + AttachmentPromptText(att, 0)})
 		}
 	}
 
@@ -155,40 +275,48 @@ func GenerateResponseWithAttachments(apiKey, model, systemPrompt, userPrompt str
 			Parts: []GeminiPart{{Text: systemPrompt}},
 		}
 	}
+	reqBody.applyOptions(opts)
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %v", err)
+		return Result{}, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(requestContext(ctx), "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to make request: %v", err)
+		return Result{}, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpclient.New(0).Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to make request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %v", err)
+		return Result{}, fmt.Errorf("failed to read response: %v", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		if msg := formatGeminiQuotaError(body); msg != "" {
-			return "", fmt.Errorf("%s", msg)
+			return Result{}, fmt.Errorf("%s", msg)
 		}
-		return "", fmt.Errorf("API error: %s", string(body))
+		return Result{}, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
 	}
 
 	var geminiResp GeminiResponse
 	if err := json.Unmarshal(body, &geminiResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %v", err)
+		return Result{}, fmt.Errorf("failed to unmarshal response: %v", err)
 	}
 
-	if len(geminiResp.Candidates) > 0 && len(geminiResp.Candidates[0].Content.Parts) > 0 {
-		return geminiResp.Candidates[0].Content.Parts[0].Text, nil
-	}
+	return geminiResp.result(model)
+}
 
-	return "", fmt.Errorf("no response generated")
+// GenerateResponseWithAttachments generates a response using Gemini API with inline attachments when available.
+func GenerateResponseWithAttachments(apiKey, model, systemPrompt, userPrompt string, attachments []Attachment, cooldownSec int) (string, error) {
+	result, err := GenerateResponseWithAttachmentsUsage(apiKey, model, systemPrompt, userPrompt, attachments, cooldownSec)
+	return result.Text, err
 }
 
 func formatGeminiQuotaError(body []byte) string {
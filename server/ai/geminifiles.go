@@ -0,0 +1,227 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"nadhi.dev/sarvar/fun/config"
+	"nadhi.dev/sarvar/fun/httpclient"
+)
+
+// DefaultGeminiUploadThresholdMB is the attachment size above which files
+// go through the Gemini Files API instead of being inlined as base64
+const DefaultGeminiUploadThresholdMB = 4
+
+const geminiAPIBase = "https://generativelanguage.googleapis.com"
+
+// geminiUploadClient allows for large files on slow links
+func geminiUploadClient() *http.Client {
+	return httpclient.New(5 * time.Minute)
+}
+
+// GeminiFileData references a file uploaded through the Files API
+type GeminiFileData struct {
+	MimeType string `json:"mimeType"`
+	FileURI  string `json:"fileUri"`
+}
+
+// geminiFile is a file resource as returned by the Files API
+type geminiFile struct {
+	Name           string `json:"name"`
+	URI            string `json:"uri"`
+	MimeType       string `json:"mimeType"`
+	State          string `json:"state"`
+	ExpirationTime string `json:"expirationTime"`
+}
+
+// cachedGeminiFile is an uploaded file that can be reused until it expires
+type cachedGeminiFile struct {
+	uri      string
+	mimeType string
+	expires  time.Time
+}
+
+// Uploaded files are cached by API key and content hash; files belong to
+// the key's project, so a different key has to upload again
+var (
+	geminiFilesMu sync.Mutex
+	geminiFiles   = make(map[string]cachedGeminiFile)
+)
+
+// geminiUploadThreshold returns the size in bytes above which attachments
+// are uploaded, or 0 when uploading is disabled
+func geminiUploadThreshold() int {
+	mb := config.GetConfigInt("GEMINI_UPLOAD_THRESHOLD_MB", DefaultGeminiUploadThresholdMB)
+	if mb < 1 {
+		return 0
+	}
+	return mb * 1024 * 1024
+}
+
+// geminiAttachmentPart returns a fileData part for a large binary attachment,
+// uploading it if it isn't already cached. ok is false when the attachment
+// should be sent inline instead, including when the upload fails.
+func geminiAttachmentPart(apiKey string, att Attachment) (part GeminiPart, ok bool) {
+	threshold := geminiUploadThreshold()
+	if threshold == 0 || att.Encoding != "base64" || att.MimeType == "" {
+		return GeminiPart{}, false
+	}
+	// base64 is 4/3 the size of the data; skip decoding files that are clearly small
+	if len(att.Content)*3/4 <= threshold {
+		return GeminiPart{}, false
+	}
+
+	data, err := att.Data()
+	if err != nil || len(data) <= threshold {
+		return GeminiPart{}, false
+	}
+
+	hash := att.Hash
+	if hash == "" {
+		hash = ContentHash(data)
+	}
+	key := ContentHash([]byte(apiKey))[:16] + ":" + hash
+
+	geminiFilesMu.Lock()
+	cached, found := geminiFiles[key]
+	geminiFilesMu.Unlock()
+	if found && time.Now().Before(cached.expires) {
+		return GeminiPart{FileData: &GeminiFileData{MimeType: cached.mimeType, FileURI: cached.uri}}, true
+	}
+
+	file, err := uploadGeminiFile(apiKey, att.Name, att.MimeType, data)
+	if err != nil {
+		log.Printf("Gemini file upload failed for %s, sending inline: %v", att.Name, err)
+		return GeminiPart{}, false
+	}
+
+	// Files expire after 48 hours; stop reusing them an hour early
+	expires := time.Now().Add(47 * time.Hour)
+	if t, err := time.Parse(time.RFC3339Nano, file.ExpirationTime); err == nil {
+		expires = t.Add(-time.Hour)
+	}
+	mimeType := file.MimeType
+	if mimeType == "" {
+		mimeType = att.MimeType
+	}
+
+	geminiFilesMu.Lock()
+	geminiFiles[key] = cachedGeminiFile{uri: file.URI, mimeType: mimeType, expires: expires}
+	geminiFilesMu.Unlock()
+
+	return GeminiPart{FileData: &GeminiFileData{MimeType: mimeType, FileURI: file.URI}}, true
+}
+
+// uploadGeminiFile uploads data with the Files API resumable protocol and
+// waits for the file to become usable
+func uploadGeminiFile(apiKey, displayName, mimeType string, data []byte) (*geminiFile, error) {
+	meta, err := json.Marshal(map[string]interface{}{
+		"file": map[string]string{"display_name": displayName},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/upload/v1beta/files?key=%s", geminiAPIBase, apiKey), bytes.NewReader(meta))
+	if err != nil {
+		return nil, err
+	}
+	start.Header.Set("Content-Type", "application/json")
+	start.Header.Set("X-Goog-Upload-Protocol", "resumable")
+	start.Header.Set("X-Goog-Upload-Command", "start")
+	start.Header.Set("X-Goog-Upload-Header-Content-Length", strconv.Itoa(len(data)))
+	start.Header.Set("X-Goog-Upload-Header-Content-Type", mimeType)
+
+	resp, err := geminiUploadClient().Do(start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start upload: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upload start error: %s", string(body))
+	}
+	uploadURL := resp.Header.Get("X-Goog-Upload-URL")
+	if uploadURL == "" {
+		return nil, fmt.Errorf("upload start returned no upload URL")
+	}
+
+	upload, err := http.NewRequest(http.MethodPost, uploadURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	upload.Header.Set("X-Goog-Upload-Offset", "0")
+	upload.Header.Set("X-Goog-Upload-Command", "upload, finalize")
+
+	resp, err = geminiUploadClient().Do(upload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload file: %v", err)
+	}
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upload error: %s", string(body))
+	}
+
+	var uploaded struct {
+		File geminiFile `json:"file"`
+	}
+	if err := json.Unmarshal(body, &uploaded); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal upload response: %v", err)
+	}
+	if uploaded.File.URI == "" {
+		return nil, fmt.Errorf("upload response has no file URI")
+	}
+
+	return waitForGeminiFile(apiKey, &uploaded.File)
+}
+
+// waitForGeminiFile polls a file that is still PROCESSING until it is
+// ACTIVE. PDFs and images are usually active immediately.
+func waitForGeminiFile(apiKey string, file *geminiFile) (*geminiFile, error) {
+	const (
+		pollInterval = 2 * time.Second
+		maxPolls     = 15
+	)
+
+	for i := 0; file.State == "PROCESSING"; i++ {
+		if i == maxPolls {
+			return nil, fmt.Errorf("file %s still processing after %s", file.Name, pollInterval*maxPolls)
+		}
+		time.Sleep(pollInterval)
+
+		resp, err := geminiUploadClient().Get(fmt.Sprintf("%s/v1beta/%s?key=%s", geminiAPIBase, file.Name, apiKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to check file state: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file state: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("file state error: %s", string(body))
+		}
+
+		var polled geminiFile
+		if err := json.Unmarshal(body, &polled); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal file state: %v", err)
+		}
+		file = &polled
+	}
+
+	if file.State == "FAILED" {
+		return nil, fmt.Errorf("file %s failed processing", file.Name)
+	}
+	return file, nil
+}
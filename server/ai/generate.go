@@ -16,6 +16,7 @@ import (
 
 	store "nadhi.dev/sarvar/fun/database"
 	"nadhi.dev/sarvar/fun/db"
+	"nadhi.dev/sarvar/fun/httpclient"
 )
 
 const (
@@ -46,6 +47,26 @@ type GenerationRequest struct {
 	WebSearchQuery      string       `json:"webSearchQuery"`
 	WebSearchEnabled    bool         `json:"webSearchEnabled"`
 	Attachments         []Attachment `json:"attachments"`
+	// WebSearchLimit is how many search results to pull context from (1-5, default 3)
+	WebSearchLimit int `json:"webSearchLimit,omitempty"`
+	// Language is the language to write the worksheet in; empty leaves it to the model
+	Language string `json:"language"`
+	// AutoApprove runs the pipeline straight through without manual review gates
+	AutoApprove bool `json:"autoApprove"`
+	// StructuredDesign makes the design step emit a validated JSON spec
+	StructuredDesign bool `json:"structuredDesign"`
+	// SplitAnswerKey produces separate student and answer key PDFs in prep-test mode
+	SplitAnswerKey bool `json:"splitAnswerKey"`
+	// OptimizePrompt expands the request into a richer brief before the design step
+	OptimizePrompt bool `json:"optimizePrompt"`
+	// SelfReview has the model check its LaTeX against the request and
+	// regenerate once if it finds serious problems
+	SelfReview bool `json:"selfReview"`
+	// DesignOptions has the design step generate this many alternative
+	// designs (2-3) for the user to pick from; 0 generates one
+	DesignOptions int `json:"designOptions,omitempty"`
+	// NotebookID files the finished sheet into this notebook of the user's; 0 for none
+	NotebookID int `json:"notebookId,omitempty"`
 }
 
 // GenerationResult contains the generated content and metadata
@@ -100,38 +121,42 @@ const defaultStylePrompt = `% Document styling for visual appeal
 \\date{\\today}`
 
 // getStylePromptForRequest resolves the style prompt from the NoSQL store.
-// Priority: explicit style name > user's default style > defaultStylePrompt
+// Priority: explicit style name > preferred style > user's default style > defaultStylePrompt
 func getStylePromptForRequest(request *GenerationRequest) string {
-	if request == nil {
-		return defaultStylePrompt
-	}
+	return ResolveStyle(request).Prompt
+}
 
-	username := strings.TrimSpace(request.Username)
-	if username == "" {
-		return defaultStylePrompt
-	}
+// ResolveStylePrompt exposes the style prompt lookup for other packages.
+func ResolveStylePrompt(request *GenerationRequest) string {
+	return getStylePromptForRequest(request)
+}
 
-	styleName := strings.TrimSpace(request.StyleName)
-	if styleName != "" {
-		if style, err := store.GetStyle(db.StylesDB, username, styleName); err == nil {
-			if style != nil && strings.TrimSpace(style.Prompt) != "" {
-				return style.Prompt
-			}
-		}
+// ResolveMode returns the request's mode, falling back to the user's
+// preferred mode and then the registry default. Explicit request values
+// always win.
+func ResolveMode(request *GenerationRequest) string {
+	if request == nil {
+		return DefaultModeName()
 	}
-
-	if style, err := store.GetDefaultStyle(db.StylesDB, username); err == nil {
-		if style != nil && strings.TrimSpace(style.Prompt) != "" {
-			return style.Prompt
-		}
+	if mode := strings.TrimSpace(request.Mode); mode != "" {
+		return mode
 	}
-
-	return defaultStylePrompt
+	if mode := userPreferences(strings.TrimSpace(request.Username)).DefaultMode; mode != "" {
+		return mode
+	}
+	return DefaultModeName()
 }
 
-// ResolveStylePrompt exposes the style prompt lookup for other packages.
-func ResolveStylePrompt(request *GenerationRequest) string {
-	return getStylePromptForRequest(request)
+// userPreferences loads a user's stored preferences, or zero values if unavailable
+func userPreferences(username string) store.UserPreferences {
+	if username == "" {
+		return store.UserPreferences{}
+	}
+	user, err := store.GetUser(db.UsersDB, username)
+	if err != nil || user == nil {
+		return store.UserPreferences{}
+	}
+	return user.Preferences
 }
 
 // buildSystemPrompt creates the system prompt for the Gemini model
@@ -212,14 +237,24 @@ Curriculum Topics to Cover:
 
 Special Instructions:
 %s
-
+%s
 Remember to provide the content in the required format with both the LaTeX code and metadata.`,
 		request.Subject,
 		request.Course,
 		request.Description,
 		tagsStr,
 		request.Curriculum,
-		request.SpecialInstructions)
+		request.SpecialInstructions,
+		languageInstruction(request.Language))
+}
+
+// languageInstruction tells the model which language to write in, or is
+// empty when no language was requested
+func languageInstruction(language string) string {
+	if strings.TrimSpace(language) == "" {
+		return ""
+	}
+	return fmt.Sprintf("\nLanguage: write all worksheet content in %s.\n", strings.TrimSpace(language))
 }
 
 // geminiRequest represents the request structure for the Gemini API
@@ -296,7 +331,7 @@ func generateGeminiResponse(apiKey, model, systemPrompt, userPrompt string, maxR
 
 		// Set a longer timeout for the HTTP client
 		// Longer timeouts aka timeout
-		client := &http.Client{Timeout: 6000 * time.Second}
+		client := httpclient.New(6000 * time.Second)
 		resp, err := client.Do(req)
 		if err != nil {
 			lastErr = err
@@ -0,0 +1,240 @@
+package ai
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/config"
+	store "nadhi.dev/sarvar/fun/database"
+	"nadhi.dev/sarvar/fun/db"
+)
+
+// DefaultMode is used when neither the request nor the user's preferences set
+// a mode, unless DEFAULT_MODE names another one
+const DefaultMode = "notes"
+
+// ValidModes lists the built-in generation modes. Further modes can be added
+// to the registry at runtime; use ModeNames for the full list.
+var ValidModes = []string{"notes", "prep-test", "super-lazy"}
+
+// modeNamePattern restricts mode names to short lowercase slugs
+var modeNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,39}$`)
+
+// builtInModes is the seed data for the mode registry and the fallback when
+// the registry is unavailable
+var builtInModes = map[string]store.GenerationMode{
+	"notes": {
+		Name:        "notes",
+		Label:       "Notes",
+		Description: "Comprehensive, professional study notes",
+		Instructions: `MODE: NOTES
+You are generating comprehensive, professional study notes.
+
+Requirements:
+- Create at least 3 pages of thorough, well-structured notes
+- Use a clean, professional document design with clear hierarchy
+- Include numbered sections and subsections
+- Add definitions, theorems, and key concepts in highlighted boxes
+- Include worked examples where relevant
+- Use proper mathematical notation where applicable
+- Add summary points at the end of each major section
+- Include diagrams descriptions where they would help understanding
+- Use professional typography: proper headings, consistent spacing, clear fonts
+- Make it comprehensive enough to be a standalone study resource
+- Include a table of contents if content is substantial
+- Add page numbers and proper headers/footers`,
+		BuiltIn: true,
+	},
+	"prep-test": {
+		Name:        "prep-test",
+		Label:       "Prep Test",
+		Description: "A practice test / exam paper with an answer key",
+		Instructions: `MODE: PREP TEST
+You are generating a practice test / exam paper.
+
+Requirements:
+- Create a complete test paper with clear sections
+- Include a mix of question types: multiple choice, short answer, long answer, and problem-solving
+- Vary difficulty: easy (30%), medium (50%), hard (20%)
+- Include point values for each question
+- Add a clear header with subject, course, date, and time limit
+- Include instructions section at the top
+- Add space for student name and ID
+- Provide an answer key section at the end
+- Make questions that genuinely test understanding, not just memorization
+- Include at least 15-25 questions depending on complexity
+- Group questions by topic or section
+- Use professional exam formatting`,
+		BuiltIn: true,
+	},
+	"super-lazy": {
+		Name:        "super-lazy",
+		Label:       "Super Lazy",
+		Description: "A retention-optimised study document for last-minute revision",
+		Instructions: `MODE: SUPER LAZY
+You are generating a study document optimized for maximum retention with minimum effort.
+
+Requirements:
+- Use proven memory techniques: spaced repetition cues, mnemonics, chunking, and visual anchors
+- Structure content as KEY POINTS with bold highlights for critical terms
+- Use the "explain like I'm 5" approach for complex concepts
+- Include quick-fire summary boxes at the end of each section
+- Add "Remember This" callout boxes with memory tricks and acronyms
+- Use comparison tables to contrast similar concepts
+- Include a one-page "cheat sheet" summary at the end with EVERYTHING essential
+- Create "If you only read ONE thing" highlights per section
+- Use bullet points extensively, avoid long paragraphs
+- Add visual separators between concepts
+- Include practice recall prompts ("Can you explain X without looking?")
+- Make at least 4-5 pages of content
+- Design it so someone reading it the night before an exam WILL pass with excellence
+- Prioritize the 20% of content that covers 80% of what's tested
+- Use casual, engaging tone - not dry textbook language`,
+		BuiltIn: true,
+	},
+}
+
+// ValidateModeName checks that name is a usable mode slug
+func ValidateModeName(name string) error {
+	if !modeNamePattern.MatchString(name) {
+		return fmt.Errorf("mode name must be 1-40 lowercase letters, digits or hyphens and start with a letter or digit")
+	}
+	if name == "default" {
+		return fmt.Errorf("mode name %q is reserved", name)
+	}
+	return nil
+}
+
+// maxModeRequirements caps how many requirements one mode may define
+const maxModeRequirements = 20
+
+// ValidateModeRequirements checks that every requirement has a name and a
+// pattern that compiles
+func ValidateModeRequirements(reqs []store.ModeRequirement) error {
+	if len(reqs) > maxModeRequirements {
+		return fmt.Errorf("a mode may define at most %d requirements", maxModeRequirements)
+	}
+	for i, req := range reqs {
+		if strings.TrimSpace(req.Name) == "" {
+			return fmt.Errorf("requirement %d has no name", i+1)
+		}
+		if strings.TrimSpace(req.Pattern) == "" {
+			return fmt.Errorf("requirement %q has no pattern", req.Name)
+		}
+		if _, err := regexp.Compile(req.Pattern); err != nil {
+			return fmt.Errorf("requirement %q has an invalid pattern: %v", req.Name, err)
+		}
+	}
+	return nil
+}
+
+// GetModeRequirements returns the registry's structural requirements for a
+// mode; modes outside the registry have none
+func GetModeRequirements(mode string) []store.ModeRequirement {
+	if db.ModesDB == nil {
+		return nil
+	}
+	m, err := store.GetMode(db.ModesDB, mode)
+	if err != nil || m == nil {
+		return nil
+	}
+	return m.Requirements
+}
+
+// DefaultModeName returns the registry default: DEFAULT_MODE when it names
+// a known mode, otherwise DefaultMode
+func DefaultModeName() string {
+	if mode := strings.TrimSpace(config.GetConfigString("DEFAULT_MODE", "")); mode != "" && IsValidMode(mode) {
+		return mode
+	}
+	return DefaultMode
+}
+
+// SetDefaultMode makes mode the default for requests and users that don't
+// pick one, saving it as DEFAULT_MODE
+func SetDefaultMode(mode string) error {
+	if !IsValidMode(mode) {
+		return fmt.Errorf("unknown mode: %s", mode)
+	}
+	return config.UpdateConfigValue("DEFAULT_MODE", mode)
+}
+
+// IsBuiltInMode reports whether name is one of the built-in modes
+func IsBuiltInMode(name string) bool {
+	_, ok := builtInModes[name]
+	return ok
+}
+
+// IsValidMode reports whether mode exists in the registry or is built in
+func IsValidMode(mode string) bool {
+	if IsBuiltInMode(mode) {
+		return true
+	}
+	if db.ModesDB == nil {
+		return false
+	}
+	m, err := store.GetMode(db.ModesDB, mode)
+	return err == nil && m != nil
+}
+
+// ListModes returns the registry contents, or the built-ins if it is unavailable
+func ListModes() []store.GenerationMode {
+	if db.ModesDB != nil {
+		if modes, err := store.GetAllModes(db.ModesDB); err == nil && len(modes) > 0 {
+			return modes
+		}
+	}
+
+	modes := make([]store.GenerationMode, 0, len(ValidModes))
+	for _, name := range ValidModes {
+		modes = append(modes, builtInModes[name])
+	}
+	return modes
+}
+
+// ModeNames returns the names of every known mode
+func ModeNames() []string {
+	modes := ListModes()
+	names := make([]string, 0, len(modes))
+	for _, m := range modes {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+// GetModeInstructions returns the design-step instructions for a mode.
+// Priority: registry entry > built-in mode > default mode > notes mode
+func GetModeInstructions(mode string) string {
+	if db.ModesDB != nil {
+		if m, err := store.GetMode(db.ModesDB, mode); err == nil && m != nil {
+			if strings.TrimSpace(m.Instructions) != "" {
+				return m.Instructions
+			}
+		}
+	}
+	if m, ok := builtInModes[mode]; ok {
+		return m.Instructions
+	}
+	if fallback := DefaultModeName(); fallback != mode {
+		return GetModeInstructions(fallback)
+	}
+	return builtInModes[DefaultMode].Instructions
+}
+
+// SeedModes adds any missing built-in modes to the registry. Existing
+// entries are left alone so admin edits to a built-in survive restarts.
+func SeedModes() error {
+	if db.ModesDB == nil {
+		return fmt.Errorf("modes DB not initialized")
+	}
+	for _, name := range ValidModes {
+		if m, err := store.GetMode(db.ModesDB, name); err == nil && m != nil {
+			continue
+		}
+		if _, err := store.SaveMode(db.ModesDB, builtInModes[name]); err != nil {
+			return fmt.Errorf("failed to seed mode %s: %w", name, err)
+		}
+	}
+	return nil
+}
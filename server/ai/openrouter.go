@@ -2,19 +2,42 @@ package ai
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
+
+	"nadhi.dev/sarvar/fun/config"
+	"nadhi.dev/sarvar/fun/httpclient"
 )
 
 const OpenRouterEndpoint = "https://openrouter.ai/api/v1/chat/completions"
 
+// Default app attribution sent to OpenRouter, overridable with
+// OPENROUTER_REFERER and OPENROUTER_TITLE
+const (
+	DefaultOpenRouterReferer = "https://github.com/Nadhila-dot/AIotate"
+	DefaultOpenRouterTitle   = "AIotate"
+)
+
 // OpenRouterRequest represents the request body for OpenRouter API
 type OpenRouterRequest struct {
 	Model    string              `json:"model"`
 	Messages []OpenRouterMessage `json:"messages"`
+	// Provider holds provider routing preferences (order, ignore, sort,
+	// allow_fallbacks, ...), passed through as configured
+	Provider map[string]interface{} `json:"provider,omitempty"`
+	// Transforms are prompt transforms such as "middle-out"
+	Transforms []string `json:"transforms,omitempty"`
+	// Stop ends generation at the first of these strings
+	Stop []string `json:"stop,omitempty"`
+	// MaxTokens caps the length of the reply
+	MaxTokens int `json:"max_tokens,omitempty"`
+	// Stream asks for the reply as server-sent events
+	Stream bool `json:"stream,omitempty"`
 }
 
 // OpenRouterMessage represents a message in the conversation
@@ -26,12 +49,21 @@ type OpenRouterMessage struct {
 // OpenRouterResponse represents the response from OpenRouter API
 type OpenRouterResponse struct {
 	Choices []OpenRouterChoice `json:"choices"`
+	Usage   *OpenRouterUsage   `json:"usage,omitempty"`
 	Error   *OpenRouterError   `json:"error,omitempty"`
 }
 
+// OpenRouterUsage reports the tokens consumed by a request
+type OpenRouterUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
 // OpenRouterChoice represents a choice in the response
 type OpenRouterChoice struct {
-	Message OpenRouterMessage `json:"message"`
+	Message      OpenRouterMessage `json:"message"`
+	FinishReason string            `json:"finish_reason,omitempty"`
 }
 
 // OpenRouterError represents an error from OpenRouter
@@ -40,13 +72,71 @@ type OpenRouterError struct {
 	Code    int    `json:"code"`
 }
 
-// GenerateWithOpenRouter generates a response using OpenRouter API
-func GenerateWithOpenRouter(apiKey, model, systemPrompt, userPrompt string, cooldownSec int) (string, error) {
+// GenerateWithOpenRouterUsage generates a response using OpenRouter API and reports token usage
+func GenerateWithOpenRouterUsage(apiKey, model, systemPrompt, userPrompt string, cooldownSec int) (Result, error) {
+	return generateOpenRouter(context.Background(), apiKey, model, systemPrompt, userPrompt, cooldownSec, requestOptions{})
+}
+
+// generateOpenRouter is GenerateWithOpenRouterUsage with request options
+func generateOpenRouter(ctx context.Context, apiKey, model, systemPrompt, userPrompt string, cooldownSec int, opts requestOptions) (Result, error) {
 	// Apply cooldown if specified
 	if cooldownSec > 0 {
 		time.Sleep(time.Duration(cooldownSec) * time.Second)
 	}
 
+	// Stream when the caller is watching for progress
+	if onChunk := chunkHandler(ctx); onChunk != nil && openRouterStreamingEnabled() {
+		return generateOpenRouterStream(ctx, apiKey, model, systemPrompt, userPrompt, opts, onChunk)
+	}
+
+	req, err := newOpenRouterRequest(ctx, apiKey, model, systemPrompt, userPrompt, opts, false)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Make HTTP request
+	client := httpclient.New(300 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read response
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	// Unmarshal response
+	var openRouterResp OpenRouterResponse
+	if err := json.Unmarshal(body, &openRouterResp); err != nil {
+		return Result{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	// Check for API error
+	if openRouterResp.Error != nil {
+		return Result{}, fmt.Errorf("OpenRouter API error: %s", openRouterResp.Error.Message)
+	}
+
+	// Extract text from response
+	if len(openRouterResp.Choices) > 0 {
+		result := Result{Text: openRouterResp.Choices[0].Message.Content, Provider: ProviderOpenRouter, Model: model, FinishReason: openRouterResp.Choices[0].FinishReason}
+		if u := openRouterResp.Usage; u != nil {
+			result.Usage = newUsage(u.PromptTokens, u.CompletionTokens, u.TotalTokens)
+		}
+		return result, nil
+	}
+
+	return Result{}, fmt.Errorf("no response generated")
+}
+
+// newOpenRouterRequest builds a chat completion request, streamed or not
+func newOpenRouterRequest(ctx context.Context, apiKey, model, systemPrompt, userPrompt string, opts requestOptions, stream bool) (*http.Request, error) {
 	// Build messages array
 	messages := []OpenRouterMessage{}
 
@@ -62,63 +152,88 @@ func GenerateWithOpenRouter(apiKey, model, systemPrompt, userPrompt string, cool
 		Content: userPrompt,
 	})
 
+	// A trailing assistant message is continued by the model
+	if opts.Prefix != "" {
+		messages = append(messages, OpenRouterMessage{
+			Role:    "assistant",
+			Content: opts.Prefix,
+		})
+	}
+
 	// Build request body
 	reqBody := OpenRouterRequest{
-		Model:    model,
-		Messages: messages,
+		Model:      model,
+		Messages:   messages,
+		Provider:   openRouterProvider(),
+		Transforms: openRouterTransforms(),
+		Stop:       opts.Stop,
+		MaxTokens:  opts.MaxTokens,
+		Stream:     stream,
 	}
 
 	// Marshal to JSON
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Create HTTP request
-	req, err := http.NewRequest("POST", OpenRouterEndpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(requestContext(ctx), "POST", OpenRouterEndpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("HTTP-Referer", "https://github.com/yourusername/aiotate") // Optional
-	req.Header.Set("X-Title", "AIotate")                                      // Optional
-
-	// Make HTTP request
-	client := &http.Client{Timeout: 300 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+	// App identification headers are optional; LOCAL_ONLY strips them
+	if !config.IsLocalOnly() {
+		if referer := openRouterHeader("OPENROUTER_REFERER", DefaultOpenRouterReferer); referer != "" {
+			req.Header.Set("HTTP-Referer", referer)
+		}
+		if title := openRouterHeader("OPENROUTER_TITLE", DefaultOpenRouterTitle); title != "" {
+			req.Header.Set("X-Title", title)
+		}
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
-	}
+	return req, nil
+}
 
-	// Unmarshal response
-	var openRouterResp OpenRouterResponse
-	if err := json.Unmarshal(body, &openRouterResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+// openRouterHeader returns a configured attribution header value. A missing
+// key uses fallback; an empty string leaves the header out.
+func openRouterHeader(key, fallback string) string {
+	v, ok := config.GetConfigValue(key).(string)
+	if !ok {
+		return fallback
 	}
+	return strings.TrimSpace(v)
+}
 
-	// Check for API error
-	if openRouterResp.Error != nil {
-		return "", fmt.Errorf("OpenRouter API error: %s", openRouterResp.Error.Message)
+// openRouterProvider returns the OPENROUTER_PROVIDER routing preferences,
+// or nil when none are set
+func openRouterProvider() map[string]interface{} {
+	provider, _ := config.GetConfigValue("OPENROUTER_PROVIDER").(map[string]interface{})
+	if len(provider) == 0 {
+		return nil
 	}
+	return provider
+}
 
-	// Extract text from response
-	if len(openRouterResp.Choices) > 0 {
-		return openRouterResp.Choices[0].Message.Content, nil
+// openRouterTransforms returns the OPENROUTER_TRANSFORMS list, skipping
+// anything that isn't a non-empty string
+func openRouterTransforms() []string {
+	raw, _ := config.GetConfigValue("OPENROUTER_TRANSFORMS").([]interface{})
+	var transforms []string
+	for _, v := range raw {
+		if t, ok := v.(string); ok && strings.TrimSpace(t) != "" {
+			transforms = append(transforms, strings.TrimSpace(t))
+		}
 	}
+	return transforms
+}
 
-	return "", fmt.Errorf("no response generated")
+// GenerateWithOpenRouter generates a response using OpenRouter API
+func GenerateWithOpenRouter(apiKey, model, systemPrompt, userPrompt string, cooldownSec int) (string, error) {
+	result, err := GenerateWithOpenRouterUsage(apiKey, model, systemPrompt, userPrompt, cooldownSec)
+	return result.Text, err
 }
@@ -0,0 +1,144 @@
+package ai
+
+import (
+	"context"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/config"
+)
+
+// maxStopSequences is the most stop sequences sent with a request;
+// OpenAI-compatible providers behind OpenRouter accept no more than 4
+const maxStopSequences = 4
+
+// requestOptions are the per-call generation settings sent to the provider
+type requestOptions struct {
+	// Stop ends generation at the first of these strings, which providers
+	// leave out of the text
+	Stop []string
+	// Prefix is sent as the start of the assistant's reply, which the
+	// model then continues; it is put back in front of the returned text
+	Prefix string
+	// StopAfter is a stop sequence that belongs to the output, such as
+	// \end{document}; it is restored after the text, and anything after it
+	// is dropped if the provider ignored the stop
+	StopAfter string
+	// MaxTokens caps the length of the reply; 0 leaves it to the provider
+	MaxTokens int
+	// Candidates asks for that many alternative replies; only Gemini
+	// honours it, other providers return one
+	Candidates int
+}
+
+type requestOptionsKey struct{}
+
+// contextOptions returns ctx's request options, if any
+func contextOptions(ctx context.Context) requestOptions {
+	if ctx == nil {
+		return requestOptions{}
+	}
+	opts, _ := ctx.Value(requestOptionsKey{}).(requestOptions)
+	return opts
+}
+
+// WithStopSequences returns a context whose generations stop at any of
+// stops, in addition to those configured for the task
+func WithStopSequences(ctx context.Context, stops ...string) context.Context {
+	opts := contextOptions(ctx)
+	opts.Stop = append(append([]string(nil), opts.Stop...), stops...)
+	return context.WithValue(ctx, requestOptionsKey{}, opts)
+}
+
+// WithResponsePrefix returns a context whose generations are primed to
+// begin with prefix. The returned text includes the prefix.
+func WithResponsePrefix(ctx context.Context, prefix string) context.Context {
+	opts := contextOptions(ctx)
+	opts.Prefix = prefix
+	return context.WithValue(ctx, requestOptionsKey{}, opts)
+}
+
+// WithStopAfter returns a context whose generations end right after marker:
+// it is sent as a stop sequence and, since providers drop the sequence that
+// stopped them, appended back to the text. Output that runs past marker
+// anyway is truncated after it.
+func WithStopAfter(ctx context.Context, marker string) context.Context {
+	opts := contextOptions(ctx)
+	opts.StopAfter = marker
+	return context.WithValue(ctx, requestOptionsKey{}, opts)
+}
+
+// WithMaxTokens returns a context whose generations stop after n output
+// tokens, for short interactive calls where a long reply is wasted
+func WithMaxTokens(ctx context.Context, n int) context.Context {
+	opts := contextOptions(ctx)
+	opts.MaxTokens = n
+	return context.WithValue(ctx, requestOptionsKey{}, opts)
+}
+
+// WithCandidates returns a context whose generations ask for n alternative
+// replies, returned in Result.Candidates
+func WithCandidates(ctx context.Context, n int) context.Context {
+	opts := contextOptions(ctx)
+	opts.Candidates = n
+	return context.WithValue(ctx, requestOptionsKey{}, opts)
+}
+
+// resolveRequestOptions returns the options for a call: those on ctx, plus
+// the task's AI_STOP_SEQUENCES. Empty and duplicate stops are dropped and
+// the list is capped at maxStopSequences, ctx's first.
+func resolveRequestOptions(ctx context.Context, taskType TaskType) requestOptions {
+	opts := contextOptions(ctx)
+
+	candidates := []string{}
+	if opts.StopAfter != "" {
+		candidates = append(candidates, opts.StopAfter)
+	}
+	candidates = append(candidates, opts.Stop...)
+	configured, _ := config.GetConfigValue("AI_STOP_SEQUENCES").(map[string]interface{})
+	if raw, ok := configured[string(taskType)].([]interface{}); ok {
+		for _, v := range raw {
+			if s, ok := v.(string); ok {
+				candidates = append(candidates, s)
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	opts.Stop = nil
+	for _, s := range candidates {
+		if strings.TrimSpace(s) == "" || seen[s] || len(opts.Stop) == maxStopSequences {
+			continue
+		}
+		seen[s] = true
+		opts.Stop = append(opts.Stop, s)
+	}
+	return opts
+}
+
+// finish applies the options to a generated result and each of its
+// candidates: the prefix is put back in front and, unless the output was
+// cut off by the token limit, the StopAfter marker is restored and anything
+// after it dropped
+func (o requestOptions) finish(result Result) Result {
+	truncated := result.HitTokenLimit()
+	result.Text = o.finishText(result.Text, truncated)
+	for i, text := range result.Candidates {
+		result.Candidates[i] = o.finishText(text, truncated)
+	}
+	return result
+}
+
+// finishText is finish for a single text
+func (o requestOptions) finishText(text string, truncated bool) string {
+	text = o.Prefix + text
+	if o.StopAfter == "" || truncated {
+		return text
+	}
+	if idx := strings.Index(text, o.StopAfter); idx >= 0 {
+		return text[:idx+len(o.StopAfter)]
+	}
+	if strings.TrimSpace(text) != "" {
+		return strings.TrimRight(text, " \t\r\n") + "\n" + o.StopAfter
+	}
+	return text
+}
@@ -0,0 +1,91 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"nadhi.dev/sarvar/fun/config"
+	logg "nadhi.dev/sarvar/fun/logs"
+)
+
+// DefaultAICallAttempts is how many times a provider call is attempted when
+// it fails with a transient error; 1 means no retries
+const DefaultAICallAttempts = 1
+
+// maxCallBackoff caps the wait between provider call attempts
+const maxCallBackoff = 30 * time.Second
+
+// apiStatusPattern pulls the HTTP status out of provider API errors
+var apiStatusPattern = regexp.MustCompile(`API error \(status (\d{3})\)`)
+
+// callAttempts returns the configured attempts per provider call.
+// AI_FAIL_FAST turns retries off regardless of AI_CALL_ATTEMPTS.
+func callAttempts() int {
+	if config.GetConfigBool("AI_FAIL_FAST", false) {
+		return 1
+	}
+	n := config.GetConfigInt("AI_CALL_ATTEMPTS", DefaultAICallAttempts)
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// isTransientError reports whether a provider call failed for a reason worth
+// retrying as is: the connection failed or dropped, or the provider answered
+// with a 5xx. Quota errors and bad requests are not retried here. Quota is
+// handled by the OpenRouter fallback, and the pipeline retries bad output.
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	if strings.HasPrefix(msg, "failed to make request") || strings.HasPrefix(msg, "failed to read response") {
+		return true
+	}
+	if m := apiStatusPattern.FindStringSubmatch(msg); m != nil {
+		status, _ := strconv.Atoi(m[1])
+		return status >= 500
+	}
+	return false
+}
+
+// requestContext returns the context a provider request is made with,
+// standing in for a nil one
+func requestContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// withCallRetry runs call, retrying transient failures with exponential
+// backoff up to the configured number of attempts. These retries sit below
+// the pipeline's own retries, which re-run a step when the output is bad.
+func withCallRetry(ctx context.Context, call func() (Result, error)) (Result, error) {
+	attempts := callAttempts()
+	backoff := time.Second
+
+	var result Result
+	var err error
+	for attempt := 1; ; attempt++ {
+		result, err = call()
+		if err == nil || attempt >= attempts || !isTransientError(err) {
+			return result, err
+		}
+
+		logg.Warning(fmt.Sprintf("AI call attempt %d/%d failed, retrying in %s: %v", attempt, attempts, backoff, err))
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxCallBackoff {
+			backoff = maxCallBackoff
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package ai
+
+import "context"
+
+type taskTypeKey struct{}
+
+// WithTaskType returns a context whose generations use taskType's model,
+// whatever task the caller asks for. The pipeline uses it to route a whole
+// step to a cheaper or stronger model.
+func WithTaskType(ctx context.Context, taskType TaskType) context.Context {
+	return context.WithValue(ctx, taskTypeKey{}, taskType)
+}
+
+// resolveTaskType returns ctx's task type override, or taskType when there is none
+func resolveTaskType(ctx context.Context, taskType TaskType) TaskType {
+	if ctx == nil {
+		return taskType
+	}
+	if override, ok := ctx.Value(taskTypeKey{}).(TaskType); ok && override != "" {
+		return override
+	}
+	return taskType
+}
+
+// ResolveModelConfig returns the model a generation for taskType would use
+// under ctx, taking its task type override into account
+func ResolveModelConfig(ctx context.Context, taskType TaskType) (*ModelConfig, error) {
+	return GetModelConfig(resolveTaskType(ctx, taskType))
+}
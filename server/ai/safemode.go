@@ -0,0 +1,16 @@
+package ai
+
+import "nadhi.dev/sarvar/fun/config"
+
+// ApplySafeMode strips what SAFE_MODE forbids from a request: its
+// attachments and web search. It reports whether safe mode is on, and does
+// nothing when it isn't.
+func ApplySafeMode(req *GenerationRequest) bool {
+	if req == nil || !config.IsSafeMode() {
+		return false
+	}
+	req.Attachments = nil
+	req.WebSearchEnabled = false
+	req.WebSearchQuery = ""
+	return true
+}
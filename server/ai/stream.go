@@ -0,0 +1,174 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"nadhi.dev/sarvar/fun/config"
+	"nadhi.dev/sarvar/fun/httpclient"
+	logg "nadhi.dev/sarvar/fun/logs"
+)
+
+// streamIdleTimeout is how long a stream may go without a line before it
+// is treated as dropped. Streams have no overall timeout, since a long
+// reply is what they're for.
+const streamIdleTimeout = 2 * time.Minute
+
+// maxStreamLine caps a single server-sent event line
+const maxStreamLine = 1 << 20
+
+// ChunkHandler receives streamed output as it arrives: the new chunk and
+// the text so far. A retried call starts over, so text may get shorter.
+type ChunkHandler func(chunk, text string)
+
+type chunkHandlerKey struct{}
+
+// WithChunkHandler returns a context whose generations stream their output
+// to fn where the provider supports it. Others call nothing and return the
+// whole text as usual.
+func WithChunkHandler(ctx context.Context, fn ChunkHandler) context.Context {
+	return context.WithValue(ctx, chunkHandlerKey{}, fn)
+}
+
+// chunkHandler returns ctx's chunk handler, if any
+func chunkHandler(ctx context.Context) ChunkHandler {
+	if ctx == nil {
+		return nil
+	}
+	fn, _ := ctx.Value(chunkHandlerKey{}).(ChunkHandler)
+	return fn
+}
+
+// openRouterStreamingEnabled reports whether OPENROUTER_STREAMING is on
+func openRouterStreamingEnabled() bool {
+	return config.GetConfigBool("OPENROUTER_STREAMING", true)
+}
+
+// openRouterStreamChunk is one server-sent event of a streamed completion
+type openRouterStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason,omitempty"`
+	} `json:"choices"`
+	Usage *OpenRouterUsage `json:"usage,omitempty"`
+	Error *OpenRouterError `json:"error,omitempty"`
+}
+
+// GenerateWithOpenRouterStream is GenerateWithOpenRouter with the reply
+// streamed: onChunk is called for each piece as it arrives, and the full
+// text is returned at the end
+func GenerateWithOpenRouterStream(apiKey, model, systemPrompt, userPrompt string, cooldownSec int, onChunk ChunkHandler) (string, error) {
+	if cooldownSec > 0 {
+		time.Sleep(time.Duration(cooldownSec) * time.Second)
+	}
+	result, err := generateOpenRouterStream(context.Background(), apiKey, model, systemPrompt, userPrompt, requestOptions{}, onChunk)
+	return result.Text, err
+}
+
+// generateOpenRouterStream makes a streamed chat completion. It reads the
+// SSE "data:" lines until the [DONE] sentinel, skipping comments and
+// chunks that don't parse. A stream that drops before [DONE] fails with a
+// read error, which is retried like any dropped connection.
+func generateOpenRouterStream(ctx context.Context, apiKey, model, systemPrompt, userPrompt string, opts requestOptions, onChunk ChunkHandler) (Result, error) {
+	// Cancelled if the stream goes quiet for too long
+	ctx, cancel := context.WithCancel(requestContext(ctx))
+	defer cancel()
+	idle := time.AfterFunc(streamIdleTimeout, cancel)
+	defer idle.Stop()
+
+	req, err := newOpenRouterRequest(ctx, apiKey, model, systemPrompt, userPrompt, opts, true)
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := httpclient.New(0).Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return Result{}, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	result := Result{Provider: ProviderOpenRouter, Model: model}
+	var text strings.Builder
+	malformed := 0
+	done := false
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLine)
+	for scanner.Scan() {
+		idle.Reset(streamIdleTimeout)
+
+		// Blank lines separate events; lines starting with ':' are
+		// keep-alive comments
+		line := strings.TrimSpace(scanner.Text())
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+
+		var chunk openRouterStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			malformed++
+			continue
+		}
+		if chunk.Error != nil {
+			return Result{}, fmt.Errorf("OpenRouter API error: %s", chunk.Error.Message)
+		}
+		if u := chunk.Usage; u != nil {
+			result.Usage = newUsage(u.PromptTokens, u.CompletionTokens, u.TotalTokens)
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		if reason := chunk.Choices[0].FinishReason; reason != "" {
+			result.FinishReason = reason
+		}
+		if piece := chunk.Choices[0].Delta.Content; piece != "" {
+			text.WriteString(piece)
+			if onChunk != nil {
+				onChunk(piece, text.String())
+			}
+		}
+	}
+
+	if malformed > 0 {
+		logg.Warning(fmt.Sprintf("OpenRouter stream: skipped %d malformed chunks", malformed))
+	}
+	if !done {
+		if err := scanner.Err(); err != nil {
+			return Result{}, fmt.Errorf("failed to read response: %w", err)
+		}
+		if ctx.Err() != nil {
+			return Result{}, fmt.Errorf("failed to read response: stream interrupted: %w", ctx.Err())
+		}
+		// Some providers close without [DONE]; a finish reason means the
+		// reply is complete anyway
+		if result.FinishReason == "" {
+			return Result{}, fmt.Errorf("failed to read response: stream ended early")
+		}
+	}
+
+	result.Text = text.String()
+	if result.Text == "" {
+		return Result{}, fmt.Errorf("no response generated")
+	}
+	return result, nil
+}
@@ -0,0 +1,105 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/config"
+	store "nadhi.dev/sarvar/fun/database"
+	"nadhi.dev/sarvar/fun/db"
+	logg "nadhi.dev/sarvar/fun/logs"
+)
+
+// Where a resolved style prompt came from
+const (
+	StyleSourceRequested   = "requested"
+	StyleSourcePreference  = "preference"
+	StyleSourceUserDefault = "user_default"
+	StyleSourceBuiltin     = "builtin"
+)
+
+// StyleResolution is the style prompt chosen for a request and how it was
+// found. Requested is the style name the request or the user's preferences
+// asked for; Missing is set when that style no longer exists.
+type StyleResolution struct {
+	Prompt    string `json:"-"`
+	Requested string `json:"requested,omitempty"`
+	Used      string `json:"used,omitempty"`
+	Source    string `json:"source"`
+	Missing   bool   `json:"missing"`
+}
+
+// ResolveStyle picks the style prompt for a request: the named style, then
+// the user's preferred style, then their default style, then the built-in
+// fallback (FALLBACK_STYLE_PROMPT, or defaultStylePrompt when unset). A
+// named style that can't be found is logged along with the fallback used.
+func ResolveStyle(request *GenerationRequest) StyleResolution {
+	res := resolveStyle(request)
+	if res.Missing {
+		logg.Warning(fmt.Sprintf("Style %q not found for %s, using %s", res.Requested, request.Username, res.describeFallback()))
+	}
+	return res
+}
+
+func resolveStyle(request *GenerationRequest) StyleResolution {
+	builtin := StyleResolution{Prompt: builtinStylePrompt(), Source: StyleSourceBuiltin}
+	if request == nil {
+		return builtin
+	}
+
+	username := strings.TrimSpace(request.Username)
+	if username == "" {
+		return builtin
+	}
+
+	source := StyleSourceRequested
+	styleName := strings.TrimSpace(request.StyleName)
+	if styleName == "" {
+		source = StyleSourcePreference
+		styleName = userPreferences(username).DefaultStyle
+	}
+	if styleName != "" {
+		if style, err := store.GetStyle(db.StylesDB, username, styleName); err == nil {
+			if style != nil && strings.TrimSpace(style.Prompt) != "" {
+				return StyleResolution{Prompt: style.Prompt, Requested: styleName, Used: styleName, Source: source}
+			}
+		}
+	}
+
+	res := builtin
+	if style, err := store.GetDefaultStyle(db.StylesDB, username); err == nil {
+		if style != nil && strings.TrimSpace(style.Prompt) != "" {
+			res = StyleResolution{Prompt: style.Prompt, Used: style.Name, Source: StyleSourceUserDefault}
+		}
+	}
+	if styleName != "" {
+		res.Requested = styleName
+		res.Missing = true
+	}
+	return res
+}
+
+// describeFallback names the style used in place of a missing one
+func (r StyleResolution) describeFallback() string {
+	if r.Source == StyleSourceUserDefault {
+		return fmt.Sprintf("default style %q", r.Used)
+	}
+	return "the built-in style"
+}
+
+// FallbackMessage explains a missing style to the user, or "" when the
+// requested style was found
+func (r StyleResolution) FallbackMessage() string {
+	if !r.Missing {
+		return ""
+	}
+	return fmt.Sprintf("Style %q was not found, using %s instead", r.Requested, r.describeFallback())
+}
+
+// builtinStylePrompt is the style used when a user has none of their own
+func builtinStylePrompt() string {
+	if prompt := config.GetConfigString("FALLBACK_STYLE_PROMPT", ""); strings.TrimSpace(prompt) != "" {
+		return prompt
+	}
+	return defaultStylePrompt
+}
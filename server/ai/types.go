@@ -45,4 +45,15 @@ type Attachment struct {
 	Size     int64  `json:"size"`
 	Content  string `json:"content"`
 	Encoding string `json:"encoding"` // "utf-8" or "base64"
+	// Hash is the SHA-256 of the raw bytes. Stored attachments carry only
+	// the hash and have their Content resolved before use.
+	Hash string `json:"hash,omitempty"`
+	// Role tells the model how to use the file (AttachmentRoleReference or
+	// AttachmentRoleTemplate); empty is treated as reference
+	Role string `json:"role,omitempty"`
+	// Description is the uploader's note on what the file is
+	Description string `json:"description,omitempty"`
+	// Order places the attachment in prompts: 1 comes first, and unordered
+	// (0) attachments follow the ordered ones
+	Order int `json:"order,omitempty"`
 }
@@ -5,19 +5,42 @@ import (
 	"fmt"
 	"strings"
 
+	"nadhi.dev/sarvar/fun/config"
 	logg "nadhi.dev/sarvar/fun/logs"
 )
 
-// Generate generates a response using the configured AI provider with message history
+// Generate generates a response using the configured AI provider with
+// message history. If several candidates come back, the first is used.
 func Generate(ctx context.Context, taskType TaskType, messages []Message) (string, error) {
+	result, err := GenerateWithUsage(ctx, taskType, messages)
+	return result.Text, err
+}
+
+// GenerateCandidates is Generate asking for n alternative responses, e.g.
+// designs for the user to pick from. Providers that can't return several
+// give back one.
+func GenerateCandidates(ctx context.Context, taskType TaskType, messages []Message, n int) ([]string, error) {
+	result, err := GenerateWithUsage(WithCandidates(ctx, n), taskType, messages)
+	if err != nil {
+		return nil, err
+	}
+	return result.Texts(), nil
+}
+
+// GenerateWithUsage is Generate with the provider's token usage returned
+// alongside the text. Usage is also recorded on ctx's UsageTracker, if any.
+func GenerateWithUsage(ctx context.Context, taskType TaskType, messages []Message) (Result, error) {
+	taskType = resolveTaskType(ctx, taskType)
 	modelConfig, err := GetModelConfig(taskType)
 	if err != nil {
-		return "", fmt.Errorf("failed to get model config: %w", err)
+		return Result{}, fmt.Errorf("failed to get model config: %w", err)
 	}
 
 	logg.Info(fmt.Sprintf("Generating with %s (model: %s, task: %s)",
 		modelConfig.Provider, modelConfig.Model, taskType))
 
+	opts := resolveRequestOptions(ctx, taskType)
+
 	// Extract system and user prompts from messages
 	var systemPrompt, userPrompt string
 	for _, msg := range messages {
@@ -29,36 +52,58 @@ func Generate(ctx context.Context, taskType TaskType, messages []Message) (strin
 		}
 	}
 
+	var result Result
 	switch modelConfig.Provider {
 	case ProviderGemini:
-		resp, err := GenerateResponse(modelConfig.APIKey, modelConfig.Model, systemPrompt, userPrompt, 0)
+		result, err = withCallRetry(ctx, func() (Result, error) {
+			return generateGemini(ctx, modelConfig.APIKey, modelConfig.Model, systemPrompt, userPrompt, 0, opts)
+		})
 		if err != nil && shouldFallbackToOpenRouter(err) {
 			if fallback := fallbackOpenRouterConfig(taskType); fallback != nil {
 				logg.Warning("Gemini quota exhausted; falling back to OpenRouter")
-				return GenerateWithOpenRouter(fallback.APIKey, fallback.Model, systemPrompt, userPrompt, 0)
+				result, err = withCallRetry(ctx, func() (Result, error) {
+					return generateOpenRouter(ctx, fallback.APIKey, fallback.Model, systemPrompt, userPrompt, 0, opts)
+				})
 			}
 		}
-		return resp, err
 
 	case ProviderOpenRouter:
-		return GenerateWithOpenRouter(modelConfig.APIKey, modelConfig.Model, systemPrompt, userPrompt, 0)
+		result, err = withCallRetry(ctx, func() (Result, error) {
+			return generateOpenRouter(ctx, modelConfig.APIKey, modelConfig.Model, systemPrompt, userPrompt, 0, opts)
+		})
 
 	default:
-		return "", fmt.Errorf("unsupported provider: %s", modelConfig.Provider)
+		return Result{}, fmt.Errorf("unsupported provider: %s", modelConfig.Provider)
 	}
+
+	if err == nil {
+		result = opts.finish(result)
+	}
+	recordUsage(ctx, result, err)
+	return result, err
 }
 
 // GenerateWithAttachments generates a response with optional file attachments.
 // For providers that don't support attachments, the attachments are appended to the prompt as raw text.
 func GenerateWithAttachments(ctx context.Context, taskType TaskType, messages []Message, attachments []Attachment) (string, error) {
+	result, err := GenerateWithAttachmentsUsage(ctx, taskType, messages, attachments)
+	return result.Text, err
+}
+
+// GenerateWithAttachmentsUsage is GenerateWithAttachments with token usage
+// returned alongside the text and recorded on ctx's UsageTracker, if any.
+func GenerateWithAttachmentsUsage(ctx context.Context, taskType TaskType, messages []Message, attachments []Attachment) (Result, error) {
+	taskType = resolveTaskType(ctx, taskType)
 	modelConfig, err := GetModelConfig(taskType)
 	if err != nil {
-		return "", fmt.Errorf("failed to get model config: %w", err)
+		return Result{}, fmt.Errorf("failed to get model config: %w", err)
 	}
 
 	logg.Info(fmt.Sprintf("Generating with %s (model: %s, task: %s, attachments: %d)",
 		modelConfig.Provider, modelConfig.Model, taskType, len(attachments)))
 
+	opts := resolveRequestOptions(ctx, taskType)
+
 	// Extract system and user prompts from messages
 	var systemPrompt, userPrompt string
 	for _, msg := range messages {
@@ -70,25 +115,37 @@ func GenerateWithAttachments(ctx context.Context, taskType TaskType, messages []
 		}
 	}
 
+	var result Result
 	switch modelConfig.Provider {
 	case ProviderGemini:
-		resp, err := GenerateResponseWithAttachments(modelConfig.APIKey, modelConfig.Model, systemPrompt, userPrompt, attachments, 0)
+		result, err = withCallRetry(ctx, func() (Result, error) {
+			return generateGeminiWithAttachments(ctx, modelConfig.APIKey, modelConfig.Model, systemPrompt, userPrompt, attachments, 0, opts)
+		})
 		if err != nil && shouldFallbackToOpenRouter(err) {
 			if fallback := fallbackOpenRouterConfig(taskType); fallback != nil {
 				logg.Warning("Gemini quota exhausted; falling back to OpenRouter")
 				combined := AppendAttachmentsToPrompt(userPrompt, attachments)
-				return GenerateWithOpenRouter(fallback.APIKey, fallback.Model, systemPrompt, combined, 0)
+				result, err = withCallRetry(ctx, func() (Result, error) {
+					return generateOpenRouter(ctx, fallback.APIKey, fallback.Model, systemPrompt, combined, 0, opts)
+				})
 			}
 		}
-		return resp, err
 
 	case ProviderOpenRouter:
 		combined := AppendAttachmentsToPrompt(userPrompt, attachments)
-		return GenerateWithOpenRouter(modelConfig.APIKey, modelConfig.Model, systemPrompt, combined, 0)
+		result, err = withCallRetry(ctx, func() (Result, error) {
+			return generateOpenRouter(ctx, modelConfig.APIKey, modelConfig.Model, systemPrompt, combined, 0, opts)
+		})
 
 	default:
-		return "", fmt.Errorf("unsupported provider: %s", modelConfig.Provider)
+		return Result{}, fmt.Errorf("unsupported provider: %s", modelConfig.Provider)
 	}
+
+	if err == nil {
+		result = opts.finish(result)
+	}
+	recordUsage(ctx, result, err)
+	return result, err
 }
 
 func shouldFallbackToOpenRouter(err error) bool {
@@ -103,6 +160,9 @@ func shouldFallbackToOpenRouter(err error) bool {
 }
 
 func fallbackOpenRouterConfig(taskType TaskType) *ModelConfig {
+	if !config.AllowRemoteAI() {
+		return nil
+	}
 	aiConfig, err := GetAIConfig()
 	if err != nil {
 		return nil
@@ -115,6 +175,7 @@ func fallbackOpenRouterConfig(taskType TaskType) *ModelConfig {
 	if taskType == TaskUtility {
 		model = aiConfig.UtilityModel
 	}
+	model = NormalizeModelName(ProviderOpenRouter, model)
 	if model == "" {
 		if taskType == TaskUtility {
 			model = "google/gemini-2.0-flash-exp:free"
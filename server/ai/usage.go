@@ -0,0 +1,125 @@
+package ai
+
+import (
+	"context"
+	"sync"
+)
+
+// Usage is the token consumption reported by a provider for one or more calls
+type Usage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// newUsage builds a Usage, deriving the total when the provider omits it
+func newUsage(prompt, completion, total int) Usage {
+	if total == 0 {
+		total = prompt + completion
+	}
+	return Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: total}
+}
+
+// Add accumulates other into u
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// Result is a generated response together with what it cost
+type Result struct {
+	Text     string
+	Usage    Usage
+	Provider AIProvider
+	Model    string
+
+	// FinishReason is the provider's stop reason, e.g. "STOP" or
+	// "MAX_TOKENS" (Gemini), "stop" or "length" (OpenRouter)
+	FinishReason string
+
+	// Candidates holds every alternative's text, Text first, when the
+	// provider returned more than one
+	Candidates []string
+}
+
+// Texts returns every candidate's text, or just Text when there was one
+func (r Result) Texts() []string {
+	if len(r.Candidates) > 0 {
+		return r.Candidates
+	}
+	return []string{r.Text}
+}
+
+// HitTokenLimit reports whether the provider stopped because the output
+// token limit was reached, leaving the text cut off
+func (r Result) HitTokenLimit() bool {
+	return r.FinishReason == "MAX_TOKENS" || r.FinishReason == "length"
+}
+
+// UsageReport summarises the usage recorded by a UsageTracker
+type UsageReport struct {
+	Usage
+	Calls   int              `json:"calls"`
+	ByModel map[string]Usage `json:"byModel,omitempty"`
+}
+
+// Add merges another report into r
+func (r *UsageReport) Add(other UsageReport) {
+	r.Usage.Add(other.Usage)
+	r.Calls += other.Calls
+	for model, u := range other.ByModel {
+		if r.ByModel == nil {
+			r.ByModel = make(map[string]Usage)
+		}
+		total := r.ByModel[model]
+		total.Add(u)
+		r.ByModel[model] = total
+	}
+}
+
+// UsageTracker accumulates usage for every generation made with a context
+// carrying it (see WithUsageTracker). It is safe for concurrent use.
+type UsageTracker struct {
+	mu     sync.Mutex
+	report UsageReport
+}
+
+// NewUsageTracker creates an empty tracker
+func NewUsageTracker() *UsageTracker {
+	return &UsageTracker{}
+}
+
+// Record adds a result's usage to the tracker
+func (t *UsageTracker) Record(result Result) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := string(result.Provider) + "/" + result.Model
+	t.report.Add(UsageReport{Usage: result.Usage, Calls: 1, ByModel: map[string]Usage{key: result.Usage}})
+}
+
+// Report returns a copy of the usage recorded so far
+func (t *UsageTracker) Report() UsageReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var report UsageReport
+	report.Add(t.report)
+	return report
+}
+
+type usageTrackerKey struct{}
+
+// WithUsageTracker returns a context whose generations are recorded in t
+func WithUsageTracker(ctx context.Context, t *UsageTracker) context.Context {
+	return context.WithValue(ctx, usageTrackerKey{}, t)
+}
+
+// recordUsage adds a successful result to the context's tracker, if any
+func recordUsage(ctx context.Context, result Result, err error) {
+	if err != nil || ctx == nil {
+		return
+	}
+	if t, ok := ctx.Value(usageTrackerKey{}).(*UsageTracker); ok && t != nil {
+		t.Record(result)
+	}
+}
@@ -0,0 +1,83 @@
+package ai
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	store "nadhi.dev/sarvar/fun/database"
+	"nadhi.dev/sarvar/fun/db"
+)
+
+// MaxTemplateVariables caps how many variables a user may store
+const MaxTemplateVariables = 100
+
+// MaxTemplateVariableLength caps the length of a single variable's value
+const MaxTemplateVariableLength = 2000
+
+// templateVariablePattern matches {{name}}, allowing spaces inside the braces
+var templateVariablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+// validVariableName matches the names templateVariablePattern can resolve
+var validVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// IsValidVariableName reports whether name can be used as {{name}}
+func IsValidVariableName(name string) bool {
+	return len(name) <= 64 && validVariableName.MatchString(name)
+}
+
+// UserVariables loads a user's template variables, or nil if unavailable
+func UserVariables(username string) map[string]string {
+	if username == "" {
+		return nil
+	}
+	user, err := store.GetUser(db.UsersDB, username)
+	if err != nil || user == nil {
+		return nil
+	}
+	return user.Variables
+}
+
+// ApplyTemplateVariables replaces {{name}} placeholders in the request's
+// text fields with vars. Placeholders with no matching variable are left as
+// written; their names are returned, sorted and without duplicates.
+func ApplyTemplateVariables(request *GenerationRequest, vars map[string]string) []string {
+	if request == nil {
+		return nil
+	}
+
+	missing := make(map[string]bool)
+	expand := func(text string) string {
+		if !strings.Contains(text, "{{") {
+			return text
+		}
+		return templateVariablePattern.ReplaceAllStringFunc(text, func(match string) string {
+			name := templateVariablePattern.FindStringSubmatch(match)[1]
+			if value, ok := vars[name]; ok {
+				return value
+			}
+			missing[name] = true
+			return match
+		})
+	}
+
+	request.Subject = expand(request.Subject)
+	request.Course = expand(request.Course)
+	request.Description = expand(request.Description)
+	request.Curriculum = expand(request.Curriculum)
+	request.SpecialInstructions = expand(request.SpecialInstructions)
+	request.WebSearchQuery = expand(request.WebSearchQuery)
+	for i, tag := range request.Tags {
+		request.Tags[i] = expand(tag)
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
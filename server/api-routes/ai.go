@@ -0,0 +1,51 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"nadhi.dev/sarvar/fun/ai"
+	"nadhi.dev/sarvar/fun/server"
+)
+
+// AIIndex registers routes reporting on the AI provider setup
+func AIIndex() error {
+	// Checks the configuration without making a generation call, so it is
+	// cheap enough for a settings page to poll
+	server.Route.Get("/api/v1/ai/health", func(c *fiber.Ctx) error {
+		if _, err := getUsernameFromAuth(c); err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		aiConfig, err := ai.GetAIConfig()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		result := fiber.Map{
+			"provider":   aiConfig.Provider,
+			"configured": true,
+			"models":     []ai.ModelCheck{},
+			"warnings":   []string{},
+		}
+		if _, err := ai.GetModelConfig(ai.TaskUtility); err != nil {
+			result["configured"] = false
+			result["error"] = err.Error()
+			return c.JSON(result)
+		}
+
+		checks, err := ai.CheckConfiguredModels()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		warnings := []string{}
+		for _, check := range checks {
+			if check.Warning != "" {
+				warnings = append(warnings, check.Warning)
+			}
+		}
+		result["models"] = checks
+		result["warnings"] = warnings
+		return c.JSON(result)
+	})
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"nadhi.dev/sarvar/fun/config"
+	store "nadhi.dev/sarvar/fun/database"
+	"nadhi.dev/sarvar/fun/db"
+	"nadhi.dev/sarvar/fun/server"
+)
+
+// Audit actions, named <thing>.<verb>
+const (
+	auditSheetCreate       = "sheet.create"
+	auditJobDelete         = "job.delete"
+	auditJobAbort          = "job.abort"
+	auditJobRetry          = "job.retry"
+	auditJobImport         = "job.import"
+	auditConfigUpdate      = "config.update"
+	auditStyleCreate       = "style.create"
+	auditStyleUpdate       = "style.update"
+	auditStyleDelete       = "style.delete"
+	auditStyleDefault      = "style.default"
+	auditModeCreate        = "mode.create"
+	auditModeUpdate        = "mode.update"
+	auditModeDelete        = "mode.delete"
+	auditModeDefault       = "mode.default"
+	auditAPIKeyCreate      = "apikey.create"
+	auditAPIKeyDelete      = "apikey.delete"
+	auditSessionRevoke     = "session.revoke"
+	auditLockoutClear      = "lockout.clear"
+	auditPreferencesUpdate = "preferences.update"
+)
+
+// defaultAuditLimit and maxAuditLimit bound how many entries one audit
+// query returns
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// recordAudit appends an entry to the audit log. A failed write is logged
+// but never fails the action it records.
+func recordAudit(user, action, target string) {
+	if db.AuditDB == nil {
+		return
+	}
+	entry := store.AuditEntry{Time: time.Now(), User: user, Action: action, Target: target}
+	if err := store.AppendAuditBadger(db.AuditDB, entry); err != nil {
+		log.Printf("[AUDIT] Failed to record %s by %s on %s: %v", action, user, target, err)
+	}
+}
+
+// auditUser returns the caller's username for an audit entry, or "" when
+// the request carries no valid session
+func auditUser(c *fiber.Ctx) string {
+	username, _ := getUsernameFromAuth(c)
+	return username
+}
+
+// changedConfigKeys returns, sorted, the keys whose values in update differ
+// from the saved config, as the target of a config change
+func changedConfigKeys(update map[string]interface{}) []string {
+	saved, _ := config.GetConfig()
+	keys := []string{}
+	for key, value := range update {
+		next, _ := json.Marshal(value)
+		current, _ := json.Marshal(saved[key])
+		if !bytes.Equal(next, current) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parseAuditSince reads since as RFC 3339 or Unix seconds
+func parseAuditSince(raw string) (time.Time, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, true
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, true
+	}
+	if secs, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(secs, 0), true
+	}
+	return time.Time{}, false
+}
+
+// AuditIndex registers the admin audit log routes
+func AuditIndex() error {
+	server.Route.Get("/api/v1/admin/audit", func(c *fiber.Ctx) error {
+		if _, err := getAdminFromAuth(c); err != nil {
+			return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{"error": err.Error()})
+		}
+		if db.AuditDB == nil {
+			return c.Status(500).JSON(fiber.Map{"error": "audit log not initialized"})
+		}
+
+		since, ok := parseAuditSince(c.Query("since"))
+		if !ok {
+			return c.Status(400).JSON(fiber.Map{"error": "since must be an RFC 3339 time or Unix seconds"})
+		}
+		limit := c.QueryInt("limit", defaultAuditLimit)
+		if limit < 1 {
+			limit = defaultAuditLimit
+		}
+		if limit > maxAuditLimit {
+			limit = maxAuditLimit
+		}
+
+		entries, err := store.GetAuditBadger(db.AuditDB, store.AuditFilter{
+			User:   strings.TrimSpace(c.Query("user")),
+			Action: strings.TrimSpace(c.Query("action")),
+			Since:  since,
+			Limit:  limit,
+		})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to read audit log"})
+		}
+		return c.JSON(fiber.Map{"entries": entries, "count": len(entries)})
+	})
+
+	return nil
+}
@@ -1,8 +1,12 @@
 package api
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
 	"nadhi.dev/sarvar/fun/auth"
+	"nadhi.dev/sarvar/fun/config"
 	"nadhi.dev/sarvar/fun/server"
 	ws "nadhi.dev/sarvar/fun/websocket"
 )
@@ -18,6 +22,35 @@ type LoginRequest struct {
     Password   string `json:"password"`
 }
 
+// getAdminFromAuth resolves the caller and makes sure they have the admin rank
+func getAdminFromAuth(c *fiber.Ctx) (string, error) {
+	authHeader := c.Get("Authorization")
+	if len(authHeader) < 8 || !strings.HasPrefix(authHeader, "Bearer ") {
+		return "", fiber.ErrUnauthorized
+	}
+	user, err := auth.GetUserBySession(authHeader[7:])
+	if err != nil || user == nil {
+		return "", fiber.ErrUnauthorized
+	}
+	if user.Rank != "admin" {
+		return "", fiber.NewError(fiber.StatusForbidden, "admin access required")
+	}
+	return user.Username, nil
+}
+
+// getSessionUsernameFromAuth resolves the caller like getUsernameFromAuth,
+// but only from a session, not an API key
+func getSessionUsernameFromAuth(c *fiber.Ctx) (string, error) {
+	username, err := getUsernameFromAuth(c)
+	if err != nil {
+		return "", fiber.ErrUnauthorized
+	}
+	if auth.IsAPIKey(c.Get("Authorization")[7:]) {
+		return "", fiber.NewError(fiber.StatusForbidden, "API keys can't manage API keys")
+	}
+	return username, nil
+}
+
 func AuthIndex() error {
 	// Register route
 	server.Route.Post("/api/v1/register", func(c *fiber.Ctx) error {
@@ -50,6 +83,9 @@ func AuthIndex() error {
 		}
 		sessionID, err := auth.Login(body.Identifier, body.Password)
 
+		if errors.Is(err, auth.ErrAccountLocked) {
+			return c.Status(429).JSON(fiber.Map{"error": err.Error()})
+		}
 		if err != nil {
 			// Prob don't like this
 			// It's not needed and is a waste of resources
@@ -87,5 +123,129 @@ func AuthIndex() error {
     })
 })
 
+	// Sessions are under /api/v1/auth which CheckAuth lets through,
+	// so both handlers resolve the caller themselves
+	server.Route.Get("/api/v1/auth/sessions", func(c *fiber.Ctx) error {
+		username, err := getUsernameFromAuth(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		sessions, err := auth.ListSessions(username)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to list sessions"})
+		}
+
+		current := c.Get("Authorization")[7:]
+		items := make([]fiber.Map, 0, len(sessions))
+		for _, s := range sessions {
+			items = append(items, fiber.Map{
+				"id":        auth.SessionPublicID(s.ID),
+				"createdAt": s.CreatedAt,
+				"current":   s.ID == current,
+			})
+		}
+		return c.JSON(fiber.Map{
+			"sessions":    items,
+			"maxSessions": config.GetConfigInt("MAX_SESSIONS", 0),
+		})
+	})
+
+	server.Route.Delete("/api/v1/auth/sessions/:id", func(c *fiber.Ctx) error {
+		username, err := getUsernameFromAuth(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		if err := auth.RevokeSession(username, c.Params("id")); err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "session not found"})
+		}
+		recordAudit(username, auditSessionRevoke, c.Params("id"))
+		return c.JSON(fiber.Map{"status": "revoked"})
+	})
+
+	// API keys for programmatic access. Managing them needs a session, so a
+	// leaked key can't be used to mint more.
+	server.Route.Post("/api/v1/auth/api-keys", func(c *fiber.Ctx) error {
+		username, err := getSessionUsernameFromAuth(c)
+		if err != nil {
+			return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{"error": err.Error()})
+		}
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := c.BodyParser(&body); err != nil && len(c.Body()) > 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+		}
+		if len(body.Name) > 100 {
+			return c.Status(400).JSON(fiber.Map{"error": "name too long"})
+		}
+		token, key, err := auth.CreateAPIKey(username, body.Name)
+		if errors.Is(err, auth.ErrTooManyAPIKeys) {
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to create API key"})
+		}
+		recordAudit(username, auditAPIKeyCreate, key.ID)
+		return c.Status(201).JSON(fiber.Map{
+			"key":       token,
+			"id":        key.ID,
+			"name":      key.Name,
+			"prefix":    key.Prefix,
+			"createdAt": key.CreatedAt,
+		})
+	})
+
+	server.Route.Get("/api/v1/auth/api-keys", func(c *fiber.Ctx) error {
+		username, err := getSessionUsernameFromAuth(c)
+		if err != nil {
+			return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{"error": err.Error()})
+		}
+		keys, err := auth.ListAPIKeys(username)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to list API keys"})
+		}
+		items := make([]fiber.Map, 0, len(keys))
+		for _, k := range keys {
+			items = append(items, fiber.Map{
+				"id":        k.ID,
+				"name":      k.Name,
+				"prefix":    k.Prefix,
+				"createdAt": k.CreatedAt,
+			})
+		}
+		return c.JSON(fiber.Map{
+			"apiKeys":   items,
+			"rateLimit": config.GetConfigInt("API_KEY_RATE_LIMIT", auth.DefaultAPIKeyRateLimit),
+		})
+	})
+
+	server.Route.Delete("/api/v1/auth/api-keys/:id", func(c *fiber.Ctx) error {
+		username, err := getSessionUsernameFromAuth(c)
+		if err != nil {
+			return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := auth.RevokeAPIKey(username, c.Params("id")); err != nil {
+			if errors.Is(err, auth.ErrAPIKeyNotFound) {
+				return c.Status(404).JSON(fiber.Map{"error": "API key not found"})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "failed to revoke API key"})
+		}
+		recordAudit(username, auditAPIKeyDelete, c.Params("id"))
+		return c.JSON(fiber.Map{"status": "revoked"})
+	})
+
+	// Admin-only: clear a login lockout so the user can try again immediately
+	server.Route.Delete("/api/v1/admin/lockouts/:username", func(c *fiber.Ctx) error {
+		admin, err := getAdminFromAuth(c)
+		if err != nil {
+			return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := auth.ClearLockout(c.Params("username")); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to clear lockout"})
+		}
+		recordAudit(admin, auditLockoutClear, c.Params("username"))
+		return c.JSON(fiber.Map{"status": "cleared"})
+	})
+
 	return nil
 }
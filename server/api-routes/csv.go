@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	vela "nadhi.dev/sarvar/fun/bucket"
+	"nadhi.dev/sarvar/fun/pipeline"
+	sheet "nadhi.dev/sarvar/fun/sheets"
+)
+
+// mimeTextCSV is the content type of job list exports
+const mimeTextCSV = "text/csv"
+
+// jobCSVHeader is the column order of job list exports
+var jobCSVHeader = []string{"id", "status", "prompt", "created", "updated", "pdf_url"}
+
+// wantsCSV reports whether a job list should be sent as CSV: ?format=csv,
+// or an Accept header preferring text/csv. JSON stays the default.
+func wantsCSV(c *fiber.Ctx) bool {
+	if format := c.Query("format"); format != "" {
+		return strings.EqualFold(format, "csv")
+	}
+	return c.Accepts(fiber.MIMEApplicationJSON, mimeTextCSV) == mimeTextCSV
+}
+
+// sendJobsCSV writes job summary rows as a CSV attachment
+func sendJobsCSV(c *fiber.Ctx, rows [][]string) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write(jobCSVHeader)
+	for _, row := range rows {
+		for i, cell := range row {
+			row[i] = csvSafeCell(cell)
+		}
+		_ = w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to build CSV"})
+	}
+
+	c.Set(fiber.HeaderContentType, mimeTextCSV+"; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="jobs.csv"`)
+	return c.Send(buf.Bytes())
+}
+
+// csvSafeCell stops spreadsheets from evaluating a cell as a formula
+func csvSafeCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// csvTime formats a timestamp for export; zero times are left empty
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// resultPDFURL reads pdf_url from a job result map
+func resultPDFURL(result interface{}) string {
+	if m, ok := result.(map[string]interface{}); ok {
+		url, _ := m["pdf_url"].(string)
+		return url
+	}
+	return ""
+}
+
+// queueItemsCSVRows converts getPipelineQueueItems output to CSV rows
+func queueItemsCSVRows(items []map[string]interface{}) [][]string {
+	rows := make([][]string, 0, len(items))
+	for _, item := range items {
+		id, _ := item["id"].(string)
+		status, _ := item["status"].(string)
+		prompt, _ := item["prompt"].(string)
+		created, _ := item["created_at"].(time.Time)
+		updated, _ := item["updated_at"].(time.Time)
+		rows = append(rows, []string{id, status, prompt, csvTime(created), csvTime(updated), resultPDFURL(item["result"])})
+	}
+	return rows
+}
+
+// legacyItemsCSVRows converts legacy queue items to CSV rows
+func legacyItemsCSVRows(items []vela.SheetQueueItem) [][]string {
+	rows := make([][]string, 0, len(items))
+	for _, item := range items {
+		rows = append(rows, []string{item.ID, item.Status, item.Prompt, item.CreatedAt, item.UpdatedAt, resultPDFURL(item.Result)})
+	}
+	return rows
+}
+
+// pipelineJobsCSVRows converts pipeline jobs to CSV rows
+func pipelineJobsCSVRows(jobs []*pipeline.Job) [][]string {
+	rows := make([][]string, 0, len(jobs))
+	for _, job := range jobs {
+		rows = append(rows, []string{job.ID.String(), string(job.Status), job.Prompt, csvTime(job.CreatedAt), csvTime(job.UpdatedAt), job.PDFURL})
+	}
+	return rows
+}
+
+// sheetJobsCSVRows converts legacy generator jobs to CSV rows
+func sheetJobsCSVRows(jobs []sheet.QueuedJob) [][]string {
+	rows := make([][]string, 0, len(jobs))
+	for _, job := range jobs {
+		rows = append(rows, []string{job.ID, job.Status, job.Prompt, csvTime(job.CreatedAt), csvTime(job.UpdatedAt), resultPDFURL(job.Result)})
+	}
+	return rows
+}
@@ -0,0 +1,287 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"nadhi.dev/sarvar/fun/ai"
+	"nadhi.dev/sarvar/fun/config"
+	"nadhi.dev/sarvar/fun/pipeline"
+)
+
+// DefaultDownloadURLTTLSeconds is how long a signed download URL stays valid
+const DefaultDownloadURLTTLSeconds = 300
+
+// storageURLPrefix is where ServeStorageFileFiber is mounted
+const storageURLPrefix = "/vela/bucket/"
+
+var (
+	errDownloadExpired   = errors.New("download link expired")
+	errDownloadSignature = errors.New("invalid download signature")
+)
+
+var (
+	processSecretOnce sync.Once
+	processSecret     []byte
+)
+
+// downloadSigningSecretEnv names the environment variable holding the HMAC
+// key. It is deliberately not read from set.json, which any signed-in user
+// can read through /api/v1/set.
+const downloadSigningSecretEnv = "DOWNLOAD_SIGNING_SECRET"
+
+// downloadSigningSecret returns $DOWNLOAD_SIGNING_SECRET, or a random secret
+// generated once per process when none is set. A random secret means links
+// stop working after a restart, which is fine for short-lived URLs.
+func downloadSigningSecret() []byte {
+	if secret := strings.TrimSpace(os.Getenv(downloadSigningSecretEnv)); secret != "" {
+		return []byte(secret)
+	}
+	processSecretOnce.Do(func() {
+		processSecret = make([]byte, 32)
+		if _, err := rand.Read(processSecret); err != nil {
+			panic(fmt.Sprintf("failed to generate download signing secret: %v", err))
+		}
+	})
+	return processSecret
+}
+
+// signedDownloadsRequired reports whether /vela/bucket rejects unsigned requests
+func signedDownloadsRequired() bool {
+	return config.GetConfigBool("REQUIRE_SIGNED_DOWNLOADS", true)
+}
+
+// downloadURLTTL returns the configured lifetime of signed URLs
+func downloadURLTTL() time.Duration {
+	seconds := config.GetConfigInt("DOWNLOAD_URL_TTL_SECONDS", DefaultDownloadURLTTLSeconds)
+	if seconds < 1 {
+		seconds = DefaultDownloadURLTTLSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// downloadSignature is the hex HMAC-SHA256 of the storage path and expiry
+func downloadSignature(relPath string, expires int64) string {
+	mac := hmac.New(sha256.New, downloadSigningSecret())
+	mac.Write([]byte(relPath))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignStorageURL turns a /vela/bucket URL into a signed one that expires at
+// expires. URLs outside the storage route are returned unchanged.
+func SignStorageURL(rawURL string, expires time.Time) string {
+	if !strings.HasPrefix(rawURL, storageURLPrefix) {
+		return rawURL
+	}
+	relPath := strings.TrimPrefix(rawURL, storageURLPrefix)
+	unix := expires.Unix()
+	return fmt.Sprintf("%s?expires=%d&sig=%s", rawURL, unix, downloadSignature(relPath, unix))
+}
+
+// responseStorageURL is a bucket URL as handed out in API responses: signed
+// when signed downloads are required, unchanged otherwise
+func responseStorageURL(rawURL string) string {
+	if rawURL == "" || !signedDownloadsRequired() {
+		return rawURL
+	}
+	return SignStorageURL(rawURL, time.Now().Add(downloadURLTTL()))
+}
+
+// unsignedStorageURL strips the signature from a bucket URL, so a link a
+// client saves, e.g. as a notebook item, doesn't expire with it
+func unsignedStorageURL(rawURL string) string {
+	if !strings.HasPrefix(rawURL, storageURLPrefix) {
+		return rawURL
+	}
+	if i := strings.IndexByte(rawURL, '?'); i >= 0 {
+		return rawURL[:i]
+	}
+	return rawURL
+}
+
+// resultURLKeys are the response fields that hold bucket URLs
+var resultURLKeys = []string{"pdf_url", "student_pdf_url", "key_pdf_url", "thumbnail_url"}
+
+// jobURLKeys are the job metadata entries that hold bucket URLs
+var jobURLKeys = []string{"studentPdfUrl", "keyPdfUrl", "thumbnailUrl"}
+
+// responseResult returns a copy of a result map with its bucket URLs
+// signed. Anything that isn't a map is returned as is. The copy keeps the
+// stored result, which may be shared, unsigned.
+func responseResult(result interface{}) interface{} {
+	m, ok := result.(map[string]interface{})
+	if !ok || m == nil {
+		return result
+	}
+	return responseResultMap(m)
+}
+
+// responseResultMap is responseResult for a map
+func responseResultMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil || !signedDownloadsRequired() {
+		return m
+	}
+	signed := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		signed[k] = v
+	}
+	for _, key := range resultURLKeys {
+		if url, ok := signed[key].(string); ok {
+			signed[key] = responseStorageURL(url)
+		}
+	}
+	return signed
+}
+
+// responseJob returns job as handed out in API responses, with its PDF and
+// artifact URLs signed. The job itself is left untouched so a signed URL
+// can never be saved.
+func responseJob(job *pipeline.Job) *pipeline.Job {
+	if job == nil || !signedDownloadsRequired() {
+		return job
+	}
+	signed := *job
+	signed.PDFURL = responseStorageURL(job.PDFURL)
+	if job.Metadata != nil {
+		signed.Metadata = make(map[string]interface{}, len(job.Metadata))
+		for k, v := range job.Metadata {
+			signed.Metadata[k] = v
+		}
+		for _, key := range jobURLKeys {
+			if url, ok := signed.Metadata[key].(string); ok {
+				signed.Metadata[key] = responseStorageURL(url)
+			}
+		}
+	}
+	return &signed
+}
+
+// responseJobs applies responseJob to each job
+func responseJobs(jobs []*pipeline.Job) []*pipeline.Job {
+	if !signedDownloadsRequired() {
+		return jobs
+	}
+	signed := make([]*pipeline.Job, len(jobs))
+	for i, job := range jobs {
+		signed[i] = responseJob(job)
+	}
+	return signed
+}
+
+// responseNotebookItems returns a copy of a notebook's items with their
+// bucket URLs signed
+func responseNotebookItems(items map[string]string) map[string]string {
+	if items == nil || !signedDownloadsRequired() {
+		return items
+	}
+	signed := make(map[string]string, len(items))
+	for name, url := range items {
+		signed[name] = responseStorageURL(url)
+	}
+	return signed
+}
+
+// verifyStorageSignature checks the expires and sig query parameters
+// against the requested storage path
+func verifyStorageSignature(relPath, expiresParam, sig string) error {
+	if expiresParam == "" || sig == "" {
+		return errDownloadSignature
+	}
+	expires, err := strconv.ParseInt(expiresParam, 10, 64)
+	if err != nil {
+		return errDownloadSignature
+	}
+	// Fiber hands wildcard params over still escaped; sign the decoded path
+	if decoded, err := url.PathUnescape(relPath); err == nil {
+		relPath = decoded
+	}
+	expected := downloadSignature(relPath, expires)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(sig))) {
+		return errDownloadSignature
+	}
+	if time.Now().Unix() > expires {
+		return errDownloadExpired
+	}
+	return nil
+}
+
+// handlePipelineDownload returns short-lived signed URLs for a completed
+// job's PDF, along with the student/key copies and thumbnail when present.
+// The PDF URLs name the file after PDF_FILENAME_PATTERN.
+func handlePipelineDownload(c *fiber.Ctx) error {
+	job, _, err := getPipelineJobForUser(c)
+	if err != nil {
+		return err
+	}
+	if job.PDFURL == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "job has no PDF"})
+	}
+
+	expires := time.Now().Add(downloadURLTTL())
+	resp := fiber.Map{
+		"jobId":     job.ID.String(),
+		"pdf_url":   withDownloadName(SignStorageURL(job.PDFURL, expires), pdfFilename(job, "")),
+		"expiresAt": expires.UTC().Format(time.RFC3339),
+	}
+	if key, ok := job.Metadata["keyPdfUrl"].(string); ok && key != "" {
+		if student, ok := job.Metadata["studentPdfUrl"].(string); ok && student != "" {
+			resp["student_pdf_url"] = withDownloadName(SignStorageURL(student, expires), pdfFilename(job, "student"))
+		}
+		resp["key_pdf_url"] = withDownloadName(SignStorageURL(key, expires), pdfFilename(job, "key"))
+	}
+	if thumb := job.ThumbnailURL(); thumb != "" {
+		resp["thumbnail_url"] = SignStorageURL(thumb, expires)
+	}
+
+	return c.JSON(resp)
+}
+
+// texFilenameUnsafe matches runs of characters left out of .tex filenames
+var texFilenameUnsafe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// texFilename names a job's .tex download after its subject, falling back
+// to the job ID
+func texFilename(job *pipeline.Job) string {
+	var req ai.GenerationRequest
+	if err := json.Unmarshal([]byte(job.Prompt), &req); err == nil {
+		slug := strings.Trim(texFilenameUnsafe.ReplaceAllString(strings.ToLower(req.Subject), "-"), "-")
+		if len(slug) > 60 {
+			slug = strings.TrimRight(slug[:60], "-")
+		}
+		if slug != "" {
+			return fmt.Sprintf("%s-%s.tex", slug, job.ID.String()[:8])
+		}
+	}
+	return job.ID.String() + ".tex"
+}
+
+// handlePipelineTex returns the job's stored LaTeX source, e.g. for editing
+// in Overleaf
+func handlePipelineTex(c *fiber.Ctx) error {
+	job, _, err := getPipelineJobForUser(c)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(job.Latex) == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "job has no LaTeX"})
+	}
+
+	c.Attachment(texFilename(job))
+	c.Set(fiber.HeaderContentType, "application/x-tex; charset=utf-8")
+	return c.SendString(job.Latex)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"nadhi.dev/sarvar/fun/config"
+	"nadhi.dev/sarvar/fun/pipeline"
+)
+
+func TestResponseJobSignsCopy(t *testing.T) {
+	// No set.json, so signed downloads are on by default
+	t.Chdir(t.TempDir())
+	config.InvalidateConfigCache()
+
+	id := uuid.New()
+	pdf := storageURLPrefix + "bucket/" + id.String() + ".pdf"
+	thumb := storageURLPrefix + "bucket/" + id.String() + "-thumb.png"
+	job := &pipeline.Job{
+		ID:       id,
+		PDFURL:   pdf,
+		Metadata: map[string]interface{}{"thumbnailUrl": thumb},
+	}
+
+	signed := responseJob(job)
+	if job.PDFURL != pdf || job.Metadata["thumbnailUrl"] != thumb {
+		t.Fatalf("responseJob modified the stored job: %q, %v", job.PDFURL, job.Metadata["thumbnailUrl"])
+	}
+	for _, url := range []string{signed.PDFURL, signed.Metadata["thumbnailUrl"].(string)} {
+		base, query, ok := strings.Cut(url, "?")
+		if !ok {
+			t.Fatalf("%q is not signed", url)
+		}
+		params := map[string]string{}
+		for _, kv := range strings.Split(query, "&") {
+			k, v, _ := strings.Cut(kv, "=")
+			params[k] = v
+		}
+		if err := verifyStorageSignature(strings.TrimPrefix(base, storageURLPrefix), params["expires"], params["sig"]); err != nil {
+			t.Errorf("%q does not verify: %v", url, err)
+		}
+	}
+
+	if got := unsignedStorageURL(signed.PDFURL); got != pdf {
+		t.Errorf("unsignedStorageURL() = %q, want %q", got, pdf)
+	}
+}
+
+func TestResponseResultMapLeavesSourceUnsigned(t *testing.T) {
+	t.Chdir(t.TempDir())
+	config.InvalidateConfigCache()
+
+	pdf := storageURLPrefix + "bucket/sheet.pdf"
+	data := map[string]interface{}{"pdf_url": pdf, "type": "completed"}
+	signed := responseResultMap(data)
+	if data["pdf_url"] != pdf {
+		t.Fatalf("source map was modified: %v", data["pdf_url"])
+	}
+	if url, _ := signed["pdf_url"].(string); !strings.Contains(url, "sig=") {
+		t.Errorf("pdf_url = %q, want a signed URL", url)
+	}
+	if signed["type"] != "completed" {
+		t.Errorf("type = %v, want completed", signed["type"])
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/ai"
+	"nadhi.dev/sarvar/fun/config"
+	"nadhi.dev/sarvar/fun/pipeline"
+)
+
+// DefaultPDFFilenamePattern names downloaded PDFs. {subject}, {course},
+// {curriculum}, {mode}, {date} (completion day, YYYY-MM-DD) and {id} (the
+// first 8 characters of the job ID) are filled in from the job.
+const DefaultPDFFilenamePattern = "{subject}-{course}-{date}"
+
+// maxDownloadNameLength caps a download name, extension excluded
+const maxDownloadNameLength = 120
+
+// downloadNameUnsafe matches runs of characters left out of download names
+var downloadNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// downloadNameDashes matches the dash runs sanitizing can leave behind
+var downloadNameDashes = regexp.MustCompile(`-{2,}`)
+
+// sanitizeDownloadName makes name safe as a file name on any filesystem and
+// inside a Content-Disposition header, or returns "" if nothing is left
+func sanitizeDownloadName(name string) string {
+	name = downloadNameUnsafe.ReplaceAllString(name, "-")
+	name = downloadNameDashes.ReplaceAllString(name, "-")
+	name = strings.Trim(name, "-._")
+	if len(name) > maxDownloadNameLength {
+		name = strings.TrimRight(name[:maxDownloadNameLength], "-._")
+	}
+	return name
+}
+
+// pdfFilename renders PDF_FILENAME_PATTERN for a job. suffix tells the
+// answer-key copies apart ("student", "key"). A pattern that renders empty
+// falls back to the job ID.
+func pdfFilename(job *pipeline.Job, suffix string) string {
+	var req ai.GenerationRequest
+	_ = json.Unmarshal([]byte(job.Prompt), &req)
+
+	date := job.UpdatedAt
+	if job.CompletedAt != nil {
+		date = *job.CompletedAt
+	}
+	pattern := config.GetConfigString("PDF_FILENAME_PATTERN", DefaultPDFFilenamePattern)
+	name := strings.NewReplacer(
+		"{subject}", req.Subject,
+		"{course}", req.Course,
+		"{curriculum}", req.Curriculum,
+		"{mode}", ai.ResolveMode(&req),
+		"{date}", date.Format("2006-01-02"),
+		"{id}", job.ID.String()[:8],
+	).Replace(pattern)
+	name = strings.TrimSuffix(sanitizeDownloadName(name), ".pdf")
+	if name == "" {
+		name = job.ID.String()
+	}
+	if suffix != "" {
+		name += "-" + suffix
+	}
+	return name + ".pdf"
+}
+
+// withDownloadName adds the name the storage route should give a file
+func withDownloadName(rawURL, name string) string {
+	sep := "?"
+	if strings.Contains(rawURL, "?") {
+		sep = "&"
+	}
+	return rawURL + sep + "name=" + url.QueryEscape(name)
+}
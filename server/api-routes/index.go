@@ -1,8 +1,11 @@
 package api
 
 import (
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
 	"nadhi.dev/sarvar/fun/config"
+	"nadhi.dev/sarvar/fun/pipeline"
 	"nadhi.dev/sarvar/fun/server"
 	ws "nadhi.dev/sarvar/fun/websocket"
 )
@@ -50,6 +53,9 @@ func Index() error {
 			})
 		}
 
+		// Left over from before the secret moved to the environment
+		delete(cfg, downloadSigningSecretEnv)
+
 		return c.JSON(cfg)
 	})
 
@@ -69,12 +75,41 @@ func Index() error {
 			})
 		}
 
+		// The completion hook runs a command on the server, so only an
+		// admin may change it
+		newCmd := pipeline.ParseOnCompleteCommand(newData["ON_COMPLETE_CMD"])
+		oldCmd := pipeline.ParseOnCompleteCommand(config.GetConfigValue("ON_COMPLETE_CMD"))
+		if strings.Join(newCmd, "\x00") != strings.Join(oldCmd, "\x00") {
+			if _, err := getAdminFromAuth(c); err != nil {
+				return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{
+					"error": "Only an admin can change ON_COMPLETE_CMD",
+				})
+			}
+		}
+
+		// Turning signed downloads off makes every PDF public again, so
+		// only an admin may change it. The secret never goes in set.json.
+		delete(newData, downloadSigningSecretEnv)
+		newSigned, ok := newData["REQUIRE_SIGNED_DOWNLOADS"].(bool)
+		if !ok {
+			newSigned = true
+		}
+		if newSigned != signedDownloadsRequired() {
+			if _, err := getAdminFromAuth(c); err != nil {
+				return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{
+					"error": "Only an admin can change REQUIRE_SIGNED_DOWNLOADS",
+				})
+			}
+		}
+
+		changed := changedConfigKeys(newData)
 		if err := config.SaveConfig(newData); err != nil {
 			return c.Status(500).JSON(fiber.Map{
 				"status": 500,
 				"error":  "Failed to save configuration",
 			})
 		}
+		recordAudit(auditUser(c), auditConfigUpdate, strings.Join(changed, ","))
 
 		return c.JSON(fiber.Map{
 			"status":  200,
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+	"nadhi.dev/sarvar/fun/config"
+)
+
+// DefaultWebsocketPingSeconds is how often job websockets are pinged, well
+// under the 60s idle timeout common to reverse proxies
+const DefaultWebsocketPingSeconds = 30
+
+// socketWriteWait bounds a single websocket write, so a dead client can't
+// hold up whoever is writing to it
+const socketWriteWait = 10 * time.Second
+
+var errSocketClosed = errors.New("websocket closed")
+
+// socketConn serializes writes to a websocket, which allows only one
+// writer at a time, between status updates and keepalive pings
+type socketConn struct {
+	conn *websocket.Conn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newSocketConn(c *websocket.Conn) *socketConn {
+	return &socketConn{conn: c}
+}
+
+// WriteJSON sends v, failing fast once the connection has been closed
+func (s *socketConn) WriteJSON(v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSocketClosed
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	if err := s.conn.WriteJSON(v); err != nil {
+		s.closeLocked()
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection; later writes are dropped
+func (s *socketConn) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked()
+}
+
+func (s *socketConn) closeLocked() {
+	if !s.closed {
+		s.closed = true
+		_ = s.conn.Close()
+	}
+}
+
+// websocketPingInterval returns WEBSOCKET_PING_SECONDS; 0 disables pings
+func websocketPingInterval() time.Duration {
+	seconds := config.GetConfigInt("WEBSOCKET_PING_SECONDS", DefaultWebsocketPingSeconds)
+	if seconds < 0 {
+		seconds = 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// keepAlive pings the client every WEBSOCKET_PING_SECONDS so proxies see
+// traffic during long generations. The client must answer (browsers pong
+// automatically) or send something within two intervals, or the read
+// deadline passes and the caller's read loop ends with an error. Call the
+// returned function once the read loop is done.
+func (s *socketConn) keepAlive() func() {
+	interval := websocketPingInterval()
+	if interval == 0 {
+		return func() {}
+	}
+
+	extend := func() { _ = s.conn.SetReadDeadline(time.Now().Add(2 * interval)) }
+	extend()
+	s.conn.SetPongHandler(func(string) error {
+		extend()
+		return nil
+	})
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := s.ping(); err != nil {
+					// A failed ping means the connection is gone; closing
+					// it ends the read loop
+					s.Close()
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// ping sends a ping control frame
+func (s *socketConn) ping() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSocketClosed
+	}
+	return s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait))
+}
+
+// readUntilClosed discards client messages until the connection fails,
+// keeping the read deadline fresh while the client is talking
+func (s *socketConn) readUntilClosed() {
+	interval := websocketPingInterval()
+	for {
+		if _, _, err := s.conn.ReadMessage(); err != nil {
+			return
+		}
+		if interval > 0 {
+			_ = s.conn.SetReadDeadline(time.Now().Add(2 * interval))
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	store "nadhi.dev/sarvar/fun/database"
+	"nadhi.dev/sarvar/fun/db"
+	notebook "nadhi.dev/sarvar/fun/notebooks"
+	"nadhi.dev/sarvar/fun/pipeline"
+	"nadhi.dev/sarvar/fun/server"
+	sheet "nadhi.dev/sarvar/fun/sheets"
+)
+
+// libraryArchiveVersion is written to manifest.json; imports of newer
+// versions are refused
+const libraryArchiveVersion = 1
+
+// maxLibraryImportBytes caps the total uncompressed size read from an
+// imported archive
+const maxLibraryImportBytes = 512 * 1024 * 1024
+
+// libraryManifest describes a library archive
+type libraryManifest struct {
+	Version    int       `json:"version"`
+	Username   string    `json:"username"`
+	ExportedAt time.Time `json:"exportedAt"`
+	Jobs       int       `json:"jobs"`
+}
+
+// libraryImportResult reports what an import restored. JobIDs maps the
+// archive's job IDs to the new ones.
+type libraryImportResult struct {
+	StylesImported int               `json:"stylesImported"`
+	StylesSkipped  []string          `json:"stylesSkipped"`
+	Notebooks      int               `json:"notebooks"`
+	Jobs           int               `json:"jobs"`
+	JobIDs         map[string]string `json:"jobIds"`
+	Errors         []string          `json:"errors,omitempty"`
+}
+
+func LibraryIndex() error {
+	server.Route.Get("/api/v1/export/library", func(c *fiber.Ctx) error {
+		return handleLibraryExport(c)
+	})
+
+	server.Route.Post("/api/v1/import/library", func(c *fiber.Ctx) error {
+		return handleLibraryImport(c)
+	})
+
+	return nil
+}
+
+// handleLibraryExport streams a zip of the caller's styles, notebooks and
+// completed jobs
+func handleLibraryExport(c *fiber.Ctx) error {
+	username, err := getUsernameFromAuth(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	styles, err := store.GetAllStyles(db.StylesDB, username)
+	if err != nil {
+		styles = []store.Style{}
+	}
+	notebooks, err := notebook.GetAllNotebooks(username)
+	if err != nil {
+		notebooks = []store.Notebook{}
+	}
+	var jobs []*pipeline.Job
+	if sheet.GlobalPipelineStore != nil {
+		all, err := sheet.GlobalPipelineStore.GetJobsByUser(username)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to load jobs"})
+		}
+		for _, job := range all {
+			if job.Status == pipeline.StatusCompleted {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+
+	manifest, _ := json.MarshalIndent(libraryManifest{
+		Version:    libraryArchiveVersion,
+		Username:   username,
+		ExportedAt: time.Now(),
+		Jobs:       len(jobs),
+	}, "", "  ")
+	stylesJSON, _ := json.MarshalIndent(styles, "", "  ")
+	notebooksJSON, _ := json.MarshalIndent(notebooks, "", "  ")
+
+	c.Set("Content-Type", "application/zip")
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="library-%s.zip"`, time.Now().Format("20060102")))
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		zw := zip.NewWriter(w)
+		defer func() {
+			_ = zw.Close()
+			_ = w.Flush()
+		}()
+
+		for _, f := range []struct {
+			name string
+			data []byte
+		}{
+			{"manifest.json", manifest},
+			{"styles.json", stylesJSON},
+			{"notebooks.json", notebooksJSON},
+		} {
+			fw, err := zw.Create(f.name)
+			if err != nil {
+				return
+			}
+			if _, err := fw.Write(f.data); err != nil {
+				return
+			}
+		}
+
+		for _, job := range jobs {
+			if err := pipeline.ExportJob(zw, path.Join("jobs", job.ID.String()), job); err != nil {
+				return
+			}
+			// Flush per job so large libraries stream instead of buffering
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// handleLibraryImport restores an archive from handleLibraryExport into
+// the caller's account. The archive is the request body, or the "archive"
+// field of a multipart form. Jobs get new IDs, styles whose name is taken
+// are skipped, and notebooks are created anew with their items pointed at
+// the imported jobs.
+func handleLibraryImport(c *fiber.Ctx) error {
+	username, err := getUsernameFromAuth(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	if sheet.GlobalPipelineStore == nil {
+		return c.Status(500).JSON(fiber.Map{"error": "pipeline not initialized"})
+	}
+
+	data := c.Body()
+	if strings.HasPrefix(c.Get("Content-Type"), "multipart/form-data") {
+		fh, err := c.FormFile("archive")
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "archive file required"})
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "failed to read archive"})
+		}
+		defer f.Close()
+		if data, err = io.ReadAll(f); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "failed to read archive"})
+		}
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid zip archive"})
+	}
+	files, err := readLibraryArchive(zr)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var manifest libraryManifest
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "manifest.json missing or invalid"})
+	}
+	if manifest.Version > libraryArchiveVersion {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("unsupported archive version %d", manifest.Version)})
+	}
+
+	result := libraryImportResult{StylesSkipped: []string{}, JobIDs: map[string]string{}}
+
+	// Jobs first, so notebook items can be pointed at their new IDs
+	jobFiles := map[string]map[string][]byte{}
+	for name, content := range files {
+		parts := strings.Split(name, "/")
+		if len(parts) != 3 || parts[0] != "jobs" {
+			continue
+		}
+		if jobFiles[parts[1]] == nil {
+			jobFiles[parts[1]] = map[string][]byte{}
+		}
+		jobFiles[parts[1]][parts[2]] = content
+	}
+	tried := 0
+	for oldID, jf := range jobFiles {
+		// Imports count against the stored job cap like new sheets. Once
+		// no room can be made the rest would fail the same way, so stop.
+		if sheet.GlobalPipelineQueue != nil {
+			if err := sheet.GlobalPipelineQueue.MakeRoomForJob(username); err != nil {
+				if errors.Is(err, pipeline.ErrStoredJobLimit) {
+					result.Errors = append(result.Errors, fmt.Sprintf("%v; %d jobs not imported", err, len(jobFiles)-tried))
+					break
+				}
+				result.Errors = append(result.Errors, fmt.Sprintf("job %s: %v", oldID, err))
+				continue
+			}
+		}
+		tried++
+		job, err := sheet.GlobalPipelineStore.ImportJob(username, jf)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("job %s: %v", oldID, err))
+			continue
+		}
+		result.JobIDs[oldID] = job.ID.String()
+		result.Jobs++
+		recordAudit(username, auditJobImport, job.ID.String())
+	}
+	// Imported artifacts count toward the quota like generated ones
+	if sheet.GlobalPipelineQueue != nil && result.Jobs > 0 {
+		sheet.GlobalPipelineQueue.EnforceStorageQuota(username)
+	}
+
+	var styles []store.Style
+	if raw, ok := files["styles.json"]; ok {
+		if err := json.Unmarshal(raw, &styles); err != nil {
+			result.Errors = append(result.Errors, "styles.json is invalid")
+		}
+	}
+	// An imported default only applies if the account has none yet
+	_, defaultErr := store.GetDefaultStyle(db.StylesDB, username)
+	keepDefault := defaultErr == nil
+	for _, s := range styles {
+		if strings.TrimSpace(s.Name) == "" || strings.TrimSpace(s.Prompt) == "" {
+			continue
+		}
+		isDefault := s.IsDefault && !keepDefault
+		if _, err := store.CreateStyle(db.StylesDB, username, s.Name, s.Prompt, s.Description, isDefault); err != nil {
+			result.StylesSkipped = append(result.StylesSkipped, s.Name)
+			continue
+		}
+		keepDefault = keepDefault || isDefault
+		result.StylesImported++
+		recordAudit(username, auditStyleCreate, s.Name)
+	}
+
+	var notebooks []store.Notebook
+	if raw, ok := files["notebooks.json"]; ok {
+		if err := json.Unmarshal(raw, &notebooks); err != nil {
+			result.Errors = append(result.Errors, "notebooks.json is invalid")
+		}
+	}
+	for _, nb := range notebooks {
+		created, err := notebook.CreateNotebook(username, nb.Name, nb.Description, notebook.Optional{
+			Tags:        nb.Optional.Tags,
+			Color:       nb.Optional.Color,
+			Description: nb.Optional.Description,
+		})
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("notebook %q: %v", nb.Name, err))
+			continue
+		}
+		for item, url := range nb.Items {
+			for oldID, newID := range result.JobIDs {
+				url = strings.ReplaceAll(url, oldID, newID)
+			}
+			if err := notebook.CreateItemToNotebook(username, created.ID, item, url); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("notebook %q item %q: %v", nb.Name, item, err))
+			}
+		}
+		result.Notebooks++
+	}
+
+	return c.JSON(result)
+}
+
+// readLibraryArchive reads every file in the archive into memory, refusing
+// archives that expand past maxLibraryImportBytes or contain unsafe paths
+func readLibraryArchive(zr *zip.Reader) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(zr.File))
+	var total int64
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := path.Clean(f.Name)
+		if strings.HasPrefix(name, "/") || strings.HasPrefix(name, "..") {
+			return nil, fmt.Errorf("invalid path in archive: %s", f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s", f.Name)
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, maxLibraryImportBytes-total+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s", f.Name)
+		}
+		total += int64(len(content))
+		if total > maxLibraryImportBytes {
+			return nil, fmt.Errorf("archive is too large")
+		}
+		files[name] = content
+	}
+	return files, nil
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"nadhi.dev/sarvar/fun/ai"
+	store "nadhi.dev/sarvar/fun/database"
+	"nadhi.dev/sarvar/fun/db"
+	"nadhi.dev/sarvar/fun/server"
+)
+
+// modeListing is a registry entry as listed to clients, flagged when it is
+// the default mode
+type modeListing struct {
+	store.GenerationMode
+	Default bool `json:"default"`
+}
+
+// ModesIndex registers the generation mode registry routes. Anyone signed in
+// can list modes; creating, editing and deleting them, and changing the
+// default, requires admin.
+func ModesIndex() error {
+	server.Route.Get("/api/v1/modes", func(c *fiber.Ctx) error {
+		if _, err := getUsernameFromAuth(c); err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		defaultMode := ai.DefaultModeName()
+		modes := ai.ListModes()
+		listing := make([]modeListing, 0, len(modes))
+		for _, mode := range modes {
+			listing = append(listing, modeListing{GenerationMode: mode, Default: mode.Name == defaultMode})
+		}
+		return c.JSON(listing)
+	})
+
+	server.Route.Get("/api/v1/modes/default", func(c *fiber.Ctx) error {
+		if _, err := getUsernameFromAuth(c); err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		return c.JSON(fiber.Map{"mode": ai.DefaultModeName()})
+	})
+
+	server.Route.Put("/api/v1/modes/default", func(c *fiber.Ctx) error {
+		admin, err := getAdminFromAuth(c)
+		if err != nil {
+			return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{"error": err.Error()})
+		}
+		var body struct {
+			Mode string `json:"mode"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+		}
+		body.Mode = strings.TrimSpace(body.Mode)
+		if !ai.IsValidMode(body.Mode) {
+			return c.Status(404).JSON(fiber.Map{"error": "mode not found"})
+		}
+		if err := ai.SetDefaultMode(body.Mode); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to save default mode"})
+		}
+		recordAudit(admin, auditModeDefault, body.Mode)
+		return c.JSON(fiber.Map{"mode": body.Mode})
+	})
+
+	server.Route.Get("/api/v1/modes/:name", func(c *fiber.Ctx) error {
+		if _, err := getUsernameFromAuth(c); err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		name := strings.TrimSpace(c.Params("name"))
+		for _, mode := range ai.ListModes() {
+			if mode.Name == name {
+				return c.JSON(modeListing{GenerationMode: mode, Default: name == ai.DefaultModeName()})
+			}
+		}
+		return c.Status(404).JSON(fiber.Map{"error": "mode not found"})
+	})
+
+	server.Route.Post("/api/v1/modes", func(c *fiber.Ctx) error {
+		admin, err := getAdminFromAuth(c)
+		if err != nil {
+			return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{"error": err.Error()})
+		}
+		var body store.GenerationMode
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+		}
+		body.Name = strings.TrimSpace(body.Name)
+		body.Instructions = strings.TrimSpace(body.Instructions)
+
+		if err := ai.ValidateModeName(body.Name); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if body.Instructions == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "instructions are required"})
+		}
+		if err := ai.ValidateModeRequirements(body.Requirements); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if ai.IsValidMode(body.Name) {
+			return c.Status(409).JSON(fiber.Map{"error": "mode already exists"})
+		}
+		body.BuiltIn = false
+
+		mode, err := store.SaveMode(db.ModesDB, body)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		recordAudit(admin, auditModeCreate, mode.Name)
+		return c.JSON(mode)
+	})
+
+	server.Route.Put("/api/v1/modes/:name", func(c *fiber.Ctx) error {
+		admin, err := getAdminFromAuth(c)
+		if err != nil {
+			return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{"error": err.Error()})
+		}
+		name := strings.TrimSpace(c.Params("name"))
+		if err := ai.ValidateModeName(name); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if !ai.IsValidMode(name) {
+			return c.Status(404).JSON(fiber.Map{"error": "mode not found"})
+		}
+		var body store.GenerationMode
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+		}
+		body.Instructions = strings.TrimSpace(body.Instructions)
+		if body.Instructions == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "instructions are required"})
+		}
+		if err := ai.ValidateModeRequirements(body.Requirements); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		body.Name = name
+		body.BuiltIn = ai.IsBuiltInMode(name)
+
+		mode, err := store.SaveMode(db.ModesDB, body)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		recordAudit(admin, auditModeUpdate, name)
+		return c.JSON(mode)
+	})
+
+	server.Route.Delete("/api/v1/modes/:name", func(c *fiber.Ctx) error {
+		admin, err := getAdminFromAuth(c)
+		if err != nil {
+			return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{"error": err.Error()})
+		}
+		name := strings.TrimSpace(c.Params("name"))
+		if ai.IsBuiltInMode(name) {
+			return c.Status(400).JSON(fiber.Map{"error": "built-in modes cannot be deleted"})
+		}
+		if name == ai.DefaultModeName() {
+			return c.Status(409).JSON(fiber.Map{"error": "the default mode cannot be deleted; set another default first"})
+		}
+		if err := store.DeleteMode(db.ModesDB, name); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to delete mode"})
+		}
+		recordAudit(admin, auditModeDelete, name)
+		return c.JSON(fiber.Map{"status": "deleted"})
+	})
+
+	return nil
+}
@@ -56,6 +56,9 @@ func Notebooks() error {
         if err != nil {
             return c.Status(500).JSON(fiber.Map{"error": "failed to get notebooks"})
         }
+        for i := range notebooks {
+            notebooks[i].Items = responseNotebookItems(notebooks[i].Items)
+        }
         return c.JSON(notebooks)
     })
 
@@ -96,6 +99,7 @@ func Notebooks() error {
         if err != nil {
             return c.Status(404).JSON(fiber.Map{"error": "notebook not found"})
         }
+        nb.Items = responseNotebookItems(nb.Items)
         return c.JSON(nb)
     })
 
@@ -112,7 +116,7 @@ func Notebooks() error {
         if err != nil {
             return c.Status(404).JSON(fiber.Map{"error": "notebook not found"})
         }
-        return c.JSON(items)
+        return c.JSON(responseNotebookItems(items))
     })
 
 	server.Route.Delete("/api/v1/notebooks/:id", func(c *fiber.Ctx) error {
@@ -159,6 +163,7 @@ func Notebooks() error {
         return c.Status(500).JSON(fiber.Map{"error": "failed to update notebook"})
     }
 
+    updatedNb.Items = responseNotebookItems(updatedNb.Items)
     return c.JSON(updatedNb)
 })
 
@@ -197,7 +202,8 @@ func Notebooks() error {
 		if err := c.BodyParser(&body); err != nil {
 			return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
 		}
-		err = notebook.CreateItemToNotebook(username, id, body.SheetName, body.Url)
+		// Clients pass back the signed link they were given; store the plain one
+		err = notebook.CreateItemToNotebook(username, id, body.SheetName, unsignedStorageURL(body.Url))
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "failed to add sheet"})
 		}
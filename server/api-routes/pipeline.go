@@ -1,13 +1,19 @@
 package api
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"path"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"nadhi.dev/sarvar/fun/ai"
+	notebook "nadhi.dev/sarvar/fun/notebooks"
 	"nadhi.dev/sarvar/fun/pipeline"
 	"nadhi.dev/sarvar/fun/server"
 	sheet "nadhi.dev/sarvar/fun/sheets"
@@ -15,6 +21,11 @@ import (
 )
 
 func PipelineIndex() error {
+	// Registered before /jobs/:id so "compare" isn't taken for a job ID
+	server.Route.Get("/api/v1/pipeline/jobs/compare", func(c *fiber.Ctx) error {
+		return handlePipelineCompare(c)
+	})
+
 	server.Route.Get("/api/v1/pipeline/jobs/:id", func(c *fiber.Ctx) error {
 		username, err := getUsernameFromAuth(c)
 		if err != nil {
@@ -31,7 +42,55 @@ func PipelineIndex() error {
 			return c.Status(404).JSON(fiber.Map{"error": "job not found"})
 		}
 
-		return c.JSON(job)
+		return c.JSON(responseJob(job))
+	})
+
+	server.Route.Get("/api/v1/pipeline/jobs/:id/stream", func(c *fiber.Ctx) error {
+		return handlePipelineJobStream(c)
+	})
+
+	server.Route.Get("/api/v1/pipeline/jobs/:id/download", func(c *fiber.Ctx) error {
+		return handlePipelineDownload(c)
+	})
+
+	server.Route.Get("/api/v1/pipeline/jobs/:id/tex", func(c *fiber.Ctx) error {
+		return handlePipelineTex(c)
+	})
+
+	server.Route.Get("/api/v1/pipeline/jobs/:id/position", func(c *fiber.Ctx) error {
+		return handlePipelineJobPosition(c)
+	})
+
+	server.Route.Post("/api/v1/pipeline/jobs/:id/labels", func(c *fiber.Ctx) error {
+		return handlePipelineLabels(c, true)
+	})
+
+	server.Route.Delete("/api/v1/pipeline/jobs/:id/labels", func(c *fiber.Ctx) error {
+		return handlePipelineLabels(c, false)
+	})
+
+	server.Route.Get("/api/v1/pipeline/labels", func(c *fiber.Ctx) error {
+		return handlePipelineLabelList(c)
+	})
+
+	server.Route.Get("/api/v1/pipeline/jobs/:id/related", func(c *fiber.Ctx) error {
+		return handlePipelineRelated(c)
+	})
+
+	server.Route.Get("/api/v1/pipeline/jobs/:id/design", func(c *fiber.Ctx) error {
+		return handlePipelineDesign(c)
+	})
+
+	server.Route.Post("/api/v1/pipeline/jobs/:id/details", func(c *fiber.Ctx) error {
+		return handlePipelineAddDetails(c)
+	})
+
+	server.Route.Post("/api/v1/pipeline/jobs/:id/design/regenerate-with-sources", func(c *fiber.Ctx) error {
+		return handlePipelineRegenerateWithSources(c)
+	})
+
+	server.Route.Post("/api/v1/pipeline/jobs/:id/design/select", func(c *fiber.Ctx) error {
+		return handlePipelineDesignSelect(c)
 	})
 
 	server.Route.Post("/api/v1/pipeline/jobs/:id/design/approve", func(c *fiber.Ctx) error {
@@ -42,6 +101,10 @@ func PipelineIndex() error {
 		return handlePipelineDesignRefine(c)
 	})
 
+	server.Route.Put("/api/v1/pipeline/jobs/:id/design/spec", func(c *fiber.Ctx) error {
+		return handlePipelineDesignSpecEdit(c)
+	})
+
 	server.Route.Post("/api/v1/pipeline/jobs/:id/latex/approve", func(c *fiber.Ctx) error {
 		return handlePipelineLatexApprove(c)
 	})
@@ -54,6 +117,10 @@ func PipelineIndex() error {
 		return handlePipelineLatexFix(c)
 	})
 
+	server.Route.Post("/api/v1/pipeline/jobs/:id/latex/regenerate-section", func(c *fiber.Ctx) error {
+		return handlePipelineRegenerateSection(c)
+	})
+
 	server.Route.Post("/api/v1/pipeline/jobs/:id/abort", func(c *fiber.Ctx) error {
 		return handlePipelineAbort(c)
 	})
@@ -62,21 +129,156 @@ func PipelineIndex() error {
 		return handlePipelineRetry(c)
 	})
 
+	// Admin-only: run one pipeline step of any job, for troubleshooting
+	server.Route.Post("/api/v1/admin/jobs/:id/step", func(c *fiber.Ctx) error {
+		return handlePipelineDebugStep(c)
+	})
+
+	server.Route.Get("/api/v1/admin/pipeline/stats", func(c *fiber.Ctx) error {
+		return handlePipelineStats(c)
+	})
+
+	// Admin-only: recompile stored LaTeX after a style or template change
+	server.Route.Post("/api/v1/admin/recompile", func(c *fiber.Ctx) error {
+		return handleAdminRecompile(c)
+	})
+
 	return nil
 }
 
+// handlePipelineDesign returns just the job's design, for reviewing it
+// without fetching the whole job and its LaTeX
+func handlePipelineDesign(c *fiber.Ctx) error {
+	job, _, err := getPipelineJobForUser(c)
+	if err != nil {
+		return err
+	}
+
+	sources, _ := pipeline.WebSourcesFromJob(job)
+	options, _ := pipeline.DesignOptionsFromJob(job)
+	return c.JSON(fiber.Map{
+		"jobId":         job.ID.String(),
+		"status":        job.Status,
+		"currentStep":   job.CurrentStep,
+		"design":        job.Design,
+		"webSources":    sources,
+		"designOptions": options,
+	})
+}
+
+// handlePipelineRegenerateWithSources generates the design again from the
+// web search results the user chose to keep
+func handlePipelineRegenerateWithSources(c *fiber.Ctx) error {
+	job, _, err := getPipelineJobForUser(c)
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		URLs []string `json:"urls"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+	switch job.Status {
+	case pipeline.StatusPending, pipeline.StatusRunning, pipeline.StatusWaitingAIFix:
+		return c.Status(409).JSON(fiber.Map{"error": "job is still being processed"})
+	}
+
+	if err := pipeline.SelectWebSources(job, body.URLs); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := sheet.GlobalPipelineStore.SaveJob(job); err != nil {
+		return saveJobError(c, err)
+	}
+
+	sheet.GlobalPipelineQueue.EmitUpdate(job, "Regenerating design from the selected web sources", ws.Stage("Design", "Sources selected", map[string]interface{}{"sources": len(body.URLs)})["data"].(map[string]interface{}))
+	_ = sheet.GlobalPipelineQueue.Enqueue(job.ID)
+
+	return c.JSON(fiber.Map{"status": "queued", "jobId": job.ID.String()})
+}
+
+// handlePipelineAddDetails adds detail to the request of a job the design
+// step stopped for being too vague, and runs the design again
+func handlePipelineAddDetails(c *fiber.Ctx) error {
+	job, _, err := getPipelineJobForUser(c)
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		Details string `json:"details"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+	if strings.TrimSpace(body.Details) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "details required"})
+	}
+	// A job waiting on its design review has a design; refine that instead
+	if job.Status != pipeline.StatusWaitingManual || job.CurrentStep != pipeline.StepDesign || strings.TrimSpace(job.Design) != "" || pipeline.AwaitingDesignChoice(job) {
+		return c.Status(409).JSON(fiber.Map{"error": "job is not waiting for request details"})
+	}
+
+	if err := sheet.GlobalPipelineQueue.AddRequestDetails(job, body.Details); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := sheet.GlobalPipelineStore.SaveJob(job); err != nil {
+		return saveJobError(c, err)
+	}
+
+	sheet.GlobalPipelineQueue.EmitUpdate(job, "Details added, generating design", ws.Stage("Design", "Details added", nil)["data"].(map[string]interface{}))
+	_ = sheet.GlobalPipelineQueue.Enqueue(job.ID)
+
+	return c.JSON(fiber.Map{"status": "queued", "jobId": job.ID.String()})
+}
+
+// handlePipelineDesignSelect picks one of the alternative designs a job was
+// parked with and moves it on to LaTeX
+func handlePipelineDesignSelect(c *fiber.Ctx) error {
+	job, _, err := getPipelineJobForUser(c)
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		Option *int `json:"option"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Option == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "option required"})
+	}
+	if !pipeline.AwaitingDesignChoice(job) {
+		return c.Status(409).JSON(fiber.Map{"error": "job is not waiting for a design choice"})
+	}
+
+	if err := sheet.GlobalPipelineQueue.SelectDesignOption(job, *body.Option); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := sheet.GlobalPipelineStore.SaveJob(job); err != nil {
+		return saveJobError(c, err)
+	}
+
+	sheet.GlobalPipelineQueue.EmitUpdate(job, "Design chosen, generating LaTeX", ws.Stage("Design", "Chosen", map[string]interface{}{"option": *body.Option})["data"].(map[string]interface{}))
+	_ = sheet.GlobalPipelineQueue.Enqueue(job.ID)
+
+	return c.JSON(fiber.Map{"status": "queued", "jobId": job.ID.String(), "option": *body.Option})
+}
+
 func handlePipelineDesignApprove(c *fiber.Ctx) error {
 	job, _, err := getPipelineJobForUser(c)
 	if err != nil {
 		return err
 	}
+	if strings.TrimSpace(job.Design) == "" {
+		return c.Status(409).JSON(fiber.Map{"error": "job has no design to approve"})
+	}
 
 	job.CurrentStep = pipeline.StepLatex
 	job.Status = pipeline.StatusPending
 	job.UpdatedAt = time.Now()
 
 	if err := sheet.GlobalPipelineStore.SaveJob(job); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to save job"})
+		return saveJobError(c, err)
 	}
 
 	sheet.GlobalPipelineQueue.EmitUpdate(job, "Design approved, generating LaTeX", ws.Stage("Design", "Approved", nil)["data"].(map[string]interface{}))
@@ -110,22 +312,39 @@ func handlePipelineDesignRefine(c *fiber.Ctx) error {
 	}
 
 	prompt := fmt.Sprintf("Refine the design based on this feedback: %s\n\nCurrent design:\n%s", refinement, job.Design)
-	refined, err := pipeline.RefinePrompt(context.Background(), conv, prompt)
+	usage := ai.NewUsageTracker()
+	refined, err := pipeline.RefinePrompt(ai.WithUsageTracker(context.Background(), usage), conv, prompt)
+	job.AddUsage(usage)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to refine design"})
 	}
 
 	job.Design = refined
+	// Free-text refinement supersedes any structured spec
+	delete(job.Metadata, "designSpec")
+	_ = sheet.GlobalPipelineStore.SaveConversation(conv)
+
+	// Auto-approved jobs skip the review gate and go straight to LaTeX
+	if job.IsAutoApprove() {
+		job.CurrentStep = pipeline.StepLatex
+		job.Status = pipeline.StatusPending
+		job.UpdatedAt = time.Now()
+		if err := sheet.GlobalPipelineStore.SaveJob(job); err != nil {
+			return saveJobError(c, err)
+		}
+		sheet.GlobalPipelineQueue.EmitUpdate(job, "Design refined, generating LaTeX", ws.Stage("Design", "Refined", nil)["data"].(map[string]interface{}))
+		_ = sheet.GlobalPipelineQueue.Enqueue(job.ID)
+		return c.JSON(fiber.Map{"status": "queued", "jobId": job.ID.String()})
+	}
+
 	job.Status = pipeline.StatusWaitingManual
 	job.CurrentStep = pipeline.StepDesign
 	job.UpdatedAt = time.Now()
 
 	if err := sheet.GlobalPipelineStore.SaveJob(job); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to save job"})
+		return saveJobError(c, err)
 	}
 
-	_ = sheet.GlobalPipelineStore.SaveConversation(conv)
-
 	reviewData := ws.Review_output(
 		"Design Review",
 		fmt.Sprintf("```text\n%s\n```", refined),
@@ -144,6 +363,38 @@ func handlePipelineDesignRefine(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"status": "updated"})
 }
 
+func handlePipelineDesignSpecEdit(c *fiber.Ctx) error {
+	job, _, err := getPipelineJobForUser(c)
+	if err != nil {
+		return err
+	}
+
+	if job.CurrentStep != pipeline.StepDesign && job.CurrentStep != pipeline.StepLatex {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("cannot edit design at step: %s", job.CurrentStep)})
+	}
+
+	var spec pipeline.DesignSpec
+	if err := c.BodyParser(&spec); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+	if err := spec.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	job.SetDesignSpec(&spec)
+	job.UpdatedAt = time.Now()
+
+	if err := sheet.GlobalPipelineStore.SaveJob(job); err != nil {
+		return saveJobError(c, err)
+	}
+
+	sheet.GlobalPipelineQueue.EmitUpdate(job, "Design spec updated", ws.Stage("Design", "Spec edited", map[string]interface{}{
+		"designSpec": spec,
+	})["data"].(map[string]interface{}))
+
+	return c.JSON(fiber.Map{"status": "updated", "design": job.Design, "designSpec": spec})
+}
+
 func handlePipelineLatexApprove(c *fiber.Ctx) error {
 	job, _, err := getPipelineJobForUser(c)
 	if err != nil {
@@ -155,7 +406,7 @@ func handlePipelineLatexApprove(c *fiber.Ctx) error {
 	job.UpdatedAt = time.Now()
 
 	if err := sheet.GlobalPipelineStore.SaveJob(job); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to save job"})
+		return saveJobError(c, err)
 	}
 
 	sheet.GlobalPipelineQueue.EmitUpdate(job, "LaTeX approved, starting compilation", ws.Stage("LaTeX", "Approved", nil)["data"].(map[string]interface{}))
@@ -188,7 +439,7 @@ func handlePipelineLatexEdit(c *fiber.Ctx) error {
 	job.UpdatedAt = time.Now()
 
 	if err := sheet.GlobalPipelineStore.SaveJob(job); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to save job"})
+		return saveJobError(c, err)
 	}
 
 	sheet.GlobalPipelineQueue.EmitUpdate(job, "LaTeX updated, starting compilation", ws.Stage("LaTeX", "Edited", nil)["data"].(map[string]interface{}))
@@ -221,22 +472,37 @@ func handlePipelineLatexFix(c *fiber.Ctx) error {
 		_ = sheet.GlobalPipelineStore.SaveConversation(conv)
 	}
 
-	fixed, err := pipeline.FixLatex(context.Background(), conv, job.Latex, errorLog)
+	usage := ai.NewUsageTracker()
+	fixed, err := pipeline.FixLatex(ai.WithUsageTracker(context.Background(), usage), conv, job.Latex, errorLog)
+	job.AddUsage(usage)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to fix latex"})
 	}
 
 	job.Latex = fixed
+	_ = sheet.GlobalPipelineStore.SaveConversation(conv)
+
+	// Auto-approved jobs skip the review gate and go straight to compilation
+	if job.IsAutoApprove() {
+		job.CurrentStep = pipeline.StepCompile
+		job.Status = pipeline.StatusPending
+		job.UpdatedAt = time.Now()
+		if err := sheet.GlobalPipelineStore.SaveJob(job); err != nil {
+			return saveJobError(c, err)
+		}
+		sheet.GlobalPipelineQueue.EmitUpdate(job, "LaTeX fixed, starting compilation", ws.Stage("LaTeX", "Fixed", nil)["data"].(map[string]interface{}))
+		_ = sheet.GlobalPipelineQueue.Enqueue(job.ID)
+		return c.JSON(fiber.Map{"status": "queued", "jobId": job.ID.String()})
+	}
+
 	job.Status = pipeline.StatusWaitingManual
 	job.CurrentStep = pipeline.StepLatex
 	job.UpdatedAt = time.Now()
 
 	if err := sheet.GlobalPipelineStore.SaveJob(job); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to save job"})
+		return saveJobError(c, err)
 	}
 
-	_ = sheet.GlobalPipelineStore.SaveConversation(conv)
-
 	reviewData := ws.Review_output(
 		"LaTeX Review",
 		fmt.Sprintf("```latex\n%s\n```", fixed),
@@ -255,26 +521,151 @@ func handlePipelineLatexFix(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"status": "updated"})
 }
 
-func handlePipelineAbort(c *fiber.Ctx) error {
+// handlePipelineRegenerateSection rewrites one \section of a completed job,
+// picked by number or title, and recompiles it. The response carries the
+// new PDF URL; on failure the previous version is kept.
+func handlePipelineRegenerateSection(c *fiber.Ctx) error {
 	job, _, err := getPipelineJobForUser(c)
 	if err != nil {
 		return err
 	}
 
+	var body struct {
+		Section     interface{} `json:"section"`
+		Instruction string      `json:"instruction"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+
+	section := ""
+	if body.Section != nil {
+		section = strings.TrimSpace(fmt.Sprint(body.Section))
+	}
+	instruction := strings.TrimSpace(body.Instruction)
+	if section == "" || instruction == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "section and instruction required"})
+	}
+
+	result, err := sheet.GlobalPipelineQueue.RegenerateSection(context.Background(), job.ID, section, instruction)
+	switch {
+	case errors.Is(err, pipeline.ErrSectionNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": err.Error(), "sections": pipeline.LatexSections(job.Latex)})
+	case errors.Is(err, pipeline.ErrNotCompleted):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "completed",
+		"jobId":   job.ID.String(),
+		"section": result.Section,
+		"pdfUrl":  responseStorageURL(result.Job.PDFURL),
+		"latex":   result.Job.Latex,
+	})
+}
+
+func handlePipelineAbort(c *fiber.Ctx) error {
+	job, username, err := getPipelineJobForUser(c)
+	if err != nil {
+		return err
+	}
+
+	// A worker holds a running job's lock, so it is stopped through the
+	// queue and marked aborted by the worker itself
+	aborting := func() error {
+		recordAudit(username, auditJobAbort, job.ID.String())
+		return c.Status(202).JSON(fiber.Map{"status": "aborting"})
+	}
+	if sheet.GlobalPipelineQueue.AbortRunningJob(job.ID) {
+		return aborting()
+	}
+
 	job.Status = pipeline.StatusAborted
 	job.UpdatedAt = time.Now()
 
 	if err := sheet.GlobalPipelineStore.SaveJob(job); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to save job"})
+		// A worker may have picked the job up since it was read
+		if errors.Is(err, pipeline.ErrJobBusy) && sheet.GlobalPipelineQueue.AbortRunningJob(job.ID) {
+			return aborting()
+		}
+		return saveJobError(c, err)
 	}
 
 	sheet.GlobalPipelineQueue.EmitUpdate(job, "Job aborted", ws.Error("Job aborted", "Aborted by user", map[string]interface{}{})["data"].(map[string]interface{}))
+	recordAudit(username, auditJobAbort, job.ID.String())
 
 	return c.JSON(fiber.Map{"status": "aborted"})
 }
 
+func handlePipelineDebugStep(c *fiber.Ctx) error {
+	if _, err := getAdminFromAuth(c); err != nil {
+		return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{"error": err.Error()})
+	}
+	if sheet.GlobalPipelineQueue == nil {
+		return c.Status(500).JSON(fiber.Map{"error": "pipeline not initialized"})
+	}
+
+	jobID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid job id"})
+	}
+
+	result, err := sheet.GlobalPipelineQueue.ExecuteStep(context.Background(), jobID)
+	switch {
+	case errors.Is(err, pipeline.ErrJobRunning), errors.Is(err, pipeline.ErrJobDone):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(404).JSON(fiber.Map{"error": "job not found"})
+	}
+
+	return c.JSON(result)
+}
+
+// handlePipelineStats reports queue depth, running jobs and stuck-job counts
+func handlePipelineStats(c *fiber.Ctx) error {
+	if _, err := getAdminFromAuth(c); err != nil {
+		return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{"error": err.Error()})
+	}
+	if sheet.GlobalPipelineQueue == nil {
+		return c.Status(500).JSON(fiber.Map{"error": "pipeline not initialized"})
+	}
+
+	return c.JSON(sheet.GlobalPipelineQueue.Stats())
+}
+
+func handleAdminRecompile(c *fiber.Ctx) error {
+	if _, err := getAdminFromAuth(c); err != nil {
+		return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{"error": err.Error()})
+	}
+	if sheet.GlobalPipelineQueue == nil {
+		return c.Status(500).JSON(fiber.Map{"error": "pipeline not initialized"})
+	}
+
+	var filter pipeline.RecompileFilter
+	if err := c.BodyParser(&filter); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+	filter.Style = strings.TrimSpace(filter.Style)
+	filter.Tag = strings.TrimSpace(filter.Tag)
+	if filter.Style == "" && filter.Tag == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "style or tag required"})
+	}
+
+	stats, err := sheet.GlobalPipelineQueue.StartRecompile(filter)
+	if errors.Is(err, pipeline.ErrRecompileRunning) {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start recompile"})
+	}
+
+	return c.Status(202).JSON(stats)
+}
+
 func handlePipelineRetry(c *fiber.Ctx) error {
-	job, _, err := getPipelineJobForUser(c)
+	job, username, err := getPipelineJobForUser(c)
 	if err != nil {
 		return err
 	}
@@ -284,6 +675,14 @@ func handlePipelineRetry(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("cannot retry job in state: %s", job.Status)})
 	}
 
+	switch c.Query("from", "start") {
+	case "start":
+	case "current":
+		return resumePipelineJob(c, job, username)
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "from must be start or current"})
+	}
+
 	// Reset the job to re-run from the beginning
 	job.Status = pipeline.StatusPending
 	job.CurrentStep = pipeline.StepPrompt
@@ -297,11 +696,14 @@ func handlePipelineRetry(c *fiber.Ctx) error {
 	job.UpdatedAt = time.Now()
 
 	if err := sheet.GlobalPipelineStore.SaveJob(job); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to save job"})
+		return saveJobError(c, err)
 	}
 
-	// Create a fresh conversation
+	// Create a fresh conversation, keeping any context from a parent job
 	conv := pipeline.NewConversation(job.ID)
+	if old, err := sheet.GlobalPipelineStore.GetConversationByJobID(job.ID); err == nil {
+		conv = old.Restart()
+	}
 	_ = sheet.GlobalPipelineStore.SaveConversation(conv)
 
 	sheet.GlobalPipelineQueue.EmitUpdate(job, "Job retrying from scratch", ws.Stage("Pipeline", "Retrying", nil)["data"].(map[string]interface{}))
@@ -309,10 +711,130 @@ func handlePipelineRetry(c *fiber.Ctx) error {
 	if err := sheet.GlobalPipelineQueue.Enqueue(job.ID); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to enqueue retry"})
 	}
+	recordAudit(username, auditJobRetry, job.ID.String())
 
 	return c.JSON(fiber.Map{"status": "retrying", "jobId": job.ID.String()})
 }
 
+// resumePipelineJob retries a failed job from the step that failed, keeping
+// the design and LaTeX it already has and its conversation
+func resumePipelineJob(c *fiber.Ctx, job *pipeline.Job, username string) error {
+	step := pipeline.ResumeStep(job)
+	job.ResetToStep(step)
+	job.RetryCount = 0
+	job.PDFURL = ""
+	job.CompletedAt = nil
+
+	if err := sheet.GlobalPipelineStore.SaveJob(job); err != nil {
+		return saveJobError(c, err)
+	}
+
+	sheet.GlobalPipelineQueue.EmitUpdate(job, fmt.Sprintf("Job resuming from the %s step", step), ws.Stage("Pipeline", "Resuming", map[string]interface{}{"from": step})["data"].(map[string]interface{}))
+
+	if err := sheet.GlobalPipelineQueue.Enqueue(job.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to enqueue retry"})
+	}
+	recordAudit(username, auditJobRetry, job.ID.String())
+
+	return c.JSON(fiber.Map{"status": "retrying", "jobId": job.ID.String(), "from": step})
+}
+
+// handlePipelineLabels adds (POST) or removes (DELETE) labels on a job. The
+// body is {"labels": [...]}; DELETE also accepts ?label= for a single label.
+func handlePipelineLabels(c *fiber.Ctx, add bool) error {
+	job, _, err := getPipelineJobForUser(c)
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		Labels []string `json:"labels"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+		}
+	}
+	if label := c.Query("label"); label != "" {
+		body.Labels = append(body.Labels, label)
+	}
+	if len(body.Labels) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "labels is required"})
+	}
+
+	var updated *pipeline.Job
+	if add {
+		updated, err = sheet.GlobalPipelineStore.UpdateJobLabels(job.ID, body.Labels, nil)
+	} else {
+		updated, err = sheet.GlobalPipelineStore.UpdateJobLabels(job.ID, nil, body.Labels)
+	}
+	if errors.Is(err, pipeline.ErrJobBusy) {
+		return saveJobError(c, err)
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	labels := updated.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+	return c.JSON(fiber.Map{"jobId": job.ID.String(), "labels": labels})
+}
+
+// handlePipelineLabelList returns the caller's labels with job counts
+func handlePipelineLabelList(c *fiber.Ctx) error {
+	if sheet.GlobalPipelineStore == nil {
+		return c.Status(500).JSON(fiber.Map{"error": "pipeline not initialized"})
+	}
+	username, err := getUsernameFromAuth(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	counts, err := sheet.GlobalPipelineStore.UserLabels(username)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to load labels"})
+	}
+	return c.JSON(counts)
+}
+
+func handlePipelineRelated(c *fiber.Ctx) error {
+	job, username, err := getPipelineJobForUser(c)
+	if err != nil {
+		return err
+	}
+
+	limit := c.QueryInt("limit", pipeline.DefaultRelatedLimit)
+	if limit > 50 {
+		limit = 50
+	}
+
+	// Notebook membership is keyed by PDF file name; a failure here only
+	// loses that signal
+	var inNotebooks map[string][]string
+	if notebooks, err := notebook.GetAllNotebooks(username); err == nil {
+		inNotebooks = make(map[string][]string)
+		for _, nb := range notebooks {
+			for _, url := range nb.Items {
+				name := path.Base(url)
+				inNotebooks[name] = append(inNotebooks[name], nb.Name)
+			}
+		}
+	}
+
+	related, err := sheet.GlobalPipelineStore.RelatedJobs(job, inNotebooks, limit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to find related jobs"})
+	}
+	for i := range related {
+		related[i].PDFURL = responseStorageURL(related[i].PDFURL)
+		related[i].ThumbnailURL = responseStorageURL(related[i].ThumbnailURL)
+	}
+
+	return c.JSON(fiber.Map{"jobId": job.ID.String(), "related": related})
+}
+
 func getPipelineJobForUser(c *fiber.Ctx) (*pipeline.Job, string, error) {
 	if sheet.GlobalPipelineStore == nil || sheet.GlobalPipelineQueue == nil {
 		return nil, "", c.Status(500).JSON(fiber.Map{"error": "pipeline not initialized"})
@@ -335,3 +857,142 @@ func getPipelineJobForUser(c *fiber.Ctx) (*pipeline.Job, string, error) {
 
 	return job, username, nil
 }
+
+// handlePipelineCompare returns two of the caller's jobs side by side, with
+// a diff of their LaTeX and the differences in request and analytics
+func handlePipelineCompare(c *fiber.Ctx) error {
+	if sheet.GlobalPipelineStore == nil {
+		return c.Status(500).JSON(fiber.Map{"error": "pipeline not initialized"})
+	}
+
+	username, err := getUsernameFromAuth(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	idA, errA := uuid.Parse(c.Query("a"))
+	idB, errB := uuid.Parse(c.Query("b"))
+	if errA != nil || errB != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "query parameters a and b must be job ids"})
+	}
+
+	jobs := make([]*pipeline.Job, 0, 2)
+	for _, id := range []uuid.UUID{idA, idB} {
+		job, err := sheet.GlobalPipelineStore.GetJob(id)
+		if err != nil || job.UserID != username {
+			return c.Status(404).JSON(fiber.Map{"error": fmt.Sprintf("job %s not found", id)})
+		}
+		jobs = append(jobs, job)
+	}
+
+	return c.JSON(pipeline.CompareJobs(jobs[0], jobs[1]))
+}
+
+// handlePipelineJobPosition reports where the caller's job is in the queue
+// and roughly how long until it starts
+func handlePipelineJobPosition(c *fiber.Ctx) error {
+	job, _, err := getPipelineJobForUser(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"jobId":    job.ID.String(),
+		"status":   job.Status,
+		"position": sheet.GlobalPipelineQueue.Position(job.ID),
+	})
+}
+
+// saveJobError answers a failed SaveJob. A job that is being processed or
+// was changed since it was read is a conflict the client can retry.
+func saveJobError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, pipeline.ErrJobBusy) || errors.Is(err, pipeline.ErrStaleJob) {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": "failed to save job"})
+}
+
+// streamHeartbeatInterval is how often an idle job stream writes a heartbeat
+// line, which also detects clients that have gone away
+const streamHeartbeatInterval = 15 * time.Second
+
+// handlePipelineJobStream streams a job's status updates as newline-delimited
+// JSON for clients that can't use the websocket. The first line is the
+// current status; the response ends once the job reaches a terminal state.
+func handlePipelineJobStream(c *fiber.Ctx) error {
+	username, err := getUsernameFromAuth(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	if sheet.GlobalPipelineStore == nil || sheet.GlobalPipelineQueue == nil {
+		return c.Status(500).JSON(fiber.Map{"error": "pipeline not initialized"})
+	}
+
+	jobID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid job id"})
+	}
+
+	// Subscribe before reading the job so no update can slip in between
+	updates := make(chan pipeline.StatusUpdate, 64)
+	unsubscribe := sheet.GlobalPipelineQueue.SubscribeJob(jobID, func(update pipeline.StatusUpdate) {
+		select {
+		case updates <- update:
+		default:
+		}
+	})
+
+	job, err := sheet.GlobalPipelineStore.GetJob(jobID)
+	if err != nil || job.UserID != username {
+		unsubscribe()
+		return c.Status(404).JSON(fiber.Map{"error": "job not found"})
+	}
+
+	initial := pipeline.StatusUpdate{
+		JobID:     job.ID,
+		Status:    job.Status,
+		Step:      job.CurrentStep,
+		Message:   fmt.Sprintf("Job %s is %s", job.ID.String(), job.Status),
+		Timestamp: job.UpdatedAt,
+		Seq:       sheet.GlobalPipelineQueue.LastUpdateSeq(job.ID),
+	}
+
+	c.Set("Content-Type", "application/x-ndjson")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		enc := json.NewEncoder(w)
+		write := func(v interface{}) bool {
+			if err := enc.Encode(v); err != nil {
+				return false
+			}
+			return w.Flush() == nil
+		}
+
+		if !write(initial) || initial.Status.IsTerminal() {
+			return
+		}
+
+		ticker := time.NewTicker(streamHeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case update := <-updates:
+				if !write(update) || update.Status.IsTerminal() {
+					return
+				}
+			case <-ticker.C:
+				if !write(fiber.Map{"jobId": jobID.String(), "type": "heartbeat", "timestamp": time.Now()}) {
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
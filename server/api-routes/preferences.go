@@ -0,0 +1,57 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"nadhi.dev/sarvar/fun/ai"
+	store "nadhi.dev/sarvar/fun/database"
+	"nadhi.dev/sarvar/fun/db"
+	"nadhi.dev/sarvar/fun/server"
+)
+
+// PreferencesIndex registers the per-user preference routes
+func PreferencesIndex() error {
+	server.Route.Get("/api/v1/preferences", func(c *fiber.Ctx) error {
+		username, err := getUsernameFromAuth(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		user, err := store.GetUser(db.UsersDB, username)
+		if err != nil || user == nil {
+			return c.Status(404).JSON(fiber.Map{"error": "user not found"})
+		}
+		return c.JSON(user.Preferences)
+	})
+
+	server.Route.Put("/api/v1/preferences", func(c *fiber.Ctx) error {
+		username, err := getUsernameFromAuth(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		var body store.UserPreferences
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+		}
+
+		body.DefaultMode = strings.TrimSpace(body.DefaultMode)
+		body.DefaultStyle = strings.TrimSpace(body.DefaultStyle)
+
+		if body.DefaultMode != "" && !ai.IsValidMode(body.DefaultMode) {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid mode", "validModes": ai.ModeNames()})
+		}
+		if body.DefaultStyle != "" {
+			if style, err := store.GetStyle(db.StylesDB, username, body.DefaultStyle); err != nil || style == nil {
+				return c.Status(400).JSON(fiber.Map{"error": "style not found"})
+			}
+		}
+
+		if err := store.UpdateUserPreferences(db.UsersDB, username, body); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to save preferences"})
+		}
+		recordAudit(username, auditPreferencesUpdate, username)
+		return c.JSON(body)
+	})
+
+	return nil
+}
@@ -3,12 +3,14 @@ package api
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -20,9 +22,12 @@ import (
 	"nadhi.dev/sarvar/fun/ai"
 	"nadhi.dev/sarvar/fun/auth"
 	vela "nadhi.dev/sarvar/fun/bucket"
+	"nadhi.dev/sarvar/fun/config"
+	notebook "nadhi.dev/sarvar/fun/notebooks"
 	"nadhi.dev/sarvar/fun/pipeline"
 	"nadhi.dev/sarvar/fun/server"
 	sheet "nadhi.dev/sarvar/fun/sheets"
+	"nadhi.dev/sarvar/fun/websearch"
 )
 
 // Sheet represents the sheet data structure
@@ -48,6 +53,16 @@ func parseCreateSheetMultipart(c *fiber.Ctx, req *struct {
 	Mode                string          `json:"mode"`
 	WebSearchQuery      string          `json:"webSearchQuery"`
 	WebSearchEnabled    bool            `json:"webSearchEnabled"`
+	WebSearchLimit      int             `json:"webSearchLimit"`
+	AutoApprove         bool            `json:"autoApprove"`
+	StructuredDesign    bool            `json:"structuredDesign"`
+	SplitAnswerKey      bool            `json:"splitAnswerKey"`
+	OptimizePrompt      bool            `json:"optimizePrompt"`
+	SelfReview          bool            `json:"selfReview"`
+	ParentJobID         string          `json:"parentJobId"`
+	StatusWebhookURL    string          `json:"statusWebhookUrl"`
+	Language            string          `json:"language"`
+	NotebookID          int             `json:"notebookId"`
 	Attachments         []ai.Attachment `json:"attachments"`
 }) error {
 	form, err := c.MultipartForm()
@@ -73,6 +88,28 @@ func parseCreateSheetMultipart(c *fiber.Ctx, req *struct {
 	req.Mode = getValue("mode")
 	req.WebSearchQuery = getValue("webSearchQuery")
 	req.WebSearchEnabled = strings.ToLower(getValue("webSearchEnabled")) == "true"
+	if v := strings.TrimSpace(getValue("webSearchLimit")); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid webSearchLimit")
+		}
+		req.WebSearchLimit = limit
+	}
+	req.AutoApprove = strings.ToLower(getValue("autoApprove")) == "true"
+	req.StructuredDesign = strings.ToLower(getValue("structuredDesign")) == "true"
+	req.SplitAnswerKey = strings.ToLower(getValue("splitAnswerKey")) == "true"
+	req.OptimizePrompt = strings.ToLower(getValue("optimizePrompt")) == "true"
+	req.SelfReview = strings.ToLower(getValue("selfReview")) == "true"
+	req.ParentJobID = getValue("parentJobId")
+	req.StatusWebhookURL = getValue("statusWebhookUrl")
+	req.Language = getValue("language")
+	if v := strings.TrimSpace(getValue("notebookId")); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid notebookId")
+		}
+		req.NotebookID = id
+	}
 
 	files := []*multipart.FileHeader{}
 	if fileList, ok := form.File["files"]; ok {
@@ -98,13 +135,73 @@ func parseCreateSheetMultipart(c *fiber.Ctx, req *struct {
 	if err != nil {
 		return err
 	}
+	if err := applyAttachmentMeta(attachments, files, getValue("attachmentMeta")); err != nil {
+		return err
+	}
 	req.Attachments = attachments
 
 	return nil
 }
 
+// attachmentMeta is the per-file metadata of a multipart upload
+type attachmentMeta struct {
+	Role        string `json:"role"`
+	Description string `json:"description"`
+	Order       int    `json:"order"`
+}
+
+// applyAttachmentMeta sets roles and descriptions from the attachmentMeta
+// form field: a JSON object keyed by file name whose values are a role, as
+// in {"past-paper.pdf": "template"}, or an object with role, description
+// and order.
+// Naming a file that wasn't uploaded is an error, to catch typos.
+func applyAttachmentMeta(attachments []ai.Attachment, files []*multipart.FileHeader, raw string) error {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &entries); err != nil {
+		return fmt.Errorf("invalid attachmentMeta: must be a JSON object keyed by file name")
+	}
+
+	for name, value := range entries {
+		var meta attachmentMeta
+		if err := json.Unmarshal(value, &meta.Role); err != nil {
+			if err := json.Unmarshal(value, &meta); err != nil {
+				return fmt.Errorf("invalid attachmentMeta for %s", name)
+			}
+		}
+		role, err := ai.NormalizeAttachmentRole(meta.Role)
+		if err != nil {
+			return fmt.Errorf("attachmentMeta for %s: %v", name, err)
+		}
+		if meta.Order < 0 {
+			return fmt.Errorf("attachmentMeta for %s: order must not be negative", name)
+		}
+
+		uploaded := false
+		for _, fh := range files {
+			uploaded = uploaded || fh.Filename == name
+		}
+		if !uploaded {
+			return fmt.Errorf("attachmentMeta names a file that was not uploaded: %s", name)
+		}
+		for i := range attachments {
+			if attachments[i].Name == name {
+				attachments[i].Role = role
+				attachments[i].Description = strings.TrimSpace(meta.Description)
+				attachments[i].Order = meta.Order
+			}
+		}
+	}
+	return nil
+}
+
+// parseAttachments reads uploaded files into attachments. A file uploaded
+// more than once (same content, whatever its name) is only kept once.
 func parseAttachments(files []*multipart.FileHeader) ([]ai.Attachment, error) {
 	attachments := make([]ai.Attachment, 0, len(files))
+	seen := make(map[string]bool, len(files))
 	for _, fh := range files {
 		file, err := fh.Open()
 		if err != nil {
@@ -116,6 +213,12 @@ func parseAttachments(files []*multipart.FileHeader) ([]ai.Attachment, error) {
 			return nil, fmt.Errorf("failed to read file: %s", fh.Filename)
 		}
 
+		hash := ai.ContentHash(data)
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
 		mimeType := fh.Header.Get("Content-Type")
 		if mimeType == "" {
 			mimeType = http.DetectContentType(data)
@@ -141,6 +244,7 @@ func parseAttachments(files []*multipart.FileHeader) ([]ai.Attachment, error) {
 			Size:     fh.Size,
 			Content:  content,
 			Encoding: encoding,
+			Hash:     hash,
 		})
 	}
 
@@ -166,6 +270,7 @@ func SheetsIndex() error {
 	}
 
 	server.Route.Post("/api/v1/sheets/generate-tags", generateTags)
+	server.Route.Post("/api/v1/sheets/suggest-tags", suggestTags)
 	server.Route.Post("/api/v1/sheets/generate-subject", generateSubject)
 	server.Route.Post("/api/v1/sheets/generate-course", generateCourse)
 	server.Route.Post("/api/v1/sheets/generate-description", generateDescription)
@@ -178,6 +283,7 @@ func SheetsIndex() error {
 		if sheet.GlobalPipelineStore != nil {
 			if jobID, err := parsePipelineJobID(id); err == nil {
 				if err := sheet.GlobalPipelineStore.DeleteJob(jobID); err == nil {
+					recordAudit(auditUser(c), auditJobDelete, id)
 					return c.JSON(fiber.Map{"status": "deleted"})
 				}
 			}
@@ -190,12 +296,14 @@ func SheetsIndex() error {
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 		}
+		recordAudit(auditUser(c), auditJobDelete, id)
 		return c.JSON(fiber.Map{"status": "deleted"})
 	})
 
 	server.Route.Get("/api/v1/sheets/get", func(c *fiber.Ctx) error {
 		// Query params
 		search := c.Query("search", "")
+		label := c.Query("label", "")
 		latest := c.Query("latest", "true") == "true"
 		objNumStr := c.Query("obj_num", "10")
 		objNum, err := strconv.Atoi(objNumStr)
@@ -204,8 +312,18 @@ func SheetsIndex() error {
 		}
 
 		if sheet.GlobalPipelineStore != nil {
-			items, err := getPipelineQueueItems(search, latest, objNum)
+			if label != "" {
+				normalized, err := pipeline.NormalizeLabel(label)
+				if err != nil {
+					return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+				}
+				label = normalized
+			}
+			items, err := getPipelineQueueItems(search, label, latest, objNum)
 			if err == nil {
+				if wantsCSV(c) {
+					return sendJobsCSV(c, queueItemsCSVRows(items))
+				}
 				return c.JSON(items)
 			}
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to read pipeline jobs"})
@@ -216,10 +334,74 @@ func SheetsIndex() error {
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to get queue items"})
 		}
+		for i := range items {
+			items[i].Result = responseResult(items[i].Result)
+		}
+		if wantsCSV(c) {
+			return sendJobsCSV(c, legacyItemsCSVRows(items))
+		}
 		return c.JSON(items)
 	})
 
-	server.Route.Post("/api/v1/sheets/create", func(c *fiber.Ctx) error {
+	server.Route.Post("/api/v1/sheets/create", createSheetHandler(false))
+
+	// Quick generate runs prompt→design→latex→compile without review gates
+	server.Route.Post("/api/v1/sheets/quick", createSheetHandler(true))
+
+	server.Route.Get("/api/v1/sheets/queue", func(c *fiber.Ctx) error {
+		userID := c.Locals("username")
+		if userID == nil {
+			userID = "anonymous"
+		}
+
+		if sheet.GlobalPipelineStore != nil {
+			if label := c.Query("label"); label != "" {
+				jobs, err := sheet.GlobalPipelineStore.GetJobsByLabel(userID.(string), label)
+				if err != nil {
+					return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+				}
+				if jobs == nil {
+					jobs = []*pipeline.Job{}
+				}
+				jobs = responseJobs(jobs)
+				if wantsCSV(c) {
+					return sendJobsCSV(c, pipelineJobsCSVRows(jobs))
+				}
+				return c.JSON(jobs)
+			}
+			jobs, err := sheet.GlobalPipelineStore.GetJobsByUser(userID.(string))
+			if err == nil {
+				jobs = responseJobs(jobs)
+				if wantsCSV(c) {
+					return sendJobsCSV(c, pipelineJobsCSVRows(jobs))
+				}
+				return c.JSON(jobs)
+			}
+		}
+
+		if sheet.GlobalSheetGenerator == nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Sheet generator not initialized"})
+		}
+		jobs, err := sheet.GlobalSheetGenerator.GetUserJobs(userID.(string))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to get queue"})
+		}
+		for i := range jobs {
+			jobs[i].Result = responseResult(jobs[i].Result)
+		}
+		if wantsCSV(c) {
+			return sendJobsCSV(c, sheetJobsCSVRows(jobs))
+		}
+		return c.JSON(jobs)
+	})
+
+	return nil
+}
+
+// createSheetHandler builds the sheet creation handler. When quick is set the
+// job is always auto-approved, regardless of what the request body says.
+func createSheetHandler(quick bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
 		var req struct {
 			Subject             string          `json:"subject"`
 			Course              string          `json:"course"`
@@ -232,6 +414,16 @@ func SheetsIndex() error {
 			Mode                string          `json:"mode"`
 			WebSearchQuery      string          `json:"webSearchQuery"`
 			WebSearchEnabled    bool            `json:"webSearchEnabled"`
+			WebSearchLimit      int             `json:"webSearchLimit"`
+			AutoApprove         bool            `json:"autoApprove"`
+			StructuredDesign    bool            `json:"structuredDesign"`
+			SplitAnswerKey      bool            `json:"splitAnswerKey"`
+			OptimizePrompt      bool            `json:"optimizePrompt"`
+			SelfReview          bool            `json:"selfReview"`
+			ParentJobID         string          `json:"parentJobId"`
+			StatusWebhookURL    string          `json:"statusWebhookUrl"`
+			Language            string          `json:"language"`
+			NotebookID          int             `json:"notebookId"`
 			Attachments         []ai.Attachment `json:"attachments"`
 		}
 		contentType := c.Get("Content-Type")
@@ -245,8 +437,42 @@ func SheetsIndex() error {
 			}
 		}
 
+		if quick {
+			req.AutoApprove = true
+		}
+
+		for i := range req.Attachments {
+			role, err := ai.NormalizeAttachmentRole(req.Attachments[i].Role)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("attachment %s: %v", req.Attachments[i].Name, err)})
+			}
+			req.Attachments[i].Role = role
+			if req.Attachments[i].Order < 0 {
+				return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("attachment %s: order must not be negative", req.Attachments[i].Name)})
+			}
+			if ai.AttachmentInjectionPolicy() == ai.InjectionPolicyReject {
+				if found := req.Attachments[i].FindInjection(); len(found) > 0 {
+					return c.Status(400).JSON(fiber.Map{
+						"error": fmt.Sprintf("attachment %s looks like it contains instructions to the AI", req.Attachments[i].Name),
+						"lines": found,
+					})
+				}
+			}
+		}
+
+		if req.WebSearchEnabled && config.IsLocalOnly() {
+			return c.Status(400).JSON(fiber.Map{"error": "web search is disabled in LOCAL_ONLY mode"})
+		}
+
+		req.StatusWebhookURL = strings.TrimSpace(req.StatusWebhookURL)
+		if req.StatusWebhookURL != "" && !isValidWebhookURL(req.StatusWebhookURL) {
+			return c.Status(400).JSON(fiber.Map{"error": "statusWebhookUrl must be an absolute http(s) URL"})
+		}
+
+		tags := normalizeTags(strings.Split(req.Tags, ","))
+
 		// Validate required fields
-		if req.Subject == "" || req.Course == "" || req.Description == "" || req.Tags == "" || req.Curriculum == "" || req.SpecialInstructions == "" || req.Visibility == "" {
+		if req.Subject == "" || req.Course == "" || req.Description == "" || len(tags) == 0 || req.Curriculum == "" || req.SpecialInstructions == "" || req.Visibility == "" {
 			return c.Status(400).JSON(fiber.Map{"error": "Invalid request: missing required fields"})
 		}
 
@@ -273,7 +499,7 @@ func SheetsIndex() error {
 			Subject:             req.Subject,
 			Course:              req.Course,
 			Description:         req.Description,
-			Tags:                strings.Split(req.Tags, ","), // Convert comma-separated string to slice
+			Tags:                tags,
 			Curriculum:          req.Curriculum,
 			SpecialInstructions: req.SpecialInstructions,
 			StyleName:           req.StyleName,
@@ -281,7 +507,48 @@ func SheetsIndex() error {
 			Mode:                req.Mode,
 			WebSearchQuery:      req.WebSearchQuery,
 			WebSearchEnabled:    req.WebSearchEnabled,
+			WebSearchLimit:      websearch.ClampLimit(req.WebSearchLimit),
 			Attachments:         req.Attachments,
+			AutoApprove:         req.AutoApprove,
+			StructuredDesign:    req.StructuredDesign,
+			SplitAnswerKey:      req.SplitAnswerKey,
+			OptimizePrompt:      req.OptimizePrompt,
+			SelfReview:          req.SelfReview,
+			Language:            strings.TrimSpace(req.Language),
+			NotebookID:          req.NotebookID,
+		}
+		// SAFE_MODE is enforced here and again when the job runs, so a
+		// crafted request can't bring attachments or web search back
+		safeMode := ai.ApplySafeMode(genRequest)
+
+		// Auto-filing needs the pipeline, and the notebook must be the user's
+		if req.NotebookID != 0 {
+			if sheet.GlobalPipelineStore == nil || sheet.GlobalPipelineQueue == nil {
+				return c.Status(400).JSON(fiber.Map{"error": "notebookId requires the pipeline"})
+			}
+			if nb, err := notebook.GetNotebook(userID, req.NotebookID); err != nil || nb == nil {
+				return c.Status(404).JSON(fiber.Map{"error": "notebook not found"})
+			}
+		}
+
+		// With REDACT_PII on, only a scrubbed copy is persisted; the pipeline
+		// generates from the original, held in memory
+		var original *ai.GenerationRequest
+		redactions := 0
+		if sheet.GlobalPipelineStore != nil && sheet.GlobalPipelineQueue != nil {
+			if stored, n := pipeline.PrepareRequestForStorage(genRequest); n > 0 {
+				original, genRequest, redactions = genRequest, stored, n
+			}
+		}
+
+		// Pipeline jobs carry references only; the bytes live once in the
+		// pipeline's content-addressed attachment store
+		if sheet.GlobalPipelineStore != nil && sheet.GlobalPipelineQueue != nil {
+			refs, err := sheet.GlobalPipelineStore.PutAttachments(genRequest.Attachments)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Failed to store attachments"})
+			}
+			genRequest.Attachments = refs
 		}
 
 		requestJSON, err := json.Marshal(genRequest)
@@ -289,18 +556,64 @@ func SheetsIndex() error {
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to build request"})
 		}
 
+		// Chained sheets need the pipeline, which keeps the conversations
+		var parentJobID uuid.UUID
+		if req.ParentJobID = strings.TrimSpace(req.ParentJobID); req.ParentJobID != "" {
+			if sheet.GlobalPipelineStore == nil || sheet.GlobalPipelineQueue == nil {
+				return c.Status(400).JSON(fiber.Map{"error": "parentJobId requires the pipeline"})
+			}
+			parentJobID, err = uuid.Parse(req.ParentJobID)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": "invalid parentJobId"})
+			}
+			parent, err := sheet.GlobalPipelineStore.GetJob(parentJobID)
+			if err != nil || parent.UserID != userID {
+				return c.Status(404).JSON(fiber.Map{"error": "parent job not found"})
+			}
+		}
+
 		if sheet.GlobalPipelineStore != nil && sheet.GlobalPipelineQueue != nil {
+			if err := sheet.GlobalPipelineQueue.MakeRoomForJob(userID); err != nil {
+				if errors.Is(err, pipeline.ErrStoredJobLimit) {
+					return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+				}
+				return c.Status(500).JSON(fiber.Map{"error": "Failed to check stored job limit"})
+			}
 			job := pipeline.NewJob(userID, string(requestJSON), 3)
 			job.Metadata["request"] = genRequest
+			job.Metadata["autoApprove"] = genRequest.AutoApprove
+			if parentJobID != uuid.Nil {
+				job.Metadata["parentJobId"] = parentJobID.String()
+			}
+			if req.StatusWebhookURL != "" {
+				job.Metadata["statusWebhookUrl"] = req.StatusWebhookURL
+			}
+			if redactions > 0 {
+				job.Metadata["piiRedactions"] = redactions
+			}
+			if safeMode {
+				job.Metadata["safeMode"] = true
+			}
 			if err := sheet.GlobalPipelineStore.SaveJob(job); err != nil {
 				return c.Status(500).JSON(fiber.Map{"error": "Failed to save job"})
 			}
 			conv := pipeline.NewConversation(job.ID)
+			if parentJobID != uuid.Nil {
+				seeded, err := sheet.GlobalPipelineStore.NewConversationFromParent(job.ID, parentJobID, config.GetConfigInt("PARENT_CONTEXT_CHARS", pipeline.DefaultParentContextChars))
+				if err != nil {
+					return c.Status(400).JSON(fiber.Map{"error": "parent job has no conversation to continue"})
+				}
+				conv = seeded
+			}
 			_ = sheet.GlobalPipelineStore.SaveConversation(conv)
+			if original != nil {
+				sheet.GlobalPipelineQueue.HoldRequest(job.ID, original)
+			}
 			if err := sheet.GlobalPipelineQueue.Enqueue(job.ID); err != nil {
 				return c.Status(500).JSON(fiber.Map{"error": "Failed to enqueue sheet"})
 			}
-			return c.JSON(fiber.Map{"jobId": job.ID.String(), "status": "queued"})
+			recordAudit(userID, auditSheetCreate, job.ID.String())
+			return c.JSON(fiber.Map{"jobId": job.ID.String(), "status": "queued", "safeMode": safeMode})
 		}
 
 		// Fallback to legacy queue
@@ -312,34 +625,19 @@ func SheetsIndex() error {
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to enqueue sheet"})
 		}
+		recordAudit(userID, auditSheetCreate, jobID)
 
-		return c.JSON(fiber.Map{"jobId": jobID, "status": "queued"})
-	})
-
-	server.Route.Get("/api/v1/sheets/queue", func(c *fiber.Ctx) error {
-		userID := c.Locals("username")
-		if userID == nil {
-			userID = "anonymous"
-		}
-
-		if sheet.GlobalPipelineStore != nil {
-			jobs, err := sheet.GlobalPipelineStore.GetJobsByUser(userID.(string))
-			if err == nil {
-				return c.JSON(jobs)
-			}
-		}
-
-		if sheet.GlobalSheetGenerator == nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Sheet generator not initialized"})
-		}
-		jobs, err := sheet.GlobalSheetGenerator.GetUserJobs(userID.(string))
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to get queue"})
-		}
-		return c.JSON(jobs)
-	})
+		return c.JSON(fiber.Map{"jobId": jobID, "status": "queued", "safeMode": safeMode})
+	}
+}
 
-	return nil
+// isValidWebhookURL reports whether raw is an absolute http or https URL
+func isValidWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
 }
 
 func parsePipelineJobID(id string) (uuid.UUID, error) {
@@ -359,7 +657,7 @@ func mapPipelineStatus(status pipeline.JobStatus) string {
 	}
 }
 
-func getPipelineQueueItems(search string, latest bool, limit int) ([]map[string]interface{}, error) {
+func getPipelineQueueItems(search, label string, latest bool, limit int) ([]map[string]interface{}, error) {
 	jobs, err := sheet.GlobalPipelineStore.GetAllJobs()
 	if err != nil {
 		return nil, err
@@ -372,6 +670,9 @@ func getPipelineQueueItems(search string, latest bool, limit int) ([]map[string]
 		if searchLower != "" && !strings.Contains(strings.ToLower(job.Prompt), searchLower) {
 			continue
 		}
+		if label != "" && !job.HasLabel(label) {
+			continue
+		}
 
 		result := interface{}(nil)
 		if job.Status == pipeline.StatusCompleted {
@@ -381,10 +682,25 @@ func getPipelineQueueItems(search string, latest bool, limit int) ([]map[string]
 					metadata = md
 				}
 			}
-			result = map[string]interface{}{
+			resultMap := map[string]interface{}{
 				"pdf_url":  job.PDFURL,
 				"metadata": metadata,
 			}
+			// Split answer key jobs expose both versions
+			if key, ok := job.Metadata["keyPdfUrl"].(string); ok && key != "" {
+				resultMap["student_pdf_url"] = job.Metadata["studentPdfUrl"]
+				resultMap["key_pdf_url"] = key
+			}
+			if thumb := job.ThumbnailURL(); thumb != "" {
+				resultMap["thumbnail_url"] = thumb
+			}
+			if analytics, ok := job.Metadata["analytics"]; ok {
+				resultMap["analytics"] = analytics
+			}
+			if abstract, ok := job.Metadata["abstract"].(string); ok && abstract != "" {
+				resultMap["abstract"] = abstract
+			}
+			result = responseResultMap(resultMap)
 		}
 
 		items = append(items, map[string]interface{}{
@@ -393,6 +709,7 @@ func getPipelineQueueItems(search string, latest bool, limit int) ([]map[string]
 			"prompt":     job.Prompt,
 			"created_at": job.CreatedAt,
 			"updated_at": job.UpdatedAt,
+			"labels":     job.Labels,
 			"result":     result,
 		})
 	}
@@ -461,7 +778,23 @@ func extractTags(response string) ([]string, error) {
 		}
 	}
 
-	return tags, nil
+	return normalizeTags(tags), nil
+}
+
+// normalizeTags trims and lowercases tags, dropping empties and duplicates
+// while keeping the order they first appeared in
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
 }
 
 // generateTags handles requests to generate tags using AI
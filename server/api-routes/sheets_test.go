@@ -0,0 +1,32 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{name: "nil", tags: nil, want: []string{}},
+		{name: "trims whitespace", tags: []string{"  algebra ", "\tcalculus\n"}, want: []string{"algebra", "calculus"}},
+		{name: "drops blanks", tags: []string{"", "   ", "geometry"}, want: []string{"geometry"}},
+		{name: "lowercases", tags: []string{"Physics", "PHYSICS"}, want: []string{"physics"}},
+		{name: "drops duplicates after trimming", tags: []string{"math", " math", "math "}, want: []string{"math"}},
+		{name: "keeps first-seen order", tags: []string{"b", "a", "b", "c"}, want: []string{"b", "a", "c"}},
+		{name: "lowercases unicode", tags: []string{"Ökonomie", "ÖKONOMIE", "ökonomie"}, want: []string{"ökonomie"}},
+		{name: "keeps non-latin tags", tags: []string{"数学", " 数学 ", "物理"}, want: []string{"数学", "物理"}},
+		{name: "greek", tags: []string{"ΦΥΣΙΚΗ", "φυσικη"}, want: []string{"φυσικη"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeTags(tt.tags); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeTags(%q) = %q, want %q", tt.tags, got, tt.want)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	store "nadhi.dev/sarvar/fun/database"
 	"nadhi.dev/sarvar/fun/db"
+	"nadhi.dev/sarvar/fun/latex"
 	"nadhi.dev/sarvar/fun/server"
 )
 
@@ -75,6 +76,7 @@ func StylesIndex() error {
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 		}
+		recordAudit(username, auditStyleCreate, body.Name)
 
 		return c.JSON(style)
 	})
@@ -106,11 +108,13 @@ func StylesIndex() error {
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 		}
+		recordAudit(username, auditStyleUpdate, name)
 
 		if body.IsDefault {
 			if _, err := store.SetDefaultStyle(db.StylesDB, username, name); err != nil {
 				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 			}
+			recordAudit(username, auditStyleDefault, name)
 		}
 
 		return c.JSON(style)
@@ -128,9 +132,45 @@ func StylesIndex() error {
 		if err := store.DeleteStyle(db.StylesDB, username, name); err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "failed to delete style"})
 		}
+		recordAudit(username, auditStyleDelete, name)
 		return c.JSON(fiber.Map{"status": "deleted"})
 	})
 
+	// Compile the style into the preview document so the editor can flag
+	// broken styles before they fail a whole generation
+	server.Route.Post("/api/v1/styles/:name/validate", func(c *fiber.Ctx) error {
+		username, err := getUsernameFromAuth(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		name := strings.TrimSpace(c.Params("name"))
+		if name == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid style name"})
+		}
+		style, err := store.GetStyle(db.StylesDB, username, name)
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "style not found"})
+		}
+
+		prepared, err := latex.PreparePreviewLatex(style.Prompt)
+		if err != nil {
+			return c.JSON(fiber.Map{"name": name, "valid": false, "errors": []string{err.Error()}})
+		}
+		compileErrors, err := latex.CheckLatexCompiles(prepared)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if compileErrors == nil {
+			compileErrors = []string{}
+		}
+
+		return c.JSON(fiber.Map{
+			"name":   name,
+			"valid":  len(compileErrors) == 0,
+			"errors": compileErrors,
+		})
+	})
+
 	server.Route.Post("/api/v1/styles/:name/default", func(c *fiber.Ctx) error {
 		username, err := getUsernameFromAuth(c)
 		if err != nil {
@@ -144,6 +184,7 @@ func StylesIndex() error {
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 		}
+		recordAudit(username, auditStyleDefault, name)
 		return c.JSON(style)
 	})
 
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"nadhi.dev/sarvar/fun/ai"
+	"nadhi.dev/sarvar/fun/config"
+)
+
+// Tag suggestions run on every pause in typing, so they are kept small:
+// a short prompt, a few tags and a reply capped well below a full answer
+const (
+	maxSuggestedTags       = 5
+	minSuggestTagsChars    = 3
+	maxSuggestTagsChars    = 500
+	suggestTagsMaxTokens   = 60
+	suggestTagsTimeout     = 10 * time.Second
+	defaultSuggestTagsWait = 750
+)
+
+// Last suggest-tags request per user, for the cooldown
+var (
+	suggestTagsMu   sync.Mutex
+	suggestTagsLast = make(map[string]time.Time)
+)
+
+// checkSuggestCooldown reports whether username may request suggestions
+// now, and if not how long until they can. The cooldown is
+// SUGGEST_TAGS_COOLDOWN_MS, short enough for a debounced input box.
+func checkSuggestCooldown(username string) (bool, time.Duration) {
+	wait := time.Duration(config.GetConfigInt("SUGGEST_TAGS_COOLDOWN_MS", defaultSuggestTagsWait)) * time.Millisecond
+
+	suggestTagsMu.Lock()
+	defer suggestTagsMu.Unlock()
+	if last, ok := suggestTagsLast[username]; ok {
+		if elapsed := time.Since(last); elapsed < wait {
+			return false, wait - elapsed
+		}
+	}
+	suggestTagsLast[username] = time.Now()
+	return true, 0
+}
+
+// suggestTags returns a few tags for partial text as the user types. Unlike
+// generateTags it takes free text, answers with the utility model under a
+// tight token limit, and rate limits each user rather than the endpoint.
+func suggestTags(c *fiber.Ctx) error {
+	username, err := getUsernameFromAuth(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var request struct {
+		Text string `json:"text"`
+	}
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request data"})
+	}
+
+	// Too little to go on yet; answer without spending a call
+	text := strings.TrimSpace(request.Text)
+	if utf8.RuneCountInString(text) < minSuggestTagsChars {
+		return c.JSON(fiber.Map{"tags": []string{}})
+	}
+	if utf8.RuneCountInString(text) > maxSuggestTagsChars {
+		text = string([]rune(text)[:maxSuggestTagsChars])
+	}
+
+	if ok, wait := checkSuggestCooldown(username); !ok {
+		return c.Status(429).JSON(fiber.Map{
+			"error":        "Too many requests, please wait",
+			"retryAfterMs": wait.Milliseconds(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), suggestTagsTimeout)
+	defer cancel()
+	ctx = ai.WithMaxTokens(ctx, suggestTagsMaxTokens)
+
+	messages := []ai.Message{
+		{
+			Role: "system",
+			Content: fmt.Sprintf(`You suggest tags for educational worksheets from partial text the user is still typing.
+Return ONLY a JSON array of at most %d short lowercase tags, nothing else.
+Example response: ["algebra", "equations", "grade 8"]`, maxSuggestedTags),
+		},
+		{Role: "user", Content: text},
+	}
+
+	response, err := ai.Generate(ctx, ai.TaskUtility, messages)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": fmt.Sprintf("Failed to suggest tags: %v", err)})
+	}
+
+	tags, _ := extractTags(response)
+	if len(tags) > maxSuggestedTags {
+		tags = tags[:maxSuggestedTags]
+	}
+	return c.JSON(fiber.Map{"tags": tags})
+}
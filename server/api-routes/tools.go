@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
@@ -37,6 +38,21 @@ func ToolsIndex() error {
 		}
 
 		context, results, err := websearch.SearchAndExtract(q, req.Limit)
+		if errors.Is(err, websearch.ErrWebSearchDisabled) {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, websearch.ErrRateLimited) {
+			return c.Status(429).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, websearch.ErrNoContent) {
+			// The results themselves are still useful without page text
+			return c.JSON(fiber.Map{
+				"query":   q,
+				"results": results,
+				"context": "",
+				"error":   err.Error(),
+			})
+		}
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 		}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"nadhi.dev/sarvar/fun/server"
+	sheet "nadhi.dev/sarvar/fun/sheets"
+)
+
+// UsageIndex registers the per-user usage routes
+func UsageIndex() error {
+	server.Route.Get("/api/v1/usage/storage", func(c *fiber.Ctx) error {
+		if sheet.GlobalPipelineQueue == nil {
+			return c.Status(500).JSON(fiber.Map{"error": "pipeline not initialized"})
+		}
+
+		username, err := getUsernameFromAuth(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		usage, err := sheet.GlobalPipelineQueue.UserStorageUsage(username)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to compute storage usage"})
+		}
+
+		return c.JSON(usage)
+	})
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"nadhi.dev/sarvar/fun/ai"
+	store "nadhi.dev/sarvar/fun/database"
+	"nadhi.dev/sarvar/fun/db"
+	"nadhi.dev/sarvar/fun/server"
+)
+
+// VariablesIndex registers the per-user template variable routes. Variables
+// fill {{name}} placeholders in sheet requests before the design step.
+func VariablesIndex() error {
+	server.Route.Get("/api/v1/variables", func(c *fiber.Ctx) error {
+		username, err := getUsernameFromAuth(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		user, err := store.GetUser(db.UsersDB, username)
+		if err != nil || user == nil {
+			return c.Status(404).JSON(fiber.Map{"error": "user not found"})
+		}
+		vars := user.Variables
+		if vars == nil {
+			vars = map[string]string{}
+		}
+		return c.JSON(vars)
+	})
+
+	// Replace every variable at once
+	server.Route.Put("/api/v1/variables", func(c *fiber.Ctx) error {
+		username, err := getUsernameFromAuth(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		var body map[string]string
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+		}
+		if err := validateVariables(body); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := store.UpdateUserVariables(db.UsersDB, username, body); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to save variables"})
+		}
+		return c.JSON(body)
+	})
+
+	server.Route.Put("/api/v1/variables/:name", func(c *fiber.Ctx) error {
+		username, err := getUsernameFromAuth(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		var body struct {
+			Value string `json:"value"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+		}
+		user, err := store.GetUser(db.UsersDB, username)
+		if err != nil || user == nil {
+			return c.Status(404).JSON(fiber.Map{"error": "user not found"})
+		}
+
+		vars := make(map[string]string, len(user.Variables)+1)
+		for k, v := range user.Variables {
+			vars[k] = v
+		}
+		vars[c.Params("name")] = body.Value
+		if err := validateVariables(vars); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := store.UpdateUserVariables(db.UsersDB, username, vars); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to save variables"})
+		}
+		return c.JSON(vars)
+	})
+
+	server.Route.Delete("/api/v1/variables/:name", func(c *fiber.Ctx) error {
+		username, err := getUsernameFromAuth(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		user, err := store.GetUser(db.UsersDB, username)
+		if err != nil || user == nil {
+			return c.Status(404).JSON(fiber.Map{"error": "user not found"})
+		}
+
+		name := c.Params("name")
+		if _, ok := user.Variables[name]; !ok {
+			return c.Status(404).JSON(fiber.Map{"error": "variable not found"})
+		}
+		delete(user.Variables, name)
+		if err := store.UpdateUserVariables(db.UsersDB, username, user.Variables); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to save variables"})
+		}
+		return c.JSON(user.Variables)
+	})
+
+	return nil
+}
+
+// validateVariables checks names, value sizes and the per-user limit
+func validateVariables(vars map[string]string) error {
+	if len(vars) > ai.MaxTemplateVariables {
+		return fmt.Errorf("at most %d variables are allowed", ai.MaxTemplateVariables)
+	}
+	for name, value := range vars {
+		if !ai.IsValidVariableName(name) {
+			return fmt.Errorf("invalid variable name %q: use letters, digits, _, . or -", name)
+		}
+		if len(value) > ai.MaxTemplateVariableLength {
+			return fmt.Errorf("variable %q exceeds %d characters", name, ai.MaxTemplateVariableLength)
+		}
+		if strings.Contains(value, "{{") {
+			return fmt.Errorf("variable %q must not contain {{", name)
+		}
+	}
+	return nil
+}
@@ -2,7 +2,10 @@ package api
 
 import (
 	_ "encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -14,6 +17,11 @@ import (
 
 // List all files in ./storage and send as JSON array (Fiber version)
 func ListStorageFilesFiber(c *fiber.Ctx) error {
+	// Listing would hand out every job ID, defeating signed downloads
+	if signedDownloadsRequired() {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
 	files := []string{}
 	root := "./storage"
 
@@ -34,9 +42,60 @@ func ListStorageFilesFiber(c *fiber.Ctx) error {
 	return c.JSON(files)
 }
 
+// errPathTraversal is returned when a requested path resolves outside the storage root
+var errPathTraversal = errors.New("path escapes storage root")
+
+// resolveStoragePath joins a user supplied path onto root and makes sure the
+// result stays inside root. Percent-encoded input is decoded first so that
+// variants like %2e%2e%2f are caught too.
+func resolveStoragePath(root, relPath string) (string, error) {
+	decoded, err := url.PathUnescape(relPath)
+	if err != nil {
+		return "", errPathTraversal
+	}
+	if strings.ContainsRune(decoded, 0) {
+		return "", errPathTraversal
+	}
+
+	// Normalise windows separators so "..\" is treated like "../"
+	decoded = strings.ReplaceAll(decoded, "\\", "/")
+	if filepath.IsAbs(decoded) || strings.HasPrefix(decoded, "/") || filepath.VolumeName(decoded) != "" {
+		return "", errPathTraversal
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+
+	absPath, err := filepath.Abs(filepath.Join(absRoot, filepath.Clean(decoded)))
+	if err != nil {
+		return "", err
+	}
+
+	if absPath != absRoot && !strings.HasPrefix(absPath, absRoot+string(filepath.Separator)) {
+		return "", errPathTraversal
+	}
+
+	return absPath, nil
+}
+
 func ServeStorageFileFiber(c *fiber.Ctx) error {
-	relPath := c.Params("*")
-	filePath := filepath.Join("./storage", relPath)
+	filePath, err := resolveStoragePath("./storage", c.Params("*"))
+	if err != nil {
+		if errors.Is(err, errPathTraversal) {
+			return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to resolve path"})
+	}
+
+	// With signed downloads on, files are only served through URLs handed
+	// out by /api/v1/pipeline/jobs/:id/download
+	if signedDownloadsRequired() {
+		if err := verifyStorageSignature(c.Params("*"), c.Query("expires"), c.Query("sig")); err != nil {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
 
 	data, err := ioutil.ReadFile(filePath)
 	if err != nil {
@@ -52,6 +111,11 @@ func ServeStorageFileFiber(c *fiber.Ctx) error {
 		c.Type("jpeg")
 	case ".pdf":
 		c.Type("pdf")
+		// Stored PDFs are named by job ID; ?name= gives the download a
+		// readable one. It isn't signed, so it is sanitized again here.
+		if name := sanitizeDownloadName(strings.TrimSuffix(c.Query("name"), ".pdf")); name != "" {
+			c.Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s.pdf"`, name))
+		}
 	case ".txt", ".md", ".json", ".csv":
 		// Force text display in browser like GitHub Raw
 		c.Set("Content-Type", "text/plain; charset=utf-8")
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveStoragePath(t *testing.T) {
+	root := t.TempDir()
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain file", path: "pdfs/sheet.pdf", want: "pdfs/sheet.pdf"},
+		{name: "root itself", path: "", want: ""},
+		{name: "dot segments inside root", path: "pdfs/../pdfs/./sheet.pdf", want: "pdfs/sheet.pdf"},
+		{name: "parent directory", path: "../secret.txt", wantErr: true},
+		{name: "nested parent directory", path: "pdfs/../../secret.txt", wantErr: true},
+		{name: "backslash parent directory", path: `..\secret.txt`, wantErr: true},
+		{name: "absolute path", path: "/etc/passwd", wantErr: true},
+		{name: "absolute backslash path", path: `\etc\passwd`, wantErr: true},
+		{name: "encoded parent directory", path: "%2e%2e%2fsecret.txt", wantErr: true},
+		{name: "encoded absolute path", path: "%2fetc%2fpasswd", wantErr: true},
+		{name: "mixed encoding", path: "pdfs/..%2f..%2fsecret.txt", wantErr: true},
+		{name: "encoded backslash", path: "..%5csecret.txt", wantErr: true},
+		{name: "invalid escape", path: "pdfs/%zz.pdf", wantErr: true},
+		{name: "null byte", path: "pdfs/sheet.pdf%00.png", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveStoragePath(root, tt.path)
+			if tt.wantErr {
+				if !errors.Is(err, errPathTraversal) {
+					t.Fatalf("resolveStoragePath(%q) = %q, %v; want errPathTraversal", tt.path, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveStoragePath(%q) returned error: %v", tt.path, err)
+			}
+			if want := filepath.Join(root, filepath.FromSlash(tt.want)); got != want {
+				t.Errorf("resolveStoragePath(%q) = %q, want %q", tt.path, got, want)
+			}
+		})
+	}
+}
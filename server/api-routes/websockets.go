@@ -2,7 +2,11 @@ package api
 
 import (
 	"crypto/md5"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
@@ -15,10 +19,20 @@ import (
 	ws "nadhi.dev/sarvar/fun/websocket"
 )
 
+// wsStatusPath reports websocket counts over plain HTTP
+const wsStatusPath = "/api/v1/ws/status"
+
 func RegisterWebsocketRoutes() {
-	// Middleware to check if connection is websocket
+	// Middleware to check if connection is websocket. The status endpoint
+	// is plain HTTP, so it is let through.
 	server.Route.Use("/api/v1/ws", func(c *fiber.Ctx) error {
+		if c.Path() == wsStatusPath {
+			return c.Next()
+		}
 		if websocket.IsWebSocketUpgrade(c) {
+			if websocketsFull() {
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": tooManySocketsMessage})
+			}
 			c.Locals("allowed", true)
 			return c.Next()
 		}
@@ -26,14 +40,19 @@ func RegisterWebsocketRoutes() {
 	})
 
 	// Websocket connection endpoint
-	server.Route.Get("/api/v1/ws/notifications", websocket.New(ws.GetManager().ConnectHandler))
+	server.Route.Get("/api/v1/ws/notifications", websocket.New(limitSockets(ws.GetManager().ConnectHandler)))
 
 	// Websocket status endpoint (HTTP)
-	server.Route.Get("/api/v1/ws/status", func(c *fiber.Ctx) error {
-		return c.JSON(ws.GetManager().Status())
+	server.Route.Get(wsStatusPath, func(c *fiber.Ctx) error {
+		status := ws.GetManager().Status()
+		status["maxConnections"] = websocketMaxConnections()
+		return c.JSON(status)
 	})
 
-	server.Route.Get("/api/v1/ws/job/:jobid", websocket.New(func(c *websocket.Conn) {
+	// One connection multiplexing updates for several of the user's jobs
+	server.Route.Get("/api/v1/ws/jobs", websocket.New(limitSockets(handleMultiJobSocket)))
+
+	server.Route.Get("/api/v1/ws/job/:jobid", websocket.New(limitSockets(func(c *websocket.Conn) {
 		jobID := c.Params("jobid")
 		sessionID := c.Query("session")
 
@@ -68,8 +87,11 @@ func RegisterWebsocketRoutes() {
 			return
 		}
 
+		conn := newSocketConn(c)
+		defer conn.Close()
+
 		lastSent := make(map[string]string)
-		sheet.GlobalSheetGenerator.Queue.RegisterJobListener(jobID, func(update sheet.StatusUpdate) {
+		listenerID := sheet.GlobalSheetGenerator.Queue.RegisterJobListener(jobID, func(update sheet.StatusUpdate) {
 			hashInput := fmt.Sprintf("%s|%v|%v", update.Status, update.Result, update.Data)
 			hash := fmt.Sprintf("%x", md5.Sum([]byte(hashInput)))
 			if lastSent[jobID] == hash {
@@ -87,28 +109,31 @@ func RegisterWebsocketRoutes() {
 			if update.Data != nil {
 				msg["data"] = update.Data
 			}
-			_ = c.WriteJSON(msg)
+			_ = conn.WriteJSON(msg)
 		})
+		defer sheet.GlobalSheetGenerator.Queue.UnregisterJobListener(jobID, listenerID)
 
 		if job, exists := sheet.GlobalSheetGenerator.Queue.GetJobStatus(jobID); exists {
 			message := fmt.Sprintf("Initial status for job %s: %s", jobID, job.Status)
 			msg := ws.Start(message, map[string]interface{}{})
 			msg["jobId"] = jobID
-			_ = c.WriteJSON(msg)
+			_ = conn.WriteJSON(msg)
 		}
 
-		for {
-			if _, _, err := c.ReadMessage(); err != nil {
-				break
-			}
-		}
-	}))
+		stop := conn.keepAlive()
+		conn.readUntilClosed()
+		stop()
+	})))
 }
 
+// registerPipelineJobListener forwards a pipeline job's updates to c until
+// the client disconnects or stops answering pings
 func registerPipelineJobListener(c *websocket.Conn, jobID uuid.UUID) {
-	lastSent := make(map[string]string)
+	conn := newSocketConn(c)
+	defer conn.Close()
 
-	sheet.GlobalPipelineQueue.RegisterJobListener(jobID, func(update pipeline.StatusUpdate) {
+	lastSent := make(map[string]string)
+	listenerID := sheet.GlobalPipelineQueue.RegisterJobListener(jobID, func(update pipeline.StatusUpdate) {
 		hashInput := fmt.Sprintf("%s|%s|%v", update.Status, update.Message, update.Data)
 		hash := fmt.Sprintf("%x", md5.Sum([]byte(hashInput)))
 		if lastSent[jobID.String()] == hash {
@@ -116,52 +141,312 @@ func registerPipelineJobListener(c *websocket.Conn, jobID uuid.UUID) {
 		}
 		lastSent[jobID.String()] = hash
 
-		payload := map[string]interface{}{}
-		if update.Data != nil {
-			payload = update.Data
-		}
-		if _, ok := payload["type"]; !ok {
-			payload["type"] = "processing"
-			payload["message"] = update.Message
-			payload["step"] = string(update.Step)
-		}
-
 		msg := map[string]interface{}{
 			"jobId": jobID.String(),
-			"data":  payload,
+			"seq":   update.Seq,
+			"data":  pipelineUpdatePayload(update),
 		}
-		_ = c.WriteJSON(msg)
+		_ = conn.WriteJSON(msg)
 	})
+	defer sheet.GlobalPipelineQueue.UnregisterJobListener(jobID, listenerID)
 
 	if job, err := sheet.GlobalPipelineStore.GetJob(jobID); err == nil {
-		payload := map[string]interface{}{
-			"type":    "stage",
-			"stage":   "Pipeline",
-			"step":    fmt.Sprintf("Status: %s", job.Status),
-			"message": fmt.Sprintf("Job %s is %s", job.ID.String(), job.Status),
-		}
-		if job.Status == pipeline.StatusCompleted {
-			metadata := map[string]interface{}{}
-			if job.Metadata != nil {
-				if md, ok := job.Metadata["metadata"].(map[string]interface{}); ok {
-					metadata = md
+		_ = conn.WriteJSON(map[string]interface{}{
+			"jobId": job.ID.String(),
+			"seq":   sheet.GlobalPipelineQueue.LastUpdateSeq(job.ID),
+			"data":  pipelineInitialPayload(job),
+		})
+	}
+
+	stop := conn.keepAlive()
+	conn.readUntilClosed()
+	stop()
+}
+
+// pipelineUpdatePayload is the websocket "data" of a status update
+func pipelineUpdatePayload(update pipeline.StatusUpdate) map[string]interface{} {
+	payload := map[string]interface{}{}
+	if update.Data != nil {
+		payload = responseResultMap(update.Data)
+	}
+	if _, ok := payload["type"]; !ok {
+		payload["type"] = "processing"
+		payload["message"] = update.Message
+		payload["step"] = string(update.Step)
+	}
+	return payload
+}
+
+// pipelineInitialPayload is the websocket "data" describing a job's current
+// state, sent when a client starts listening to it
+func pipelineInitialPayload(job *pipeline.Job) map[string]interface{} {
+	payload := map[string]interface{}{
+		"type":    "stage",
+		"stage":   "Pipeline",
+		"step":    fmt.Sprintf("Status: %s", job.Status),
+		"message": fmt.Sprintf("Job %s is %s", job.ID.String(), job.Status),
+	}
+	if job.Status == pipeline.StatusPending {
+		payload["queue"] = sheet.GlobalPipelineQueue.Position(job.ID)
+	}
+	if job.Status == pipeline.StatusCompleted {
+		metadata := map[string]interface{}{}
+		if job.Metadata != nil {
+			if md, ok := job.Metadata["metadata"].(map[string]interface{}); ok {
+				metadata = md
+			}
+		}
+		payload = ws.Completed("Sheet generation completed", map[string]interface{}{
+			"pdf_url":  responseStorageURL(job.PDFURL),
+			"metadata": metadata,
+		}, map[string]interface{}{})["data"].(map[string]interface{})
+	}
+	return payload
+}
+
+// maxSocketJobs caps how many jobs one multi-job connection may follow
+const maxSocketJobs = 50
+
+// socketSendBuffer is how many messages a multi-job connection queues
+// before updates for it are dropped
+const socketSendBuffer = 64
+
+// jobSocketCommand is a client message on the multi-job socket
+type jobSocketCommand struct {
+	Action string   `json:"action"`
+	IDs    []string `json:"ids"`
+}
+
+// jobSocket tracks the subscriptions of one multi-job connection
+type jobSocket struct {
+	username string
+	send     chan map[string]interface{}
+
+	mu       sync.Mutex
+	subs     map[uuid.UUID]func()
+	lastSent map[uuid.UUID]string
+	closed   bool
+}
+
+// handleMultiJobSocket serves /api/v1/ws/jobs?ids=a,b,c&session=... Updates
+// for every subscribed job the user owns arrive tagged with their jobId.
+// Clients send {"action":"subscribe"|"unsubscribe","ids":[...]} to change
+// the set; each change is answered with a "subscriptions" message.
+func handleMultiJobSocket(c *websocket.Conn) {
+	sessionID := c.Query("session")
+	isValid, err := auth.IsSessionValid(sessionID)
+	if err != nil || !isValid {
+		_ = c.WriteJSON(ws.Error("Invalid session", "Authentication failed", map[string]interface{}{}))
+		c.Close()
+		return
+	}
+	user, err := auth.GetUserBySession(sessionID)
+	if err != nil || user == nil {
+		_ = c.WriteJSON(ws.Error("Invalid session", "Authentication failed", map[string]interface{}{}))
+		c.Close()
+		return
+	}
+	if sheet.GlobalPipelineQueue == nil || sheet.GlobalPipelineStore == nil {
+		_ = c.WriteJSON(ws.Error("Server error", "Pipeline not initialized", map[string]interface{}{}))
+		c.Close()
+		return
+	}
+
+	js := &jobSocket{
+		username: user.Username,
+		send:     make(chan map[string]interface{}, socketSendBuffer),
+		subs:     make(map[uuid.UUID]func()),
+		lastSent: make(map[uuid.UUID]string),
+	}
+
+	// Listener callbacks only queue messages; this goroutine does the
+	// writes, so a slow client never holds up the pipeline
+	conn := newSocketConn(c)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg := range js.send {
+			if err := conn.WriteJSON(msg); err != nil {
+				for range js.send {
 				}
+				return
 			}
-			payload = ws.Completed("Sheet generation completed", map[string]interface{}{
-				"pdf_url":  job.PDFURL,
-				"metadata": metadata,
-			}, map[string]interface{}{})["data"].(map[string]interface{})
 		}
+	}()
+	// Runs in reverse: unsubscribe and close the queue, then wait for the writer
+	defer func() { <-done }()
+	defer js.close()
 
-		_ = c.WriteJSON(map[string]interface{}{
-			"jobId": job.ID.String(),
-			"data":  payload,
-		})
+	if ids := c.Query("ids"); ids != "" {
+		js.subscribe(strings.Split(ids, ","))
 	}
 
+	stop := conn.keepAlive()
+	defer stop()
+	interval := websocketPingInterval()
 	for {
-		if _, _, err := c.ReadMessage(); err != nil {
-			break
+		_, raw, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		if interval > 0 {
+			_ = c.SetReadDeadline(time.Now().Add(2 * interval))
+		}
+		var cmd jobSocketCommand
+		if err := json.Unmarshal(raw, &cmd); err != nil {
+			js.push(ws.Error("Invalid message", `Expected {"action": "subscribe" or "unsubscribe", "ids": [...]}`, map[string]interface{}{}))
+			continue
+		}
+		switch strings.ToLower(cmd.Action) {
+		case "subscribe":
+			js.subscribe(cmd.IDs)
+		case "unsubscribe":
+			js.unsubscribe(cmd.IDs)
+		default:
+			js.push(ws.Error("Invalid message", fmt.Sprintf("Unknown action %q", cmd.Action), map[string]interface{}{}))
+		}
+	}
+}
+
+// subscribe follows the given jobs, skipping ones that don't exist or
+// aren't the user's, and sends each new job's current state
+func (js *jobSocket) subscribe(ids []string) {
+	var added, rejected []string
+	for _, raw := range ids {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		jobID, err := uuid.Parse(raw)
+		if err != nil {
+			rejected = append(rejected, raw)
+			continue
+		}
+		job, err := sheet.GlobalPipelineStore.GetJob(jobID)
+		if err != nil || job.UserID != js.username {
+			rejected = append(rejected, raw)
+			continue
+		}
+
+		js.mu.Lock()
+		if _, ok := js.subs[jobID]; ok || js.closed {
+			js.mu.Unlock()
+			continue
+		}
+		if len(js.subs) >= maxSocketJobs {
+			js.mu.Unlock()
+			rejected = append(rejected, raw)
+			continue
+		}
+		js.subs[jobID] = sheet.GlobalPipelineQueue.SubscribeJob(jobID, func(update pipeline.StatusUpdate) {
+			js.forward(jobID, update)
+		})
+		js.mu.Unlock()
+
+		added = append(added, jobID.String())
+		js.push(map[string]interface{}{
+			"jobId": jobID.String(),
+			"seq":   sheet.GlobalPipelineQueue.LastUpdateSeq(jobID),
+			"data":  pipelineInitialPayload(job),
+		})
+	}
+	js.pushSubscriptions(added, nil, rejected)
+}
+
+// unsubscribe stops following the given jobs
+func (js *jobSocket) unsubscribe(ids []string) {
+	var removed []string
+	js.mu.Lock()
+	for _, raw := range ids {
+		jobID, err := uuid.Parse(strings.TrimSpace(raw))
+		if err != nil {
+			continue
+		}
+		if unsub, ok := js.subs[jobID]; ok {
+			unsub()
+			delete(js.subs, jobID)
+			delete(js.lastSent, jobID)
+			removed = append(removed, jobID.String())
 		}
 	}
+	js.mu.Unlock()
+	js.pushSubscriptions(nil, removed, nil)
+}
+
+// forward queues a job's status update, skipping exact repeats
+func (js *jobSocket) forward(jobID uuid.UUID, update pipeline.StatusUpdate) {
+	hash := fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%s|%s|%v", update.Status, update.Message, update.Data))))
+	js.mu.Lock()
+	if js.lastSent[jobID] == hash {
+		js.mu.Unlock()
+		return
+	}
+	js.lastSent[jobID] = hash
+	js.mu.Unlock()
+
+	// Other subscribers see the same map, so add defaults to a copy
+	payload := make(map[string]interface{}, len(update.Data)+3)
+	for k, v := range update.Data {
+		payload[k] = v
+	}
+	update.Data = payload
+	js.push(map[string]interface{}{
+		"jobId": jobID.String(),
+		"seq":   update.Seq,
+		"data":  pipelineUpdatePayload(update),
+	})
+}
+
+// pushSubscriptions reports a change to the subscribed set
+func (js *jobSocket) pushSubscriptions(added, removed, rejected []string) {
+	js.mu.Lock()
+	current := make([]string, 0, len(js.subs))
+	for id := range js.subs {
+		current = append(current, id.String())
+	}
+	js.mu.Unlock()
+
+	msg := map[string]interface{}{
+		"type":   "subscriptions",
+		"jobIds": current,
+	}
+	if len(added) > 0 {
+		msg["added"] = added
+	}
+	if len(removed) > 0 {
+		msg["removed"] = removed
+	}
+	if len(rejected) > 0 {
+		msg["rejected"] = rejected
+	}
+	js.push(msg)
+}
+
+// push queues a message for the writer, dropping it if the client has
+// fallen socketSendBuffer messages behind
+func (js *jobSocket) push(msg map[string]interface{}) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if js.closed {
+		return
+	}
+	select {
+	case js.send <- msg:
+	default:
+	}
+}
+
+// close drops every subscription and stops the writer
+func (js *jobSocket) close() {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if js.closed {
+		return
+	}
+	js.closed = true
+	for id, unsub := range js.subs {
+		unsub()
+		delete(js.subs, id)
+	}
+	close(js.send)
 }
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"nadhi.dev/sarvar/fun/server"
+)
+
+func TestWebsocketStatusOverHTTP(t *testing.T) {
+	RegisterWebsocketRoutes()
+
+	resp, err := server.Route.Test(httptest.NewRequest("GET", wsStatusPath, nil))
+	if err != nil {
+		t.Fatalf("GET %s: %v", wsStatusPath, err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("GET %s = %d, want 200", wsStatusPath, resp.StatusCode)
+	}
+
+	// Socket endpoints still demand an upgrade
+	resp, err = server.Route.Test(httptest.NewRequest("GET", "/api/v1/ws/notifications", nil))
+	if err != nil {
+		t.Fatalf("GET notifications: %v", err)
+	}
+	if resp.StatusCode != 426 {
+		t.Errorf("plain GET of a socket endpoint = %d, want 426", resp.StatusCode)
+	}
+}
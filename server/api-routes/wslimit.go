@@ -0,0 +1,50 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+	"nadhi.dev/sarvar/fun/config"
+	ws "nadhi.dev/sarvar/fun/websocket"
+)
+
+// DefaultWebsocketMaxConnections caps how many websockets the server holds
+// at once, so a misbehaving client can't use up file descriptors
+const DefaultWebsocketMaxConnections = 1000
+
+// tooManySocketsMessage is the reason given to refused connections
+const tooManySocketsMessage = "too many websocket connections, try again later"
+
+// websocketMaxConnections returns WEBSOCKET_MAX_CONNECTIONS; 0 means no limit
+func websocketMaxConnections() int {
+	max := config.GetConfigInt("WEBSOCKET_MAX_CONNECTIONS", DefaultWebsocketMaxConnections)
+	if max < 0 {
+		max = 0
+	}
+	return max
+}
+
+// websocketsFull reports whether the cap is reached, for refusing an
+// upgrade before it happens
+func websocketsFull() bool {
+	max := websocketMaxConnections()
+	return max > 0 && ws.GetManager().OpenConnections() >= max
+}
+
+// limitSockets counts a websocket handler's connections against
+// WEBSOCKET_MAX_CONNECTIONS. The upgrade middleware refuses most excess
+// connections; one that slips past it while the count races up is closed
+// with "try again later" (1013).
+func limitSockets(handler func(*websocket.Conn)) func(*websocket.Conn) {
+	return func(c *websocket.Conn) {
+		manager := ws.GetManager()
+		if !manager.TryOpen(websocketMaxConnections()) {
+			msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, tooManySocketsMessage)
+			_ = c.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+			_ = c.Close()
+			return
+		}
+		defer manager.Closed()
+		handler(c)
+	}
+}
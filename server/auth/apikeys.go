@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"nadhi.dev/sarvar/fun/config"
+	store "nadhi.dev/sarvar/fun/database"
+	"nadhi.dev/sarvar/fun/db"
+)
+
+// APIKeyPrefix starts every API key, so CheckAuth can tell keys from session IDs
+const APIKeyPrefix = "aiot_"
+
+// MaxAPIKeysPerUser caps how many API keys one user may hold
+const MaxAPIKeysPerUser = 20
+
+// DefaultAPIKeyRateLimit is how many requests per minute one API key may make
+const DefaultAPIKeyRateLimit = 60
+
+var (
+	// ErrTooManyAPIKeys is returned when a user already holds MaxAPIKeysPerUser keys
+	ErrTooManyAPIKeys = errors.New("too many API keys")
+	// ErrAPIKeyNotFound is returned when a key is unknown or revoked
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrRateLimited is returned when an API key is over its request rate
+	ErrRateLimited = errors.New("API key rate limit exceeded")
+)
+
+// IsAPIKey reports whether a bearer token is an API key rather than a session ID
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// hashAPIKey returns the hex SHA-256 of a key, which is what gets stored
+func hashAPIKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey issues a new API key for username. The returned token is the
+// only copy of the key; it can't be recovered later.
+func CreateAPIKey(username, name string) (string, *store.APIKey, error) {
+	existing, err := store.GetAPIKeysByUser(db.APIKeysDB, username)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(existing) >= MaxAPIKeysPerUser {
+		return "", nil, ErrTooManyAPIKeys
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	token := APIKeyPrefix + hex.EncodeToString(secret)
+	key := store.APIKey{
+		ID:        hex.EncodeToString(id),
+		Username:  username,
+		Name:      strings.TrimSpace(name),
+		Prefix:    token[:len(APIKeyPrefix)+6],
+		Hash:      hashAPIKey(token),
+		CreatedAt: time.Now(),
+	}
+	if err := store.AddAPIKey(db.APIKeysDB, key); err != nil {
+		return "", nil, err
+	}
+	return token, &key, nil
+}
+
+// GetUserByAPIKey resolves an API key to the user that owns it
+func GetUserByAPIKey(token string) (*store.User, *store.APIKey, error) {
+	if !IsAPIKey(token) {
+		return nil, nil, ErrAPIKeyNotFound
+	}
+	key, err := store.GetAPIKeyByHash(db.APIKeysDB, hashAPIKey(token))
+	if err != nil {
+		return nil, nil, err
+	}
+	if key == nil {
+		return nil, nil, ErrAPIKeyNotFound
+	}
+	user, err := store.GetUser(db.UsersDB, key.Username)
+	if err != nil || user == nil {
+		return nil, nil, errors.New("user not found")
+	}
+	return user, key, nil
+}
+
+// ListAPIKeys returns a user's API keys, oldest first
+func ListAPIKeys(username string) ([]store.APIKey, error) {
+	return store.GetAPIKeysByUser(db.APIKeysDB, username)
+}
+
+// RevokeAPIKey deletes one of a user's API keys
+func RevokeAPIKey(username, id string) error {
+	removed, err := store.RemoveAPIKey(db.APIKeysDB, username, id)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// apiKeyWindow counts one key's requests in the current minute
+type apiKeyWindow struct {
+	start time.Time
+	count int
+}
+
+var (
+	apiKeyWindowsMu sync.Mutex
+	apiKeyWindows   = make(map[string]*apiKeyWindow)
+)
+
+// allowAPIKeyRequest counts a request against the key's per-minute limit
+// (API_KEY_RATE_LIMIT, 0 for unlimited). When over the limit it returns
+// ErrRateLimited and how long until the window resets.
+func allowAPIKeyRequest(keyID string) (time.Duration, error) {
+	limit := config.GetConfigInt("API_KEY_RATE_LIMIT", DefaultAPIKeyRateLimit)
+	if limit <= 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	apiKeyWindowsMu.Lock()
+	defer apiKeyWindowsMu.Unlock()
+
+	w, ok := apiKeyWindows[keyID]
+	if !ok || now.Sub(w.start) >= time.Minute {
+		// Drop stale windows as we go so revoked keys don't linger
+		for id, old := range apiKeyWindows {
+			if now.Sub(old.start) >= time.Minute {
+				delete(apiKeyWindows, id)
+			}
+		}
+		w = &apiKeyWindow{start: now}
+		apiKeyWindows[keyID] = w
+	}
+	if w.count >= limit {
+		return w.start.Add(time.Minute).Sub(now), ErrRateLimited
+	}
+	w.count++
+	return 0, nil
+}
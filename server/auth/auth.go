@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"errors"
 	"strings"
 
@@ -8,6 +9,9 @@ import (
 	"nadhi.dev/sarvar/fun/db"
 )
 
+// dummyPassword is compared against when no user matches the identifier
+const dummyPassword = "\x00invalid-credentials-placeholder"
+
 func Register(username, email, password, rank string) error {
     users, err := store.GetAllUsers(db.UsersDB)
     if err != nil {
@@ -23,16 +27,45 @@ func Register(username, email, password, rank string) error {
 }
 
 func Login(identifier, password string) (string, error) {
+    key := lockoutKey(identifier)
+    if err := checkLockout(key); err != nil {
+        return "", err
+    }
+
     users, err := store.GetAllUsers(db.UsersDB)
     if err != nil {
         return "", err
     }
+
+    var matched *store.User
     for _, u := range users {
-        if (strings.EqualFold(u.Username, identifier) || strings.EqualFold(u.Email, identifier)) && u.Password == password {
-            return CreateSession(u.Username)
+        if strings.EqualFold(u.Username, identifier) || strings.EqualFold(u.Email, identifier) {
+            u := u
+            matched = &u
+            break
+        }
+    }
+
+    // Always run the comparison so unknown users take the same time as wrong passwords
+    stored := dummyPassword
+    if matched != nil {
+        stored = matched.Password
+        key = lockoutKey(matched.Username)
+        if err := checkLockout(key); err != nil {
+            return "", err
+        }
+    }
+    ok := subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+
+    if matched == nil || !ok {
+        if matched != nil {
+            recordFailedLogin(key)
         }
+        return "", errors.New("invalid credentials")
     }
-    return "", errors.New("invalid credentials")
+
+    _ = ClearLockout(key)
+    return CreateSession(matched.Username)
 }
 
 func loadUsers() ([]store.User, error) {
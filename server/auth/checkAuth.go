@@ -1,8 +1,11 @@
 package auth
 
 import (
-    "github.com/gofiber/fiber/v2"
+    "math"
+    "strconv"
     "strings"
+
+    "github.com/gofiber/fiber/v2"
 )
 
 func CheckAuth(c *fiber.Ctx) error {
@@ -17,6 +20,9 @@ func CheckAuth(c *fiber.Ctx) error {
         return c.Status(401).JSON(fiber.Map{"error": "missing or invalid authorization header"})
     }
     sessionID := authHeader[7:]
+    if IsAPIKey(sessionID) {
+        return checkAPIKey(c, sessionID)
+    }
     valid, err := IsSessionValid(sessionID)
     if err != nil || !valid {
         return c.Status(401).JSON(fiber.Map{"error": "invalid session"})
@@ -24,6 +30,19 @@ func CheckAuth(c *fiber.Ctx) error {
     return c.Next()
 }
 
+// checkAPIKey admits a request carrying an API key, subject to the key's rate limit
+func checkAPIKey(c *fiber.Ctx, token string) error {
+    _, key, err := GetUserByAPIKey(token)
+    if err != nil {
+        return c.Status(401).JSON(fiber.Map{"error": "invalid API key"})
+    }
+    if wait, err := allowAPIKeyRequest(key.ID); err != nil {
+        c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+        return c.Status(429).JSON(fiber.Map{"error": err.Error()})
+    }
+    return c.Next()
+}
+
 func GetUserInfo(c *fiber.Ctx) error {
     path := c.Path()
     // Allow /api/v1/auth*, /api/v1/info*, /api/v1/ws*, /api/v1/login*, and /api/v1/register* without auth (mirroring CheckAuth)
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	store "nadhi.dev/sarvar/fun/database"
+	"nadhi.dev/sarvar/fun/db"
+)
+
+// ErrAccountLocked is returned by Login while a username is locked out
+var ErrAccountLocked = errors.New("account temporarily locked")
+
+const (
+	// lockoutThreshold is the number of failures between each lockout step
+	lockoutThreshold = 5
+	lockoutBase      = 5 * time.Minute
+	lockoutMax       = 24 * time.Hour
+)
+
+// lockoutMu serialises the read-modify-write of lockout records, so
+// concurrent failed logins each count
+var lockoutMu sync.Mutex
+
+// lockoutKey normalises an identifier so username/email casing can't dodge the counter
+func lockoutKey(identifier string) string {
+	return strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// lockoutDuration returns how long to lock after the given number of failures.
+// Locks kick in at every multiple of lockoutThreshold and double each step.
+func lockoutDuration(failures int) time.Duration {
+	if failures < lockoutThreshold || failures%lockoutThreshold != 0 {
+		return 0
+	}
+	d := lockoutBase
+	for step := failures/lockoutThreshold - 1; step > 0; step-- {
+		d *= 2
+		if d >= lockoutMax {
+			return lockoutMax
+		}
+	}
+	return d
+}
+
+// checkLockout returns ErrAccountLocked if the key is currently locked
+func checkLockout(key string) error {
+	lockout, err := store.GetLockout(db.LockoutsDB, key)
+	if err != nil || lockout == nil {
+		return nil
+	}
+	now := time.Now()
+	if lockout.IsLocked(now) {
+		remaining := lockout.LockedUntil.Sub(now).Round(time.Second)
+		return fmt.Errorf("%w: try again in %s", ErrAccountLocked, remaining)
+	}
+	return nil
+}
+
+// recordFailedLogin bumps the failure counter and applies a lock when a
+// threshold is hit. Only called for existing users, so guessing random
+// usernames can't grow the lockouts store.
+func recordFailedLogin(key string) {
+	lockoutMu.Lock()
+	defer lockoutMu.Unlock()
+
+	lockout, err := store.GetLockout(db.LockoutsDB, key)
+	if err != nil || lockout == nil {
+		lockout = &store.LoginLockout{Username: key}
+	}
+	now := time.Now()
+	lockout.Failures++
+	lockout.LastFailure = now
+	if d := lockoutDuration(lockout.Failures); d > 0 {
+		lockout.LockedUntil = now.Add(d)
+	}
+	_ = store.SaveLockout(db.LockoutsDB, *lockout)
+}
+
+// ClearLockout resets the failure counter for a username
+func ClearLockout(username string) error {
+	lockoutMu.Lock()
+	defer lockoutMu.Unlock()
+	return store.ClearLockout(db.LockoutsDB, lockoutKey(username))
+}
@@ -1,14 +1,28 @@
 package auth
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"math/rand"
+	"strings"
 	"time"
 
+	"nadhi.dev/sarvar/fun/config"
 	store "nadhi.dev/sarvar/fun/database"
 	"nadhi.dev/sarvar/fun/db"
 )
 
+// ErrMaxSessions is returned when a login would exceed MAX_SESSIONS and the
+// configured policy is to reject rather than evict
+var ErrMaxSessions = errors.New("maximum sessions reached")
+
+// Session limit policies for SESSION_LIMIT_POLICY
+const (
+    SessionPolicyEvict  = "evict"
+    SessionPolicyReject = "reject"
+)
+
 type Session struct {
     ID       string `json:"id"`
     Username string `json:"username"`
@@ -24,7 +38,13 @@ func generateSessionID() string {
     return "nadhi.dev_" + string(b)
 }
 
+// GetUserBySession resolves a bearer token to its user. API keys are
+// accepted too, so handlers work the same for either kind of token.
 func GetUserBySession(sessionID string) (*store.User, error) {
+    if IsAPIKey(sessionID) {
+        user, _, err := GetUserByAPIKey(sessionID)
+        return user, err
+    }
     s, err := store.GetSession(db.SessionsDB, sessionID)
     if err != nil {
         return nil, err
@@ -49,8 +69,12 @@ func GetUserBySession(sessionID string) (*store.User, error) {
 }
 
 func CreateSession(username string) (string, error) {
+    if err := enforceSessionLimit(username); err != nil {
+        return "", err
+    }
+
     id := generateSessionID()
-    session := store.Session{ID: id, Data: map[string]any{"username": username}}
+    session := store.Session{ID: id, Data: map[string]any{"username": username}, CreatedAt: time.Now()}
     err := store.AddSession(db.SessionsDB, session)
     if err != nil {
         return "", err
@@ -58,10 +82,74 @@ func CreateSession(username string) (string, error) {
     return id, nil
 }
 
+// IsSessionValid reports whether a bearer token is a live session or a
+// known API key
 func IsSessionValid(sessionID string) (bool, error) {
+    if IsAPIKey(sessionID) {
+        _, _, err := GetUserByAPIKey(sessionID)
+        return err == nil, nil
+    }
     s, err := store.GetSession(db.SessionsDB, sessionID)
     if err != nil {
         return false, err
     }
     return s != nil, nil
+}
+
+// enforceSessionLimit makes room for a new session according to MAX_SESSIONS.
+// With the "evict" policy (default) the oldest sessions are dropped, with
+// "reject" the login fails with ErrMaxSessions.
+func enforceSessionLimit(username string) error {
+    maxSessions := config.GetConfigInt("MAX_SESSIONS", 0)
+    if maxSessions <= 0 {
+        return nil
+    }
+
+    sessions, err := store.GetSessionsByUser(db.SessionsDB, username)
+    if err != nil {
+        return err
+    }
+    if len(sessions) < maxSessions {
+        return nil
+    }
+
+    policy := strings.ToLower(config.GetConfigString("SESSION_LIMIT_POLICY", SessionPolicyEvict))
+    if policy == SessionPolicyReject {
+        return ErrMaxSessions
+    }
+
+    // Sessions are sorted oldest first
+    for _, s := range sessions[:len(sessions)-maxSessions+1] {
+        if err := store.RemoveSession(db.SessionsDB, s.ID); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// ListSessions returns the active sessions for a user, oldest first
+func ListSessions(username string) ([]store.Session, error) {
+    return store.GetSessionsByUser(db.SessionsDB, username)
+}
+
+// SessionPublicID returns the ID a session is listed under: the first 8
+// bytes of its token's SHA-256, in hex. The token itself is the bearer
+// credential, so it never leaves the server.
+func SessionPublicID(sessionID string) string {
+    sum := sha256.Sum256([]byte(sessionID))
+    return hex.EncodeToString(sum[:8])
+}
+
+// RevokeSession removes the user's session listed under publicID
+func RevokeSession(username, publicID string) error {
+    sessions, err := ListSessions(username)
+    if err != nil {
+        return err
+    }
+    for _, s := range sessions {
+        if SessionPublicID(s.ID) == publicID {
+            return store.RemoveSession(db.SessionsDB, s.ID)
+        }
+    }
+    return errors.New("session not found")
 }
\ No newline at end of file
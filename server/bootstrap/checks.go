@@ -129,6 +129,8 @@ func createDirectories() error {
 		"./zp-database/notebooks",
 		"./zp-database/queue",
 		"./zp-database/styles",
+		"./zp-database/lockouts",
+		"./zp-database/modes",
 		"./storage/bucket",
 		"./storage/queue_data",
 		"./generated",
@@ -170,6 +172,77 @@ func checkConfigFile() error {
   "AI_MAIN_MODEL": "",
   "AI_UTILITY_MODEL": "",
   "MAX_SESSIONS": 2,
+  "SESSION_LIMIT_POLICY": "evict",
+  "MAX_JOBS_PER_USER": 2,
+  "LOCAL_ONLY": false,
+  "LOCAL_ONLY_ALLOW_REMOTE_AI": false,
+  "MAX_LATEX_BYTES": 150000,
+  "MAX_LATEX_CONTINUATIONS": 2,
+  "CORS_ALLOWED_ORIGINS": "",
+  "CORS_ALLOWED_METHODS": "GET,POST,PUT,DELETE,OPTIONS",
+  "CORS_ALLOWED_HEADERS": "Origin,Content-Type,Accept,Authorization",
+  "LATEX_POSTPROCESSORS": "strip-fences,smart-quotes,unicode-math",
+  "WEBHOOK_SECRET": "",
+  "STORAGE_QUOTA_MB": 0,
+  "GEMINI_UPLOAD_THRESHOLD_MB": 4,
+  "PDF_THUMBNAILS": true,
+  "PIPELINE_WRITE_BEHIND": false,
+  "PIPELINE_FLUSH_SECONDS": 5,
+  "MAX_CONCURRENT_COMPILES": 0,
+  "SHEET_ANALYTICS": true,
+  "REQUIRE_SIGNED_DOWNLOADS": true,
+  "DOWNLOAD_URL_TTL_SECONDS": 300,
+  "STUCK_JOB_MINUTES": 15,
+  "PARENT_CONTEXT_CHARS": 8000,
+  "AI_CALL_ATTEMPTS": 1,
+  "AI_FAIL_FAST": false,
+  "OUTBOUND_PROXY": "",
+  "OUTBOUND_CA_FILES": "",
+  "REDACT_PII": false,
+  "REDACT_PII_PATTERNS": [],
+  "CONVERSATION_MAX_MESSAGES": 200,
+  "CONVERSATION_MAX_BYTES": 2097152,
+  "DETECT_ATTACHMENT_LANGUAGE": false,
+  "API_KEY_RATE_LIMIT": 60,
+  "TECTONIC_FLAGS": "--untrusted",
+  "MODEL_ROUTING_SMALL_BYTES": 0,
+  "MODEL_ROUTING_LARGE_BYTES": 0,
+  "OPENROUTER_REFERER": "https://github.com/Nadhila-dot/AIotate",
+  "OPENROUTER_TITLE": "AIotate",
+  "OPENROUTER_PROVIDER": {},
+  "OPENROUTER_TRANSFORMS": [],
+  "FALLBACK_STYLE_PROMPT": "",
+  "PDF_METADATA": true,
+  "SELF_REVIEW": false,
+  "LATEX_PACKAGE_CHECK": true,
+  "LATEX_ALLOWED_PACKAGES": [],
+  "TECTONIC_TRANSIENT_RETRIES": 3,
+  "TECTONIC_RETRY_BACKOFF_MS": 2000,
+  "AI_STOP_SEQUENCES": {},
+  "MAX_STORED_JOBS_PER_USER": 0,
+  "STORED_JOBS_POLICY": "reject",
+  "DRAFT_THEN_REFINE": false,
+  "DEFAULT_MODE": "notes",
+  "JOB_DEADLINE_MINUTES": 30,
+  "SUGGEST_TAGS_COOLDOWN_MS": 750,
+  "AI_MODEL_CATALOG_LIVE": true,
+  "SHEET_ABSTRACTS": false,
+  "OPENROUTER_STREAMING": true,
+  "WEBSOCKET_PING_SECONDS": 30,
+  "ON_COMPLETE_CMD": "",
+  "ON_COMPLETE_TIMEOUT_SECONDS": 60,
+  "ATTACHMENT_CONTEXT_CHARS": 60000,
+  "ATTACHMENT_ROLE_PRIORITY": ["template", "reference"],
+  "SAFE_MODE": false,
+  "PROMPT_TEMPLATES": {},
+  "ATTACHMENT_INJECTION_POLICY": "off",
+  "JOB_ARCHIVE_AFTER_DAYS": 0,
+  "JOB_ARCHIVE_DIR": "./storage/archive",
+  "MIN_REQUEST_SIGNAL_WORDS": 3,
+  "PDF_FILENAME_PATTERN": "{subject}-{course}-{date}",
+  "PIPELINE_JOB_CACHE": true,
+  "WEBSOCKET_MAX_CONNECTIONS": 1000,
+  "WEB_SEARCH_MIN_RESULTS": 2,
   "SHEET_QUEUE_DIR": "./storage/queue_data"
 }
 `
@@ -17,13 +17,84 @@ func InitConfigs() {
 
 		// Create a default config file
 		defaultConfig := map[string]interface{}{
-			"AI_PROVIDER":        "gemini",
-			"GEMINI_API_KEY":     "",
-			"OPENROUTER_API_KEY": "",
-			"AI_MAIN_MODEL":      "",
-			"AI_UTILITY_MODEL":   "",
-			"MAX_SESSIONS":       2,
-			"SHEET_QUEUE_DIR":    "./storage/queue_data",
+			"AI_PROVIDER":                 "gemini",
+			"GEMINI_API_KEY":              "",
+			"OPENROUTER_API_KEY":          "",
+			"AI_MAIN_MODEL":               "",
+			"AI_UTILITY_MODEL":            "",
+			"MAX_SESSIONS":                2,
+			"SESSION_LIMIT_POLICY":        "evict",
+			"MAX_JOBS_PER_USER":           2,
+			"LOCAL_ONLY":                  false,
+			"LOCAL_ONLY_ALLOW_REMOTE_AI":  false,
+			"MAX_LATEX_BYTES":             150000,
+			"MAX_LATEX_CONTINUATIONS":     2,
+			"CORS_ALLOWED_ORIGINS":        "",
+			"CORS_ALLOWED_METHODS":        "GET,POST,PUT,DELETE,OPTIONS",
+			"CORS_ALLOWED_HEADERS":        "Origin,Content-Type,Accept,Authorization",
+			"LATEX_POSTPROCESSORS":        "strip-fences,smart-quotes,unicode-math",
+			"WEBHOOK_SECRET":              "",
+			"STORAGE_QUOTA_MB":            0,
+			"GEMINI_UPLOAD_THRESHOLD_MB":  4,
+			"PDF_THUMBNAILS":              true,
+			"PIPELINE_WRITE_BEHIND":       false,
+			"PIPELINE_FLUSH_SECONDS":      5,
+			"MAX_CONCURRENT_COMPILES":     0,
+			"SHEET_ANALYTICS":             true,
+			"REQUIRE_SIGNED_DOWNLOADS":    true,
+			"DOWNLOAD_URL_TTL_SECONDS":    300,
+			"STUCK_JOB_MINUTES":           15,
+			"PARENT_CONTEXT_CHARS":        8000,
+			"AI_CALL_ATTEMPTS":            1,
+			"AI_FAIL_FAST":                false,
+			"OUTBOUND_PROXY":              "",
+			"OUTBOUND_CA_FILES":           "",
+			"REDACT_PII":                  false,
+			"REDACT_PII_PATTERNS":         []interface{}{},
+			"CONVERSATION_MAX_MESSAGES":   200,
+			"CONVERSATION_MAX_BYTES":      2097152,
+			"DETECT_ATTACHMENT_LANGUAGE":  false,
+			"API_KEY_RATE_LIMIT":          60,
+			"TECTONIC_FLAGS":              "--untrusted",
+			"MODEL_ROUTING_SMALL_BYTES":   0,
+			"MODEL_ROUTING_LARGE_BYTES":   0,
+			"OPENROUTER_REFERER":          "https://github.com/Nadhila-dot/AIotate",
+			"OPENROUTER_TITLE":            "AIotate",
+			"OPENROUTER_PROVIDER":         map[string]interface{}{},
+			"OPENROUTER_TRANSFORMS":       []interface{}{},
+			"FALLBACK_STYLE_PROMPT":       "",
+			"PDF_METADATA":                true,
+			"SELF_REVIEW":                 false,
+			"LATEX_PACKAGE_CHECK":         true,
+			"LATEX_ALLOWED_PACKAGES":      []interface{}{},
+			"TECTONIC_TRANSIENT_RETRIES":  3,
+			"TECTONIC_RETRY_BACKOFF_MS":   2000,
+			"AI_STOP_SEQUENCES":           map[string]interface{}{},
+			"MAX_STORED_JOBS_PER_USER":    0,
+			"STORED_JOBS_POLICY":          "reject",
+			"DRAFT_THEN_REFINE":           false,
+			"DEFAULT_MODE":                "notes",
+			"JOB_DEADLINE_MINUTES":        30,
+			"SUGGEST_TAGS_COOLDOWN_MS":    750,
+			"AI_MODEL_CATALOG_LIVE":       true,
+			"SHEET_ABSTRACTS":             false,
+			"OPENROUTER_STREAMING":        true,
+			"WEBSOCKET_PING_SECONDS":      30,
+			"ON_COMPLETE_CMD":             "",
+			"ON_COMPLETE_TIMEOUT_SECONDS": 60,
+			"ATTACHMENT_CONTEXT_CHARS":    60000,
+			"ATTACHMENT_ROLE_PRIORITY":    []interface{}{"template", "reference"},
+			"SAFE_MODE":                   false,
+			"PROMPT_TEMPLATES":            map[string]interface{}{},
+			"ATTACHMENT_INJECTION_POLICY": "off",
+			"JOB_ARCHIVE_AFTER_DAYS":      0,
+			"JOB_ARCHIVE_DIR":             "./storage/archive",
+			"MIN_REQUEST_SIGNAL_WORDS":    3,
+			"PDF_FILENAME_PATTERN":        "{subject}-{course}-{date}",
+			"PIPELINE_JOB_CACHE":          true,
+			"WEBSOCKET_MAX_CONNECTIONS":   1000,
+			"WEB_SEARCH_MIN_RESULTS":      2,
+			"SHEET_QUEUE_DIR":             "./storage/queue_data",
 		}
 
 		if err := config.SaveConfig(defaultConfig); err != nil {
@@ -77,6 +148,371 @@ func InitConfigs() {
 			updated = true
 		}
 
+		if _, ok := cfg["SESSION_LIMIT_POLICY"]; !ok {
+			cfg["SESSION_LIMIT_POLICY"] = "evict"
+			updated = true
+		}
+
+		if _, ok := cfg["MAX_JOBS_PER_USER"]; !ok {
+			cfg["MAX_JOBS_PER_USER"] = 2
+			updated = true
+		}
+
+		if _, ok := cfg["LOCAL_ONLY"]; !ok {
+			cfg["LOCAL_ONLY"] = false
+			updated = true
+		}
+
+		if _, ok := cfg["LOCAL_ONLY_ALLOW_REMOTE_AI"]; !ok {
+			cfg["LOCAL_ONLY_ALLOW_REMOTE_AI"] = false
+			updated = true
+		}
+
+		if _, ok := cfg["MAX_LATEX_BYTES"]; !ok {
+			cfg["MAX_LATEX_BYTES"] = 150000
+			updated = true
+		}
+
+		if _, ok := cfg["MAX_LATEX_CONTINUATIONS"]; !ok {
+			cfg["MAX_LATEX_CONTINUATIONS"] = 2
+			updated = true
+		}
+
+		if _, ok := cfg["CORS_ALLOWED_ORIGINS"]; !ok {
+			cfg["CORS_ALLOWED_ORIGINS"] = ""
+			updated = true
+		}
+
+		if _, ok := cfg["CORS_ALLOWED_METHODS"]; !ok {
+			cfg["CORS_ALLOWED_METHODS"] = "GET,POST,PUT,DELETE,OPTIONS"
+			updated = true
+		}
+
+		if _, ok := cfg["CORS_ALLOWED_HEADERS"]; !ok {
+			cfg["CORS_ALLOWED_HEADERS"] = "Origin,Content-Type,Accept,Authorization"
+			updated = true
+		}
+
+		if _, ok := cfg["LATEX_POSTPROCESSORS"]; !ok {
+			cfg["LATEX_POSTPROCESSORS"] = "strip-fences,smart-quotes,unicode-math"
+			updated = true
+		}
+
+		if _, ok := cfg["WEBHOOK_SECRET"]; !ok {
+			cfg["WEBHOOK_SECRET"] = ""
+			updated = true
+		}
+
+		if _, ok := cfg["STORAGE_QUOTA_MB"]; !ok {
+			cfg["STORAGE_QUOTA_MB"] = 0
+			updated = true
+		}
+
+		if _, ok := cfg["GEMINI_UPLOAD_THRESHOLD_MB"]; !ok {
+			cfg["GEMINI_UPLOAD_THRESHOLD_MB"] = 4
+			updated = true
+		}
+
+		if _, ok := cfg["PDF_THUMBNAILS"]; !ok {
+			cfg["PDF_THUMBNAILS"] = true
+			updated = true
+		}
+
+		if _, ok := cfg["PIPELINE_WRITE_BEHIND"]; !ok {
+			cfg["PIPELINE_WRITE_BEHIND"] = false
+			updated = true
+		}
+
+		if _, ok := cfg["PIPELINE_FLUSH_SECONDS"]; !ok {
+			cfg["PIPELINE_FLUSH_SECONDS"] = 5
+			updated = true
+		}
+
+		if _, ok := cfg["MAX_CONCURRENT_COMPILES"]; !ok {
+			cfg["MAX_CONCURRENT_COMPILES"] = 0
+			updated = true
+		}
+
+		if _, ok := cfg["SHEET_ANALYTICS"]; !ok {
+			cfg["SHEET_ANALYTICS"] = true
+			updated = true
+		}
+
+		if _, ok := cfg["REQUIRE_SIGNED_DOWNLOADS"]; !ok {
+			cfg["REQUIRE_SIGNED_DOWNLOADS"] = true
+			updated = true
+		}
+
+		// The signing secret is read from the environment only; set.json is
+		// readable by any signed-in user
+		if secret, ok := cfg["DOWNLOAD_SIGNING_SECRET"]; ok {
+			if s, _ := secret.(string); s != "" {
+				logg.Warning("DOWNLOAD_SIGNING_SECRET in set.json is ignored and has been removed; set it as an environment variable")
+			}
+			delete(cfg, "DOWNLOAD_SIGNING_SECRET")
+			updated = true
+		}
+
+		if _, ok := cfg["DOWNLOAD_URL_TTL_SECONDS"]; !ok {
+			cfg["DOWNLOAD_URL_TTL_SECONDS"] = 300
+			updated = true
+		}
+
+		if _, ok := cfg["STUCK_JOB_MINUTES"]; !ok {
+			cfg["STUCK_JOB_MINUTES"] = 15
+			updated = true
+		}
+
+		if _, ok := cfg["PARENT_CONTEXT_CHARS"]; !ok {
+			cfg["PARENT_CONTEXT_CHARS"] = 8000
+			updated = true
+		}
+
+		if _, ok := cfg["AI_CALL_ATTEMPTS"]; !ok {
+			cfg["AI_CALL_ATTEMPTS"] = 1
+			updated = true
+		}
+
+		if _, ok := cfg["AI_FAIL_FAST"]; !ok {
+			cfg["AI_FAIL_FAST"] = false
+			updated = true
+		}
+
+		if _, ok := cfg["OUTBOUND_PROXY"]; !ok {
+			cfg["OUTBOUND_PROXY"] = ""
+			updated = true
+		}
+
+		if _, ok := cfg["OUTBOUND_CA_FILES"]; !ok {
+			cfg["OUTBOUND_CA_FILES"] = ""
+			updated = true
+		}
+
+		if _, ok := cfg["REDACT_PII"]; !ok {
+			cfg["REDACT_PII"] = false
+			updated = true
+		}
+
+		if _, ok := cfg["REDACT_PII_PATTERNS"]; !ok {
+			cfg["REDACT_PII_PATTERNS"] = []interface{}{}
+			updated = true
+		}
+
+		if _, ok := cfg["CONVERSATION_MAX_MESSAGES"]; !ok {
+			cfg["CONVERSATION_MAX_MESSAGES"] = 200
+			updated = true
+		}
+
+		if _, ok := cfg["CONVERSATION_MAX_BYTES"]; !ok {
+			cfg["CONVERSATION_MAX_BYTES"] = 2097152
+			updated = true
+		}
+
+		if _, ok := cfg["DETECT_ATTACHMENT_LANGUAGE"]; !ok {
+			cfg["DETECT_ATTACHMENT_LANGUAGE"] = false
+			updated = true
+		}
+
+		if _, ok := cfg["API_KEY_RATE_LIMIT"]; !ok {
+			cfg["API_KEY_RATE_LIMIT"] = 60
+			updated = true
+		}
+
+		if _, ok := cfg["TECTONIC_FLAGS"]; !ok {
+			cfg["TECTONIC_FLAGS"] = "--untrusted"
+			updated = true
+		}
+
+		if _, ok := cfg["MODEL_ROUTING_SMALL_BYTES"]; !ok {
+			cfg["MODEL_ROUTING_SMALL_BYTES"] = 0
+			updated = true
+		}
+
+		if _, ok := cfg["MODEL_ROUTING_LARGE_BYTES"]; !ok {
+			cfg["MODEL_ROUTING_LARGE_BYTES"] = 0
+			updated = true
+		}
+
+		if _, ok := cfg["OPENROUTER_REFERER"]; !ok {
+			cfg["OPENROUTER_REFERER"] = "https://github.com/Nadhila-dot/AIotate"
+			updated = true
+		}
+
+		if _, ok := cfg["OPENROUTER_TITLE"]; !ok {
+			cfg["OPENROUTER_TITLE"] = "AIotate"
+			updated = true
+		}
+
+		if _, ok := cfg["OPENROUTER_PROVIDER"]; !ok {
+			cfg["OPENROUTER_PROVIDER"] = map[string]interface{}{}
+			updated = true
+		}
+
+		if _, ok := cfg["OPENROUTER_TRANSFORMS"]; !ok {
+			cfg["OPENROUTER_TRANSFORMS"] = []interface{}{}
+			updated = true
+		}
+
+		if _, ok := cfg["FALLBACK_STYLE_PROMPT"]; !ok {
+			cfg["FALLBACK_STYLE_PROMPT"] = ""
+			updated = true
+		}
+
+		if _, ok := cfg["PDF_METADATA"]; !ok {
+			cfg["PDF_METADATA"] = true
+			updated = true
+		}
+
+		if _, ok := cfg["SELF_REVIEW"]; !ok {
+			cfg["SELF_REVIEW"] = false
+			updated = true
+		}
+
+		if _, ok := cfg["LATEX_PACKAGE_CHECK"]; !ok {
+			cfg["LATEX_PACKAGE_CHECK"] = true
+			updated = true
+		}
+
+		if _, ok := cfg["LATEX_ALLOWED_PACKAGES"]; !ok {
+			cfg["LATEX_ALLOWED_PACKAGES"] = []interface{}{}
+			updated = true
+		}
+
+		if _, ok := cfg["TECTONIC_TRANSIENT_RETRIES"]; !ok {
+			cfg["TECTONIC_TRANSIENT_RETRIES"] = 3
+			updated = true
+		}
+
+		if _, ok := cfg["TECTONIC_RETRY_BACKOFF_MS"]; !ok {
+			cfg["TECTONIC_RETRY_BACKOFF_MS"] = 2000
+			updated = true
+		}
+
+		if _, ok := cfg["AI_STOP_SEQUENCES"]; !ok {
+			cfg["AI_STOP_SEQUENCES"] = map[string]interface{}{}
+			updated = true
+		}
+
+		if _, ok := cfg["MAX_STORED_JOBS_PER_USER"]; !ok {
+			cfg["MAX_STORED_JOBS_PER_USER"] = 0
+			updated = true
+		}
+
+		if _, ok := cfg["STORED_JOBS_POLICY"]; !ok {
+			cfg["STORED_JOBS_POLICY"] = "reject"
+			updated = true
+		}
+
+		if _, ok := cfg["DRAFT_THEN_REFINE"]; !ok {
+			cfg["DRAFT_THEN_REFINE"] = false
+			updated = true
+		}
+
+		if _, ok := cfg["DEFAULT_MODE"]; !ok {
+			cfg["DEFAULT_MODE"] = "notes"
+			updated = true
+		}
+
+		if _, ok := cfg["JOB_DEADLINE_MINUTES"]; !ok {
+			cfg["JOB_DEADLINE_MINUTES"] = 30
+			updated = true
+		}
+
+		if _, ok := cfg["SUGGEST_TAGS_COOLDOWN_MS"]; !ok {
+			cfg["SUGGEST_TAGS_COOLDOWN_MS"] = 750
+			updated = true
+		}
+
+		if _, ok := cfg["AI_MODEL_CATALOG_LIVE"]; !ok {
+			cfg["AI_MODEL_CATALOG_LIVE"] = true
+			updated = true
+		}
+
+		if _, ok := cfg["SHEET_ABSTRACTS"]; !ok {
+			cfg["SHEET_ABSTRACTS"] = false
+			updated = true
+		}
+
+		if _, ok := cfg["OPENROUTER_STREAMING"]; !ok {
+			cfg["OPENROUTER_STREAMING"] = true
+			updated = true
+		}
+
+		if _, ok := cfg["WEBSOCKET_PING_SECONDS"]; !ok {
+			cfg["WEBSOCKET_PING_SECONDS"] = 30
+			updated = true
+		}
+
+		if _, ok := cfg["ON_COMPLETE_CMD"]; !ok {
+			cfg["ON_COMPLETE_CMD"] = ""
+			updated = true
+		}
+
+		if _, ok := cfg["ON_COMPLETE_TIMEOUT_SECONDS"]; !ok {
+			cfg["ON_COMPLETE_TIMEOUT_SECONDS"] = 60
+			updated = true
+		}
+
+		if _, ok := cfg["ATTACHMENT_CONTEXT_CHARS"]; !ok {
+			cfg["ATTACHMENT_CONTEXT_CHARS"] = 60000
+			updated = true
+		}
+
+		if _, ok := cfg["ATTACHMENT_ROLE_PRIORITY"]; !ok {
+			cfg["ATTACHMENT_ROLE_PRIORITY"] = []interface{}{"template", "reference"}
+			updated = true
+		}
+
+		if _, ok := cfg["SAFE_MODE"]; !ok {
+			cfg["SAFE_MODE"] = false
+			updated = true
+		}
+
+		if _, ok := cfg["PROMPT_TEMPLATES"]; !ok {
+			cfg["PROMPT_TEMPLATES"] = map[string]interface{}{}
+			updated = true
+		}
+
+		if _, ok := cfg["ATTACHMENT_INJECTION_POLICY"]; !ok {
+			cfg["ATTACHMENT_INJECTION_POLICY"] = "off"
+			updated = true
+		}
+
+		if _, ok := cfg["JOB_ARCHIVE_AFTER_DAYS"]; !ok {
+			cfg["JOB_ARCHIVE_AFTER_DAYS"] = 0
+			updated = true
+		}
+
+		if _, ok := cfg["JOB_ARCHIVE_DIR"]; !ok {
+			cfg["JOB_ARCHIVE_DIR"] = "./storage/archive"
+			updated = true
+		}
+
+		if _, ok := cfg["MIN_REQUEST_SIGNAL_WORDS"]; !ok {
+			cfg["MIN_REQUEST_SIGNAL_WORDS"] = 3
+			updated = true
+		}
+
+		if _, ok := cfg["PDF_FILENAME_PATTERN"]; !ok {
+			cfg["PDF_FILENAME_PATTERN"] = "{subject}-{course}-{date}"
+			updated = true
+		}
+
+		if _, ok := cfg["PIPELINE_JOB_CACHE"]; !ok {
+			cfg["PIPELINE_JOB_CACHE"] = true
+			updated = true
+		}
+
+		if _, ok := cfg["WEBSOCKET_MAX_CONNECTIONS"]; !ok {
+			cfg["WEBSOCKET_MAX_CONNECTIONS"] = 1000
+			updated = true
+		}
+
+		if _, ok := cfg["WEB_SEARCH_MIN_RESULTS"]; !ok {
+			cfg["WEB_SEARCH_MIN_RESULTS"] = 2
+			updated = true
+		}
+
 		if _, ok := cfg["SHEET_QUEUE_DIR"]; !ok {
 			cfg["SHEET_QUEUE_DIR"] = "./storage/queue_data"
 			updated = true
@@ -2,28 +2,55 @@ package config
 
 import (
 	"encoding/json"
+	"maps"
 	"os"
+	"sync"
+	"time"
+
+	logg "nadhi.dev/sarvar/fun/logs"
 )
 
 const ConfigPath = "./set.json"
 
-// GetConfigValue retrieves a specific value from the config
-func GetConfigValue(key string) interface{} {
-	data, err := os.ReadFile(ConfigPath)
-	if err != nil {
-		return nil
+// configCacheTTL is how long a read of set.json is reused before the file is
+// read again, so manual edits still apply within a few seconds
+const configCacheTTL = 2 * time.Second
+
+var (
+	configCacheMu sync.Mutex
+	// cachedConfig is the last config read successfully. It is never
+	// mutated, only replaced.
+	cachedConfig map[string]interface{}
+	cachedAt     time.Time
+)
+
+// loadConfig returns the config, reading set.json at most once per
+// configCacheTTL. When a read fails, e.g. while the file is being replaced,
+// the last known good config is used instead of failing the caller.
+func loadConfig() (map[string]interface{}, error) {
+	configCacheMu.Lock()
+	defer configCacheMu.Unlock()
+
+	if cachedConfig != nil && time.Since(cachedAt) < configCacheTTL {
+		return cachedConfig, nil
 	}
 
-	var config map[string]interface{}
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil
+	config, err := readConfigFile()
+	if err != nil {
+		if cachedConfig != nil {
+			logg.Warning("Failed to read " + ConfigPath + ", using last known good config: " + err.Error())
+			return cachedConfig, nil
+		}
+		return nil, err
 	}
 
-	return config[key]
+	cachedConfig = config
+	cachedAt = time.Now()
+	return config, nil
 }
 
-// GetConfig retrieves the entire configuration
-func GetConfig() (map[string]interface{}, error) {
+// readConfigFile reads and parses set.json
+func readConfigFile() (map[string]interface{}, error) {
 	data, err := os.ReadFile(ConfigPath)
 	if err != nil {
 		return nil, err
@@ -37,6 +64,34 @@ func GetConfig() (map[string]interface{}, error) {
 	return config, nil
 }
 
+// InvalidateConfigCache makes the next config lookup read set.json again
+func InvalidateConfigCache() {
+	configCacheMu.Lock()
+	defer configCacheMu.Unlock()
+	cachedAt = time.Time{}
+}
+
+// GetConfigValue retrieves a specific value from the config
+func GetConfigValue(key string) interface{} {
+	config, err := loadConfig()
+	if err != nil {
+		return nil
+	}
+
+	return config[key]
+}
+
+// GetConfig retrieves the entire configuration. The returned map is a copy
+// the caller may modify.
+func GetConfig() (map[string]interface{}, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return maps.Clone(config), nil
+}
+
 // GetAPIKey retrieves the AI API key from config
 func GetAPIKey() (string, error) {
 	config, err := GetConfig()
@@ -51,3 +106,34 @@ func GetAPIKey() (string, error) {
 
 	return apiKey, nil
 }
+
+// GetConfigInt retrieves a numeric config value, falling back when it is
+// missing or not a number. JSON numbers decode as float64 so both are accepted.
+func GetConfigInt(key string, fallback int) int {
+	switch v := GetConfigValue(key).(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return fallback
+	}
+}
+
+// GetConfigString retrieves a string config value, falling back when it is
+// missing or empty
+func GetConfigString(key string, fallback string) string {
+	if v, ok := GetConfigValue(key).(string); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+// GetConfigBool retrieves a boolean config value, falling back when it is
+// missing or not a boolean
+func GetConfigBool(key string, fallback bool) bool {
+	if v, ok := GetConfigValue(key).(bool); ok {
+		return v
+	}
+	return fallback
+}
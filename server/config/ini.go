@@ -17,7 +17,11 @@ func SaveConfig(config map[string]interface{}) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(ConfigPath, data, 0644)
+	if err := os.WriteFile(ConfigPath, data, 0644); err != nil {
+		return err
+	}
+	InvalidateConfigCache()
+	return nil
 }
 
 // UpdateConfigValue updates a specific configuration value
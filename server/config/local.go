@@ -0,0 +1,19 @@
+package config
+
+import "errors"
+
+// ErrLocalOnly is returned by features that need the network while LOCAL_ONLY is set
+var ErrLocalOnly = errors.New("disabled in LOCAL_ONLY mode")
+
+// IsLocalOnly reports whether LOCAL_ONLY is enabled. In this mode the server
+// sends no identifying headers, performs no web search and refuses remote
+// AI providers unless LOCAL_ONLY_ALLOW_REMOTE_AI is also set.
+func IsLocalOnly() bool {
+	return GetConfigBool("LOCAL_ONLY", false)
+}
+
+// AllowRemoteAI reports whether remote AI providers may be used. It is always
+// true outside LOCAL_ONLY mode.
+func AllowRemoteAI() bool {
+	return !IsLocalOnly() || GetConfigBool("LOCAL_ONLY_ALLOW_REMOTE_AI", false)
+}
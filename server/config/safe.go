@@ -0,0 +1,8 @@
+package config
+
+// IsSafeMode reports whether SAFE_MODE is enabled. In this mode sheets are
+// generated from the textual request alone: attachments are dropped and web
+// search is off for every job, whatever the request asks for.
+func IsSafeMode() bool {
+	return GetConfigBool("SAFE_MODE", false)
+}
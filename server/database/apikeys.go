@@ -0,0 +1,101 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// APIKey is a long-lived credential for programmatic access. Only a hash of
+// the key is stored; Prefix keeps its first characters so users can tell
+// their keys apart.
+type APIKey struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// AddAPIKey stores an API key, indexed by its hash
+func AddAPIKey(db *DB, key APIKey) error {
+	store, err := db.GetStore("apikeys")
+	if err != nil {
+		return err
+	}
+
+	var keys map[string]APIKey
+	if err := store.GetData(&keys); err != nil {
+		keys = make(map[string]APIKey)
+	}
+
+	keys[key.Hash] = key
+	return store.SetData(keys)
+}
+
+// GetAPIKeyByHash retrieves the API key with the given hash, or nil if none exists
+func GetAPIKeyByHash(db *DB, hash string) (*APIKey, error) {
+	store, err := db.GetStore("apikeys")
+	if err != nil {
+		return nil, err
+	}
+
+	var keys map[string]APIKey
+	if err := store.GetData(&keys); err != nil {
+		return nil, err
+	}
+
+	key, ok := keys[hash]
+	if !ok {
+		return nil, nil
+	}
+	return &key, nil
+}
+
+// GetAPIKeysByUser returns a user's API keys, oldest first
+func GetAPIKeysByUser(db *DB, username string) ([]APIKey, error) {
+	store, err := db.GetStore("apikeys")
+	if err != nil {
+		return nil, err
+	}
+
+	var keys map[string]APIKey
+	if err := store.GetData(&keys); err != nil {
+		return nil, err
+	}
+	return filterAPIKeysByUser(keys, username), nil
+}
+
+// RemoveAPIKey deletes a user's API key by ID. It reports whether a key was removed.
+func RemoveAPIKey(db *DB, username, id string) (bool, error) {
+	store, err := db.GetStore("apikeys")
+	if err != nil {
+		return false, err
+	}
+
+	var keys map[string]APIKey
+	if err := store.GetData(&keys); err != nil {
+		return false, err
+	}
+
+	for hash, key := range keys {
+		if key.ID == id && key.Username == username {
+			delete(keys, hash)
+			return true, store.SetData(keys)
+		}
+	}
+	return false, nil
+}
+
+func filterAPIKeysByUser(keys map[string]APIKey, username string) []APIKey {
+	result := make([]APIKey, 0)
+	for _, k := range keys {
+		if k.Username == username {
+			result = append(result, k)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
@@ -1,10 +1,21 @@
 package store
 
+import "fmt"
+
 type User struct {
-    Username string `json:"username"`
-    Email    string `json:"email"`
-    Password string `json:"password"`
-    Rank     string `json:"rank"`
+    Username    string          `json:"username"`
+    Email       string          `json:"email"`
+    Password    string          `json:"password"`
+    Rank        string          `json:"rank"`
+    Preferences UserPreferences `json:"preferences"`
+    // Variables fill {{name}} placeholders in generation requests
+    Variables   map[string]string `json:"variables,omitempty"`
+}
+
+// UserPreferences holds per-user defaults applied when a request omits them
+type UserPreferences struct {
+    DefaultMode  string `json:"defaultMode,omitempty"`
+    DefaultStyle string `json:"defaultStyle,omitempty"`
 }
 
 func AddUser(db *DB, user User) error {
@@ -59,4 +70,42 @@ func RemoveUser(db *DB, username string) error {
     }
     delete(users, username)
     return store.SetData(users)
-}
\ No newline at end of file
+}
+
+// UpdateUserPreferences replaces the preferences stored on a user record
+func UpdateUserPreferences(db *DB, username string, prefs UserPreferences) error {
+    store, err := db.GetStore("users")
+    if err != nil {
+        return err
+    }
+    var users map[string]User
+    if err := store.GetData(&users); err != nil {
+        return err
+    }
+    user, ok := users[username]
+    if !ok {
+        return fmt.Errorf("user %s not found", username)
+    }
+    user.Preferences = prefs
+    users[username] = user
+    return store.SetData(users)
+}
+
+// UpdateUserVariables replaces the template variables stored on a user record
+func UpdateUserVariables(db *DB, username string, vars map[string]string) error {
+    store, err := db.GetStore("users")
+    if err != nil {
+        return err
+    }
+    var users map[string]User
+    if err := store.GetData(&users); err != nil {
+        return err
+    }
+    user, ok := users[username]
+    if !ok {
+        return fmt.Errorf("user %s not found", username)
+    }
+    user.Variables = vars
+    users[username] = user
+    return store.SetData(users)
+}
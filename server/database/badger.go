@@ -140,7 +140,7 @@ func (bdb *BadgerDB) Backup(path string) error {
 
 // ExportToJSON exports all data to JSON files for debugging
 func (bdb *BadgerDB) ExportToJSON(outputDir string) error {
-	collections := []string{"users", "sessions", "notebooks", "queue", "styles"}
+	collections := []string{"users", "sessions", "notebooks", "queue", "styles", "lockouts", "modes", "apikeys"}
 
 	for _, collection := range collections {
 		var data map[string]interface{}
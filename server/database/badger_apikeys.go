@@ -0,0 +1,48 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// AddAPIKeyBadger stores an API key in BadgerDB, keyed by its hash
+func AddAPIKeyBadger(bdb *BadgerDB, key APIKey) error {
+	return bdb.Set(fmt.Sprintf("apikeys:%s", key.Hash), key)
+}
+
+// GetAPIKeyByHashBadger retrieves an API key from BadgerDB by its hash
+func GetAPIKeyByHashBadger(bdb *BadgerDB, hash string) (*APIKey, error) {
+	var key APIKey
+	err := bdb.Get(fmt.Sprintf("apikeys:%s", hash), &key)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetAPIKeysByUserBadger retrieves a user's API keys from BadgerDB, oldest first
+func GetAPIKeysByUserBadger(bdb *BadgerDB, username string) ([]APIKey, error) {
+	keys := make(map[string]APIKey)
+	if err := bdb.GetAll("apikeys:", &keys); err != nil {
+		return nil, err
+	}
+	return filterAPIKeysByUser(keys, username), nil
+}
+
+// RemoveAPIKeyBadger deletes a user's API key from BadgerDB by ID
+func RemoveAPIKeyBadger(bdb *BadgerDB, username, id string) (bool, error) {
+	keys, err := GetAPIKeysByUserBadger(bdb, username)
+	if err != nil {
+		return false, err
+	}
+	for _, key := range keys {
+		if key.ID == id {
+			return true, bdb.Delete(fmt.Sprintf("apikeys:%s", key.Hash))
+		}
+	}
+	return false, nil
+}
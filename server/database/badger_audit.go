@@ -0,0 +1,94 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// auditPrefix keys every audit entry; the rest of the key is the entry's
+// time, so entries sort oldest first
+const auditPrefix = "audit:"
+
+// auditSeq keeps keys unique for entries written in the same nanosecond
+var auditSeq atomic.Uint64
+
+// AuditEntry records one mutating action: who did what to which target
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Action string    `json:"action"`
+	Target string    `json:"target,omitempty"`
+}
+
+// AuditFilter narrows an audit query. Empty fields match everything.
+type AuditFilter struct {
+	User   string
+	Action string
+	Since  time.Time
+	// Limit keeps only the newest Limit matches; 0 keeps all
+	Limit int
+}
+
+// auditKey returns the key for an entry written at t
+func auditKey(t time.Time) string {
+	return fmt.Sprintf("%s%020d-%010d", auditPrefix, t.UnixNano(), auditSeq.Add(1))
+}
+
+// AppendAuditBadger adds an entry to the audit log. Entries are never
+// updated or deleted.
+func AppendAuditBadger(bdb *BadgerDB, entry AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Time = entry.Time.UTC()
+	return bdb.Set(auditKey(entry.Time), entry)
+}
+
+// GetAuditBadger returns the audit entries matching filter, newest first.
+// It walks the log backwards from the newest entry, so a query with a Limit
+// stops as soon as it has enough matches.
+func GetAuditBadger(bdb *BadgerDB, filter AuditFilter) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+
+	err := bdb.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(auditPrefix)
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		// Entries older than Since sort below this key
+		var stop []byte
+		if !filter.Since.IsZero() {
+			stop = []byte(fmt.Sprintf("%s%020d", auditPrefix, filter.Since.UnixNano()))
+		}
+		for it.Seek([]byte(auditPrefix + "\xff")); it.Valid(); it.Next() {
+			if stop != nil && bytes.Compare(it.Item().Key(), stop) < 0 {
+				break
+			}
+			var entry AuditEntry
+			err := it.Item().Value(func(val []byte) error {
+				return jsonUnmarshal(val, &entry)
+			})
+			if err != nil {
+				return err
+			}
+			if (filter.User != "" && entry.User != filter.User) || (filter.Action != "" && entry.Action != filter.Action) {
+				continue
+			}
+			entries = append(entries, entry)
+			if filter.Limit > 0 && len(entries) == filter.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetAuditBadger(t *testing.T) {
+	bdb, err := InitBadgerDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("InitBadgerDB: %v", err)
+	}
+	defer bdb.Close()
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	writes := []AuditEntry{
+		{User: "alice", Action: "style.create"},
+		{User: "bob", Action: "style.create"},
+		{User: "alice", Action: "job.delete"},
+		{User: "alice", Action: "style.create"},
+		{User: "bob", Action: "job.delete"},
+	}
+	for i, entry := range writes {
+		entry.Time = base.Add(time.Duration(i) * time.Minute)
+		if err := AppendAuditBadger(bdb, entry); err != nil {
+			t.Fatalf("AppendAuditBadger: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   []int // indexes into writes, newest first
+	}{
+		{name: "everything", filter: AuditFilter{}, want: []int{4, 3, 2, 1, 0}},
+		{name: "limit keeps newest", filter: AuditFilter{Limit: 2}, want: []int{4, 3}},
+		{name: "user", filter: AuditFilter{User: "alice"}, want: []int{3, 2, 0}},
+		{name: "user and limit", filter: AuditFilter{User: "alice", Limit: 1}, want: []int{3}},
+		{name: "action", filter: AuditFilter{Action: "job.delete"}, want: []int{4, 2}},
+		{name: "since is inclusive", filter: AuditFilter{Since: base.Add(2 * time.Minute)}, want: []int{4, 3, 2}},
+		{name: "since and user", filter: AuditFilter{Since: base.Add(time.Minute), User: "bob"}, want: []int{4, 1}},
+		{name: "since after everything", filter: AuditFilter{Since: base.Add(time.Hour)}, want: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetAuditBadger(bdb, tt.filter)
+			if err != nil {
+				t.Fatalf("GetAuditBadger: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, w := range tt.want {
+				want := writes[w]
+				if got[i].User != want.User || got[i].Action != want.Action || !got[i].Time.Equal(base.Add(time.Duration(w)*time.Minute)) {
+					t.Errorf("entry %d = %+v, want write %d (%+v)", i, got[i], w, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// GetLockoutBadger retrieves a lockout record from BadgerDB
+func GetLockoutBadger(bdb *BadgerDB, username string) (*LoginLockout, error) {
+	key := fmt.Sprintf("lockouts:%s", username)
+	var lockout LoginLockout
+	err := bdb.Get(key, &lockout)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lockout, nil
+}
+
+// SaveLockoutBadger stores a lockout record in BadgerDB
+func SaveLockoutBadger(bdb *BadgerDB, lockout LoginLockout) error {
+	key := fmt.Sprintf("lockouts:%s", lockout.Username)
+	return bdb.Set(key, lockout)
+}
+
+// ClearLockoutBadger removes a lockout record from BadgerDB
+func ClearLockoutBadger(bdb *BadgerDB, username string) error {
+	key := fmt.Sprintf("lockouts:%s", username)
+	return bdb.Delete(key)
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// GetModeBadger retrieves a generation mode from BadgerDB
+func GetModeBadger(bdb *BadgerDB, name string) (*GenerationMode, error) {
+	key := fmt.Sprintf("modes:%s", name)
+	var mode GenerationMode
+	err := bdb.Get(key, &mode)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mode, nil
+}
+
+// GetAllModesBadger retrieves all generation modes from BadgerDB
+func GetAllModesBadger(bdb *BadgerDB) ([]GenerationMode, error) {
+	var modes []GenerationMode
+
+	err := bdb.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte("modes:")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+
+			err := item.Value(func(val []byte) error {
+				var mode GenerationMode
+				if err := jsonUnmarshal(val, &mode); err != nil {
+					return err
+				}
+				modes = append(modes, mode)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return modes, err
+}
+
+// SaveModeBadger stores a generation mode in BadgerDB
+func SaveModeBadger(bdb *BadgerDB, mode GenerationMode) error {
+	key := fmt.Sprintf("modes:%s", mode.Name)
+	return bdb.Set(key, mode)
+}
+
+// DeleteModeBadger removes a generation mode from BadgerDB
+func DeleteModeBadger(bdb *BadgerDB, name string) error {
+	key := fmt.Sprintf("modes:%s", name)
+	return bdb.Delete(key)
+}
@@ -26,6 +26,15 @@ func GetSessionBadger(bdb *BadgerDB, id string) (*Session, error) {
 	return &session, nil
 }
 
+// GetSessionsByUserBadger retrieves all sessions for a user from BadgerDB, oldest first
+func GetSessionsByUserBadger(bdb *BadgerDB, username string) ([]Session, error) {
+	sessions := make(map[string]Session)
+	if err := bdb.GetAll("sessions:", &sessions); err != nil {
+		return nil, err
+	}
+	return filterSessionsByUser(sessions, username), nil
+}
+
 // RemoveSessionBadger removes a session from BadgerDB
 func RemoveSessionBadger(bdb *BadgerDB, id string) error {
 	key := fmt.Sprintf("sessions:%s", id)
@@ -57,6 +57,32 @@ func GetAllUsersBadger(bdb *BadgerDB) (map[string]User, error) {
 	return users, err
 }
 
+// UpdateUserPreferencesBadger replaces the preferences stored on a user record
+func UpdateUserPreferencesBadger(bdb *BadgerDB, username string, prefs UserPreferences) error {
+	user, err := GetUserBadger(bdb, username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user %s not found", username)
+	}
+	user.Preferences = prefs
+	return AddUserBadger(bdb, *user)
+}
+
+// UpdateUserVariablesBadger replaces the template variables stored on a user record
+func UpdateUserVariablesBadger(bdb *BadgerDB, username string, vars map[string]string) error {
+	user, err := GetUserBadger(bdb, username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user %s not found", username)
+	}
+	user.Variables = vars
+	return AddUserBadger(bdb, *user)
+}
+
 // RemoveUserBadger removes a user from BadgerDB
 func RemoveUserBadger(bdb *BadgerDB, username string) error {
 	key := fmt.Sprintf("users:%s", username)
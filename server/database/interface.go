@@ -86,6 +86,14 @@ func (udb *UnifiedDB) RemoveUser(username string) error {
 	return RemoveUserBadger(udb.Badger, username)
 }
 
+func (udb *UnifiedDB) UpdateUserPreferences(username string, prefs UserPreferences) error {
+	return UpdateUserPreferencesBadger(udb.Badger, username, prefs)
+}
+
+func (udb *UnifiedDB) UpdateUserVariables(username string, vars map[string]string) error {
+	return UpdateUserVariablesBadger(udb.Badger, username, vars)
+}
+
 // Session operations
 func (udb *UnifiedDB) AddSession(session Session) error {
 	return AddSessionBadger(udb.Badger, session)
@@ -95,10 +103,44 @@ func (udb *UnifiedDB) GetSession(id string) (*Session, error) {
 	return GetSessionBadger(udb.Badger, id)
 }
 
+func (udb *UnifiedDB) GetSessionsByUser(username string) ([]Session, error) {
+	return GetSessionsByUserBadger(udb.Badger, username)
+}
+
 func (udb *UnifiedDB) RemoveSession(id string) error {
 	return RemoveSessionBadger(udb.Badger, id)
 }
 
+// Lockout operations
+func (udb *UnifiedDB) GetLockout(username string) (*LoginLockout, error) {
+	return GetLockoutBadger(udb.Badger, username)
+}
+
+func (udb *UnifiedDB) SaveLockout(lockout LoginLockout) error {
+	return SaveLockoutBadger(udb.Badger, lockout)
+}
+
+func (udb *UnifiedDB) ClearLockout(username string) error {
+	return ClearLockoutBadger(udb.Badger, username)
+}
+
+// API key operations
+func (udb *UnifiedDB) AddAPIKey(key APIKey) error {
+	return AddAPIKeyBadger(udb.Badger, key)
+}
+
+func (udb *UnifiedDB) GetAPIKeyByHash(hash string) (*APIKey, error) {
+	return GetAPIKeyByHashBadger(udb.Badger, hash)
+}
+
+func (udb *UnifiedDB) GetAPIKeysByUser(username string) ([]APIKey, error) {
+	return GetAPIKeysByUserBadger(udb.Badger, username)
+}
+
+func (udb *UnifiedDB) RemoveAPIKey(username, id string) (bool, error) {
+	return RemoveAPIKeyBadger(udb.Badger, username, id)
+}
+
 // Notebook operations
 func (udb *UnifiedDB) CreateNotebook(username, name, description string, optional Optional) (*Notebook, error) {
 	return CreateNotebookBadger(udb.Badger, username, name, description, optional)
@@ -181,3 +223,29 @@ func (udb *UnifiedDB) DeleteStyle(username, name string) error {
 func (udb *UnifiedDB) UpdateStyle(style Style) error {
 	return UpdateStyleBadger(udb.Badger, style)
 }
+
+// Mode operations
+func (udb *UnifiedDB) GetMode(name string) (*GenerationMode, error) {
+	return GetModeBadger(udb.Badger, name)
+}
+
+func (udb *UnifiedDB) GetAllModes() ([]GenerationMode, error) {
+	return GetAllModesBadger(udb.Badger)
+}
+
+func (udb *UnifiedDB) SaveMode(mode GenerationMode) error {
+	return SaveModeBadger(udb.Badger, mode)
+}
+
+func (udb *UnifiedDB) DeleteMode(name string) error {
+	return DeleteModeBadger(udb.Badger, name)
+}
+
+// Audit operations
+func (udb *UnifiedDB) AppendAudit(entry AuditEntry) error {
+	return AppendAuditBadger(udb.Badger, entry)
+}
+
+func (udb *UnifiedDB) GetAudit(filter AuditFilter) ([]AuditEntry, error) {
+	return GetAuditBadger(udb.Badger, filter)
+}
@@ -0,0 +1,71 @@
+package store
+
+import "time"
+
+// LoginLockout tracks failed login attempts for a username
+type LoginLockout struct {
+	Username    string    `json:"username"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+// IsLocked reports whether the lockout is still in effect at the given time
+func (l *LoginLockout) IsLocked(now time.Time) bool {
+	return l != nil && now.Before(l.LockedUntil)
+}
+
+// GetLockout retrieves the lockout record for a username, or nil if none exists
+func GetLockout(db *DB, username string) (*LoginLockout, error) {
+	store, err := db.GetStore("lockouts")
+	if err != nil {
+		return nil, err
+	}
+
+	var lockouts map[string]LoginLockout
+	if err := store.GetData(&lockouts); err != nil {
+		return nil, err
+	}
+
+	lockout, ok := lockouts[username]
+	if !ok {
+		return nil, nil
+	}
+	return &lockout, nil
+}
+
+// SaveLockout stores the lockout record for a username
+func SaveLockout(db *DB, lockout LoginLockout) error {
+	store, err := db.GetStore("lockouts")
+	if err != nil {
+		return err
+	}
+
+	var lockouts map[string]LoginLockout
+	if err := store.GetData(&lockouts); err != nil {
+		lockouts = make(map[string]LoginLockout)
+	}
+
+	lockouts[lockout.Username] = lockout
+	return store.SetData(lockouts)
+}
+
+// ClearLockout removes any lockout record for a username
+func ClearLockout(db *DB, username string) error {
+	store, err := db.GetStore("lockouts")
+	if err != nil {
+		return err
+	}
+
+	var lockouts map[string]LoginLockout
+	if err := store.GetData(&lockouts); err != nil {
+		return err
+	}
+
+	if _, ok := lockouts[username]; !ok {
+		return nil
+	}
+
+	delete(lockouts, username)
+	return store.SetData(lockouts)
+}
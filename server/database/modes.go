@@ -0,0 +1,98 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// GetMode retrieves a generation mode by name
+func GetMode(db *DB, name string) (*GenerationMode, error) {
+	store, err := db.GetStore("modes")
+	if err != nil {
+		return nil, err
+	}
+
+	var modes map[string]GenerationMode
+	if err := store.GetData(&modes); err != nil {
+		return nil, err
+	}
+
+	mode, exists := modes[name]
+	if !exists {
+		return nil, fmt.Errorf("mode %s not found", name)
+	}
+
+	return &mode, nil
+}
+
+// GetAllModes retrieves every generation mode, sorted by name
+func GetAllModes(db *DB) ([]GenerationMode, error) {
+	store, err := db.GetStore("modes")
+	if err != nil {
+		return nil, err
+	}
+
+	var modes map[string]GenerationMode
+	if err := store.GetData(&modes); err != nil {
+		return []GenerationMode{}, nil
+	}
+
+	result := make([]GenerationMode, 0, len(modes))
+	for _, mode := range modes {
+		result = append(result, mode)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result, nil
+}
+
+// SaveMode creates or replaces a generation mode, preserving its creation time
+func SaveMode(db *DB, mode GenerationMode) (*GenerationMode, error) {
+	store, err := db.GetStore("modes")
+	if err != nil {
+		return nil, err
+	}
+
+	var modes map[string]GenerationMode
+	if err := store.GetData(&modes); err != nil || modes == nil {
+		modes = make(map[string]GenerationMode)
+	}
+
+	now := time.Now()
+	if existing, exists := modes[mode.Name]; exists {
+		mode.CreatedAt = existing.CreatedAt
+	} else if mode.CreatedAt.IsZero() {
+		mode.CreatedAt = now
+	}
+	mode.UpdatedAt = now
+
+	modes[mode.Name] = mode
+
+	if err := store.SetData(modes); err != nil {
+		return nil, err
+	}
+
+	return &mode, nil
+}
+
+// DeleteMode removes a generation mode by name
+func DeleteMode(db *DB, name string) error {
+	store, err := db.GetStore("modes")
+	if err != nil {
+		return err
+	}
+
+	var modes map[string]GenerationMode
+	if err := store.GetData(&modes); err != nil {
+		return err
+	}
+
+	if _, exists := modes[name]; !exists {
+		return nil
+	}
+
+	delete(modes, name)
+
+	return store.SetData(modes)
+}
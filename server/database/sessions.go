@@ -1,9 +1,20 @@
 package store
 
+import (
+    "sort"
+    "time"
+)
 
 type Session struct {
-    ID   string
-    Data map[string]any
+    ID        string
+    Data      map[string]any
+    CreatedAt time.Time
+}
+
+// Username returns the user the session belongs to, or "" if unknown
+func (s Session) Username() string {
+    username, _ := s.Data["username"].(string)
+    return username
 }
 
 func AddSession(db *DB, session Session) error {
@@ -35,6 +46,19 @@ func GetSession(db *DB, id string) (*Session, error) {
     return &session, nil
 }
 
+// GetSessionsByUser returns all sessions for a user, oldest first
+func GetSessionsByUser(db *DB, username string) ([]Session, error) {
+    store, err := db.GetStore("sessions")
+    if err != nil {
+        return nil, err
+    }
+    var sessions map[string]Session
+    if err := store.GetData(&sessions); err != nil {
+        return nil, err
+    }
+    return filterSessionsByUser(sessions, username), nil
+}
+
 func RemoveSession(db *DB, id string) error {
     store, err := db.GetStore("sessions")
     if err != nil {
@@ -46,4 +70,17 @@ func RemoveSession(db *DB, id string) error {
     }
     delete(sessions, id)
     return store.SetData(sessions)
-}
\ No newline at end of file
+}
+
+func filterSessionsByUser(sessions map[string]Session, username string) []Session {
+    result := make([]Session, 0)
+    for _, s := range sessions {
+        if s.Username() == username {
+            result = append(result, s)
+        }
+    }
+    sort.Slice(result, func(i, j int) bool {
+        return result[i].CreatedAt.Before(result[j].CreatedAt)
+    })
+    return result
+}
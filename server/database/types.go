@@ -37,3 +37,23 @@ type Style struct {
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
 }
+
+// GenerationMode is a named set of instructions that shapes the design step
+type GenerationMode struct {
+	Name         string `json:"name"`
+	Label        string `json:"label"`
+	Description  string `json:"description"`
+	Instructions string `json:"instructions"`
+	// Requirements are checked against the generated LaTeX
+	Requirements []ModeRequirement `json:"requirements,omitempty"`
+	BuiltIn      bool              `json:"builtIn"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	UpdatedAt    time.Time         `json:"updatedAt"`
+}
+
+// ModeRequirement is a structural element a mode's LaTeX must contain,
+// given as a regular expression, e.g. `\\section\*?\{Answer Key\}`
+type ModeRequirement struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
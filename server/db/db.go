@@ -1,6 +1,8 @@
 package db
 
 import (
+	"path/filepath"
+
 	store "nadhi.dev/sarvar/fun/database"
 )
 
@@ -9,6 +11,13 @@ var UsersDB *store.DB
 var QueueDB *store.DB
 var NotebooksDB *store.DB
 var StylesDB *store.DB
+var LockoutsDB *store.DB
+var ModesDB *store.DB
+var APIKeysDB *store.DB
+
+// AuditDB is the append-only audit log, kept in Badger rather than a JSON
+// store since it only ever grows
+var AuditDB *store.BadgerDB
 
 func InitSessionsDB() error {
 	var err error
@@ -39,3 +48,27 @@ func InitStylesDB() error {
 	StylesDB, err = store.InitDB("styles")
 	return err
 }
+
+func InitLockoutsDB() error {
+	var err error
+	LockoutsDB, err = store.InitDB("lockouts")
+	return err
+}
+
+func InitModesDB() error {
+	var err error
+	ModesDB, err = store.InitDB("modes")
+	return err
+}
+
+func InitAPIKeysDB() error {
+	var err error
+	APIKeysDB, err = store.InitDB("apikeys")
+	return err
+}
+
+func InitAuditDB() error {
+	var err error
+	AuditDB, err = store.InitBadgerDB(filepath.Join("./zp-database", "audit"))
+	return err
+}
@@ -0,0 +1,89 @@
+// Package httpclient builds the HTTP clients used for outbound calls to AI
+// providers and web search, so proxy and CA settings apply everywhere.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"nadhi.dev/sarvar/fun/config"
+	logg "nadhi.dev/sarvar/fun/logs"
+)
+
+var (
+	mu          sync.Mutex
+	transport   *http.Transport
+	settingsKey string
+)
+
+// New returns a client with the given timeout (0 means none) that uses the
+// shared outbound transport
+func New(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: Transport()}
+}
+
+// Transport returns the shared outbound transport. It honours OUTBOUND_PROXY
+// (falling back to the HTTPS_PROXY/HTTP_PROXY/NO_PROXY environment) and
+// trusts the PEM files in OUTBOUND_CA_FILES on top of the system roots.
+// The transport is rebuilt only when those settings change, so connections
+// are pooled across calls.
+func Transport() *http.Transport {
+	proxy := strings.TrimSpace(config.GetConfigString("OUTBOUND_PROXY", ""))
+	caFiles := strings.TrimSpace(config.GetConfigString("OUTBOUND_CA_FILES", ""))
+	key := proxy + "\n" + caFiles
+
+	mu.Lock()
+	defer mu.Unlock()
+	if transport != nil && key == settingsKey {
+		return transport
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	if proxy != "" {
+		if proxyURL, err := url.Parse(proxy); err != nil || proxyURL.Host == "" {
+			logg.Warning(fmt.Sprintf("Ignoring invalid OUTBOUND_PROXY %q", proxy))
+		} else {
+			t.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+	if caFiles != "" {
+		if pool, err := certPool(caFiles); err != nil {
+			logg.Warning(fmt.Sprintf("Ignoring OUTBOUND_CA_FILES: %v", err))
+		} else {
+			t.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+		}
+	}
+
+	transport, settingsKey = t, key
+	return transport
+}
+
+// certPool adds the comma-separated PEM bundles to the system roots
+func certPool(files string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	for _, path := range strings.Split(files, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", path)
+		}
+	}
+	return pool, nil
+}
@@ -8,6 +8,7 @@ import (
     "net/http"
     "os"
 	"github.com/joho/godotenv"
+	"nadhi.dev/sarvar/fun/config"
 )
 
 type TargetUser struct {
@@ -27,6 +28,10 @@ type LoginResponse struct {
 
 
 func GetLoginLink(userID string) (string, error) {
+	if config.IsLocalOnly() {
+		return "", fmt.Errorf("kasm sessions are %w", config.ErrLocalOnly)
+	}
+
 	// Load API credentials from .env file
 	_ = godotenv.Load(".env")
 	apiKey := os.Getenv("API_KEY")
@@ -1,17 +1,30 @@
 package latex
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 )
 
+// Asset is an auxiliary file (such as an image) written next to the .tex
+// file before compiling, so \includegraphics can find it by name
+type Asset struct {
+	Name string
+	Data []byte
+}
+
 // ConvertLatexToPDFWithRetry tries to convert LaTeX to PDF with AI-powered fixes
 func ConvertLatexToPDFWithRetry(latexContent, texFilename, outputPath string) (string, error) {
+	return ConvertLatexToPDFWithAssets(latexContent, texFilename, outputPath, nil)
+}
+
+// ConvertLatexToPDFWithAssets is ConvertLatexToPDFWithRetry with extra files
+// materialized into the compile working directory
+func ConvertLatexToPDFWithAssets(latexContent, texFilename, outputPath string, assets []Asset) (string, error) {
 	const maxAttempts = 3
 	var conversionErr error
 
@@ -31,11 +44,15 @@ func ConvertLatexToPDFWithRetry(latexContent, texFilename, outputPath string) (s
 		return "", fmt.Errorf("failed to create fixes directory: %w", err)
 	}
 
-	// Initial attempt with original content
-	pdfPath, conversionErr := convertToPDF(latexContent, texFilename, outputPath)
+	// Initial attempt with original content; transient failures are
+	// retried as-is and never sent to the AI fixer
+	pdfPath, conversionErr := convertWithTransientRetry(latexContent, texFilename, outputPath, assets)
 	if conversionErr == nil {
 		return pdfPath, nil
 	}
+	if errors.Is(conversionErr, ErrTransientCompile) {
+		return "", conversionErr
+	}
 
 	log.Printf("[ERROR] Initial conversion failed: %v", conversionErr)
 
@@ -71,11 +88,14 @@ func ConvertLatexToPDFWithRetry(latexContent, texFilename, outputPath string) (s
 		}
 
 		// Try conversion with fixed content
-		pdfPath, conversionErr = convertToPDF(fixedContent, texFilename, outputPath)
+		pdfPath, conversionErr = convertWithTransientRetry(fixedContent, texFilename, outputPath, assets)
 		if conversionErr == nil {
 			log.Printf("Successfully fixed and converted LaTeX on attempt %d", attempt)
 			return pdfPath, nil
 		}
+		if errors.Is(conversionErr, ErrTransientCompile) {
+			return "", conversionErr
+		}
 
 		log.Printf("Conversion still failed after fix attempt %d: %v", attempt, conversionErr)
 
@@ -118,7 +138,7 @@ func truncateString(s string, max int) string {
 	return s[:max] + "..."
 }
 
-func convertToPDF(latexContent, texFilename, outputPath string) (string, error) {
+func convertToPDF(latexContent, texFilename, outputPath string, assets []Asset) (string, error) {
 	// Check if LaTeX content is empty before proceeding
 	latexContent = strings.TrimSpace(latexContent)
 	if latexContent == "" {
@@ -135,6 +155,9 @@ func convertToPDF(latexContent, texFilename, outputPath string) (string, error)
 		!strings.Contains(latexContent, "\\begin{document}") {
 		return "", fmt.Errorf("invalid LaTeX content: missing required elements")
 	}
+	if err := checkInputPaths(latexContent); err != nil {
+		return "", err
+	}
 
 	// Log the first and last 100 characters of the content for debugging
 	contentPreview := latexContent
@@ -160,6 +183,18 @@ func convertToPDF(latexContent, texFilename, outputPath string) (string, error)
 		return "", fmt.Errorf("failed to write LaTeX content: %w", err)
 	}
 
+	// Write any assets (e.g. attached images) alongside the .tex file
+	for _, asset := range assets {
+		name := filepath.Base(asset.Name)
+		if name == "." || name == string(filepath.Separator) || name == texFilename {
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(tempDir, name), asset.Data, 0644); err != nil {
+			return "", fmt.Errorf("failed to write asset %s: %w", name, err)
+		}
+		log.Printf("[DEBUG] Wrote asset %s (%d bytes)", name, len(asset.Data))
+	}
+
 	// Verify the file was written correctly and has content
 	if fileInfo, err := os.Stat(tempTexPath); err != nil {
 		return "", fmt.Errorf("failed to verify LaTeX file was written: %w", err)
@@ -176,14 +211,14 @@ func convertToPDF(latexContent, texFilename, outputPath string) (string, error)
 	log.Printf("[DEBUG] Expected PDF output path: %s", tempPDFPath)
 
 	// Run Tectonic command with detailed output capture
-	cmd := exec.Command("tectonic", "--outfmt=pdf", "--keep-logs", "-o", tempDir, tempTexPath)
-
-	// Set working directory to temp directory to ensure relative paths work
-	cmd.Dir = tempDir
+	// Run in the temp directory so relative paths work and nothing else is in reach
+	cmd := tectonicCommand(tempDir, "--outfmt=pdf", "--keep-logs", "-o", tempDir, tempTexPath)
 	log.Printf("[DEBUG] Running Tectonic in directory: %s", cmd.Dir)
 	log.Printf("[DEBUG] Tectonic command: %v", cmd.Args)
 
+	release := acquireCompileSlot()
 	output, err := cmd.CombinedOutput()
+	release()
 	if err != nil {
 		// Save the error output for debugging
 		errorLogPath := filepath.Join("./generated/error_logs", fileBase+".log")
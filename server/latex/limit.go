@@ -0,0 +1,36 @@
+package latex
+
+import (
+	"runtime"
+	"sync"
+)
+
+// compileSlots bounds how many Tectonic processes run at once, independent
+// of how many pipeline workers there are. AI fix requests between attempts
+// happen outside a slot, so only the CPU-heavy part is serialised.
+var (
+	compileSlotsMu sync.Mutex
+	compileSlots   = make(chan struct{}, runtime.NumCPU())
+)
+
+// SetMaxConcurrentCompiles sets how many LaTeX compilations may run at the
+// same time. Values below 1 use the number of CPUs.
+func SetMaxConcurrentCompiles(n int) {
+	if n < 1 {
+		n = runtime.NumCPU()
+	}
+	compileSlotsMu.Lock()
+	defer compileSlotsMu.Unlock()
+	compileSlots = make(chan struct{}, n)
+}
+
+// acquireCompileSlot blocks until a compile may start and returns the
+// function that frees the slot
+func acquireCompileSlot() func() {
+	compileSlotsMu.Lock()
+	slots := compileSlots
+	compileSlotsMu.Unlock()
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
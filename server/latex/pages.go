@@ -0,0 +1,74 @@
+package latex
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+var (
+	pdfStreamPattern = regexp.MustCompile(`(?s)stream\r?\n(.*?)\r?\n?endstream`)
+	pdfPagesPattern  = regexp.MustCompile(`/Type\s*/Pages\b[^>]*?/Count\s+(\d+)|/Count\s+(\d+)[^>]*?/Type\s*/Pages\b`)
+	pdfPagePattern   = regexp.MustCompile(`/Type\s*/Page\b`)
+)
+
+// maxInflatedStream caps how much a single PDF stream may expand to while
+// looking for page objects
+const maxInflatedStream = 8 << 20
+
+// CountPDFPages returns the number of pages in a PDF without a PDF library.
+// It reads the /Count of the page tree root, looking inside compressed
+// object streams as well, since Tectonic's output packs objects that way.
+// Counting /Type /Page objects is the fallback.
+func CountPDFPages(pdfPath string) (int, error) {
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		return 0, err
+	}
+
+	sources := [][]byte{data}
+	for _, m := range pdfStreamPattern.FindAllSubmatch(data, -1) {
+		if inflated, err := inflate(m[1]); err == nil {
+			sources = append(sources, inflated)
+		}
+	}
+
+	// The root of the page tree has the largest /Count
+	count := 0
+	for _, src := range sources {
+		for _, m := range pdfPagesPattern.FindAllSubmatch(src, -1) {
+			digits := m[1]
+			if len(digits) == 0 {
+				digits = m[2]
+			}
+			if n, err := strconv.Atoi(string(digits)); err == nil && n > count {
+				count = n
+			}
+		}
+	}
+	if count > 0 {
+		return count, nil
+	}
+
+	for _, src := range sources {
+		count += len(pdfPagePattern.FindAll(src, -1))
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("no pages found in %s", pdfPath)
+	}
+	return count, nil
+}
+
+// inflate decompresses a FlateDecode stream, giving up on oversized output
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, maxInflatedStream))
+}
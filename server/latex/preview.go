@@ -16,20 +16,20 @@ const previewTemplate = `\documentclass[11pt]{article}
 \usepackage{graphicx}
 \geometry{margin=1in}
 
-% Style prompt
+%% Style prompt
 %s
 
 \begin{document}
 \section*{Style Preview}
 This preview uses your current style prompt to render a sample layout.\\
-	extcolor{primary}{Primary Accent}\\
-	extcolor{secondary}{Secondary Accent}\\
-	extcolor{accent}{Accent}\\
-	extcolor{light}{Light Accent}
+\textcolor{primary}{Primary Accent}\\
+\textcolor{secondary}{Secondary Accent}\\
+\textcolor{accent}{Accent}\\
+\textcolor{light}{Light Accent}
 
 \vspace{12pt}
 \fcolorbox{primary}{light}{\parbox{0.88\linewidth}{\centering
-	extbf{Sample callout}\\
+\textbf{Sample callout}\\
 Use this block to verify your primary/secondary palette, spacing, and typography.
 }}
 
@@ -66,11 +66,59 @@ func PreparePreviewLatex(input string) (string, error) {
 	return src, nil
 }
 
+// CheckLatexCompiles compiles latexContent to PDF in a scratch directory and
+// discards the result. On a compile failure it returns the TeX error lines
+// with a nil error; err is only for failures to run the check at all.
+func CheckLatexCompiles(latexContent string) (compileErrors []string, err error) {
+	if strings.TrimSpace(latexContent) == "" {
+		return nil, fmt.Errorf("latex content is empty")
+	}
+	if err := checkInputPaths(latexContent); err != nil {
+		return []string{err.Error()}, nil
+	}
+
+	tempDir, err := ioutil.TempDir("", "latex-check")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	texPath := filepath.Join(tempDir, "check.tex")
+	if err := ioutil.WriteFile(texPath, []byte(latexContent), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write latex file: %w", err)
+	}
+
+	cmd := tectonicCommand(tempDir, "--outfmt=pdf", "-o", tempDir, texPath)
+	release := acquireCompileSlot()
+	output, runErr := cmd.CombinedOutput()
+	release()
+	if runErr == nil {
+		return nil, nil
+	}
+	if _, ok := runErr.(*exec.ExitError); !ok {
+		return nil, fmt.Errorf("failed to run tectonic: %w", runErr)
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "error:") || strings.HasPrefix(line, "!") {
+			compileErrors = append(compileErrors, line)
+		}
+	}
+	if len(compileErrors) == 0 {
+		compileErrors = []string{strings.TrimSpace(truncateString(string(output), 2000))}
+	}
+	return compileErrors, nil
+}
+
 // ConvertLatexToHTML renders LaTeX to HTML using Tectonic.
 func ConvertLatexToHTML(latexContent, texFilename string) (string, error) {
 	if strings.TrimSpace(latexContent) == "" {
 		return "", fmt.Errorf("latex content is empty")
 	}
+	if err := checkInputPaths(latexContent); err != nil {
+		return "", err
+	}
 
 	if texFilename == "" {
 		texFilename = "preview.tex"
@@ -90,9 +138,11 @@ func ConvertLatexToHTML(latexContent, texFilename string) (string, error) {
 	fileBase := strings.TrimSuffix(texFilename, filepath.Ext(texFilename))
 	htmlPath := filepath.Join(tempDir, fileBase+".html")
 
-	cmd := exec.Command("tectonic", "--outfmt=html", "--keep-logs", "-o", tempDir, texPath)
-	cmd.Dir = tempDir
-	if output, err := cmd.CombinedOutput(); err != nil {
+	cmd := tectonicCommand(tempDir, "--outfmt=html", "--keep-logs", "-o", tempDir, texPath)
+	release := acquireCompileSlot()
+	output, err := cmd.CombinedOutput()
+	release()
+	if err != nil {
 		return "", fmt.Errorf("tectonic html failed: %w\nTectonic output:\n%s", err, string(output))
 	}
 
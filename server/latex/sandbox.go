@@ -0,0 +1,93 @@
+package latex
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DefaultTectonicFlags harden every Tectonic run. --untrusted (Tectonic
+// 0.12+) disables shell-escape and other known-insecure features, even if
+// the document asks for them.
+var DefaultTectonicFlags = []string{"--untrusted"}
+
+var (
+	tectonicFlagsMu sync.RWMutex
+	tectonicFlags   = DefaultTectonicFlags
+)
+
+// SetTectonicFlags sets the flags passed to Tectonic before each run's own
+// arguments, replacing the defaults. Pass e.g. "-Z shell-escape" instead of
+// --untrusted to allow shell-escape; an empty list runs Tectonic unhardened.
+func SetTectonicFlags(flags []string) {
+	tectonicFlagsMu.Lock()
+	defer tectonicFlagsMu.Unlock()
+	tectonicFlags = append([]string(nil), flags...)
+}
+
+// sandboxEnvKeys are the only environment variables Tectonic inherits, so
+// API keys and other secrets in the server's environment don't reach it
+var sandboxEnvKeys = []string{"PATH", "HOME", "USERPROFILE", "LANG", "XDG_CACHE_HOME", "TECTONIC_CACHE_DIR", "SYSTEMROOT"}
+
+// tectonicCommand builds a Tectonic invocation run in workDir: the
+// configured hardening flags, the run's own args, workDir as the working
+// and temp directory, and a minimal environment. It does not stop the
+// process reading files elsewhere.
+func tectonicCommand(workDir string, args ...string) *exec.Cmd {
+	tectonicFlagsMu.RLock()
+	flags := append([]string(nil), tectonicFlags...)
+	tectonicFlagsMu.RUnlock()
+
+	cmd := exec.Command("tectonic", append(flags, args...)...)
+	cmd.Dir = workDir
+	env := []string{"TMPDIR=" + workDir, "TEMP=" + workDir, "TMP=" + workDir}
+	for _, key := range sandboxEnvKeys {
+		if v, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+v)
+		}
+	}
+	cmd.Env = env
+	return cmd
+}
+
+// fileInputPatterns match commands that read a file, either named in braces
+// or, for the TeX primitives, as a bare word
+var fileInputPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\\(input|include|includegraphics|includepdf|InputIfFileExists|lstinputlisting|verbatiminput)\s*(?:\[[^\]]*\])?\s*\{([^}]*)\}`),
+	regexp.MustCompile(`\\(input|openin\s*\d+\s*=?)\s*([^\s{}\\]+)`),
+}
+
+// checkInputPaths rejects documents that read files outside the compile
+// directory: absolute paths, home-relative paths and parent references.
+// Attachments are written next to the .tex file, so worksheets never need
+// them.
+//
+// This is a best-effort check against mistakes and plainly written
+// commands, not a security boundary. TeX can build a command name at run
+// time (\csname input\endcsname, \@@input, catcode changes) and the regexes
+// only see the source text, while --untrusted does not restrict reads. Real
+// isolation has to come from running the server as a user or in a
+// container that cannot read anything sensitive.
+func checkInputPaths(latexContent string) error {
+	for _, pattern := range fileInputPatterns {
+		for _, m := range pattern.FindAllStringSubmatch(latexContent, -1) {
+			path := strings.TrimSpace(m[2])
+			if escapesWorkDir(path) {
+				return fmt.Errorf("\\%s %s reads outside the compile directory; use files relative to the document", strings.Fields(m[1])[0], path)
+			}
+		}
+	}
+	return nil
+}
+
+// escapesWorkDir reports whether a path could point outside the directory
+// it is resolved against
+func escapesWorkDir(path string) bool {
+	p := strings.ReplaceAll(path, "\\", "/")
+	return strings.HasPrefix(p, "/") || strings.HasPrefix(p, "~") ||
+		(len(p) > 1 && p[1] == ':') ||
+		p == ".." || strings.HasPrefix(p, "../") || strings.Contains(p, "/../") || strings.HasSuffix(p, "/..")
+}
@@ -0,0 +1,61 @@
+package latex
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ThumbnailWidth is the width in pixels of generated PDF thumbnails
+const ThumbnailWidth = 400
+
+var (
+	thumbnailOnce sync.Once
+	thumbnailTool string
+)
+
+// DetectThumbnailer finds a tool that can render a PDF page to PNG,
+// preferring pdftoppm (poppler) over Ghostscript. It returns "" when
+// neither is installed; the result is cached after the first call.
+func DetectThumbnailer() string {
+	thumbnailOnce.Do(func() {
+		for _, tool := range []string{"pdftoppm", "gs"} {
+			if _, err := exec.LookPath(tool); err == nil {
+				thumbnailTool = tool
+				return
+			}
+		}
+	})
+	return thumbnailTool
+}
+
+// GenerateThumbnail renders the first page of pdfPath to a PNG at pngPath
+func GenerateThumbnail(pdfPath, pngPath string) error {
+	var cmd *exec.Cmd
+	switch DetectThumbnailer() {
+	case "pdftoppm":
+		// pdftoppm appends .png to the output prefix itself
+		prefix := strings.TrimSuffix(pngPath, filepath.Ext(pngPath))
+		cmd = exec.Command("pdftoppm", "-png", "-f", "1", "-l", "1", "-singlefile",
+			"-scale-to", fmt.Sprint(ThumbnailWidth), pdfPath, prefix)
+	case "gs":
+		// 48 dpi renders a letter/A4 page roughly ThumbnailWidth wide
+		cmd = exec.Command("gs", "-q", "-dNOPAUSE", "-dBATCH", "-dSAFER",
+			"-sDEVICE=png16m", "-dFirstPage=1", "-dLastPage=1", "-r48",
+			"-sOutputFile="+pngPath, pdfPath)
+	default:
+		return fmt.Errorf("no thumbnail tool available (install pdftoppm or ghostscript)")
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w\n%s", cmd.Args[0], err, string(output))
+	}
+	if _, err := os.Stat(pngPath); err != nil {
+		return fmt.Errorf("%s produced no thumbnail", cmd.Args[0])
+	}
+	return nil
+}
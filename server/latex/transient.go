@@ -0,0 +1,94 @@
+package latex
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DefaultTransientRetries is how many times a compile that failed for an
+// infrastructure reason is re-run with the same LaTeX
+const DefaultTransientRetries = 3
+
+// DefaultTransientBackoff is the wait before the first such retry; it
+// doubles on each one after
+const DefaultTransientBackoff = 2 * time.Second
+
+// ErrTransientCompile marks a compile that kept failing for reasons outside
+// the document, such as package downloads timing out
+var ErrTransientCompile = errors.New("transient compile failure")
+
+var (
+	transientMu      sync.RWMutex
+	transientRetries = DefaultTransientRetries
+	transientBackoff = DefaultTransientBackoff
+)
+
+// SetTransientRetryPolicy sets how often, and after what first delay, a
+// transient Tectonic failure is retried. retries below 0 disable retrying
+// and a backoff below 0 uses the default.
+func SetTransientRetryPolicy(retries int, backoff time.Duration) {
+	if retries < 0 {
+		retries = 0
+	}
+	if backoff < 0 {
+		backoff = DefaultTransientBackoff
+	}
+	transientMu.Lock()
+	defer transientMu.Unlock()
+	transientRetries = retries
+	transientBackoff = backoff
+}
+
+// transientPatterns match Tectonic output caused by the network, the
+// package cache or the machine rather than the LaTeX. Tectonic fetches
+// missing packages on first use, so a slow or flaky connection fails
+// documents that are fine.
+var transientPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)error sending request|failed to (download|retrieve|fetch)|unable to (download|fetch)`),
+	regexp.MustCompile(`(?i)timed? ?out|connection (reset|refused|closed|aborted)|broken pipe`),
+	regexp.MustCompile(`(?i)dns error|could not resolve|failed to lookup address|no such host|network is unreachable`),
+	regexp.MustCompile(`(?i)tls handshake|certificate verify failed|\b(502|503|504)\b .*(gateway|unavailable)`),
+	regexp.MustCompile(`(?i)temporarily unavailable|too many open files|no space left on device`),
+	regexp.MustCompile(`(?i)(blocking waiting for|failed to acquire|could not acquire) .*lock|database is locked|lock file`),
+}
+
+// isTransientFailure reports whether a convertToPDF error looks like an
+// infrastructure problem worth retrying as-is, rather than a LaTeX error
+// for the AI fixer
+func isTransientFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	for _, p := range transientPatterns {
+		if p.MatchString(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// convertWithTransientRetry is convertToPDF that re-runs the same LaTeX,
+// with exponential backoff, while failures look transient. If they still
+// do after the last retry, the error wraps ErrTransientCompile.
+func convertWithTransientRetry(latexContent, texFilename, outputPath string, assets []Asset) (string, error) {
+	transientMu.RLock()
+	retries, delay := transientRetries, transientBackoff
+	transientMu.RUnlock()
+
+	pdfPath, err := convertToPDF(latexContent, texFilename, outputPath, assets)
+	for attempt := 1; attempt <= retries && isTransientFailure(err); attempt++ {
+		log.Printf("[WARNING] Transient compile failure for %s, retrying in %s (%d/%d): %s", texFilename, delay, attempt, retries, truncateString(extractErrorMessage(err), 200))
+		time.Sleep(delay)
+		delay *= 2
+		pdfPath, err = convertToPDF(latexContent, texFilename, outputPath, assets)
+	}
+	if isTransientFailure(err) {
+		return "", fmt.Errorf("%w: %v", ErrTransientCompile, err)
+	}
+	return pdfPath, err
+}
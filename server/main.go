@@ -6,12 +6,17 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	webview "github.com/webview/webview_go"
+	"nadhi.dev/sarvar/fun/ai"
 	"nadhi.dev/sarvar/fun/bootstrap"
 	config "nadhi.dev/sarvar/fun/config"
+	"nadhi.dev/sarvar/fun/latex"
 	logg "nadhi.dev/sarvar/fun/logs"
+	notebook "nadhi.dev/sarvar/fun/notebooks"
 	"nadhi.dev/sarvar/fun/pipeline"
 	"nadhi.dev/sarvar/fun/routes"
 	"nadhi.dev/sarvar/fun/server"
@@ -26,6 +31,11 @@ func init() {
 		log.Fatal(err)
 	}
 
+	// Seed the generation mode registry with the built-in modes
+	if err := ai.SeedModes(); err != nil {
+		logg.Warning(fmt.Sprintf("Failed to seed generation modes: %v", err))
+	}
+
 	var err error
 	var queue_dir string
 
@@ -36,12 +46,60 @@ func init() {
 		queue_dir = "./storage/queue_data" // Fallback to default
 	}
 
+	// Configure the LaTeX post-processor chain
+	postProcessors := strings.Split(config.GetConfigString("LATEX_POSTPROCESSORS", strings.Join(pipeline.DefaultPostProcessors, ",")), ",")
+	if err := pipeline.SetPostProcessors(postProcessors); err != nil {
+		logg.Warning(fmt.Sprintf("Invalid LATEX_POSTPROCESSORS, using defaults: %v", err))
+	}
+
+	// Hardening flags for every Tectonic run
+	latex.SetTectonicFlags(strings.Fields(config.GetConfigString("TECTONIC_FLAGS", strings.Join(latex.DefaultTectonicFlags, " "))))
+
+	// Bound concurrent Tectonic runs separately from the worker count
+	latex.SetMaxConcurrentCompiles(config.GetConfigInt("MAX_CONCURRENT_COMPILES", 0))
+
+	// Transient Tectonic failures (package downloads, locks) are retried as-is
+	latex.SetTransientRetryPolicy(
+		config.GetConfigInt("TECTONIC_TRANSIENT_RETRIES", latex.DefaultTransientRetries),
+		time.Duration(config.GetConfigInt("TECTONIC_RETRY_BACKOFF_MS", int(latex.DefaultTransientBackoff/time.Millisecond)))*time.Millisecond,
+	)
+
+	// Hard caps on conversation size, so refine/fix loops can't grow one forever
+	pipeline.SetConversationLimits(
+		config.GetConfigInt("CONVERSATION_MAX_MESSAGES", pipeline.DefaultMaxConversationMessages),
+		config.GetConfigInt("CONVERSATION_MAX_BYTES", pipeline.DefaultMaxConversationBytes),
+	)
+
 	// Initialize new pipeline system
 	pipelineStore, err := pipeline.NewStore("./storage/pipeline")
 	if err != nil {
 		logg.Error(fmt.Sprintf("Failed to initialize pipeline store: %v", err))
 	} else {
+		pipelineStore.SetJobCache(config.GetConfigBool("PIPELINE_JOB_CACHE", true))
+		if config.GetConfigBool("PIPELINE_WRITE_BEHIND", false) {
+			interval := time.Duration(config.GetConfigInt("PIPELINE_FLUSH_SECONDS", int(pipeline.DefaultFlushInterval/time.Second))) * time.Second
+			if err := pipelineStore.EnableWriteBehind(interval); err != nil {
+				logg.Warning(fmt.Sprintf("Failed to enable write-behind, staying synchronous: %v", err))
+			}
+		}
+		if err := pipelineStore.SetArchiveDir(config.GetConfigString("JOB_ARCHIVE_DIR", pipeline.DefaultArchiveDir)); err != nil {
+			logg.Warning(fmt.Sprintf("Failed to set up job archive: %v", err))
+		} else {
+			pipelineStore.StartArchiving(time.Duration(config.GetConfigInt("JOB_ARCHIVE_AFTER_DAYS", pipeline.DefaultArchiveAfterDays)) * 24 * time.Hour)
+		}
 		pipelineQueue := pipeline.NewQueue(100, pipelineStore, nil)
+		pipelineQueue.SetMaxJobsPerUser(config.GetConfigInt("MAX_JOBS_PER_USER", pipeline.DefaultMaxJobsPerUser))
+		pipelineQueue.SetMaxLatexBytes(config.GetConfigInt("MAX_LATEX_BYTES", pipeline.DefaultMaxLatexBytes))
+		pipelineQueue.SetMaxLatexContinuations(config.GetConfigInt("MAX_LATEX_CONTINUATIONS", pipeline.DefaultMaxLatexContinuations))
+		pipelineQueue.SetWebhookSecret(config.GetConfigString("WEBHOOK_SECRET", ""))
+		pipelineQueue.SetStorageQuotaMB(config.GetConfigInt("STORAGE_QUOTA_MB", pipeline.DefaultStorageQuotaMB))
+		pipelineQueue.SetStoredJobLimit(config.GetConfigInt("MAX_STORED_JOBS_PER_USER", pipeline.DefaultMaxStoredJobs), config.GetConfigString("STORED_JOBS_POLICY", pipeline.StoredJobsReject))
+		pipelineQueue.SetThumbnailsEnabled(config.GetConfigBool("PDF_THUMBNAILS", true))
+		pipelineQueue.SetAnalyticsEnabled(config.GetConfigBool("SHEET_ANALYTICS", true))
+		pipelineQueue.SetAbstractsEnabled(config.GetConfigBool("SHEET_ABSTRACTS", false))
+		pipelineQueue.SetStuckJobThreshold(time.Duration(config.GetConfigInt("STUCK_JOB_MINUTES", pipeline.DefaultStuckJobMinutes)) * time.Minute)
+		pipelineQueue.SetJobDeadline(time.Duration(config.GetConfigInt("JOB_DEADLINE_MINUTES", pipeline.DefaultJobDeadlineMinutes)) * time.Minute)
+		pipelineQueue.SetNotebookFiler(notebook.CreateItemToNotebook)
 		pipelineQueue.Start(context.Background(), 2)
 		sheet.GlobalPipelineStore = pipelineStore
 		sheet.GlobalPipelineQueue = pipelineQueue
@@ -71,6 +129,7 @@ func main() {
 	go func() {
 		<-sigChan
 		bootstrap.ShowShutdown()
+		closePipelineStore()
 		os.Exit(0)
 	}()
 
@@ -92,4 +151,15 @@ func main() {
 	w.Navigate(fmt.Sprintf("http://127.0.0.1:%d", PORT))
 
 	w.Run()
+	closePipelineStore()
+}
+
+// closePipelineStore flushes any job changes still held in memory
+func closePipelineStore() {
+	if sheet.GlobalPipelineStore == nil {
+		return
+	}
+	if err := sheet.GlobalPipelineStore.Close(); err != nil {
+		logg.Error(fmt.Sprintf("Failed to flush pipeline store: %v", err))
+	}
 }
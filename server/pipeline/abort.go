@@ -0,0 +1,40 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	ws "nadhi.dev/sarvar/fun/websocket"
+)
+
+// AbortRunningJob stops a job a worker is processing. The worker holds the
+// job's lock, so it can't be saved from outside; instead its context is
+// cancelled and the worker marks it aborted before committing. It reports
+// false if no worker is running the job.
+func (q *Queue) AbortRunningJob(jobID uuid.UUID) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r, ok := q.running[jobID]
+	if !ok {
+		return false
+	}
+	r.aborted = true
+	r.cancel()
+	return true
+}
+
+// jobAborted reports whether AbortRunningJob was called for a running job
+func (q *Queue) jobAborted(jobID uuid.UUID) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r, ok := q.running[jobID]
+	return ok && r.aborted
+}
+
+// markAborted records a user abort on the worker's copy of the job
+func (q *Queue) markAborted(job *Job) {
+	job.Status = StatusAborted
+	job.UpdatedAt = time.Now()
+	q.sendUpdate(job, "Job aborted", ws.Error("Job aborted", "Aborted by user", map[string]interface{}{})["data"].(map[string]interface{}))
+}
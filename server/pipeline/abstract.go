@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"nadhi.dev/sarvar/fun/ai"
+)
+
+// maxAbstractSourceChars caps how much of the design or LaTeX is sent to
+// the summarizer; the opening of a sheet says what it covers
+const maxAbstractSourceChars = 6000
+
+// abstractMaxTokens bounds the reply; an abstract is one or two sentences
+const abstractMaxTokens = 150
+
+// SetAbstractsEnabled turns the post-compile abstract step on or off
+func (q *Queue) SetAbstractsEnabled(enabled bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.abstracts = enabled
+}
+
+// attachAbstract summarizes a freshly compiled job into
+// Metadata["abstract"] for library listings. The design is summarized when
+// there is one, else the LaTeX. A job that already has an abstract, such
+// as one being recompiled, keeps it, and a failed call leaves the job
+// without one rather than failing it.
+func (q *Queue) attachAbstract(ctx context.Context, job *Job) {
+	q.mu.Lock()
+	enabled := q.abstracts
+	q.mu.Unlock()
+	if !enabled {
+		return
+	}
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]interface{})
+	}
+	if existing, _ := job.Metadata["abstract"].(string); existing != "" {
+		return
+	}
+
+	source := strings.TrimSpace(job.Design)
+	if source == "" {
+		source = strings.TrimSpace(job.Latex)
+	}
+	if source == "" {
+		return
+	}
+	if utf8.RuneCountInString(source) > maxAbstractSourceChars {
+		source = string([]rune(source)[:maxAbstractSourceChars])
+	}
+
+	abstract, err := GenerateDescription(ai.WithMaxTokens(ctx, abstractMaxTokens), source)
+	if err != nil {
+		q.logger.Printf("Abstract: failed to summarize job %s: %v", job.ID, err)
+		return
+	}
+	if abstract = strings.TrimSpace(abstract); abstract != "" {
+		job.Metadata["abstract"] = abstract
+	}
+}
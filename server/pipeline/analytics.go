@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/latex"
+)
+
+// Analytics are objective metrics computed from a compiled sheet
+type Analytics struct {
+	Pages        int     `json:"pages"` // 0 when the PDF couldn't be read
+	Questions    int     `json:"questions"`
+	Words        int     `json:"words"`
+	ReadingGrade float64 `json:"readingGrade"` // Flesch-Kincaid grade level
+	Length       string  `json:"length"`       // short, medium or long
+	Difficulty   string  `json:"difficulty"`   // easy, medium or hard
+}
+
+var (
+	latexCommentPattern = regexp.MustCompile(`(?m)(^|[^\\])%.*$`)
+	latexMathPattern    = regexp.MustCompile(`(?s)\$\$.*?\$\$|\$[^$]*\$|\\\[.*?\\\]|\\\(.*?\\\)`)
+	latexEnvPattern     = regexp.MustCompile(`\\(begin|end)\{[^}]*\}(\[[^\]]*\])?`)
+	latexCommandPattern = regexp.MustCompile(`\\[a-zA-Z@]+\*?(\[[^\]]*\])?`)
+	enumeratePattern    = regexp.MustCompile(`(?s)\\begin\{enumerate\}.*?\\end\{enumerate\}`)
+	sentenceEndPattern  = regexp.MustCompile(`[.!?]+(\s|$)`)
+	vowelGroupPattern   = regexp.MustCompile(`[aeiouy]+`)
+)
+
+// SetAnalyticsEnabled turns the post-compile analytics step on or off
+func (q *Queue) SetAnalyticsEnabled(enabled bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.analytics = enabled
+}
+
+// attachAnalytics stores metrics for a freshly compiled job in
+// Metadata["analytics"]. pdfPath is the PDF whose pages are counted.
+func (q *Queue) attachAnalytics(job *Job, pdfPath string) {
+	q.mu.Lock()
+	enabled := q.analytics
+	q.mu.Unlock()
+	if !enabled {
+		return
+	}
+
+	a := analyzeLatex(job.Latex)
+	if pages, err := latex.CountPDFPages(pdfPath); err == nil {
+		a.Pages = pages
+	} else {
+		q.logger.Printf("Analytics: could not count pages for job %s: %v", job.ID, err)
+	}
+	a.Length = lengthClass(a.Pages, a.Words)
+
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]interface{})
+	}
+	job.Metadata["analytics"] = a
+}
+
+// analyzeLatex computes the text-based metrics; Pages and Length are filled
+// in by the caller once the PDF is available
+func analyzeLatex(src string) Analytics {
+	a := Analytics{Questions: countQuestions(src)}
+
+	text := latexPlainText(src)
+	words := strings.Fields(text)
+	a.Words = len(words)
+	if a.Words == 0 {
+		a.Difficulty = "easy"
+		return a
+	}
+
+	sentences := len(sentenceEndPattern.FindAllString(text, -1))
+	if sentences == 0 {
+		sentences = 1
+	}
+	syllables := 0
+	for _, w := range words {
+		syllables += countSyllables(w)
+	}
+
+	grade := 0.39*float64(a.Words)/float64(sentences) + 11.8*float64(syllables)/float64(a.Words) - 15.59
+	a.ReadingGrade = math.Round(math.Max(grade, 0)*10) / 10
+
+	switch {
+	case a.ReadingGrade < 6:
+		a.Difficulty = "easy"
+	case a.ReadingGrade < 10:
+		a.Difficulty = "medium"
+	default:
+		a.Difficulty = "hard"
+	}
+	return a
+}
+
+// countQuestions counts \question commands (exam class) or, failing that,
+// the items of enumerate lists
+func countQuestions(src string) int {
+	if n := strings.Count(src, `\question`); n > 0 {
+		return n
+	}
+	n := 0
+	for _, list := range enumeratePattern.FindAllString(src, -1) {
+		n += len(itemPattern.FindAllString(list, -1))
+	}
+	return n
+}
+
+// latexPlainText strips the preamble, comments, math and commands, leaving
+// roughly the prose a student reads
+func latexPlainText(src string) string {
+	if i := strings.Index(src, `\begin{document}`); i >= 0 {
+		src = src[i+len(`\begin{document}`):]
+	}
+	src = latexCommentPattern.ReplaceAllString(src, "$1")
+	src = latexMathPattern.ReplaceAllString(src, " x ")
+	src = latexEnvPattern.ReplaceAllString(src, " ")
+	src = latexCommandPattern.ReplaceAllString(src, " ")
+	src = strings.NewReplacer("{", " ", "}", " ", "&", " ", `\\`, " ", "~", " ").Replace(src)
+	return src
+}
+
+// countSyllables estimates syllables from vowel groups, dropping a silent e
+func countSyllables(word string) int {
+	word = strings.ToLower(strings.Trim(word, ".,;:!?\"'()[]"))
+	if word == "" {
+		return 0
+	}
+	n := len(vowelGroupPattern.FindAllString(word, -1))
+	if strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le") && n > 1 {
+		n--
+	}
+	if n == 0 {
+		n = 1
+	}
+	return n
+}
+
+// lengthClass buckets a sheet by pages, or by words when pages are unknown
+func lengthClass(pages, words int) string {
+	if pages == 0 {
+		pages = (words + 399) / 400
+	}
+	switch {
+	case pages <= 2:
+		return "short"
+	case pages <= 6:
+		return "medium"
+	default:
+		return "long"
+	}
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"strings"
+
+	"nadhi.dev/sarvar/fun/ai"
+)
+
+// Answer key markers are LaTeX comments, so the full document still compiles
+// as-is and the student version is produced by cutting between them.
+const (
+	AnswerKeyBeginMarker = "%%BEGIN_ANSWER_KEY%%"
+	AnswerKeyEndMarker   = "%%END_ANSWER_KEY%%"
+)
+
+// answerKeyInstructions tells the model how to delimit the answer key
+const answerKeyInstructions = `
+
+Answer Key Delimiting (required):
+- Place the ENTIRE answer key section between two marker lines, each on its own line:
+  ` + AnswerKeyBeginMarker + `
+  ...answer key content...
+  ` + AnswerKeyEndMarker + `
+- The begin marker must come before the answer key heading (and any \newpage that starts it)
+- The end marker must come before \end{document}
+- Do not place answers anywhere else in the document`
+
+// wantsSplitAnswerKey reports whether the request asks for separate student and key PDFs.
+// Only prep-test mode has an answer key to split.
+func wantsSplitAnswerKey(req *ai.GenerationRequest) bool {
+	return req != nil && req.SplitAnswerKey && ai.ResolveMode(req) == "prep-test"
+}
+
+// StripAnswerKey removes the delimited answer key section from the LaTeX.
+// It returns false if no begin marker was found. A missing end marker cuts
+// up to \end{document}.
+func StripAnswerKey(latexSrc string) (string, bool) {
+	start := strings.Index(latexSrc, AnswerKeyBeginMarker)
+	if start < 0 {
+		return latexSrc, false
+	}
+
+	rest := latexSrc[start:]
+	if end := strings.Index(rest, AnswerKeyEndMarker); end >= 0 {
+		return latexSrc[:start] + rest[end+len(AnswerKeyEndMarker):], true
+	}
+	if end := strings.Index(rest, `\end{document}`); end >= 0 {
+		return latexSrc[:start] + rest[end:], true
+	}
+	return latexSrc[:start] + "\n\\end{document}\n", true
+}
@@ -0,0 +1,250 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultArchiveDir is where archived jobs are kept
+const DefaultArchiveDir = "./storage/archive"
+
+// DefaultArchiveAfterDays is how old a finished job must be before it is
+// archived; 0 disables archival
+const DefaultArchiveAfterDays = 0
+
+// archiveInterval is how often StartArchiving looks for jobs to archive
+const archiveInterval = time.Hour
+
+// SetArchiveDir sets the directory archived jobs are written to and read
+// from. GetJob falls back to it for jobs not in the active store, so it is
+// set even while archival is off to keep earlier archives readable.
+func (s *Store) SetArchiveDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	s.archiveDir = dir
+	return s.loadArchivedOwnersUnsafe()
+}
+
+// loadArchivedOwnersUnsafe builds archivedOwners from the archive files.
+// Callers hold jobsMu.
+func (s *Store) loadArchivedOwnersUnsafe() error {
+	entries, err := os.ReadDir(s.archiveDir)
+	if err != nil {
+		return fmt.Errorf("failed to read archive directory: %w", err)
+	}
+	s.archivedOwners = make(map[uuid.UUID]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		id, err := uuid.Parse(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		job, err := s.loadArchivedJob(id)
+		if err != nil {
+			log.Printf("Warning: skipping unreadable archived job %s: %v", id, err)
+			continue
+		}
+		s.archivedOwners[id] = job.UserID
+	}
+	return nil
+}
+
+// GetArchivedJobsByUser returns the user's archived jobs. Storage quotas
+// and the stored job cap count these alongside the active ones.
+func (s *Store) GetArchivedJobsByUser(userID string) ([]*Job, error) {
+	s.jobsMu.RLock()
+	defer s.jobsMu.RUnlock()
+
+	var jobs []*Job
+	for id, owner := range s.archivedOwners {
+		if owner != userID {
+			continue
+		}
+		job, err := s.loadArchivedJob(id)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// UpdateArchivedJob applies update to an archived job and rewrites its
+// archive file, leaving it archived. It fails with os.ErrNotExist if the
+// job isn't archived.
+func (s *Store) UpdateArchivedJob(id uuid.UUID, update func(*Job)) error {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+
+	if _, ok := s.archivedOwners[id]; !ok {
+		return os.ErrNotExist
+	}
+	job, err := s.loadArchivedJob(id)
+	if err != nil {
+		return err
+	}
+	update(job)
+	return s.writeArchivedJob(job)
+}
+
+// StartArchiving archives finished jobs older than after now and then every
+// hour, until the store is closed. after below one disables it.
+func (s *Store) StartArchiving(after time.Duration) {
+	if after <= 0 {
+		return
+	}
+	s.jobsMu.Lock()
+	if s.archiveStop != nil || s.archiveDir == "" {
+		s.jobsMu.Unlock()
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	s.archiveStop, s.archiveDone = stop, done
+	s.jobsMu.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(archiveInterval)
+		defer ticker.Stop()
+		for {
+			if n, err := s.ArchiveJobs(after); err != nil {
+				log.Printf("Warning: job archival failed: %v", err)
+			} else if n > 0 {
+				log.Printf("Archived %d jobs", n)
+			}
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stopArchiving stops the archival loop, if running
+func (s *Store) stopArchiving() {
+	s.jobsMu.Lock()
+	stop, done := s.archiveStop, s.archiveDone
+	s.archiveStop, s.archiveDone = nil, nil
+	s.jobsMu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// ArchiveJobs moves completed, failed and aborted jobs that finished more
+// than after ago out of the jobs file into one file each under the archive
+// directory. Jobs held by GetJobForUpdate are left for the next run. It
+// returns how many jobs were archived.
+func (s *Store) ArchiveJobs(after time.Duration) (int, error) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+
+	if s.archiveDir == "" {
+		return 0, fmt.Errorf("no archive directory set")
+	}
+	jobs, err := s.loadJobsUnsafe()
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-after)
+	archived := 0
+	for key, job := range jobs {
+		if !job.Status.IsTerminal() || !completedTime(job).Before(cutoff) {
+			continue
+		}
+		// Lock order is job lock before jobsMu, so only try it
+		lock := s.jobLock(job.ID)
+		if !lock.TryLock() {
+			s.releaseJobLock(job.ID)
+			continue
+		}
+		err := s.writeArchivedJob(job)
+		s.unlockJob(job.ID, lock)
+		if err != nil {
+			log.Printf("Warning: failed to archive job %s: %v", job.ID, err)
+			continue
+		}
+		if s.archivedOwners == nil {
+			s.archivedOwners = make(map[uuid.UUID]string)
+		}
+		s.archivedOwners[job.ID] = job.UserID
+		delete(jobs, key)
+		archived++
+	}
+	if archived == 0 {
+		return 0, nil
+	}
+
+	// The archive files are written, so drop the jobs from disk right away
+	if err := s.saveJobsUnsafe(jobs, true); err != nil {
+		return 0, err
+	}
+	return archived, nil
+}
+
+// archivePath is the file an archived job is kept in
+func (s *Store) archivePath(id uuid.UUID) string {
+	return filepath.Join(s.archiveDir, id.String()+".json")
+}
+
+// writeArchivedJob writes a job's archive file. Callers hold jobsMu.
+func (s *Store) writeArchivedJob(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+	return atomicWriteFile(s.archivePath(job.ID), "", data)
+}
+
+// loadArchivedJob reads an archived job. Callers hold jobsMu.
+func (s *Store) loadArchivedJob(id uuid.UUID) (*Job, error) {
+	if s.archiveDir == "" {
+		return nil, os.ErrNotExist
+	}
+	data, err := os.ReadFile(s.archivePath(id))
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal archived job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// isArchived reports whether a job has an archive file. Callers hold jobsMu.
+func (s *Store) isArchived(id uuid.UUID) bool {
+	if s.archiveDir == "" {
+		return false
+	}
+	_, err := os.Stat(s.archivePath(id))
+	return err == nil
+}
+
+// removeArchivedJob deletes a job's archive file, if any. Callers hold jobsMu.
+func (s *Store) removeArchivedJob(id uuid.UUID) {
+	if s.archiveDir == "" {
+		return
+	}
+	delete(s.archivedOwners, id)
+	if err := os.Remove(s.archivePath(id)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: failed to remove archived job %s: %v", id, err)
+	}
+}
@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/ai"
+	"nadhi.dev/sarvar/fun/latex"
+)
+
+// imageExtensions maps the image MIME types tectonic can embed to file extensions
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/jpg":  ".jpg",
+}
+
+// attachmentImageName is the base name an image attachment is written as.
+// Index is the attachment's 1-based upload position, which is also its [n]
+// in the attachment context however the attachments are prioritized.
+func attachmentImageName(index int) string {
+	return fmt.Sprintf("attachment-%d", index)
+}
+
+// imageAttachmentNames lists the \includegraphics names for every usable
+// image attachment. Images that don't decode are left out, since they won't
+// be in the compile directory.
+func imageAttachmentNames(attachments []ai.Attachment) []string {
+	var names []string
+	for i, att := range attachments {
+		if _, _, ok, err := decodeImageAttachment(att); ok && err == nil {
+			names = append(names, attachmentImageName(i+1))
+		}
+	}
+	return names
+}
+
+// imageAttachmentAssets decodes base64 image attachments into compile
+// assets. An image that fails to decode is skipped and reported in the
+// returned error; the others are still returned.
+func imageAttachmentAssets(attachments []ai.Attachment) ([]latex.Asset, error) {
+	var assets []latex.Asset
+	var errs []error
+	for i, att := range attachments {
+		ext, data, ok, err := decodeImageAttachment(att)
+		if !ok {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("attachment %d (%s): invalid base64: %w", i+1, att.Name, err))
+			continue
+		}
+		assets = append(assets, latex.Asset{
+			Name: attachmentImageName(i+1) + ext,
+			Data: data,
+		})
+	}
+	return assets, errors.Join(errs...)
+}
+
+// decodeImageAttachment returns the file extension and bytes of an image
+// attachment tectonic can embed. ok is false for anything else.
+func decodeImageAttachment(att ai.Attachment) (ext string, data []byte, ok bool, err error) {
+	ext, ok = imageExtensions[strings.ToLower(att.MimeType)]
+	if !ok || att.Encoding != "base64" {
+		return "", nil, false, nil
+	}
+	data, err = base64.StdEncoding.DecodeString(att.Content)
+	return ext, data, true, err
+}
+
+// imageAttachmentInstructions tells the model which attached images it may embed
+func imageAttachmentInstructions(attachments []ai.Attachment) string {
+	names := imageAttachmentNames(attachments)
+	if len(names) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(`
+
+Attached Images:
+The following attached images are available in the compile directory: %s
+You may embed them with \usepackage{graphicx} and \includegraphics[width=...]{%s} (no file extension).
+Do not reference any other external files.`, strings.Join(names, ", "), names[0])
+}
@@ -0,0 +1,35 @@
+package pipeline
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	"nadhi.dev/sarvar/fun/ai"
+)
+
+func TestImageAttachmentAssetsSkipsBadImages(t *testing.T) {
+	png := base64.StdEncoding.EncodeToString([]byte("png bytes"))
+	attachments := []ai.Attachment{
+		{Name: "good.png", MimeType: "image/png", Encoding: "base64", Content: png},
+		{Name: "broken.png", MimeType: "image/png", Encoding: "base64", Content: "not base64!"},
+		{Name: "notes.txt", MimeType: "text/plain", Encoding: "utf-8", Content: "notes"},
+		{Name: "photo.jpg", MimeType: "image/jpeg", Encoding: "base64", Content: png},
+	}
+
+	assets, err := imageAttachmentAssets(attachments)
+	if err == nil {
+		t.Error("want an error naming the broken attachment")
+	}
+	var names []string
+	for _, a := range assets {
+		names = append(names, a.Name)
+	}
+	if want := []string{"attachment-1.png", "attachment-4.jpg"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("assets = %v, want %v", names, want)
+	}
+
+	if got, want := imageAttachmentNames(attachments), []string{"attachment-1", "attachment-4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("names = %v, want %v", got, want)
+	}
+}
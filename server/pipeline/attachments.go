@@ -0,0 +1,112 @@
+package pipeline
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"nadhi.dev/sarvar/fun/ai"
+)
+
+// attachmentHashPattern matches a hex SHA-256, so a hash is always a safe file name
+var attachmentHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// PutAttachments writes attachment bytes to the content-addressed store and
+// returns references: copies with Hash set and Content emptied. Identical
+// files are stored once however many jobs attach them. The hash is always
+// recomputed from the content, never taken from the caller.
+func (s *Store) PutAttachments(attachments []ai.Attachment) ([]ai.Attachment, error) {
+	if len(attachments) == 0 {
+		return attachments, nil
+	}
+
+	refs := make([]ai.Attachment, 0, len(attachments))
+	seen := make(map[string]bool, len(attachments))
+	for _, att := range attachments {
+		data, err := att.Data()
+		if err != nil {
+			return nil, fmt.Errorf("attachment %s: %w", att.Name, err)
+		}
+
+		hash := ai.ContentHash(data)
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		if err := s.writeAttachment(hash, data); err != nil {
+			return nil, fmt.Errorf("failed to store attachment %s: %w", att.Name, err)
+		}
+
+		att.Hash = hash
+		att.Content = ""
+		refs = append(refs, att)
+	}
+
+	return refs, nil
+}
+
+// ResolveAttachments fills in the content of attachment references.
+// Attachments that still carry their content (jobs created before the
+// store existed) are returned unchanged.
+func (s *Store) ResolveAttachments(attachments []ai.Attachment) ([]ai.Attachment, error) {
+	if len(attachments) == 0 {
+		return attachments, nil
+	}
+
+	resolved := make([]ai.Attachment, len(attachments))
+	for i, att := range attachments {
+		if att.Content != "" || att.Hash == "" {
+			resolved[i] = att
+			continue
+		}
+		if !attachmentHashPattern.MatchString(att.Hash) {
+			return nil, fmt.Errorf("attachment %s: invalid hash", att.Name)
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.attachmentsDir, att.Hash))
+		if err != nil {
+			return nil, fmt.Errorf("attachment %s is missing from the store: %w", att.Name, err)
+		}
+
+		if att.Encoding == "base64" {
+			att.Content = base64.StdEncoding.EncodeToString(data)
+		} else {
+			att.Content = string(data)
+		}
+		resolved[i] = att
+	}
+
+	return resolved, nil
+}
+
+// writeAttachment stores data under its hash unless it is already present.
+// The file appears atomically, so a concurrent reader never sees it partly written.
+func (s *Store) writeAttachment(hash string, data []byte) error {
+	path := filepath.Join(s.attachmentsDir, hash)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(s.attachmentsDir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
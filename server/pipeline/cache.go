@@ -0,0 +1,140 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// jobCache holds the parsed jobs file so reads skip reading and decoding
+// it. It only ever holds jobs decoded from JSON, never a caller's copy, and
+// hands out clones, so callers still own the jobs they get.
+type jobCache struct {
+	// mu guards jobs. It can't be jobsMu: reads hold only jobsMu's read
+	// lock, so concurrent readers would fill the cache at the same time,
+	// and taking jobsMu's write lock for every read would serialise all
+	// reads behind each other and behind saves. mu is only held to swap
+	// the map or clone out of it.
+	mu      sync.Mutex
+	enabled bool
+	jobs    map[string]*Job
+}
+
+// SetJobCache turns the in-memory job cache on or off. It is on by default.
+func (s *Store) SetJobCache(enabled bool) {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	s.cache.enabled = enabled
+	s.cache.jobs = nil
+}
+
+// cachedJobs returns a copy of the cached jobs, or false on a miss
+func (s *Store) cachedJobs() (map[string]*Job, bool) {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	if !s.cache.enabled || s.cache.jobs == nil {
+		return nil, false
+	}
+	jobs := make(map[string]*Job, len(s.cache.jobs))
+	for id, job := range s.cache.jobs {
+		jobs[id] = job.clone()
+	}
+	return jobs, true
+}
+
+// cachedJob returns a copy of one cached job without cloning the rest.
+// hit is false on a cache miss, found false if the cache lacks the job.
+func (s *Store) cachedJob(id uuid.UUID) (job *Job, found, hit bool) {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	if !s.cache.enabled || s.cache.jobs == nil {
+		return nil, false, false
+	}
+	cached, ok := s.cache.jobs[id.String()]
+	if !ok {
+		return nil, false, true
+	}
+	return cached.clone(), true, true
+}
+
+// fillJobCache caches freshly decoded jobs, keeping clones so the caller's
+// copies stay its own
+func (s *Store) fillJobCache(jobs map[string]*Job) {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	if !s.cache.enabled {
+		return
+	}
+	cached := make(map[string]*Job, len(jobs))
+	for id, job := range jobs {
+		cached[id] = job.clone()
+	}
+	s.cache.jobs = cached
+}
+
+// cacheSavedJobs refills the cache from the jobs file contents just
+// written. The saved map holds the caller's own jobs, which may carry typed
+// metadata and go on changing, so the bytes are decoded instead. Saves are
+// frequent while workers run; dropping the cache on each would make most
+// reads miss.
+func (s *Store) cacheSavedJobs(data []byte) {
+	s.cache.mu.Lock()
+	enabled := s.cache.enabled
+	s.cache.mu.Unlock()
+	if !enabled {
+		return
+	}
+
+	var jobs map[string]*Job
+	if err := json.Unmarshal(data, &jobs); err != nil || jobs == nil {
+		s.invalidateJobCache()
+		return
+	}
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	if s.cache.enabled {
+		s.cache.jobs = jobs
+	}
+}
+
+// invalidateJobCache drops the cache after a write
+func (s *Store) invalidateJobCache() {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	s.cache.jobs = nil
+}
+
+// clone copies a job decoded from JSON deeply enough that changing the
+// copy, including its metadata and labels, leaves the original alone
+func (j *Job) clone() *Job {
+	c := *j
+	c.Labels = append([]string(nil), j.Labels...)
+	if j.Labels == nil {
+		c.Labels = nil
+	}
+	if j.Metadata != nil {
+		c.Metadata = cloneJSONValue(j.Metadata).(map[string]interface{})
+	}
+	return &c
+}
+
+// cloneJSONValue deep-copies a value as encoding/json decodes it
+func cloneJSONValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[k] = cloneJSONValue(v)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, v := range t {
+			s[i] = cloneJSONValue(v)
+		}
+		return s
+	default:
+		return v
+	}
+}
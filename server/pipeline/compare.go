@@ -0,0 +1,316 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/ai"
+	"nadhi.dev/sarvar/fun/websearch"
+)
+
+// maxDiffCells bounds the LCS table of a LaTeX diff; larger changed regions
+// are shown as one replaced block
+const maxDiffCells = 4_000_000
+
+// diffContext is how many unchanged lines surround each hunk
+const diffContext = 3
+
+// Comparison puts two jobs side by side, for A/B testing prompts and styles
+type Comparison struct {
+	A         ComparedJob       `json:"a"`
+	B         ComparedJob       `json:"b"`
+	LatexDiff string            `json:"latexDiff"`
+	Summary   ComparisonSummary `json:"summary"`
+}
+
+// ComparedJob is one side of a comparison. Attachment contents are left out.
+type ComparedJob struct {
+	ID        string                `json:"id"`
+	Status    JobStatus             `json:"status"`
+	Request   *ai.GenerationRequest `json:"request,omitempty"`
+	Design    string                `json:"design"`
+	Latex     string                `json:"latex"`
+	Analytics *Analytics            `json:"analytics,omitempty"`
+}
+
+// ComparisonSummary lists what differs. Deltas are B minus A and are left
+// out when either job lacks the metric.
+type ComparisonSummary struct {
+	ChangedFields     []string `json:"changedFields"`
+	SameLatex         bool     `json:"sameLatex"`
+	LinesAdded        int      `json:"linesAdded"`
+	LinesRemoved      int      `json:"linesRemoved"`
+	PagesDelta        *int     `json:"pagesDelta,omitempty"`
+	QuestionsDelta    *int     `json:"questionsDelta,omitempty"`
+	WordsDelta        *int     `json:"wordsDelta,omitempty"`
+	ReadingGradeDelta *float64 `json:"readingGradeDelta,omitempty"`
+}
+
+// CompareJobs builds the comparison of two jobs
+func CompareJobs(a, b *Job) *Comparison {
+	cmp := &Comparison{A: comparedJob(a), B: comparedJob(b)}
+
+	cmp.Summary.ChangedFields = changedRequestFields(cmp.A.Request, cmp.B.Request)
+	cmp.Summary.SameLatex = a.Latex == b.Latex
+	if !cmp.Summary.SameLatex {
+		cmp.LatexDiff, cmp.Summary.LinesAdded, cmp.Summary.LinesRemoved = unifiedDiff(a.Latex, b.Latex, a.ID.String()+".tex", b.ID.String()+".tex")
+	}
+
+	if x, y := cmp.A.Analytics, cmp.B.Analytics; x != nil && y != nil {
+		if x.Pages > 0 && y.Pages > 0 {
+			d := y.Pages - x.Pages
+			cmp.Summary.PagesDelta = &d
+		}
+		questions := y.Questions - x.Questions
+		words := y.Words - x.Words
+		grade := math.Round((y.ReadingGrade-x.ReadingGrade)*10) / 10
+		cmp.Summary.QuestionsDelta = &questions
+		cmp.Summary.WordsDelta = &words
+		cmp.Summary.ReadingGradeDelta = &grade
+	}
+
+	return cmp
+}
+
+// comparedJob extracts one side of a comparison
+func comparedJob(job *Job) ComparedJob {
+	side := ComparedJob{
+		ID:        job.ID.String(),
+		Status:    job.Status,
+		Design:    job.Design,
+		Latex:     job.Latex,
+		Analytics: analyticsFromJob(job),
+	}
+
+	var req ai.GenerationRequest
+	if err := json.Unmarshal([]byte(job.Prompt), &req); err == nil {
+		for i := range req.Attachments {
+			req.Attachments[i].Content = ""
+		}
+		side.Request = &req
+	}
+	return side
+}
+
+// analyticsFromJob returns the job's stored analytics or, for jobs compiled
+// without them, the text metrics computed from its LaTeX (pages unknown)
+func analyticsFromJob(job *Job) *Analytics {
+	if a, ok := metadataAs[Analytics](job, "analytics"); ok {
+		return &a
+	}
+	if strings.TrimSpace(job.Latex) == "" {
+		return nil
+	}
+	a := analyzeLatex(job.Latex)
+	return &a
+}
+
+// changedRequestFields names the request fields that differ between a and b
+func changedRequestFields(a, b *ai.GenerationRequest) []string {
+	changed := []string{}
+	if a == nil || b == nil {
+		return changed
+	}
+	fields := []struct {
+		name string
+		a, b string
+	}{
+		{"subject", a.Subject, b.Subject},
+		{"course", a.Course, b.Course},
+		{"description", a.Description, b.Description},
+		{"tags", strings.Join(a.Tags, ","), strings.Join(b.Tags, ",")},
+		{"curriculum", a.Curriculum, b.Curriculum},
+		{"specialInstructions", a.SpecialInstructions, b.SpecialInstructions},
+		{"styleName", a.StyleName, b.StyleName},
+		{"mode", a.Mode, b.Mode},
+		{"language", a.Language, b.Language},
+		{"webSearchQuery", a.WebSearchQuery, b.WebSearchQuery},
+		{"webSearchEnabled", fmt.Sprint(a.WebSearchEnabled), fmt.Sprint(b.WebSearchEnabled)},
+		{"webSearchLimit", fmt.Sprint(websearch.ClampLimit(a.WebSearchLimit)), fmt.Sprint(websearch.ClampLimit(b.WebSearchLimit))},
+		{"structuredDesign", fmt.Sprint(a.StructuredDesign), fmt.Sprint(b.StructuredDesign)},
+		{"splitAnswerKey", fmt.Sprint(a.SplitAnswerKey), fmt.Sprint(b.SplitAnswerKey)},
+		{"optimizePrompt", fmt.Sprint(a.OptimizePrompt), fmt.Sprint(b.OptimizePrompt)},
+		{"selfReview", fmt.Sprint(a.SelfReview), fmt.Sprint(b.SelfReview)},
+		{"attachments", attachmentNames(a.Attachments), attachmentNames(b.Attachments)},
+	}
+	for _, f := range fields {
+		if f.a != f.b {
+			changed = append(changed, f.name)
+		}
+	}
+	return changed
+}
+
+// attachmentNames identifies a request's attachments by name and hash,
+// with the role of any that have one
+func attachmentNames(attachments []ai.Attachment) string {
+	names := make([]string, len(attachments))
+	for i, att := range attachments {
+		names[i] = att.Name + "@" + att.Hash
+		if att.Role != "" {
+			names[i] += " (" + att.Role + ")"
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed, '+' added
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// unifiedDiff renders a unified diff of two texts and counts the added and
+// removed lines
+func unifiedDiff(a, b, nameA, nameB string) (string, int, int) {
+	ops := diffLines(strings.Split(a, "\n"), strings.Split(b, "\n"))
+
+	added, removed := 0, 0
+	for _, op := range ops {
+		switch op.kind {
+		case '+':
+			added++
+		case '-':
+			removed++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", nameA, nameB)
+
+	lineA, lineB := 1, 1
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			lineA++
+			lineB++
+			i++
+			continue
+		}
+
+		// Grow the hunk until diffContext*2 unchanged lines separate changes
+		start := i
+		for start > 0 && i-start < diffContext && ops[start-1].kind == ' ' {
+			start--
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > diffContext*2 {
+				end = min(end+diffContext, len(ops))
+				break
+			}
+			end = run
+		}
+
+		startA, startB := lineA-(i-start), lineB-(i-start)
+		countA, countB := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				countA++
+			}
+			if op.kind != '-' {
+				countB++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", startA, countA, startB, countB)
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			out.WriteByte('\n')
+		}
+
+		lineA = startA + countA
+		lineB = startB + countB
+		i = end
+	}
+
+	return out.String(), added, removed
+}
+
+// diffLines computes a line edit script from a to b. Common leading and
+// trailing lines are matched directly and the rest by longest common
+// subsequence, unless that table would exceed maxDiffCells.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)*len(midB) > maxDiffCells {
+		for _, line := range midA {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range midB {
+			ops = append(ops, diffOp{'+', line})
+		}
+	} else {
+		ops = append(ops, lcsDiff(midA, midB)...)
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// lcsDiff is the longest-common-subsequence edit script of a and b
+func lcsDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, n+m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+// SaveConversation persists a single conversation to its own file, so
+// appending a message never rewrites other conversations
+func (s *Store) SaveConversation(conv *Conversation) error {
+	s.convMu.Lock()
+	defer s.convMu.Unlock()
+
+	if err := s.saveConversationUnsafe(conv); err != nil {
+		return err
+	}
+
+	// The index only changes when a job gets a new conversation
+	jobKey := conv.JobID.String()
+	if s.convIndex[jobKey] != conv.ID.String() {
+		s.convIndex[jobKey] = conv.ID.String()
+		if err := s.saveConversationIndexUnsafe(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetConversation retrieves a conversation by ID
+func (s *Store) GetConversation(id uuid.UUID) (*Conversation, error) {
+	s.convMu.RLock()
+	defer s.convMu.RUnlock()
+
+	return s.loadConversationUnsafe(id.String())
+}
+
+// GetConversationByJobID retrieves the current conversation for a job
+func (s *Store) GetConversationByJobID(jobID uuid.UUID) (*Conversation, error) {
+	s.convMu.RLock()
+	defer s.convMu.RUnlock()
+
+	convID, ok := s.convIndex[jobID.String()]
+	if !ok {
+		return nil, fmt.Errorf("conversation not found for job: %s", jobID)
+	}
+
+	return s.loadConversationUnsafe(convID)
+}
+
+// Internal unsafe methods (must be called with convMu held)
+
+func (s *Store) conversationPath(id string) string {
+	return filepath.Join(s.convDir, id+".json")
+}
+
+func (s *Store) loadConversationUnsafe(id string) (*Conversation, error) {
+	path := s.conversationPath(id)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("conversation not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conversation file: %w", err)
+	}
+
+	var conv Conversation
+	if len(data) == 0 || json.Unmarshal(data, &conv) != nil {
+		conv = Conversation{}
+		backup, berr := os.ReadFile(path + ".bak")
+		if berr == nil && len(backup) > 0 {
+			if json.Unmarshal(backup, &conv) == nil {
+				s.repairFromBackup(path, path+".bak", backup)
+				return &conv, nil
+			}
+		}
+		return nil, fmt.Errorf("failed to unmarshal conversation %s", id)
+	}
+
+	return &conv, nil
+}
+
+func (s *Store) saveConversationUnsafe(conv *Conversation) error {
+	data, err := json.MarshalIndent(conv, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversation: %w", err)
+	}
+
+	path := s.conversationPath(conv.ID.String())
+	if err := atomicWriteFile(path, path+".bak", data); err != nil {
+		return fmt.Errorf("failed to write conversation file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) loadConversationIndex() error {
+	s.convMu.Lock()
+	defer s.convMu.Unlock()
+
+	data, err := os.ReadFile(s.convIndexPath)
+	if err != nil {
+		return fmt.Errorf("failed to read conversation index: %w", err)
+	}
+
+	var index map[string]string
+	if err := json.Unmarshal(data, &index); err != nil {
+		return fmt.Errorf("failed to unmarshal conversation index: %w", err)
+	}
+	if index == nil {
+		index = make(map[string]string)
+	}
+
+	s.convIndex = index
+	return nil
+}
+
+func (s *Store) saveConversationIndexUnsafe() error {
+	data, err := json.MarshalIndent(s.convIndex, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversation index: %w", err)
+	}
+
+	if err := atomicWriteFile(s.convIndexPath, s.convIndexPath+".bak", data); err != nil {
+		return fmt.Errorf("failed to write conversation index: %w", err)
+	}
+
+	return nil
+}
+
+// migrateLegacyConversations splits the old single conversations.json into
+// per-conversation files. The legacy file (and its backup) are renamed with
+// a .migrated suffix afterwards so the migration only runs once.
+func (s *Store) migrateLegacyConversations(legacyPath string) error {
+	data, err := os.ReadFile(legacyPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read legacy conversations: %w", err)
+	}
+
+	var convs map[string]*Conversation
+	if len(data) == 0 || json.Unmarshal(data, &convs) != nil {
+		backup, berr := os.ReadFile(legacyPath + ".bak")
+		if berr != nil || json.Unmarshal(backup, &convs) != nil {
+			return fmt.Errorf("legacy conversations file %s is corrupt and has no valid backup", legacyPath)
+		}
+	}
+
+	s.convMu.Lock()
+	defer s.convMu.Unlock()
+
+	for _, conv := range convs {
+		if conv == nil {
+			continue
+		}
+		if err := s.saveConversationUnsafe(conv); err != nil {
+			return fmt.Errorf("failed to migrate conversation %s: %w", conv.ID, err)
+		}
+
+		// Several conversations can share a job (e.g. after a retry); keep the newest
+		jobKey := conv.JobID.String()
+		if existingID, ok := s.convIndex[jobKey]; ok {
+			if existing, found := convs[existingID]; found && existing.UpdatedAt.After(conv.UpdatedAt) {
+				continue
+			}
+		}
+		s.convIndex[jobKey] = conv.ID.String()
+	}
+
+	if err := s.saveConversationIndexUnsafe(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(legacyPath, legacyPath+".migrated"); err != nil {
+		return fmt.Errorf("failed to retire legacy conversations file: %w", err)
+	}
+	if _, err := os.Stat(legacyPath + ".bak"); err == nil {
+		_ = os.Rename(legacyPath+".bak", legacyPath+".bak.migrated")
+	}
+
+	log.Printf("Migrated %d conversations from %s to %s", len(convs), legacyPath, s.convDir)
+	return nil
+}
@@ -0,0 +1,76 @@
+package pipeline
+
+import "sync"
+
+// DefaultMaxConversationMessages caps how many messages a conversation keeps
+const DefaultMaxConversationMessages = 200
+
+// DefaultMaxConversationBytes caps the total content size of a conversation
+const DefaultMaxConversationBytes = 2 << 20
+
+var (
+	convLimitsMu    sync.RWMutex
+	maxConvMessages = DefaultMaxConversationMessages
+	maxConvBytes    = DefaultMaxConversationBytes
+)
+
+// SetConversationLimits sets the hard caps AddMessage enforces. Values below
+// 1 disable that cap.
+func SetConversationLimits(maxMessages, maxBytes int) {
+	if maxMessages < 0 {
+		maxMessages = 0
+	}
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	convLimitsMu.Lock()
+	defer convLimitsMu.Unlock()
+	maxConvMessages = maxMessages
+	maxConvBytes = maxBytes
+}
+
+// conversationLimits returns the current caps
+func conversationLimits() (int, int) {
+	convLimitsMu.RLock()
+	defer convLimitsMu.RUnlock()
+	return maxConvMessages, maxConvBytes
+}
+
+// enforceLimits evicts the oldest non-system messages until the
+// conversation is within the caps. The newest message is always kept, even
+// if it alone is over the byte cap.
+func (c *Conversation) enforceLimits() {
+	maxMessages, maxBytes := conversationLimits()
+	if maxMessages == 0 && maxBytes == 0 {
+		return
+	}
+
+	size := 0
+	for _, msg := range c.Messages {
+		size += len(msg.Content)
+	}
+
+	for (maxMessages > 0 && len(c.Messages) > maxMessages) || (maxBytes > 0 && size > maxBytes) {
+		i := c.oldestEvictable()
+		if i < 0 {
+			return
+		}
+		size -= len(c.Messages[i].Content)
+		c.Messages = append(c.Messages[:i], c.Messages[i+1:]...)
+		if i < c.SeededMessages {
+			c.SeededMessages--
+		}
+		c.EvictedMessages++
+	}
+}
+
+// oldestEvictable returns the index of the oldest non-system message other
+// than the newest, or -1 if there is none
+func (c *Conversation) oldestEvictable() int {
+	for i := 0; i < len(c.Messages)-1; i++ {
+		if c.Messages[i].Role != "system" {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,54 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultJobDeadlineMinutes is how long one processing run of a job may
+// take in total; 0 disables the deadline
+const DefaultJobDeadlineMinutes = 30
+
+// SetJobDeadline sets how long a worker may spend on one job before its
+// work is cancelled and the job fails. Unlike the stuck threshold this
+// holds even while the job keeps making progress. Values below 1 disable
+// the deadline.
+func (q *Queue) SetJobDeadline(d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if d < 0 {
+		d = 0
+	}
+	q.jobDeadline = d
+}
+
+// JobDeadline returns the per-job deadline, 0 when disabled
+func (q *Queue) JobDeadline() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.jobDeadline
+}
+
+// withJobDeadline returns a context that expires at the job deadline, if
+// one is set. In-flight provider calls are cancelled when it does.
+func (q *Queue) withJobDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d := q.JobDeadline(); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+// failPastDeadline runs once a step returns after the job's deadline
+// passed. A job the step already finished, aborted or parked for review is
+// left as is; otherwise it is failed, replacing whatever error the cancelled
+// step recorded. It reports whether the job was failed.
+func (q *Queue) failPastDeadline(job *Job) bool {
+	if job.Status == StatusCompleted || job.Status == StatusAborted || job.Status == StatusWaitingManual {
+		return false
+	}
+	msg := fmt.Sprintf("Generation deadline exceeded (%s)", q.JobDeadline())
+	job.SetError(msg, nil)
+	q.sendUpdate(job, "Generation deadline exceeded", q.errorData(msg))
+	return true
+}
@@ -0,0 +1,93 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/ai"
+)
+
+// MaxDesignOptions is the most alternative designs one job can ask for
+const MaxDesignOptions = 3
+
+// Job metadata keys for design options: the alternatives the design step
+// generated, and the one the user picked
+const (
+	designOptionsKey        = "designOptions"
+	selectedDesignOptionKey = "selectedDesignOption"
+)
+
+// designOptionCount returns how many alternative designs the request asks
+// for, capped at MaxDesignOptions, or 0 for a single design. Structured
+// designs and auto-approved jobs, which can't wait for a pick, get one.
+func designOptionCount(req *ai.GenerationRequest) int {
+	if req.DesignOptions < 2 || req.StructuredDesign || req.AutoApprove {
+		return 0
+	}
+	if req.DesignOptions > MaxDesignOptions {
+		return MaxDesignOptions
+	}
+	return req.DesignOptions
+}
+
+// DesignOptionsFromJob returns the alternative designs the job's design
+// step generated, if it was asked for options
+func DesignOptionsFromJob(job *Job) ([]string, bool) {
+	options, ok := metadataAs[[]string](job, designOptionsKey)
+	if !ok || len(options) == 0 {
+		return nil, false
+	}
+	return options, true
+}
+
+// AwaitingDesignChoice reports whether the job is parked for the user to
+// pick one of its design options
+func AwaitingDesignChoice(job *Job) bool {
+	if job.Status != StatusWaitingManual || job.CurrentStep != StepDesign || strings.TrimSpace(job.Design) != "" {
+		return false
+	}
+	_, ok := DesignOptionsFromJob(job)
+	return ok
+}
+
+// parkDesignOptions saves the alternatives and stops the job until the user
+// picks one
+func (q *Queue) parkDesignOptions(job *Job, options []string) {
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]interface{})
+	}
+	job.Metadata[designOptionsKey] = options
+	delete(job.Metadata, selectedDesignOptionKey)
+	job.Design = ""
+
+	msg := fmt.Sprintf("%d designs generated, pick one to continue", len(options))
+	job.SetWaitingManual(msg)
+	q.sendUpdate(job, msg, q.stageData("Design", "Choose a design", map[string]interface{}{
+		"designOptions": options,
+	}))
+}
+
+// SelectDesignOption makes the design at index (0-based) the job's design,
+// adds it to the conversation and moves the job on to the LaTeX step. The
+// caller saves and enqueues the job.
+func (q *Queue) SelectDesignOption(job *Job, index int) error {
+	if !AwaitingDesignChoice(job) {
+		return fmt.Errorf("job is not waiting for a design choice")
+	}
+	options, _ := DesignOptionsFromJob(job)
+	if index < 0 || index >= len(options) {
+		return fmt.Errorf("option must be between 0 and %d", len(options)-1)
+	}
+
+	conv, err := q.store.GetConversationByJobID(job.ID)
+	if err != nil {
+		conv = NewConversation(job.ID)
+	}
+	conv.AddMessage("assistant", options[index])
+	_ = q.store.SaveConversation(conv)
+
+	job.Design = options[index]
+	job.Metadata[selectedDesignOptionKey] = index
+	job.ResetToStep(StepLatex)
+	return nil
+}
@@ -0,0 +1,288 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/ai"
+)
+
+// DesignSpecSystemPrompt replaces SystemPrompt when the design step emits JSON
+const DesignSpecSystemPrompt = `You are a deterministic document design engine.
+
+Rules:
+- Output ONLY a single JSON object matching the requested schema
+- Do not explain
+- Do not include markdown code blocks
+- Never invent data
+- Never use placeholders or TODOs`
+
+// designSpecSchema is shown to the model and mirrors DesignSpec
+const designSpecSchema = `{
+  "title": string,                       // required
+  "documentType": string,                // e.g. "notes", "practice test", "cheat sheet"
+  "purpose": string,
+  "sections": [                          // required, at least one
+    {
+      "title": string,                   // required
+      "topics": [string],
+      "questions": [
+        {"type": string, "count": int, "difficulty": "easy" | "medium" | "hard"}
+      ]
+    }
+  ],
+  "difficultyDistribution": {"easy": int, "medium": int, "hard": int},  // percentages summing to 100, optional
+  "layout": string,
+  "specialRequirements": [string]
+}`
+
+// validQuestionTypes lists the question types a DesignSpec may use
+var validQuestionTypes = map[string]bool{
+	"multiple-choice": true,
+	"short-answer":    true,
+	"long-answer":     true,
+	"problem-solving": true,
+	"true-false":      true,
+	"fill-in-blank":   true,
+	"matching":        true,
+	"worked-example":  true,
+	"recall-prompt":   true,
+}
+
+// validDifficulties lists the difficulty levels a DesignSpec may use
+var validDifficulties = map[string]bool{
+	"easy":   true,
+	"medium": true,
+	"hard":   true,
+}
+
+// DesignSpec is the structured output of the design step
+type DesignSpec struct {
+	Title                  string          `json:"title"`
+	DocumentType           string          `json:"documentType"`
+	Purpose                string          `json:"purpose"`
+	Sections               []DesignSection `json:"sections"`
+	DifficultyDistribution map[string]int  `json:"difficultyDistribution,omitempty"`
+	Layout                 string          `json:"layout"`
+	SpecialRequirements    []string        `json:"specialRequirements,omitempty"`
+}
+
+// DesignSection is a single section of a DesignSpec
+type DesignSection struct {
+	Title     string         `json:"title"`
+	Topics    []string       `json:"topics,omitempty"`
+	Questions []QuestionSpec `json:"questions,omitempty"`
+}
+
+// QuestionSpec describes a group of questions within a section
+type QuestionSpec struct {
+	Type       string `json:"type"`
+	Count      int    `json:"count"`
+	Difficulty string `json:"difficulty,omitempty"`
+}
+
+// Validate checks the spec against the schema and normalises enum values
+func (s *DesignSpec) Validate() error {
+	if strings.TrimSpace(s.Title) == "" {
+		return fmt.Errorf("title is required")
+	}
+	if len(s.Sections) == 0 {
+		return fmt.Errorf("at least one section is required")
+	}
+
+	for i := range s.Sections {
+		sec := &s.Sections[i]
+		if strings.TrimSpace(sec.Title) == "" {
+			return fmt.Errorf("section %d: title is required", i+1)
+		}
+		for j := range sec.Questions {
+			q := &sec.Questions[j]
+			q.Type = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(q.Type), " ", "-"))
+			q.Difficulty = strings.ToLower(strings.TrimSpace(q.Difficulty))
+			if !validQuestionTypes[q.Type] {
+				return fmt.Errorf("section %d question %d: unknown type %q", i+1, j+1, q.Type)
+			}
+			if q.Count < 1 {
+				return fmt.Errorf("section %d question %d: count must be at least 1", i+1, j+1)
+			}
+			if q.Difficulty != "" && !validDifficulties[q.Difficulty] {
+				return fmt.Errorf("section %d question %d: unknown difficulty %q", i+1, j+1, q.Difficulty)
+			}
+		}
+	}
+
+	if len(s.DifficultyDistribution) > 0 {
+		total := 0
+		for level, pct := range s.DifficultyDistribution {
+			if !validDifficulties[level] {
+				return fmt.Errorf("difficultyDistribution: unknown level %q", level)
+			}
+			if pct < 0 {
+				return fmt.Errorf("difficultyDistribution: %s must not be negative", level)
+			}
+			total += pct
+		}
+		if total != 100 {
+			return fmt.Errorf("difficultyDistribution must sum to 100, got %d", total)
+		}
+	}
+
+	return nil
+}
+
+// Render produces the human-readable prose design from the spec
+func (s *DesignSpec) Render() string {
+	var b strings.Builder
+
+	b.WriteString(fmt.Sprintf("Title: %s\n", s.Title))
+	if s.DocumentType != "" {
+		b.WriteString(fmt.Sprintf("Document Type: %s\n", s.DocumentType))
+	}
+	if s.Purpose != "" {
+		b.WriteString(fmt.Sprintf("Purpose: %s\n", s.Purpose))
+	}
+
+	b.WriteString("\nSections:\n")
+	for i, sec := range s.Sections {
+		b.WriteString(fmt.Sprintf("%d. %s\n", i+1, sec.Title))
+		if len(sec.Topics) > 0 {
+			b.WriteString(fmt.Sprintf("   Topics: %s\n", strings.Join(sec.Topics, ", ")))
+		}
+		for _, q := range sec.Questions {
+			line := fmt.Sprintf("   - %d x %s", q.Count, q.Type)
+			if q.Difficulty != "" {
+				line += fmt.Sprintf(" (%s)", q.Difficulty)
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+
+	if len(s.DifficultyDistribution) > 0 {
+		b.WriteString(fmt.Sprintf("\nDifficulty: easy %d%%, medium %d%%, hard %d%%\n",
+			s.DifficultyDistribution["easy"], s.DifficultyDistribution["medium"], s.DifficultyDistribution["hard"]))
+	}
+	if s.Layout != "" {
+		b.WriteString(fmt.Sprintf("\nLayout: %s\n", s.Layout))
+	}
+	if len(s.SpecialRequirements) > 0 {
+		b.WriteString("\nSpecial Requirements:\n")
+		for _, req := range s.SpecialRequirements {
+			b.WriteString(fmt.Sprintf("- %s\n", req))
+		}
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// LatexBrief is the design text handed to the LaTeX step: the prose
+// rendering followed by the exact spec so counts are followed precisely
+func (s *DesignSpec) LatexBrief() string {
+	specJSON, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return s.Render()
+	}
+	return fmt.Sprintf("%s\n\nStructured spec (follow section order and question counts exactly):\n%s", s.Render(), specJSON)
+}
+
+// ParseDesignSpec decodes and validates a spec from raw model output
+func ParseDesignSpec(raw string) (*DesignSpec, error) {
+	raw = strings.TrimSpace(raw)
+	raw = strings.TrimPrefix(raw, "```json")
+	raw = strings.TrimPrefix(raw, "```")
+	raw = strings.TrimSuffix(raw, "```")
+
+	start := strings.Index(raw, "{")
+	end := strings.LastIndex(raw, "}")
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("no JSON object found in design output")
+	}
+
+	var spec DesignSpec
+	if err := json.Unmarshal([]byte(raw[start:end+1]), &spec); err != nil {
+		return nil, fmt.Errorf("invalid design spec JSON: %w", err)
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid design spec: %w", err)
+	}
+	return &spec, nil
+}
+
+// DesignSpecFromJob returns the structured spec stored on a job, if any
+func DesignSpecFromJob(job *Job) (*DesignSpec, bool) {
+	spec, ok := metadataAs[*DesignSpec](job, "designSpec")
+	if !ok || spec == nil {
+		return nil, false
+	}
+	return spec, true
+}
+
+// metadataAs returns job.Metadata[key] as a T. Values set in memory are
+// returned as-is; values read back from disk are generic JSON, so they are
+// re-encoded and decoded into T.
+func metadataAs[T any](job *Job, key string) (T, bool) {
+	var v T
+	if job == nil || job.Metadata == nil || job.Metadata[key] == nil {
+		return v, false
+	}
+	if typed, ok := job.Metadata[key].(T); ok {
+		return typed, true
+	}
+	data, err := json.Marshal(job.Metadata[key])
+	if err != nil {
+		return v, false
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, false
+	}
+	return v, true
+}
+
+// SetDesignSpec stores the spec on the job and refreshes the prose design
+func (j *Job) SetDesignSpec(spec *DesignSpec) {
+	if j.Metadata == nil {
+		j.Metadata = make(map[string]interface{})
+	}
+	j.Metadata["designSpec"] = spec
+	j.Design = spec.Render()
+}
+
+// GenerateDesignSpec creates a structured design specification from the prompt
+func GenerateDesignSpec(ctx context.Context, conv *Conversation, prompt string, attachments []ai.Attachment) (*DesignSpec, error) {
+	conv.AddMessage("user", prompt)
+
+	messages := buildMessages(ctx, ai.TaskUtility, conv, prompt)
+	messages[0].Content = DesignSpecSystemPrompt
+	messages = append(messages, ai.Message{
+		Role: "user",
+		Content: fmt.Sprintf(`Create a structured design specification for the educational worksheet described above.
+
+Respond with a single JSON object using this schema:
+%s
+
+Allowed question types: multiple-choice, short-answer, long-answer, problem-solving, true-false, fill-in-blank, matching, worked-example, recall-prompt.
+Output ONLY the JSON object.`, designSpecSchema),
+	})
+
+	var result string
+	var err error
+	if len(attachments) > 0 {
+		result, err = ai.GenerateWithAttachments(ctx, ai.TaskUtility, messages, attachments)
+	} else {
+		result, err = ai.Generate(ctx, ai.TaskUtility, messages)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("design generation failed: %w", err)
+	}
+
+	spec, err := ParseDesignSpec(result)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the conversation readable: store the prose rendering
+	conv.AddMessage("assistant", spec.Render())
+
+	return spec, nil
+}
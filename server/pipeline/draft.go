@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"context"
+
+	"nadhi.dev/sarvar/fun/ai"
+	"nadhi.dev/sarvar/fun/config"
+	"nadhi.dev/sarvar/fun/latex"
+)
+
+// DraftAttempt is one LaTeX generation under the draft-then-refine
+// strategy. Only the draft is checked; the compile step checks the
+// refinement as usual.
+type DraftAttempt struct {
+	Task    ai.TaskType `json:"task"`
+	Model   string      `json:"model,omitempty"`
+	Passed  bool        `json:"passed"`
+	Reasons []string    `json:"reasons,omitempty"`
+	Bytes   int         `json:"bytes"`
+	// CompileChecked is false when the draft couldn't be test-compiled,
+	// e.g. because it uses attached images
+	CompileChecked bool   `json:"compileChecked"`
+	Error          string `json:"error,omitempty"`
+}
+
+// DraftResult records the draft-then-refine attempts and which model's
+// output the job kept
+type DraftResult struct {
+	Attempts   []DraftAttempt `json:"attempts"`
+	Escalated  bool           `json:"escalated"`
+	FinalTask  ai.TaskType    `json:"finalTask"`
+	FinalModel string         `json:"finalModel,omitempty"`
+}
+
+// draftThenRefineEnabled reports whether DRAFT_THEN_REFINE is set
+func draftThenRefineEnabled() bool {
+	return config.GetConfigBool("DRAFT_THEN_REFINE", false)
+}
+
+// modelName returns the model a task runs on, for the record
+func modelName(task ai.TaskType) string {
+	if mc, err := ai.GetModelConfig(task); err == nil {
+		return mc.Model
+	}
+	return ""
+}
+
+// evaluateDraft checks that draft LaTeX matches the mode and compiles. The
+// compile check is skipped when the document needs attached images, which
+// only the real compile has.
+func evaluateDraft(mode, latexSrc string, attachments []ai.Attachment) DraftAttempt {
+	attempt := DraftAttempt{Bytes: len(latexSrc), Passed: true}
+
+	if check := checkLatexMode(mode, latexSrc); check.Checked && !check.Passed {
+		attempt.Passed = false
+		attempt.Reasons = append(attempt.Reasons, check.Reasons...)
+	}
+
+	if len(imageAttachmentNames(attachments)) > 0 {
+		return attempt
+	}
+	compileErrors, err := latex.CheckLatexCompiles(latexSrc)
+	if err != nil {
+		// The check itself couldn't run; judge the draft on the mode alone
+		return attempt
+	}
+	attempt.CompileChecked = true
+	if len(compileErrors) > 0 {
+		attempt.Passed = false
+		attempt.Reasons = append(attempt.Reasons, "does not compile: "+compileErrors[0])
+	}
+	return attempt
+}
+
+// generateLatexDraftFirst generates LaTeX with the utility model and keeps
+// it if it compiles and matches the mode; otherwise it is regenerated with
+// ctx's model (the main model). The attempts are saved on the job.
+func (q *Queue) generateLatexDraftFirst(ctx context.Context, job *Job, conv *Conversation, design, stylePrompt string, request *ai.GenerationRequest) (string, error) {
+	result := DraftResult{}
+	defer func() {
+		if job.Metadata == nil {
+			job.Metadata = make(map[string]interface{})
+		}
+		job.Metadata["draftRefine"] = result
+	}()
+
+	q.sendUpdate(job, "Drafting LaTeX with the utility model", q.stageData("LaTeX", "Drafting", nil))
+	draft, err := q.generateLatex(ai.WithTaskType(ctx, ai.TaskUtility), conv, design, stylePrompt, request.Attachments)
+	var attempt DraftAttempt
+	if err != nil {
+		attempt = DraftAttempt{Error: err.Error()}
+	} else {
+		attempt = evaluateDraft(ai.ResolveMode(request), draft, request.Attachments)
+	}
+	attempt.Task = ai.TaskUtility
+	attempt.Model = modelName(ai.TaskUtility)
+	result.Attempts = append(result.Attempts, attempt)
+
+	if err == nil && attempt.Passed {
+		result.FinalTask, result.FinalModel = attempt.Task, attempt.Model
+		q.sendUpdate(job, "Draft passed checks, skipping the main model", q.stageData("LaTeX", "Draft accepted", nil))
+		return draft, nil
+	}
+
+	result.Escalated = true
+	q.sendUpdate(job, "Draft failed checks, refining with the main model", q.stageData("LaTeX", "Draft escalated", map[string]interface{}{
+		"reasons": attempt.Reasons,
+		"error":   attempt.Error,
+	}))
+	refined, err := q.generateLatex(ctx, conv, design, stylePrompt, request.Attachments)
+	final := DraftAttempt{Task: ai.TaskLaTeXGeneration, Model: modelName(ai.TaskLaTeXGeneration), Bytes: len(refined)}
+	if err != nil {
+		final.Error = err.Error()
+	}
+	result.Attempts = append(result.Attempts, final)
+	if err != nil {
+		return "", err
+	}
+	result.FinalTask, result.FinalModel = final.Task, final.Model
+	return refined, nil
+}
@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// StepFunc runs one pipeline step for a job. A step that finishes calls
+// job.AdvanceStep; one that stops the job (error or manual review) leaves
+// CurrentStep where it is.
+type StepFunc func(q *Queue, ctx context.Context, job *Job) error
+
+// StepNode is a step in the pipeline graph
+type StepNode struct {
+	Name PipelineStep
+	Run  StepFunc
+	// Next picks the step that follows for this job. Nil means the next
+	// node in the graph, or StepDone after the last one.
+	Next func(job *Job) PipelineStep
+}
+
+// pipelineGraph is the order the worker runs steps in. Adding, skipping or
+// reordering a step is a change here, not in the worker.
+var pipelineGraph []StepNode
+
+// The graph is built in init because the steps advance through it
+// themselves, which a package-level initializer can't refer back to
+func init() {
+	pipelineGraph = []StepNode{
+		{Name: StepPrompt, Run: (*Queue).executePromptStep},
+		{Name: StepDesign, Run: (*Queue).executeDesignStep},
+		{Name: StepLatex, Run: (*Queue).executeLatexStep},
+		{Name: StepCompile, Run: (*Queue).executeCompileStep},
+	}
+}
+
+// stepNode returns the graph node for a step
+func stepNode(step PipelineStep) (StepNode, bool) {
+	for _, node := range pipelineGraph {
+		if node.Name == step {
+			return node, true
+		}
+	}
+	return StepNode{}, false
+}
+
+// nextStep resolves the step after the job's current one
+func nextStep(job *Job) PipelineStep {
+	for i, node := range pipelineGraph {
+		if node.Name != job.CurrentStep {
+			continue
+		}
+		if node.Next != nil {
+			return node.Next(job)
+		}
+		if i+1 < len(pipelineGraph) {
+			return pipelineGraph[i+1].Name
+		}
+		return StepDone
+	}
+	return job.CurrentStep
+}
+
+// runStep executes the job's current step
+func (q *Queue) runStep(ctx context.Context, job *Job) error {
+	node, ok := stepNode(job.CurrentStep)
+	if !ok {
+		return fmt.Errorf("unknown step: %s", job.CurrentStep)
+	}
+	return node.Run(q, q.withStreamProgress(ctx, job), job)
+}
+
+// ResumeStep is the step a failed or aborted job picks up from when it is
+// retried without starting over: the step it stopped on, moved back to the
+// first one whose input is missing, since a job that failed early has no
+// design or LaTeX yet
+func ResumeStep(job *Job) PipelineStep {
+	step := job.CurrentStep
+	if _, ok := stepNode(step); !ok {
+		step = StepCompile
+	}
+	if step == StepCompile && strings.TrimSpace(job.Latex) == "" {
+		step = StepLatex
+	}
+	if step == StepLatex && strings.TrimSpace(job.Design) == "" {
+		step = StepDesign
+	}
+	return step
+}
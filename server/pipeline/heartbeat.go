@@ -0,0 +1,204 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultStuckJobMinutes is how long a running job may go without a
+// heartbeat before it is treated as stuck; 0 disables detection
+const DefaultStuckJobMinutes = 15
+
+// heartbeatCheckInterval is how often the monitor looks for stale heartbeats
+const heartbeatCheckInterval = 30 * time.Second
+
+// maxStallRequeues is how many times a stuck job is re-queued before it is
+// failed instead
+const maxStallRequeues = 1
+
+// runningJob tracks a job a worker is processing
+type runningJob struct {
+	job     *Job
+	cancel  context.CancelFunc
+	beat    time.Time
+	step    PipelineStep
+	retries int
+	stuck   bool
+	// aborted is set by AbortRunningJob
+	aborted bool
+}
+
+// SetStuckJobThreshold sets how long a running job may go without a
+// heartbeat before its work is cancelled. Values below 1 disable detection.
+func (q *Queue) SetStuckJobThreshold(d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if d < 0 {
+		d = 0
+	}
+	q.stuckAfter = d
+}
+
+// trackJob registers job as running and returns a context the monitor
+// cancels if the job stops sending heartbeats. The returned function must be
+// called once processing finishes.
+func (q *Queue) trackJob(ctx context.Context, job *Job) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	q.mu.Lock()
+	q.running[job.ID] = &runningJob{job: job, cancel: cancel}
+	q.heartbeatLocked(job)
+	q.mu.Unlock()
+
+	return ctx, func() {
+		cancel()
+		q.mu.Lock()
+		delete(q.running, job.ID)
+		q.mu.Unlock()
+	}
+}
+
+// beginStep records the step about to run, so a stall can be retried from
+// it with the retry count it started with
+func (q *Queue) beginStep(job *Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if r, ok := q.running[job.ID]; ok {
+		r.step = job.CurrentStep
+		r.retries = job.RetryCount
+	}
+	q.heartbeatLocked(job)
+}
+
+// heartbeatLocked marks the job as making progress. Only the worker's own
+// copy of the job is stamped; callers must hold q.mu.
+func (q *Queue) heartbeatLocked(job *Job) {
+	r, ok := q.running[job.ID]
+	if !ok || r.job != job {
+		return
+	}
+	now := time.Now()
+	r.beat = now
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]interface{})
+	}
+	job.Metadata["heartbeat"] = now.Format(time.RFC3339)
+}
+
+// monitorHeartbeats periodically cancels jobs whose heartbeat has gone stale
+func (q *Queue) monitorHeartbeats(ctx context.Context) {
+	ticker := time.NewTicker(heartbeatCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if !q.checkHeartbeats(now) {
+				return
+			}
+		}
+	}
+}
+
+// checkHeartbeats flags and cancels stale jobs. It returns false once the
+// queue has stopped.
+func (q *Queue) checkHeartbeats(now time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stopped {
+		return false
+	}
+	if q.stuckAfter == 0 {
+		return true
+	}
+
+	for id, r := range q.running {
+		if r.stuck || now.Sub(r.beat) < q.stuckAfter {
+			continue
+		}
+		r.stuck = true
+		q.stuckDetected++
+		q.logger.Printf("Job %s stuck in step %s: no heartbeat for %s, cancelling", id, r.step, now.Sub(r.beat).Round(time.Second))
+		r.cancel()
+	}
+	return true
+}
+
+// jobStalled reports whether the monitor cancelled the job's context
+func (q *Queue) jobStalled(jobID uuid.UUID) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r, ok := q.running[jobID]
+	return ok && r.stuck
+}
+
+// recoverStuckJob runs on the worker once the step of a job flagged by the
+// monitor returns. A step that still finished is left as is; otherwise the
+// job is reset to the stalled step, or failed once it has stalled too
+// often. Either way the cancelled context can't run further steps, so it
+// reports whether the job should be re-queued to carry on.
+func (q *Queue) recoverStuckJob(job *Job, stepErr error) bool {
+	if stepErr == nil {
+		if job.Status != StatusPending && job.Status != StatusRunning {
+			return false
+		}
+		job.Status = StatusPending
+		return true
+	}
+
+	q.mu.Lock()
+	r := q.running[job.ID]
+	step, retries, threshold := r.step, r.retries, q.stuckAfter
+	q.mu.Unlock()
+
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]interface{})
+	}
+	stalls := metadataInt(job.Metadata["stallCount"]) + 1
+	job.Metadata["stallCount"] = stalls
+	job.Metadata["lastStallAt"] = time.Now().Format(time.RFC3339)
+
+	if stalls <= maxStallRequeues {
+		// Retries burned by the cancelled context don't count against the job
+		job.RetryCount = retries
+		job.ResetToStep(step)
+		q.mu.Lock()
+		q.stuckRequeued++
+		q.mu.Unlock()
+		q.sendUpdate(job, "Job stalled, re-queueing", q.stageData("Pipeline", "Stalled", map[string]interface{}{"step": step, "stallCount": stalls}))
+		return true
+	}
+
+	msg := fmt.Sprintf("Job stalled in %s step: no progress for %s", step, threshold)
+	job.SetError(msg, nil)
+	q.mu.Lock()
+	q.stuckFailed++
+	q.mu.Unlock()
+	q.sendUpdate(job, "Job stalled", q.errorData(msg))
+	return false
+}
+
+// requeueStuckJob puts a recovered job back on the queue. It runs after
+// processJob has committed, since Enqueue reads the store.
+func (q *Queue) requeueStuckJob(jobID uuid.UUID) {
+	if err := q.Enqueue(jobID); err != nil {
+		q.logger.Printf("Failed to re-queue stuck job %s: %v", jobID, err)
+	}
+}
+
+// metadataInt reads a count that may have round-tripped through JSON
+func metadataInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	}
+	return 0
+}
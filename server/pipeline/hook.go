@@ -0,0 +1,101 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"nadhi.dev/sarvar/fun/config"
+)
+
+// DefaultOnCompleteTimeoutSeconds bounds a run of ON_COMPLETE_CMD
+const DefaultOnCompleteTimeoutSeconds = 60
+
+// maxHookOutput caps how much of the command's output is logged
+const maxHookOutput = 4096
+
+// ParseOnCompleteCommand reads an ON_COMPLETE_CMD value: a program path,
+// or a list of the program and its fixed arguments. It returns nil when
+// unset. No shell is involved; use ["sh", "-c", "..."] to get one.
+func ParseOnCompleteCommand(v interface{}) []string {
+	switch cmd := v.(type) {
+	case string:
+		if cmd = strings.TrimSpace(cmd); cmd != "" {
+			return []string{cmd}
+		}
+	case []interface{}:
+		var parts []string
+		for _, p := range cmd {
+			s, ok := p.(string)
+			if !ok {
+				return nil
+			}
+			parts = append(parts, s)
+		}
+		if len(parts) > 0 && strings.TrimSpace(parts[0]) != "" {
+			return parts
+		}
+	}
+	return nil
+}
+
+// runCompletionHook starts ON_COMPLETE_CMD for a freshly compiled job with
+// the job ID and the PDF's absolute path appended to its arguments. It runs
+// in the background, so a slow command never holds up the worker, and is
+// killed after ON_COMPLETE_TIMEOUT_SECONDS. The exit status and output go
+// to the log. keyPDF is the answer key's path for split jobs, else "".
+func (q *Queue) runCompletionHook(job *Job, pdfPath, keyPDF string) {
+	command := ParseOnCompleteCommand(config.GetConfigValue("ON_COMPLETE_CMD"))
+	if len(command) == 0 {
+		return
+	}
+
+	if abs, err := filepath.Abs(pdfPath); err == nil {
+		pdfPath = abs
+	}
+	if abs, err := filepath.Abs(keyPDF); err == nil && keyPDF != "" {
+		keyPDF = abs
+	}
+	timeout := time.Duration(config.GetConfigInt("ON_COMPLETE_TIMEOUT_SECONDS", DefaultOnCompleteTimeoutSeconds)) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultOnCompleteTimeoutSeconds * time.Second
+	}
+	jobID, userID := job.ID.String(), job.UserID
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		args := append(append([]string(nil), command[1:]...), jobID, pdfPath)
+		cmd := exec.CommandContext(ctx, command[0], args...)
+		// Children that outlive a killed command would otherwise hold the
+		// output open until they exit
+		cmd.WaitDelay = time.Second
+		cmd.Env = append(os.Environ(),
+			"AIOTATE_JOB_ID="+jobID,
+			"AIOTATE_PDF_PATH="+pdfPath,
+			"AIOTATE_KEY_PDF_PATH="+keyPDF,
+			"AIOTATE_USER="+userID,
+		)
+
+		started := time.Now()
+		output, err := cmd.CombinedOutput()
+		out := strings.TrimSpace(string(output))
+		if len(out) > maxHookOutput {
+			out = out[:maxHookOutput] + "... (truncated)"
+		}
+
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			q.logger.Printf("On-complete hook for job %s timed out after %s; output: %s", jobID, timeout, out)
+		case err != nil:
+			q.logger.Printf("On-complete hook for job %s failed: %v; output: %s", jobID, err, out)
+		default:
+			q.logger.Printf("On-complete hook for job %s finished in %s; output: %s", jobID, time.Since(started).Round(time.Millisecond), out)
+		}
+	}()
+}
@@ -0,0 +1,115 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// DefaultMaxStoredJobs is the per-user cap on stored jobs; 0 means unlimited
+const DefaultMaxStoredJobs = 0
+
+// Stored job policies: what creating a job past the cap does
+const (
+	StoredJobsReject = "reject"
+	StoredJobsEvict  = "evict"
+)
+
+// ErrStoredJobLimit is returned when a user is at the stored job cap and
+// nothing could be evicted to make room
+var ErrStoredJobLimit = errors.New("stored job limit reached")
+
+// SetStoredJobLimit caps how many jobs a single user may have stored.
+// policy decides what happens to a new job past the cap: StoredJobsReject
+// refuses it, StoredJobsEvict deletes the user's oldest completed jobs,
+// with their artifacts, to make room. max below 1 disables the cap and an
+// unknown policy rejects.
+func (q *Queue) SetStoredJobLimit(max int, policy string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if max < 0 {
+		max = 0
+	}
+	if policy != StoredJobsEvict {
+		policy = StoredJobsReject
+	}
+	q.maxStoredJobs = max
+	q.storedJobsPolicy = policy
+}
+
+// StoredJobLimit returns the per-user cap (0 when unlimited) and its policy
+func (q *Queue) StoredJobLimit() (int, string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.maxStoredJobs, q.storedJobsPolicy
+}
+
+// MakeRoomForJob is called before a job is created for userID. Under the
+// cap it does nothing. At the cap it returns ErrStoredJobLimit, or with the
+// evict policy first deletes the oldest completed jobs until one more fits.
+func (q *Queue) MakeRoomForJob(userID string) error {
+	max, policy := q.StoredJobLimit()
+	if max == 0 || userID == "" {
+		return nil
+	}
+
+	// Serialized so two creates can't both evict for the same slot
+	q.storedJobsMu.Lock()
+	defer q.storedJobsMu.Unlock()
+
+	// Archived jobs count too; deleting one removes its archive file
+	jobs, _, err := q.userJobs(userID)
+	if err != nil {
+		return fmt.Errorf("failed to count jobs: %w", err)
+	}
+	excess := len(jobs) - max + 1
+	if excess <= 0 {
+		return nil
+	}
+	if policy != StoredJobsEvict {
+		return fmt.Errorf("%w: %d of %d jobs stored; delete some to create more", ErrStoredJobLimit, len(jobs), max)
+	}
+
+	var candidates []*Job
+	for _, job := range jobs {
+		if job.Status == StatusCompleted {
+			candidates = append(candidates, job)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return completedTime(candidates[i]).Before(completedTime(candidates[j]))
+	})
+
+	for _, candidate := range candidates {
+		if excess == 0 {
+			break
+		}
+		if err := q.deleteStoredJob(candidate.ID); err != nil {
+			q.logger.Printf("Stored job limit: failed to evict job %s: %v", candidate.ID, err)
+			continue
+		}
+		excess--
+		q.logger.Printf("Stored job limit: evicted job %s for %s", candidate.ID, userID)
+	}
+	if excess > 0 {
+		return fmt.Errorf("%w: %d of %d jobs stored and none could be evicted", ErrStoredJobLimit, len(jobs), max)
+	}
+	return nil
+}
+
+// deleteStoredJob removes a job's artifacts and then its record
+func (q *Queue) deleteStoredJob(jobID uuid.UUID) error {
+	for _, path := range jobArtifactPaths(jobID) {
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	if err := q.store.DeleteJob(jobID); err != nil {
+		return err
+	}
+	q.forgetUpdateSeq(jobID)
+	return nil
+}
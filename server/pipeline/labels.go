@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// MaxJobLabels caps how many labels a single job can carry
+const MaxJobLabels = 20
+
+// labelPattern limits labels to short, URL-friendly names like "to-review"
+// or "2024-spring"
+var labelPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9 _.-]{0,39}$`)
+
+// NormalizeLabel trims and lower-cases a label and checks it is valid
+func NormalizeLabel(label string) (string, error) {
+	label = strings.ToLower(strings.TrimSpace(label))
+	if !labelPattern.MatchString(label) {
+		return "", fmt.Errorf("invalid label %q: use up to 40 letters, digits, spaces, _, . or -", label)
+	}
+	return label, nil
+}
+
+// HasLabel reports whether the job carries label
+func (j *Job) HasLabel(label string) bool {
+	for _, l := range j.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateJobLabels adds and removes labels on a job and returns the updated
+// job. Labels are normalised first; adding one the job already has or
+// removing one it lacks is a no-op. It fails with ErrJobBusy rather than
+// waiting while a worker holds the job.
+func (s *Store) UpdateJobLabels(id uuid.UUID, add, remove []string) (*Job, error) {
+	addSet, err := normalizeLabels(add)
+	if err != nil {
+		return nil, err
+	}
+	removeSet, err := normalizeLabels(remove)
+	if err != nil {
+		return nil, err
+	}
+
+	job, commit, rollback, err := s.lockJobForUpdate(id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make(map[string]bool, len(job.Labels)+len(addSet))
+	for _, l := range job.Labels {
+		kept[l] = true
+	}
+	for l := range addSet {
+		kept[l] = true
+	}
+	labels := make([]string, 0, len(kept))
+	for l := range kept {
+		if !removeSet[l] {
+			labels = append(labels, l)
+		}
+	}
+	if len(labels) > MaxJobLabels {
+		rollback()
+		return nil, fmt.Errorf("a job can have at most %d labels", MaxJobLabels)
+	}
+	sort.Strings(labels)
+	job.Labels = labels
+
+	return job, commit()
+}
+
+// GetJobsByLabel returns the user's jobs carrying label, using the label
+// index rather than checking every job
+func (s *Store) GetJobsByLabel(userID, label string) ([]*Job, error) {
+	label, err := NormalizeLabel(label)
+	if err != nil {
+		return nil, err
+	}
+
+	s.jobsMu.RLock()
+	defer s.jobsMu.RUnlock()
+
+	ids := s.labelIndex[label]
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	jobs, err := s.loadJobsUnsafe()
+	if err != nil {
+		return nil, err
+	}
+
+	var labelled []*Job
+	for id := range ids {
+		if job, ok := jobs[id]; ok && job.UserID == userID {
+			labelled = append(labelled, job)
+		}
+	}
+	return labelled, nil
+}
+
+// UserLabels counts how many of the user's jobs carry each label
+func (s *Store) UserLabels(userID string) (map[string]int, error) {
+	jobs, err := s.GetJobsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, job := range jobs {
+		for _, l := range job.Labels {
+			counts[l]++
+		}
+	}
+	return counts, nil
+}
+
+// loadLabelIndex builds the label index from the jobs on disk
+func (s *Store) loadLabelIndex() error {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+
+	jobs, err := s.loadJobsUnsafe()
+	if err != nil {
+		return err
+	}
+	s.indexLabelsUnsafe(jobs)
+	return nil
+}
+
+// indexLabelsUnsafe rebuilds the label index (must be called with jobsMu held)
+func (s *Store) indexLabelsUnsafe(jobs map[string]*Job) {
+	index := make(map[string]map[string]bool)
+	for id, job := range jobs {
+		for _, l := range job.Labels {
+			if index[l] == nil {
+				index[l] = make(map[string]bool)
+			}
+			index[l][id] = true
+		}
+	}
+	s.labelIndex = index
+}
+
+// normalizeLabels normalises a list of labels into a set
+func normalizeLabels(labels []string) (map[string]bool, error) {
+	set := make(map[string]bool, len(labels))
+	for _, l := range labels {
+		normalized, err := NormalizeLabel(l)
+		if err != nil {
+			return nil, err
+		}
+		set[normalized] = true
+	}
+	return set, nil
+}
@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"nadhi.dev/sarvar/fun/ai"
+	"nadhi.dev/sarvar/fun/config"
+)
+
+// minLanguageConfidence is the least confidence at which a detected
+// language is applied to the request
+const minLanguageConfidence = 0.8
+
+// languageSampleChars bounds how much attachment text is sent for detection
+const languageSampleChars = 2000
+
+// detectLanguageInstruction asks the utility model to name the language of a
+// text sample
+const detectLanguageInstruction = `Identify the natural language the text below is written in.
+
+Respond with ONLY a JSON object, no markdown:
+{"language": "<English name of the language, e.g. Spanish>", "confidence": <number from 0 to 1>}
+
+Text:
+%s`
+
+// languageDetectionEnabled reports whether DETECT_ATTACHMENT_LANGUAGE is set
+func languageDetectionEnabled() bool {
+	return config.GetConfigBool("DETECT_ATTACHMENT_LANGUAGE", false)
+}
+
+// attachmentTextSample joins the start of the text attachments, up to
+// languageSampleChars bytes, cut at a rune boundary
+func attachmentTextSample(attachments []ai.Attachment) string {
+	var b strings.Builder
+	for _, att := range attachments {
+		if att.Encoding == "base64" || strings.TrimSpace(att.Content) == "" {
+			continue
+		}
+		b.WriteString(strings.TrimSpace(att.Content))
+		b.WriteString("\n")
+		if b.Len() >= languageSampleChars {
+			break
+		}
+	}
+	sample := b.String()
+	if len(sample) > languageSampleChars {
+		cut := languageSampleChars
+		for cut > 0 && !utf8.RuneStart(sample[cut]) {
+			cut--
+		}
+		sample = sample[:cut]
+	}
+	return strings.TrimSpace(sample)
+}
+
+// DetectLanguage asks the utility model which language sample is written
+// in, returning the language's English name and the model's confidence
+func DetectLanguage(ctx context.Context, sample string) (string, float64, error) {
+	result, err := ai.Generate(ctx, ai.TaskUtility, []ai.Message{
+		{Role: "system", Content: "You are a language identification tool. Output only JSON."},
+		{Role: "user", Content: fmt.Sprintf(detectLanguageInstruction, sample)},
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("language detection failed: %w", err)
+	}
+
+	raw := strings.TrimSpace(result)
+	start := strings.Index(raw, "{")
+	end := strings.LastIndex(raw, "}")
+	if start < 0 || end <= start {
+		return "", 0, fmt.Errorf("no JSON object found in language detection output")
+	}
+
+	var detected struct {
+		Language   string  `json:"language"`
+		Confidence float64 `json:"confidence"`
+	}
+	if err := json.Unmarshal([]byte(raw[start:end+1]), &detected); err != nil {
+		return "", 0, fmt.Errorf("invalid language detection JSON: %w", err)
+	}
+	language := strings.TrimSpace(detected.Language)
+	if language == "" {
+		return "", 0, fmt.Errorf("language detection returned no language")
+	}
+	return language, detected.Confidence, nil
+}
+
+// detectRequestLanguage fills in the request's language from its text
+// attachments when the user left it empty and detection is enabled. The
+// result is kept in the job's metadata, so retries reuse it instead of
+// detecting again. Failures only produce a warning.
+func (q *Queue) detectRequestLanguage(ctx context.Context, job *Job, request *ai.GenerationRequest) {
+	if strings.TrimSpace(request.Language) != "" {
+		return
+	}
+
+	if language, ok := job.Metadata["detectedLanguage"].(string); ok {
+		if confidence, _ := job.Metadata["languageConfidence"].(float64); confidence >= minLanguageConfidence {
+			request.Language = language
+		}
+		return
+	}
+
+	if !languageDetectionEnabled() {
+		return
+	}
+	sample := attachmentTextSample(request.Attachments)
+	if sample == "" {
+		return
+	}
+
+	language, confidence, err := DetectLanguage(ctx, sample)
+	if err != nil {
+		q.sendUpdate(job, "Language detection failed, continuing without it", q.stageData("Design", "Language detection failed", map[string]interface{}{"error": err.Error()}))
+		return
+	}
+
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]interface{})
+	}
+	job.Metadata["detectedLanguage"] = language
+	job.Metadata["languageConfidence"] = confidence
+
+	if confidence < minLanguageConfidence {
+		q.sendUpdate(job, fmt.Sprintf("Attachments look like %s, but not confidently enough to switch language", language), q.stageData("Design", "Language uncertain", map[string]interface{}{
+			"language":   language,
+			"confidence": confidence,
+		}))
+		return
+	}
+
+	request.Language = language
+	q.sendUpdate(job, fmt.Sprintf("Detected attachment language: %s", language), q.stageData("Design", "Language detected", map[string]interface{}{
+		"language":   language,
+		"confidence": confidence,
+	}))
+}
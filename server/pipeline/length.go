@@ -0,0 +1,53 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultMaxLatexBytes bounds generated LaTeX; roughly 40-50 dense pages
+const DefaultMaxLatexBytes = 150000
+
+// sectionBoundaryPattern matches the start of a line beginning a section,
+// the safest place to cut a document short
+var sectionBoundaryPattern = regexp.MustCompile(`(?m)^[ \t]*\\(section|subsection|newpage|clearpage)\b`)
+
+// concisenessInstruction is appended to the design when regenerating LaTeX
+// that came out over the size limit
+func concisenessInstruction(size, limit int) string {
+	return fmt.Sprintf(`
+
+IMPORTANT: A previous attempt produced %d bytes of LaTeX, over the %d byte limit.
+Be more concise: keep the same structure and coverage, but shorten explanations,
+trim repetitive examples and keep the whole document under %d bytes.`, size, limit, limit)
+}
+
+// truncateLatex cuts the document at the last section boundary that keeps it
+// under limit and closes it with \end{document}. It returns false if no safe
+// boundary exists after \begin{document}.
+func truncateLatex(latexSrc string, limit int) (string, bool) {
+	const closing = "\n\\end{document}\n"
+
+	bodyStart := strings.Index(latexSrc, `\begin{document}`)
+	if bodyStart < 0 {
+		return latexSrc, false
+	}
+	bodyStart += len(`\begin{document}`)
+
+	cut := -1
+	for _, loc := range sectionBoundaryPattern.FindAllStringIndex(latexSrc, -1) {
+		if loc[0] <= bodyStart {
+			continue
+		}
+		if loc[0]+len(closing) > limit {
+			break
+		}
+		cut = loc[0]
+	}
+	if cut < 0 {
+		return latexSrc, false
+	}
+
+	return strings.TrimRight(latexSrc[:cut], " \t\n") + closing, true
+}
@@ -0,0 +1,174 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"nadhi.dev/sarvar/fun/ai"
+)
+
+// libraryArtifacts maps the file names used in a library archive to the
+// suffix of the job's file in the bucket
+var libraryArtifacts = []struct {
+	name   string
+	suffix string
+}{
+	{"sheet.pdf", ".pdf"},
+	{"student.pdf", "-student.pdf"},
+	{"key.pdf", "-key.pdf"},
+	{"thumb.png", "-thumb.png"},
+}
+
+// jobLinkKeys are the metadata entries holding URLs of a job's artifacts
+var jobLinkKeys = []string{"studentPdfUrl", "keyPdfUrl", "thumbnailUrl"}
+
+// ExportJob writes a job into a library archive under dir: job.json (the
+// full record), request.json, design.txt, latex.tex and whichever of its
+// PDFs and thumbnail are still on disk
+func ExportJob(zw *zip.Writer, dir string, job *Job) error {
+	record, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"job.json", record},
+		{"design.txt", []byte(job.Design)},
+		{"latex.tex", []byte(job.Latex)},
+	}
+	var req ai.GenerationRequest
+	if err := json.Unmarshal([]byte(job.Prompt), &req); err == nil {
+		if data, err := json.MarshalIndent(req, "", "  "); err == nil {
+			files = append(files, struct {
+				name string
+				data []byte
+			}{"request.json", data})
+		}
+	}
+
+	for _, f := range files {
+		if err := writeZipFile(zw, path.Join(dir, f.name), f.data); err != nil {
+			return err
+		}
+	}
+
+	bucket := filepath.Join("./storage", "bucket")
+	for _, a := range libraryArtifacts {
+		data, err := os.ReadFile(filepath.Join(bucket, job.ID.String()+a.suffix))
+		if err != nil {
+			continue
+		}
+		if err := writeZipFile(zw, path.Join(dir, a.name), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeZipFile adds one file to an archive
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// ImportJob recreates an exported job for userID under a new ID, so it can
+// never collide with an existing job. files holds one job folder of a
+// library archive, keyed by file name. Artifacts are written to the bucket
+// and the job's URLs are pointed at them; links to notebooks and parent
+// jobs from the old account are dropped. Only completed jobs are imported.
+// The store does not know the stored job cap, so callers must call
+// Queue.MakeRoomForJob first.
+func (s *Store) ImportJob(userID string, files map[string][]byte) (*Job, error) {
+	record, ok := files["job.json"]
+	if !ok {
+		return nil, fmt.Errorf("job.json missing")
+	}
+	var job Job
+	if err := json.Unmarshal(record, &job); err != nil {
+		return nil, fmt.Errorf("invalid job.json: %w", err)
+	}
+	if job.Status != StatusCompleted {
+		return nil, fmt.Errorf("job %s is not completed", job.ID)
+	}
+
+	oldID := job.ID.String()
+	job.ID = uuid.New()
+	job.UserID = userID
+	job.ConversationID = uuid.New()
+	job.Revision = 0
+	job.UpdatedAt = time.Now()
+
+	var req ai.GenerationRequest
+	if err := json.Unmarshal([]byte(job.Prompt), &req); err == nil {
+		req.Username = userID
+		req.NotebookID = 0
+		if data, err := json.Marshal(req); err == nil {
+			job.Prompt = string(data)
+		}
+	}
+
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]interface{})
+	}
+	for _, key := range []string{"notebookItem", "notebookError", "parentJobId", "artifactsEvicted", "artifactsEvictedAt"} {
+		delete(job.Metadata, key)
+	}
+	job.Metadata["importedFrom"] = oldID
+	job.Metadata["importedAt"] = time.Now().Format(time.RFC3339)
+
+	bucket := filepath.Join("./storage", "bucket")
+	if err := os.MkdirAll(bucket, 0755); err != nil {
+		return nil, err
+	}
+	written := map[string]bool{}
+	for _, a := range libraryArtifacts {
+		data, ok := files[a.name]
+		if !ok {
+			continue
+		}
+		filename := job.ID.String() + a.suffix
+		if err := os.WriteFile(filepath.Join(bucket, filename), data, 0644); err != nil {
+			return nil, err
+		}
+		written[oldID+a.suffix] = true
+	}
+
+	// Repoint artifact URLs at the new files; drop those not in the archive
+	relink := func(url string) string {
+		base := path.Base(url)
+		if url == "" || !written[base] {
+			return ""
+		}
+		return strings.Replace(url, oldID, job.ID.String(), 1)
+	}
+	job.PDFURL = relink(job.PDFURL)
+	for _, key := range jobLinkKeys {
+		url, _ := job.Metadata[key].(string)
+		if url = relink(url); url != "" {
+			job.Metadata[key] = url
+		} else {
+			delete(job.Metadata, key)
+		}
+	}
+	if job.PDFURL == "" {
+		job.Metadata["artifactsEvicted"] = true
+	}
+
+	if err := s.SaveJob(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
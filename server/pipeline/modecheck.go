@@ -0,0 +1,101 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ModeCheck records whether generated LaTeX looks like the requested mode.
+// It is purely heuristic: no model call is made to judge the output.
+type ModeCheck struct {
+	Mode        string   `json:"mode"`
+	Checked     bool     `json:"checked"`
+	Passed      bool     `json:"passed"`
+	Reasons     []string `json:"reasons,omitempty"`
+	Regenerated bool     `json:"regenerated"`
+}
+
+var (
+	questionWordPattern = regexp.MustCompile(`(?i)\bquestion\s*\d*|\\question\b|\bQ\d+\b`)
+	pointValuePattern   = regexp.MustCompile(`(?i)[\(\[]\s*\d+\s*(marks?|points?|pts?)\s*[\)\]]|\b\d+\s*(marks|points|pts)\b`)
+	sectionPattern      = regexp.MustCompile(`\\(sub)*section\*?\{`)
+	itemPattern         = regexp.MustCompile(`\\item\b`)
+)
+
+// checkLatexMode applies cheap structural checks for the built-in modes.
+// Custom modes have no known shape, so they are reported as unchecked.
+func checkLatexMode(mode, latexSrc string) ModeCheck {
+	check := ModeCheck{Mode: mode, Checked: true, Passed: true}
+
+	switch mode {
+	case "prep-test":
+		// A test should show at least two of: numbered items, question
+		// labels and point values
+		signals := 0
+		if strings.Contains(latexSrc, `\begin{enumerate}`) && len(itemPattern.FindAllString(latexSrc, -1)) >= 5 {
+			signals++
+		} else {
+			check.Reasons = append(check.Reasons, "few or no enumerated items")
+		}
+		if len(questionWordPattern.FindAllString(latexSrc, -1)) >= 3 {
+			signals++
+		} else {
+			check.Reasons = append(check.Reasons, "no question labels")
+		}
+		if len(pointValuePattern.FindAllString(latexSrc, -1)) >= 3 {
+			signals++
+		} else {
+			check.Reasons = append(check.Reasons, "no point values")
+		}
+		check.Passed = signals >= 2
+
+	case "notes", "super-lazy":
+		if n := len(sectionPattern.FindAllString(latexSrc, -1)); n < 2 {
+			check.Reasons = append(check.Reasons, fmt.Sprintf("only %d section heading(s)", n))
+			check.Passed = false
+		}
+
+	default:
+		check.Checked = false
+	}
+
+	if check.Passed {
+		check.Reasons = nil
+	}
+	return check
+}
+
+// modeReinforcement is appended to the design when regenerating LaTeX that
+// failed the mode check
+func modeReinforcement(check ModeCheck) string {
+	var b strings.Builder
+	b.WriteString("\n\nIMPORTANT: A previous attempt did not follow the requested mode")
+	if len(check.Reasons) > 0 {
+		b.WriteString(fmt.Sprintf(" (%s)", strings.Join(check.Reasons, "; ")))
+	}
+	b.WriteString(".\n")
+
+	switch check.Mode {
+	case "prep-test":
+		b.WriteString(`This MUST be a test paper, not notes:
+- Number every question inside an enumerate environment
+- Label questions clearly (e.g. "Question 1")
+- Show a point value for every question, e.g. (5 points)
+- Do not write explanatory notes in place of questions`)
+	default:
+		b.WriteString(`These MUST be structured notes:
+- Organise the content under \section and \subsection headings
+- Use at least three sections covering the main topics`)
+	}
+
+	return b.String()
+}
+
+// setModeCheck stores the mode check result on the job
+func (j *Job) setModeCheck(check ModeCheck) {
+	if j.Metadata == nil {
+		j.Metadata = make(map[string]interface{})
+	}
+	j.Metadata["modeCheck"] = check
+}
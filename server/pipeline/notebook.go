@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NotebookFiler adds a finished sheet to one of a user's notebooks
+type NotebookFiler func(username string, notebookID int, sheetName, url string) error
+
+// SetNotebookFiler sets how completed jobs whose request names a notebook
+// are filed into it. Without one, notebookId is ignored.
+func (q *Queue) SetNotebookFiler(filer NotebookFiler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.notebookFiler = filer
+}
+
+// fileInNotebook adds a completed job's PDF to the notebook its request
+// named. It runs once per job: the result is recorded in metadata, so
+// recompiles and later runs don't file the sheet again. A failure is
+// logged and recorded but doesn't fail the job.
+func (q *Queue) fileInNotebook(job *Job) {
+	if job.Status != StatusCompleted || job.PDFURL == "" {
+		return
+	}
+	if _, filed := job.Metadata["notebookItem"]; filed {
+		return
+	}
+
+	q.mu.Lock()
+	filer := q.notebookFiler
+	q.mu.Unlock()
+	if filer == nil {
+		return
+	}
+
+	request, err := q.parseRequest(job)
+	if err != nil || request.NotebookID == 0 {
+		return
+	}
+
+	name := notebookItemName(request.Subject, job)
+	if err := filer(job.UserID, request.NotebookID, name, job.PDFURL); err != nil {
+		q.logger.Printf("Failed to add job %s to notebook %d: %v", job.ID, request.NotebookID, err)
+		job.Metadata["notebookError"] = err.Error()
+		return
+	}
+	delete(job.Metadata, "notebookError")
+	job.Metadata["notebookItem"] = map[string]interface{}{
+		"notebookId": request.NotebookID,
+		"name":       name,
+	}
+}
+
+// notebookItemName names a sheet in a notebook after its subject. Notebook
+// items are keyed by name, so the short job ID keeps sheets on the same
+// subject from replacing each other.
+func notebookItemName(subject string, job *Job) string {
+	short := job.ID.String()[:8]
+	subject = strings.TrimSpace(subject)
+	if subject == "" {
+		return fmt.Sprintf("Sheet %s", short)
+	}
+	return fmt.Sprintf("%s (%s)", subject, short)
+}
@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/ai"
+)
+
+// optimizePromptInstruction asks the utility model to turn a terse request
+// into a brief the design step can work from
+const optimizePromptInstruction = `Rewrite the worksheet request below as a clear, detailed brief for a document designer.
+
+Rules:
+- Keep every fact, topic and constraint the user gave; do not contradict them
+- Make implicit expectations explicit: audience level, scope, key topics, and what a good result includes
+- Do not invent specific data, sources or numbers the user did not provide
+- Output ONLY the brief as plain prose or short bullet points, no preamble
+
+Request:
+%s`
+
+// OptimizePrompt expands a short or vague request into a richer brief using
+// the utility model. Both the original request and the brief are recorded
+// in the conversation.
+func OptimizePrompt(ctx context.Context, conv *Conversation, request *ai.GenerationRequest) (string, error) {
+	original := requestBrief(request)
+	conv.AddMessage("user", fmt.Sprintf(optimizePromptInstruction, original))
+
+	result, err := ai.Generate(ctx, ai.TaskUtility, []ai.Message{
+		{Role: "system", Content: "You are an instructional designer who clarifies worksheet requests."},
+		{Role: "user", Content: fmt.Sprintf(optimizePromptInstruction, original)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("prompt optimization failed: %w", err)
+	}
+
+	brief := strings.TrimSpace(result)
+	if brief == "" {
+		return "", fmt.Errorf("prompt optimization returned an empty brief")
+	}
+
+	conv.AddMessage("assistant", brief)
+	return brief, nil
+}
+
+// requestBrief renders the user-written parts of a request
+func requestBrief(req *ai.GenerationRequest) string {
+	var b strings.Builder
+	fields := []struct{ label, value string }{
+		{"Subject", req.Subject},
+		{"Course", req.Course},
+		{"Description", req.Description},
+		{"Curriculum", req.Curriculum},
+		{"Special Instructions", req.SpecialInstructions},
+		{"Mode", ai.ResolveMode(req)},
+		{"Language", req.Language},
+	}
+	for _, f := range fields {
+		if strings.TrimSpace(f.value) != "" {
+			b.WriteString(fmt.Sprintf("%s: %s\n", f.label, strings.TrimSpace(f.value)))
+		}
+	}
+	if len(req.Tags) > 0 {
+		b.WriteString(fmt.Sprintf("Tags: %s\n", strings.Join(req.Tags, ", ")))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// optimizeRequest replaces the request's description with the optimized
+// brief, generating it once per job; retries reuse the stored brief
+func (q *Queue) optimizeRequest(ctx context.Context, job *Job, conv *Conversation, request *ai.GenerationRequest) {
+	brief, _ := job.Metadata["optimizedBrief"].(string)
+	if brief == "" {
+		q.sendUpdate(job, "Optimizing prompt", q.stageData("Design", "Optimizing prompt", nil))
+		var err error
+		brief, err = OptimizePrompt(ctx, conv, request)
+		if err != nil {
+			q.sendUpdate(job, "Prompt optimization failed, using the original request", q.stageData("Design", "Optimization skipped", map[string]interface{}{"error": err.Error()}))
+			return
+		}
+		if job.Metadata == nil {
+			job.Metadata = make(map[string]interface{})
+		}
+		job.Metadata["originalDescription"] = request.Description
+		job.Metadata["optimizedBrief"] = brief
+	}
+	request.Description = brief
+}
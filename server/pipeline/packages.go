@@ -0,0 +1,123 @@
+package pipeline
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/config"
+)
+
+// DefaultAllowedPackages are packages known to be available to the
+// compiler. LATEX_ALLOWED_PACKAGES replaces the list when set.
+var DefaultAllowedPackages = []string{
+	"afterpage", "amsfonts", "amsmath", "amssymb", "amsthm", "array",
+	"babel", "bm", "booktabs", "calc", "cancel", "caption", "chemfig",
+	"circuitikz", "color", "colortbl", "csquotes", "dcolumn", "enumerate",
+	"enumitem", "etoolbox", "exam", "fancyhdr", "float", "fontenc",
+	"fontspec", "framed", "gensymb", "geometry", "graphicx", "hhline",
+	"hyperref", "ifthen", "inputenc", "lastpage", "lmodern", "listings",
+	"longtable", "makecell", "marvosym", "mathtools", "mdframed", "mhchem",
+	"microtype", "multicol", "multirow", "needspace", "parskip", "pdflscape",
+	"pgf", "pgfplots", "physics", "pifont", "polyglossia", "ragged2e",
+	"setspace", "siunitx", "soul", "subcaption", "tabularx", "tabulary",
+	"tcolorbox", "textcomp", "tikz", "tikz-cd", "titlesec", "ulem",
+	"upgreek", "url", "verbatim", "wasysym", "wrapfig", "xcolor", "xeCJK",
+	"xparse", "xspace",
+}
+
+// usepackagePattern matches \usepackage and \RequirePackage commands; the
+// groups are the command up to the brace and the package list
+var usepackagePattern = regexp.MustCompile(`(\\(?:usepackage|RequirePackage)\s*(?:\[[^\]]*\])?\s*)\{([^}]*)\}`)
+
+// packageCheckEnabled reports whether LATEX_PACKAGE_CHECK is set (default on)
+func packageCheckEnabled() bool {
+	return config.GetConfigBool("LATEX_PACKAGE_CHECK", true)
+}
+
+// allowedPackages returns the configured whitelist as a set
+func allowedPackages() map[string]bool {
+	names := DefaultAllowedPackages
+	if raw, ok := config.GetConfigValue("LATEX_ALLOWED_PACKAGES").([]interface{}); ok && len(raw) > 0 {
+		names = nil
+		for _, v := range raw {
+			if name, ok := v.(string); ok && strings.TrimSpace(name) != "" {
+				names = append(names, strings.TrimSpace(name))
+			}
+		}
+	}
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		allowed[name] = true
+	}
+	return allowed
+}
+
+// removeUnknownPackages drops packages not in allowed from every
+// \usepackage line, removing lines left empty, and returns the sorted names
+// it removed. Commented-out lines are left alone.
+func removeUnknownPackages(src string, allowed map[string]bool) (string, []string) {
+	removed := map[string]bool{}
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		code := line
+		if idx := strings.Index(line, "%"); idx >= 0 {
+			code = line[:idx]
+		}
+		if !usepackagePattern.MatchString(code) {
+			continue
+		}
+		lines[i] = usepackagePattern.ReplaceAllStringFunc(code, func(cmd string) string {
+			m := usepackagePattern.FindStringSubmatch(cmd)
+			var kept []string
+			for _, name := range strings.Split(m[2], ",") {
+				name = strings.TrimSpace(name)
+				if name == "" {
+					continue
+				}
+				if allowed[name] {
+					kept = append(kept, name)
+				} else {
+					removed[name] = true
+				}
+			}
+			if len(kept) == 0 {
+				return ""
+			}
+			return m[1] + "{" + strings.Join(kept, ",") + "}"
+		}) + line[len(code):]
+	}
+	if len(removed) == 0 {
+		return src, nil
+	}
+
+	names := make([]string, 0, len(removed))
+	for name := range removed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(lines, "\n"), names
+}
+
+// enforcePackageWhitelist removes packages the compiler is not known to
+// have before the first compile, since a missing package fails it outright.
+// The removed names are logged and saved on the job.
+func (q *Queue) enforcePackageWhitelist(job *Job, latexSrc string) string {
+	if !packageCheckEnabled() {
+		return latexSrc
+	}
+	cleaned, removed := removeUnknownPackages(latexSrc, allowedPackages())
+	if len(removed) == 0 {
+		return latexSrc
+	}
+
+	q.logger.Printf("Job %s: removed unknown LaTeX packages: %s", job.ID, strings.Join(removed, ", "))
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]interface{})
+	}
+	job.Metadata["removedPackages"] = removed
+	q.sendUpdate(job, "Removed unknown LaTeX packages", q.stageData("LaTeX", "Packages removed", map[string]interface{}{
+		"packages": removed,
+	}))
+	return cleaned
+}
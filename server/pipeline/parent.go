@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// DefaultParentContextChars bounds how much of a parent job's conversation
+// is copied into a child job
+const DefaultParentContextChars = 8000
+
+// parentContextIntro opens the copied context so the model knows it is
+// background rather than the current request
+const parentContextIntro = `The following is the conversation from a previous worksheet in this unit (job %s).
+Use it as context and build on it, but create a new worksheet for the request that follows.`
+
+// NewConversationFromParent creates the conversation for jobID seeded with a
+// copy of parentJobID's conversation, oldest messages first, up to maxChars
+// of content. Context the parent itself inherited is not carried further,
+// so chains of sheets don't snowball. Values of maxChars below 1 use the
+// default.
+func (s *Store) NewConversationFromParent(jobID, parentJobID uuid.UUID, maxChars int) (*Conversation, error) {
+	parent, err := s.GetConversationByJobID(parentJobID)
+	if err != nil {
+		return nil, err
+	}
+	if maxChars < 1 {
+		maxChars = DefaultParentContextChars
+	}
+
+	conv := NewConversation(jobID)
+	conv.AddMessage("user", fmt.Sprintf(parentContextIntro, parentJobID))
+
+	own := parent.Messages
+	if parent.SeededMessages > 0 && parent.SeededMessages <= len(own) {
+		own = own[parent.SeededMessages:]
+	}
+
+	remaining := maxChars
+	for _, msg := range own {
+		if remaining <= 0 {
+			break
+		}
+		content := msg.Content
+		if len(content) > remaining {
+			cut := remaining
+			for cut > 0 && !utf8.RuneStart(content[cut]) {
+				cut--
+			}
+			content = content[:cut] + "\n[truncated]"
+		}
+		remaining -= len(msg.Content)
+		conv.Messages = append(conv.Messages, Message{
+			Role:      msg.Role,
+			Content:   content,
+			Timestamp: msg.Timestamp,
+		})
+	}
+	conv.SeededMessages = len(conv.Messages)
+
+	return conv, nil
+}
+
+// Restart returns a fresh conversation for the same job that keeps only the
+// context seeded from a parent job, for retrying a job from scratch
+func (c *Conversation) Restart() *Conversation {
+	conv := NewConversation(c.JobID)
+	if c.SeededMessages > 0 && c.SeededMessages <= len(c.Messages) {
+		conv.Messages = append(conv.Messages, c.Messages[:c.SeededMessages]...)
+		conv.SeededMessages = c.SeededMessages
+	}
+	return conv
+}
@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/ai"
+	"nadhi.dev/sarvar/fun/config"
+)
+
+// hyperrefPattern matches a \usepackage line that loads hyperref
+var hyperrefPattern = regexp.MustCompile(`\\usepackage\s*(?:\[[^\]]*\])?\s*\{[^}]*\bhyperref\b[^}]*\}`)
+
+// pdfMetadataEnabled reports whether PDF_METADATA is set (default on)
+func pdfMetadataEnabled() bool {
+	return config.GetConfigBool("PDF_METADATA", true)
+}
+
+// stampPDFMetadata adds a \hypersetup with the sheet's title, subject,
+// author and keywords before \begin{document}, loading hyperref if the
+// document doesn't. LaTeX that already calls \hypersetup, or has no
+// \begin{document}, is returned unchanged.
+func stampPDFMetadata(src string, req *ai.GenerationRequest, author string) string {
+	if req == nil || strings.Contains(src, `\hypersetup`) {
+		return src
+	}
+	begin := strings.Index(src, `\begin{document}`)
+	if begin < 0 {
+		return src
+	}
+
+	title := req.Subject
+	if title == "" {
+		title = req.Course
+	}
+	fields := []struct{ key, value string }{
+		{"pdftitle", title},
+		{"pdfsubject", req.Course},
+		{"pdfauthor", author},
+		{"pdfkeywords", strings.Join(req.Tags, ", ")},
+		{"pdfcreator", "AIotate"},
+	}
+	var entries []string
+	for _, f := range fields {
+		if v := pdfMetadataValue(f.value); v != "" {
+			entries = append(entries, fmt.Sprintf("  %s={%s}", f.key, v))
+		}
+	}
+
+	var stamp strings.Builder
+	if !hyperrefPattern.MatchString(src[:begin]) {
+		// hidelinks keeps the added package from boxing existing references
+		stamp.WriteString("\\usepackage[hidelinks]{hyperref}\n")
+	}
+	stamp.WriteString("\\hypersetup{\n" + strings.Join(entries, ",\n") + "\n}\n")
+
+	return src[:begin] + stamp.String() + src[begin:]
+}
+
+// pdfMetadataReplacer makes free text safe inside a \hypersetup value
+var pdfMetadataReplacer = strings.NewReplacer(
+	`\`, "",
+	"{", "",
+	"}", "",
+	"%", `\%`,
+	"#", `\#`,
+	"&", `\&`,
+	"$", `\$`,
+	"_", `\_`,
+	"^", "",
+	"~", " ",
+	"\n", " ",
+	"\r", " ",
+)
+
+// pdfMetadataValue escapes a metadata value and collapses its whitespace
+func pdfMetadataValue(s string) string {
+	return strings.Join(strings.Fields(pdfMetadataReplacer.Replace(s)), " ")
+}
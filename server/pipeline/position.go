@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// processingWindow is how many recent processing runs the ETA averages over
+const processingWindow = 20
+
+// Queue states reported by Position
+const (
+	PositionQueued    = "queued"
+	PositionDeferred  = "deferred"
+	PositionRunning   = "running"
+	PositionNotQueued = "not_queued"
+)
+
+// QueuePosition is where a job stands in the queue. Position and Ahead are
+// only set for queued jobs; ETASeconds estimates the wait until the job
+// starts and is left out until the queue has processed a job.
+type QueuePosition struct {
+	State          string   `json:"state"`
+	Position       int      `json:"position,omitempty"`
+	Ahead          int      `json:"ahead"`
+	Queued         int      `json:"queued"`
+	Workers        int      `json:"workers"`
+	ETASeconds     *int     `json:"etaSeconds,omitempty"`
+	AverageSeconds *float64 `json:"averageSeconds,omitempty"`
+}
+
+// markQueuedLocked records a job sent to the jobs channel. Callers hold q.mu
+// and call it before the send, so a worker can't dequeue it first.
+func (q *Queue) markQueuedLocked(jobID uuid.UUID) {
+	q.pending = append(q.pending, jobID)
+}
+
+// unmarkQueuedLocked drops the first pending entry for a job, after a
+// worker took it off the channel or the send failed. Callers hold q.mu.
+func (q *Queue) unmarkQueuedLocked(jobID uuid.UUID) {
+	for i, id := range q.pending {
+		if id == jobID {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// recordProcessingTime adds one processing run to the rolling average
+func (q *Queue) recordProcessingTime(d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.processingTimes = append(q.processingTimes, d)
+	if len(q.processingTimes) > processingWindow {
+		q.processingTimes = q.processingTimes[len(q.processingTimes)-processingWindow:]
+	}
+}
+
+// Position reports where a job is in the queue. The ETA assumes every
+// worker is busy: the job waits for one run to free a worker, plus one run
+// per worker for each full round of jobs ahead of it.
+func (q *Queue) Position(jobID uuid.UUID) QueuePosition {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pos := QueuePosition{
+		State:   PositionNotQueued,
+		Queued:  len(q.pending),
+		Workers: q.workers,
+	}
+
+	var avg time.Duration
+	if len(q.processingTimes) > 0 {
+		var total time.Duration
+		for _, d := range q.processingTimes {
+			total += d
+		}
+		avg = total / time.Duration(len(q.processingTimes))
+		seconds := avg.Seconds()
+		pos.AverageSeconds = &seconds
+	}
+
+	if _, ok := q.running[jobID]; ok {
+		pos.State = PositionRunning
+		return pos
+	}
+	for _, d := range q.deferred {
+		if d.ID == jobID {
+			pos.State = PositionDeferred
+			return pos
+		}
+	}
+	for i, id := range q.pending {
+		if id != jobID {
+			continue
+		}
+		pos.State = PositionQueued
+		pos.Position = i + 1
+		pos.Ahead = i
+		if avg > 0 {
+			workers := max(q.workers, 1)
+			eta := int((avg * time.Duration(i/workers+1)).Round(time.Second).Seconds())
+			pos.ETASeconds = &eta
+		}
+		return pos
+	}
+	return pos
+}
@@ -0,0 +1,169 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// PostProcessor is a named transform applied to model-generated LaTeX
+// before it is stored on the job
+type PostProcessor struct {
+	Name        string
+	Description string
+	Apply       func(string) string
+}
+
+// DefaultPostProcessors is the chain used unless configured otherwise
+var DefaultPostProcessors = []string{"strip-fences", "smart-quotes", "unicode-math"}
+
+// postProcessors lists the built-in transforms by name
+var postProcessors = map[string]PostProcessor{
+	"strip-fences": {
+		Name:        "strip-fences",
+		Description: "Remove markdown code fences and surrounding whitespace",
+		Apply:       stripMarkdownFences,
+	},
+	"smart-quotes": {
+		Name:        "smart-quotes",
+		Description: "Replace typographic quotes, dashes and ellipses with LaTeX equivalents",
+		Apply:       smartQuoteReplacer.Replace,
+	},
+	"unicode-math": {
+		Name:        "unicode-math",
+		Description: "Replace unicode math symbols and Greek letters with LaTeX commands",
+		Apply:       unicodeMathReplacer.Replace,
+	},
+}
+
+var (
+	postProcessMu    sync.RWMutex
+	postProcessChain = DefaultPostProcessors
+)
+
+// SetPostProcessors sets which post-processors run, in order. Unknown names
+// are rejected and the current chain is left unchanged.
+func SetPostProcessors(names []string) error {
+	chain := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := postProcessors[name]; !ok {
+			return fmt.Errorf("unknown post-processor %q", name)
+		}
+		chain = append(chain, name)
+	}
+
+	postProcessMu.Lock()
+	defer postProcessMu.Unlock()
+	postProcessChain = chain
+	return nil
+}
+
+// PostProcessors returns the post-processors that currently run, in order
+func PostProcessors() []PostProcessor {
+	postProcessMu.RLock()
+	defer postProcessMu.RUnlock()
+
+	chain := make([]PostProcessor, 0, len(postProcessChain))
+	for _, name := range postProcessChain {
+		chain = append(chain, postProcessors[name])
+	}
+	return chain
+}
+
+// postProcessLatex runs the configured chain over generated LaTeX
+func postProcessLatex(latex string) string {
+	for _, p := range PostProcessors() {
+		latex = p.Apply(latex)
+	}
+	return latex
+}
+
+// stripMarkdownFences removes markdown code blocks and trims whitespace
+func stripMarkdownFences(latex string) string {
+	latex = strings.TrimPrefix(latex, "```latex\n")
+	latex = strings.TrimPrefix(latex, "```latex")
+	latex = strings.TrimPrefix(latex, "```\n")
+	latex = strings.TrimPrefix(latex, "```")
+	latex = strings.TrimSuffix(latex, "\n```")
+	latex = strings.TrimSuffix(latex, "```")
+
+	return strings.TrimSpace(latex)
+}
+
+// smartQuoteReplacer maps typographic punctuation to pdflatex-safe input
+var smartQuoteReplacer = strings.NewReplacer(
+	"“", "``",
+	"”", "''",
+	"„", ",,",
+	"‘", "`",
+	"’", "'",
+	"–", "--",
+	"—", "---",
+	"…", `\ldots{}`,
+	"\u00a0", "~", // non-breaking space
+)
+
+// unicodeMathReplacer maps unicode math symbols to LaTeX. \ensuremath keeps
+// the result valid whether the symbol appeared in text or math mode.
+var unicodeMathReplacer = strings.NewReplacer(
+	"≤", `\ensuremath{\leq}`,
+	"≥", `\ensuremath{\geq}`,
+	"≠", `\ensuremath{\neq}`,
+	"≈", `\ensuremath{\approx}`,
+	"≡", `\ensuremath{\equiv}`,
+	"±", `\ensuremath{\pm}`,
+	"∓", `\ensuremath{\mp}`,
+	"×", `\ensuremath{\times}`,
+	"÷", `\ensuremath{\div}`,
+	"·", `\ensuremath{\cdot}`,
+	"∞", `\ensuremath{\infty}`,
+	"√", `\ensuremath{\surd}`,
+	"∑", `\ensuremath{\sum}`,
+	"∏", `\ensuremath{\prod}`,
+	"∫", `\ensuremath{\int}`,
+	"∂", `\ensuremath{\partial}`,
+	"∇", `\ensuremath{\nabla}`,
+	"∈", `\ensuremath{\in}`,
+	"∉", `\ensuremath{\notin}`,
+	"⊂", `\ensuremath{\subset}`,
+	"⊆", `\ensuremath{\subseteq}`,
+	"∪", `\ensuremath{\cup}`,
+	"∩", `\ensuremath{\cap}`,
+	"∅", `\ensuremath{\emptyset}`,
+	"∀", `\ensuremath{\forall}`,
+	"∃", `\ensuremath{\exists}`,
+	"→", `\ensuremath{\rightarrow}`,
+	"←", `\ensuremath{\leftarrow}`,
+	"↔", `\ensuremath{\leftrightarrow}`,
+	"⇒", `\ensuremath{\Rightarrow}`,
+	"⇔", `\ensuremath{\Leftrightarrow}`,
+	"°", `\ensuremath{^\circ}`,
+	"²", `\ensuremath{^{2}}`,
+	"³", `\ensuremath{^{3}}`,
+	"α", `\ensuremath{\alpha}`,
+	"β", `\ensuremath{\beta}`,
+	"γ", `\ensuremath{\gamma}`,
+	"δ", `\ensuremath{\delta}`,
+	"ε", `\ensuremath{\varepsilon}`,
+	"θ", `\ensuremath{\theta}`,
+	"λ", `\ensuremath{\lambda}`,
+	"μ", `\ensuremath{\mu}`,
+	"π", `\ensuremath{\pi}`,
+	"ρ", `\ensuremath{\rho}`,
+	"σ", `\ensuremath{\sigma}`,
+	"τ", `\ensuremath{\tau}`,
+	"φ", `\ensuremath{\phi}`,
+	"ω", `\ensuremath{\omega}`,
+	"Γ", `\ensuremath{\Gamma}`,
+	"Δ", `\ensuremath{\Delta}`,
+	"Θ", `\ensuremath{\Theta}`,
+	"Λ", `\ensuremath{\Lambda}`,
+	"Π", `\ensuremath{\Pi}`,
+	"Σ", `\ensuremath{\Sigma}`,
+	"Φ", `\ensuremath{\Phi}`,
+	"Ω", `\ensuremath{\Omega}`,
+)
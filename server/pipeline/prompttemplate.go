@@ -0,0 +1,96 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/ai"
+	"nadhi.dev/sarvar/fun/config"
+)
+
+// PromptTemplate overrides the built-in prompts for one model or provider.
+// Empty fields keep the built-in prompt.
+type PromptTemplate struct {
+	// System replaces SystemPrompt
+	System string
+	// Latex replaces the LaTeX generation prompt. {{design}} is replaced
+	// by the design, {{style}} by the style definitions and {{images}} by
+	// the attached image instructions.
+	Latex string
+}
+
+// promptTemplateFields are the PROMPT_TEMPLATES entry keys
+const (
+	promptTemplateSystem = "system"
+	promptTemplateLatex  = "latex"
+)
+
+// promptTemplateFor returns the PROMPT_TEMPLATES overrides for the model a
+// task runs on under ctx. A field set for the exact model wins over one set
+// for its provider; fields set for neither are empty.
+func promptTemplateFor(ctx context.Context, task ai.TaskType) PromptTemplate {
+	templates, _ := config.GetConfigValue("PROMPT_TEMPLATES").(map[string]interface{})
+	if len(templates) == 0 {
+		return PromptTemplate{}
+	}
+	mc, err := ai.ResolveModelConfig(ctx, task)
+	if err != nil {
+		return PromptTemplate{}
+	}
+
+	// Model keys are matched the way model settings are, so
+	// "models/gemini-2.5-pro" finds gemini-2.5-pro
+	var modelEntry, providerEntry map[string]interface{}
+	for key, raw := range templates {
+		entry, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if key == string(mc.Provider) {
+			providerEntry = entry
+		} else if ai.NormalizeModelName(mc.Provider, key) == mc.Model {
+			modelEntry = entry
+		}
+	}
+
+	field := func(name string) string {
+		for _, entry := range []map[string]interface{}{modelEntry, providerEntry} {
+			if s, ok := entry[name].(string); ok && strings.TrimSpace(s) != "" {
+				return s
+			}
+		}
+		return ""
+	}
+	return PromptTemplate{
+		System: field(promptTemplateSystem),
+		Latex:  field(promptTemplateLatex),
+	}
+}
+
+// systemPromptFor returns the system prompt for a task under ctx
+func systemPromptFor(ctx context.Context, task ai.TaskType) string {
+	if system := promptTemplateFor(ctx, task).System; system != "" {
+		return system
+	}
+	return SystemPrompt
+}
+
+// latexPromptFor fills in the LaTeX prompt template for the model under
+// ctx, or returns ok false to use the built-in prompt. A template without
+// {{design}} would drop the design, so it is ignored.
+func latexPromptFor(ctx context.Context, design, stylePrompt, images string) (string, bool) {
+	tmpl := promptTemplateFor(ctx, ai.TaskLaTeXGeneration).Latex
+	if tmpl == "" {
+		return "", false
+	}
+	if !strings.Contains(tmpl, "{{design}}") {
+		log.Printf("PROMPT_TEMPLATES: latex template has no {{design}}, using the built-in prompt")
+		return "", false
+	}
+	return strings.NewReplacer(
+		"{{design}}", design,
+		"{{style}}", stylePrompt,
+		"{{images}}", images,
+	).Replace(tmpl), true
+}
@@ -3,6 +3,7 @@ package pipeline
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/google/uuid"
 	"nadhi.dev/sarvar/fun/ai"
+	"nadhi.dev/sarvar/fun/config"
 	"nadhi.dev/sarvar/fun/latex"
 	"nadhi.dev/sarvar/fun/websearch"
 	ws "nadhi.dev/sarvar/fun/websocket"
@@ -20,15 +22,95 @@ import (
 
 // Queue manages job processing with a simple worker pool
 type Queue struct {
-	jobs      chan uuid.UUID
-	store     *Store
-	logger    *log.Logger
-	wg        sync.WaitGroup
-	updates   chan StatusUpdate
-	mu        sync.Mutex
-	listeners map[uuid.UUID]func(StatusUpdate)
+	jobs    chan uuid.UUID
+	store   *Store
+	logger  *log.Logger
+	wg      sync.WaitGroup
+	updates chan StatusUpdate
+	mu      sync.Mutex
+
+	// listeners receive a job's status updates; each job can have any
+	// number of them, told apart by the ID RegisterJobListener returns
+	listeners      map[uuid.UUID][]listenerEntry
+	nextListenerID int
+
+	// Per-user fairness: jobs for a user already at maxPerUser are parked
+	// in deferred and re-queued whenever any running job finishes
+	maxPerUser int
+	active     map[string]int
+	deferred   []deferredJob
+	stopped    bool
+
+	// maxLatexBytes bounds generated LaTeX; 0 disables the guard
+	maxLatexBytes int
+
+	// maxLatexContinuations caps follow-up requests for cut-off LaTeX
+	maxLatexContinuations int
+
+	// Per-job status webhooks, each delivered by its own goroutine
+	webhooks      map[uuid.UUID]*statusWebhook
+	webhookSecret string
+
+	// storageQuota caps each user's artifact bytes; 0 means unlimited
+	storageQuota int64
+
+	// maxStoredJobs caps each user's stored jobs; 0 means unlimited
+	maxStoredJobs    int
+	storedJobsPolicy string
+	storedJobsMu     sync.Mutex
+
+	// thumbnails renders a PNG of each PDF's first page after compiling
+	thumbnails bool
+
+	// analytics stores page, question and reading-level metrics after compiling
+	analytics bool
+
+	// abstracts summarizes each sheet in a sentence or two after compiling
+	abstracts bool
+
+	// Heartbeats: jobs being processed, and how long one may go quiet
+	// before the monitor cancels it
+	running       map[uuid.UUID]*runningJob
+	stuckAfter    time.Duration
+	stuckDetected int
+	stuckRequeued int
+	stuckFailed   int
+
+	// jobDeadline bounds a single processing run of a job; 0 means none
+	jobDeadline time.Duration
+
+	// heldRequests keeps unredacted requests in memory while only the
+	// redacted copy is stored
+	heldRequests map[uuid.UUID]*ai.GenerationRequest
+
+	// Bulk recompiles: the latest batch, and jobs whose updates are muted
+	// while it compiles them
+	recompile *RecompileStats
+	muted     map[uuid.UUID]bool
+
+	// updateSeq is the last sequence number sent for each job
+	updateSeq map[uuid.UUID]uint64
+
+	// pending mirrors the jobs channel in order, so Position can tell how
+	// many jobs are ahead; processingTimes are the latest run durations
+	// for its ETA
+	pending         []uuid.UUID
+	processingTimes []time.Duration
+	workers         int
+
+	// notebookFiler files completed sheets into the notebook their request names
+	notebookFiler NotebookFiler
 }
 
+// deferredJob is a job parked because its user was at the concurrency limit
+type deferredJob struct {
+	ID     uuid.UUID
+	UserID string
+}
+
+// DefaultMaxJobsPerUser caps how many of one user's jobs run at once
+const DefaultMaxJobsPerUser = 2
+
 // NewQueue creates a new queue with the specified capacity
 func NewQueue(size int, store *Store, logger *log.Logger) *Queue {
 	if logger == nil {
@@ -40,25 +122,142 @@ func NewQueue(size int, store *Store, logger *log.Logger) *Queue {
 		store:     store,
 		logger:    logger,
 		updates:   make(chan StatusUpdate, 100),
-		listeners: make(map[uuid.UUID]func(StatusUpdate)),
+		listeners: make(map[uuid.UUID][]listenerEntry),
+
+		maxPerUser: DefaultMaxJobsPerUser,
+		active:     make(map[string]int),
+
+		storedJobsPolicy: StoredJobsReject,
+
+		maxLatexBytes:         DefaultMaxLatexBytes,
+		maxLatexContinuations: DefaultMaxLatexContinuations,
+
+		webhooks: make(map[uuid.UUID]*statusWebhook),
+
+		analytics: true,
+
+		running:    make(map[uuid.UUID]*runningJob),
+		stuckAfter: DefaultStuckJobMinutes * time.Minute,
+
+		jobDeadline: DefaultJobDeadlineMinutes * time.Minute,
+
+		heldRequests: make(map[uuid.UUID]*ai.GenerationRequest),
+
+		muted: make(map[uuid.UUID]bool),
+
+		updateSeq: make(map[uuid.UUID]uint64),
 	}
 }
 
-// RegisterJobListener registers a callback for a specific job ID
-func (q *Queue) RegisterJobListener(jobID uuid.UUID, cb func(StatusUpdate)) {
+// SetMaxJobsPerUser sets how many jobs a single user may have processing
+// at the same time. Values below 1 disable the limit.
+func (q *Queue) SetMaxJobsPerUser(n int) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	q.listeners[jobID] = cb
+	q.maxPerUser = n
+}
+
+// SetMaxLatexBytes sets the largest LaTeX document the LaTeX step accepts.
+// Values below 1 disable the guard.
+func (q *Queue) SetMaxLatexBytes(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.maxLatexBytes = n
+}
+
+// SetMaxLatexContinuations sets how many times the LaTeX step asks the model
+// to continue a document that was cut off. 0 disables continuations.
+func (q *Queue) SetMaxLatexContinuations(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if n < 0 {
+		n = 0
+	}
+	q.maxLatexContinuations = n
+}
+
+// generateLatex runs GenerateLatex with the queue's continuation limit
+func (q *Queue) generateLatex(ctx context.Context, conv *Conversation, design, stylePrompt string, attachments []ai.Attachment) (string, error) {
+	q.mu.Lock()
+	maxContinuations := q.maxLatexContinuations
+	q.mu.Unlock()
+	return GenerateLatexWithContinuations(ctx, conv, design, stylePrompt, attachments, maxContinuations)
+}
+
+// ActiveJobsByUser returns a snapshot of in-progress job counts per user
+func (q *Queue) ActiveJobsByUser() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	counts := make(map[string]int, len(q.active))
+	for user, n := range q.active {
+		counts[user] = n
+	}
+	return counts
+}
+
+// listenerEntry is a callback registered for one job's status updates
+type listenerEntry struct {
+	id int
+	cb func(StatusUpdate)
+}
+
+// RegisterJobListener adds a callback for a specific job ID alongside any
+// already registered, and returns its ID for UnregisterJobListener.
+// Callbacks run while the worker holds the job's lock, so they must not
+// call GetJobForUpdate for that job.
+func (q *Queue) RegisterJobListener(jobID uuid.UUID, cb func(StatusUpdate)) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	id := q.nextListenerID
+	q.nextListenerID++
+	q.listeners[jobID] = append(q.listeners[jobID], listenerEntry{id: id, cb: cb})
+	return id
+}
+
+// UnregisterJobListener removes a callback added by RegisterJobListener.
+// Owners must call it when they stop listening, e.g. when a websocket
+// closes, or the callback keeps firing and is never freed.
+func (q *Queue) UnregisterJobListener(jobID uuid.UUID, listenerID int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// Rebuilt rather than edited in place, since sendUpdate may be
+	// iterating over a copy of the old slice
+	kept := make([]listenerEntry, 0, len(q.listeners[jobID]))
+	for _, l := range q.listeners[jobID] {
+		if l.id != listenerID {
+			kept = append(kept, l)
+		}
+	}
+	if len(kept) == 0 {
+		delete(q.listeners, jobID)
+		return
+	}
+	q.listeners[jobID] = kept
+}
+
+// SubscribeJob registers a listener and returns the function that removes
+// it. The callback runs on the worker goroutine, so it must not block or
+// take the job's lock.
+func (q *Queue) SubscribeJob(jobID uuid.UUID, cb func(StatusUpdate)) func() {
+	id := q.RegisterJobListener(jobID, cb)
+	return func() { q.UnregisterJobListener(jobID, id) }
 }
 
 // Start initializes worker goroutines
 func (q *Queue) Start(ctx context.Context, workers int) {
 	q.logger.Printf("Starting queue with %d workers", workers)
+	q.mu.Lock()
+	q.workers = workers
+	q.mu.Unlock()
 
 	// Start status update handler
 	q.wg.Add(1)
 	go q.statusUpdateHandler(ctx)
 
+	go q.monitorHeartbeats(ctx)
+
 	// Start workers
 	for i := 0; i < workers; i++ {
 		q.wg.Add(1)
@@ -69,6 +268,9 @@ func (q *Queue) Start(ctx context.Context, workers int) {
 // Stop gracefully shuts down the queue
 func (q *Queue) Stop() {
 	q.logger.Println("Stopping queue")
+	q.mu.Lock()
+	q.stopped = true
+	q.mu.Unlock()
 	close(q.jobs)
 	close(q.updates)
 	q.wg.Wait()
@@ -82,11 +284,15 @@ func (q *Queue) Enqueue(jobID uuid.UUID) error {
 		return fmt.Errorf("cannot enqueue non-existent job: %w", err)
 	}
 
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.markQueuedLocked(jobID)
 	select {
 	case q.jobs <- jobID:
 		q.logger.Printf("Enqueued job %s", jobID)
 		return nil
 	default:
+		q.unmarkQueuedLocked(jobID)
 		return fmt.Errorf("queue is full")
 	}
 }
@@ -107,23 +313,118 @@ func (q *Queue) worker(ctx context.Context, id int) {
 				q.logger.Printf("Worker %d shutting down (channel closed)", id)
 				return
 			}
+			q.mu.Lock()
+			q.unmarkQueuedLocked(jobID)
+			q.mu.Unlock()
+
+			userID := q.jobOwner(jobID)
+			if !q.acquireUserSlot(userID, jobID) {
+				q.logger.Printf("Worker %d: user %s at concurrency limit, deferring job %s", id, userID, jobID)
+				continue
+			}
 
 			q.logger.Printf("Worker %d processing job %s", id, jobID)
-			if err := q.processJob(ctx, jobID); err != nil {
+			requeue, err := q.processJob(ctx, jobID)
+			if err != nil {
 				q.logger.Printf("Worker %d: job %s failed: %v", id, jobID, err)
 			}
+			q.releaseUserSlot(userID)
+			// processJob has released the store lock, so eviction can
+			// safely load and update the user's other jobs
+			q.enforceStorageQuota(userID, jobID)
+			if requeue {
+				q.requeueStuckJob(jobID)
+			}
+		}
+	}
+}
+
+// jobOwner looks up the user a job belongs to, or "" if it can't be read
+func (q *Queue) jobOwner(jobID uuid.UUID) string {
+	job, err := q.store.GetJob(jobID)
+	if err != nil {
+		return ""
+	}
+	return job.UserID
+}
+
+// acquireUserSlot reserves a processing slot for the user. If the user is
+// already at their limit the job is deferred and false is returned.
+func (q *Queue) acquireUserSlot(userID string, jobID uuid.UUID) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if userID == "" || q.maxPerUser < 1 {
+		return true
+	}
+	if q.active[userID] >= q.maxPerUser {
+		q.deferred = append(q.deferred, deferredJob{ID: jobID, UserID: userID})
+		return false
+	}
+	q.active[userID]++
+	return true
+}
+
+// releaseUserSlot frees a slot and re-queues deferred jobs that can run now
+func (q *Queue) releaseUserSlot(userID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if userID == "" || q.active[userID] == 0 {
+		return
+	}
+	q.active[userID]--
+	if q.active[userID] == 0 {
+		delete(q.active, userID)
+	}
+	if q.stopped {
+		return
+	}
+	q.requeueDeferredLocked()
+}
+
+// requeueDeferredLocked sends deferred jobs back to the channel, oldest
+// first, for every user with free slots, not just the one whose job just
+// finished. It runs after every job, so a job left deferred because the
+// channel was full is retried once a worker drains it. Callers hold q.mu.
+//
+// Never touch the store here: processJob holds the store lock while
+// calling sendUpdate, which takes q.mu
+func (q *Queue) requeueDeferredLocked() {
+	free := make(map[string]int)
+	kept := q.deferred[:0]
+	for i, d := range q.deferred {
+		if _, ok := free[d.UserID]; !ok {
+			free[d.UserID] = q.maxPerUser - q.active[d.UserID]
+		}
+		if free[d.UserID] <= 0 {
+			kept = append(kept, d)
+			continue
+		}
+		q.markQueuedLocked(d.ID)
+		select {
+		case q.jobs <- d.ID:
+			free[d.UserID]--
+		default:
+			// Channel full; the workers draining it will retry the rest
+			q.unmarkQueuedLocked(d.ID)
+			kept = append(kept, q.deferred[i:]...)
+			q.deferred = kept
+			return
 		}
 	}
+	q.deferred = kept
 }
 
 // processJob executes the full pipeline for a single job in one pass.
-// It holds the store write lock for the duration, so individual steps
-// must NOT call Enqueue (which would deadlock on the store mutex).
-func (q *Queue) processJob(ctx context.Context, jobID uuid.UUID) error {
+// It holds the job's lock for the duration (see the Store locking
+// contract), so steps and listeners must not take it again for this job.
+// It reports whether a job recovered from a stall needs re-queueing.
+func (q *Queue) processJob(ctx context.Context, jobID uuid.UUID) (bool, error) {
 	// Acquire exclusive lock on job
 	job, commit, err := q.store.GetJobForUpdate(jobID)
 	if err != nil {
-		return fmt.Errorf("failed to lock job: %w", err)
+		return false, fmt.Errorf("failed to lock job: %w", err)
 	}
 	defer func() {
 		if err := commit(); err != nil {
@@ -131,41 +432,64 @@ func (q *Queue) processJob(ctx context.Context, jobID uuid.UUID) error {
 		}
 	}()
 
+	// Record token usage for every generation made while processing;
+	// deferred after commit so it runs first and is saved with the job
+	usage := ai.NewUsageTracker()
+	ctx = ai.WithUsageTracker(ctx, usage)
+	defer job.AddUsage(usage)
+	defer q.releaseRequest(job)
+	defer q.fileInNotebook(job)
+
+	// Auto-approved jobs never wait on review; resume one that was parked
+	if job.Status == StatusWaitingManual && job.IsAutoApprove() {
+		job.Status = StatusPending
+	}
+
 	// Check if job is in a processable state
 	if job.Status != StatusPending && job.Status != StatusRunning {
 		q.logger.Printf("Job %s is in state %s, skipping", jobID, job.Status)
-		return nil
+		return false, nil
 	}
 
 	// Mark as running
 	job.Status = StatusRunning
-	q.sendUpdate(job, "Job processing started", q.stageData("Pipeline", "Job processing started", nil))
-
-	// Run all pipeline steps in sequence
+	ctx, cancel := q.withJobDeadline(ctx)
+	defer cancel()
+	ctx, untrack := q.trackJob(ctx, job)
+	defer untrack()
+	started := time.Now()
+	defer func() { q.recordProcessingTime(time.Since(started)) }()
+	q.sendUpdate(job, "Job processing started", q.stageData("Pipeline", "Job processing started", map[string]interface{}{
+		"autoApprove": job.IsAutoApprove(),
+	}))
+
+	// Walk the step graph until the job finishes or stops
 	for {
-		var stepErr error
-		switch job.CurrentStep {
-		case StepPrompt:
-			stepErr = q.executePromptStep(ctx, job)
-		case StepDesign:
-			stepErr = q.executeDesignStep(ctx, job)
-		case StepLatex:
-			stepErr = q.executeLatexStep(ctx, job)
-		case StepCompile:
-			stepErr = q.executeCompileStep(ctx, job)
-		case StepDone:
-			return nil
-		default:
-			return fmt.Errorf("unknown step: %s", job.CurrentStep)
+		if job.CurrentStep == StepDone {
+			return false, nil
 		}
-
-		if stepErr != nil {
-			return stepErr
+		q.beginStep(job)
+		err := q.runStep(ctx, job)
+		if q.jobAborted(job.ID) {
+			q.markAborted(job)
+			return false, nil
+		}
+		if q.jobStalled(job.ID) {
+			if q.recoverStuckJob(job, err) {
+				return true, nil
+			}
+			return false, err
+		}
+		if ctx.Err() == context.DeadlineExceeded && q.failPastDeadline(job) {
+			return false, fmt.Errorf("job %s exceeded its deadline", job.ID)
+		}
+		if err != nil {
+			return false, err
 		}
 
 		// If the step didn't advance (e.g. completed/errored), stop
 		if job.Status != StatusPending && job.Status != StatusRunning {
-			return nil
+			return false, nil
 		}
 
 		// Reset status for next step
@@ -208,6 +532,17 @@ func (q *Queue) executeDesignStep(ctx context.Context, job *Job) error {
 		q.sendUpdate(job, "Design generation failed", q.errorData(msg))
 		return err
 	}
+	if config.IsSafeMode() {
+		q.sendUpdate(job, "Safe mode is on: generating from the request text only, without attachments or web search", q.stageData("Design", "Safe mode", map[string]interface{}{"safeMode": true}))
+	}
+	q.applyTemplateVariables(job, request)
+	// Too little to go on gives a vague design; ask for more before
+	// spending a model call on it
+	if !hasEnoughSignal(request) {
+		return q.parkUnderspecified(job, request)
+	}
+	q.detectRequestLanguage(ctx, job, request)
+	route := q.modelRoute(job, request)
 
 	conv, convErr := q.store.GetConversationByJobID(job.ID)
 	if convErr != nil {
@@ -215,11 +550,35 @@ func (q *Queue) executeDesignStep(ctx context.Context, job *Job) error {
 		_ = q.store.SaveConversation(conv)
 	}
 
+	if request.OptimizePrompt {
+		q.optimizeRequest(ctx, job, conv, request)
+	}
+
 	designPrompt := q.formatDesignPrompt(request)
 
-	if request.WebSearchEnabled && strings.TrimSpace(request.WebSearchQuery) != "" {
-		webContext, _, err := websearch.SearchAndExtract(request.WebSearchQuery, 3)
-		if err != nil {
+	if selected, ok := selectedWebSources(job); ok && request.WebSearchEnabled {
+		// The user picked which of the earlier results to keep; no new search
+		if len(selected) == 0 {
+			q.sendUpdate(job, "No web sources selected, continuing without web context", q.stageData("WebSearch", "No sources selected", nil))
+		} else if webContext, err := websearch.ExtractResults(selected); err != nil {
+			q.sendUpdate(job, "Selected web sources couldn't be read, continuing without web context", q.stageData("WebSearch", "No content", map[string]interface{}{"error": err.Error(), "noContent": true}))
+		} else {
+			designPrompt = designPrompt + "\n\n" + webContext
+			q.sendUpdate(job, "Selected web sources added", q.stageData("WebSearch", "Completed", map[string]interface{}{"sources": len(selected)}))
+		}
+	} else if request.WebSearchEnabled && strings.TrimSpace(request.WebSearchQuery) != "" {
+		webContext, results, err := websearch.SearchAndExtract(request.WebSearchQuery, request.WebSearchLimit)
+		if len(results) > 0 {
+			if job.Metadata == nil {
+				job.Metadata = make(map[string]interface{})
+			}
+			job.Metadata[webSourcesKey] = results
+		}
+		if errors.Is(err, websearch.ErrRateLimited) {
+			q.sendUpdate(job, "Web search is rate limited, continuing without web context", q.stageData("WebSearch", "Rate limited", map[string]interface{}{"error": err.Error(), "rateLimited": true}))
+		} else if errors.Is(err, websearch.ErrNoContent) {
+			q.sendUpdate(job, "Web search found nothing usable, continuing without web context", q.stageData("WebSearch", "No content", map[string]interface{}{"error": err.Error(), "noContent": true}))
+		} else if err != nil {
 			q.sendUpdate(job, "Web search failed, continuing without web context", q.stageData("WebSearch", "Failed", map[string]interface{}{"error": err.Error()}))
 		} else {
 			designPrompt = designPrompt + "\n\n" + webContext
@@ -227,7 +586,16 @@ func (q *Queue) executeDesignStep(ctx context.Context, job *Job) error {
 		}
 	}
 
-	design, err := GenerateDesign(ctx, conv, designPrompt, request.Attachments)
+	var design string
+	var spec *DesignSpec
+	var options []string
+	if request.StructuredDesign {
+		spec, err = GenerateDesignSpec(routedContext(ctx, route, StepDesign), conv, designPrompt, request.Attachments)
+	} else if n := designOptionCount(request); n > 0 {
+		options, err = GenerateDesignOptions(routedContext(ctx, route, StepDesign), conv, designPrompt, request.Attachments, n)
+	} else {
+		design, err = GenerateDesign(routedContext(ctx, route, StepDesign), conv, designPrompt, request.Attachments)
+	}
 	if err != nil {
 		if job.CanRetry() {
 			job.IncrementRetry()
@@ -242,7 +610,22 @@ func (q *Queue) executeDesignStep(ctx context.Context, job *Job) error {
 		return err
 	}
 
-	job.Design = design
+	if len(options) > 1 {
+		_ = q.store.SaveConversation(conv)
+		q.parkDesignOptions(job, options)
+		return nil
+	}
+	if len(options) == 1 {
+		// The provider gave one design; carry on as if none were asked for
+		design = options[0]
+		conv.AddMessage("assistant", design)
+	}
+
+	if spec != nil {
+		job.SetDesignSpec(spec)
+	} else {
+		job.Design = design
+	}
 	_ = q.store.SaveConversation(conv)
 
 	q.sendUpdate(job, "Design generated, advancing to LaTeX", q.stageData("Design", "Design generated", nil))
@@ -270,8 +653,32 @@ func (q *Queue) executeLatexStep(ctx context.Context, job *Job) error {
 		_ = q.store.SaveConversation(conv)
 	}
 
-	stylePrompt := ai.ResolveStylePrompt(request)
-	latexOutput, err := GenerateLatex(ctx, conv, job.Design, stylePrompt, request.Attachments)
+	route := q.modelRoute(job, request)
+	ctx = routedContext(ctx, route, StepLatex)
+
+	style := ai.ResolveStyle(request)
+	stylePrompt := style.Prompt
+	if style.Missing {
+		job.Metadata["styleFallback"] = style
+		q.sendUpdate(job, style.FallbackMessage(), q.stageData("LaTeX", "Style not found", map[string]interface{}{
+			"requestedStyle": style.Requested,
+			"usedStyle":      style.Used,
+			"styleSource":    style.Source,
+		}))
+	}
+	design := job.Design
+	if spec, ok := DesignSpecFromJob(job); ok {
+		design = spec.LatexBrief()
+	}
+	if wantsSplitAnswerKey(request) {
+		design += answerKeyInstructions
+	}
+	var latexOutput string
+	if route == RouteDefault && draftThenRefineEnabled() {
+		latexOutput, err = q.generateLatexDraftFirst(ctx, job, conv, design, stylePrompt, request)
+	} else {
+		latexOutput, err = q.generateLatex(ctx, conv, design, stylePrompt, request.Attachments)
+	}
 	if err != nil {
 		if job.CanRetry() {
 			job.IncrementRetry()
@@ -286,6 +693,67 @@ func (q *Queue) executeLatexStep(ctx context.Context, job *Job) error {
 		return err
 	}
 
+	// Cheap structural check that the output matches the mode; one
+	// regeneration with a firmer instruction if it clearly doesn't
+	check := checkLatexMode(ai.ResolveMode(request), latexOutput)
+	if check.Checked && !check.Passed {
+		q.sendUpdate(job, "LaTeX does not match the requested mode, regenerating", q.stageData("LaTeX", "Mode check failed", map[string]interface{}{
+			"mode":    check.Mode,
+			"reasons": check.Reasons,
+		}))
+		retryOutput, retryErr := q.generateLatex(ctx, conv, design+modeReinforcement(check), stylePrompt, request.Attachments)
+		if retryErr != nil {
+			q.logger.Printf("Mode regeneration failed for job %s, keeping first attempt: %v", job.ID, retryErr)
+		} else {
+			latexOutput = retryOutput
+			check = checkLatexMode(check.Mode, latexOutput)
+			check.Regenerated = true
+		}
+	}
+	job.setModeCheck(check)
+
+	// Operator-defined structural requirements for the mode; one targeted
+	// regeneration naming what is missing
+	requirements := checkModeRequirements(check.Mode, latexOutput)
+	if !requirements.Passed {
+		q.sendUpdate(job, "LaTeX is missing required elements, regenerating", q.stageData("LaTeX", "Requirements failed", map[string]interface{}{
+			"mode":    requirements.Mode,
+			"missing": requirements.Missing(),
+		}))
+		retryOutput, retryErr := q.generateLatex(ctx, conv, design+requirementsFeedback(requirements), stylePrompt, request.Attachments)
+		if retryErr != nil {
+			q.logger.Printf("Requirements regeneration failed for job %s, keeping first attempt: %v", job.ID, retryErr)
+		} else {
+			latexOutput = retryOutput
+			requirements = checkModeRequirements(requirements.Mode, latexOutput)
+			requirements.Regenerated = true
+		}
+	}
+	if len(requirements.Checks) > 0 {
+		job.setRequirementsCheck(requirements)
+	}
+
+	// Optional model self-review; one regeneration with its critique on fail
+	if wantsSelfReview(request) {
+		review := ReviewLatex(ctx, request, latexOutput)
+		if !review.Passed {
+			q.sendUpdate(job, "Self-review found problems, regenerating", q.stageData("LaTeX", "Self-review failed", map[string]interface{}{
+				"issues": review.Issues,
+			}))
+			retryOutput, retryErr := q.generateLatex(ctx, conv, design+selfReviewCritique(review), stylePrompt, request.Attachments)
+			if retryErr != nil {
+				q.logger.Printf("Self-review regeneration failed for job %s, keeping first attempt: %v", job.ID, retryErr)
+			} else {
+				latexOutput = retryOutput
+				review.Regenerated = true
+			}
+		}
+		job.setSelfReview(review)
+	}
+
+	latexOutput = q.enforceLatexLimit(ctx, job, conv, design, stylePrompt, request, latexOutput)
+	latexOutput = q.enforcePackageWhitelist(job, latexOutput)
+
 	job.Latex = latexOutput
 	_ = q.store.SaveConversation(conv)
 
@@ -296,6 +764,46 @@ func (q *Queue) executeLatexStep(ctx context.Context, job *Job) error {
 	return nil
 }
 
+// enforceLatexLimit regenerates over-long LaTeX once with a request to be
+// concise, then truncates at a section boundary if it is still too long
+func (q *Queue) enforceLatexLimit(ctx context.Context, job *Job, conv *Conversation, design, stylePrompt string, request *ai.GenerationRequest, latexOutput string) string {
+	q.mu.Lock()
+	limit := q.maxLatexBytes
+	q.mu.Unlock()
+
+	if limit < 1 || len(latexOutput) <= limit {
+		return latexOutput
+	}
+
+	q.sendUpdate(job, "LaTeX exceeds the size limit, regenerating more concisely", q.stageData("LaTeX", "Size limit exceeded", map[string]interface{}{
+		"size":  len(latexOutput),
+		"limit": limit,
+	}))
+	concise, err := q.generateLatex(ctx, conv, design+concisenessInstruction(len(latexOutput), limit), stylePrompt, request.Attachments)
+	if err != nil {
+		q.logger.Printf("Concise regeneration failed for job %s: %v", job.ID, err)
+	} else if len(concise) <= limit {
+		return concise
+	} else {
+		latexOutput = concise
+	}
+
+	truncated, ok := truncateLatex(latexOutput, limit)
+	if !ok {
+		q.logger.Printf("Warning: job %s LaTeX is %d bytes (limit %d) and has no safe cut point", job.ID, len(latexOutput), limit)
+		return latexOutput
+	}
+	q.sendUpdate(job, "LaTeX still exceeds the size limit, truncated at a section boundary", q.stageData("LaTeX", "Truncated", map[string]interface{}{
+		"size":  len(latexOutput),
+		"limit": limit,
+	}))
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]interface{})
+	}
+	job.Metadata["latexTruncated"] = true
+	return truncated
+}
+
 // executeCompileStep compiles the LaTeX to PDF
 func (q *Queue) executeCompileStep(ctx context.Context, job *Job) error {
 	q.sendUpdate(job, "Compiling LaTeX to PDF", q.stageData("Compile", "Compiling LaTeX", nil))
@@ -338,38 +846,138 @@ func (q *Queue) executeCompileStep(ctx context.Context, job *Job) error {
 	pdfFilename := fmt.Sprintf("%s.pdf", job.ID.String())
 	outputPath := filepath.Join(outputDir, pdfFilename)
 
-	_, err := latex.ConvertLatexToPDFWithRetry(job.Latex, texFilename, outputPath)
+	// Materialize image attachments so \includegraphics{attachment-N} resolves
+	var assets []latex.Asset
+	request, reqErr := q.parseRequest(job)
+	if reqErr == nil {
+		var assetErr error
+		// Unreadable images are skipped; the rest are still materialized
+		assets, assetErr = imageAttachmentAssets(request.Attachments)
+		if assetErr != nil {
+			q.sendUpdate(job, "Skipping unreadable image attachments", q.stageData("Compile", "Attachments skipped", map[string]interface{}{"error": assetErr.Error()}))
+		}
+	}
+
+	// Stamp title, author and keywords into the PDF; job.Latex stays as generated
+	stamp := func(src string) string { return src }
+	if reqErr == nil && pdfMetadataEnabled() {
+		stamp = func(src string) string { return stampPDFMetadata(src, request, job.UserID) }
+	}
+
+	if reqErr == nil && wantsSplitAnswerKey(request) {
+		if studentLatex, ok := StripAnswerKey(job.Latex); ok {
+			return q.compileSplitAnswerKey(ctx, job, stamp(studentLatex), stamp(job.Latex), outputDir, assets)
+		}
+		q.sendUpdate(job, "Answer key markers not found, producing a single PDF", q.stageData("Compile", "Answer key not split", nil))
+	}
+
+	_, err := latex.ConvertLatexToPDFWithAssets(stamp(job.Latex), texFilename, outputPath, assets)
 	if err != nil {
 		msg := fmt.Sprintf("LaTeX compilation failed: %v", err)
+		if errors.Is(err, latex.ErrTransientCompile) {
+			// The LaTeX may be fine; a plain retry later is the fix
+			msg = fmt.Sprintf("LaTeX compilation failed for a transient reason, retry later: %v", err)
+		}
 		job.SetError(msg, nil)
 		q.sendUpdate(job, "Compilation failed", q.errorData(msg))
 		return err
 	}
 
-	if job.Metadata == nil {
-		job.Metadata = make(map[string]interface{})
+	q.ensureCompileMetadata(job)
+	q.attachThumbnail(job, outputPath)
+	q.attachAnalytics(job, outputPath)
+	q.attachAbstract(ctx, job)
+
+	pdfURL := fmt.Sprintf("/vela/bucket/bucket/%s", pdfFilename)
+	job.SetCompleted(pdfURL)
+	q.runCompletionHook(job, outputPath, "")
+
+	q.sendUpdate(job, "Compilation completed successfully", ws.Completed("Sheet generation completed", map[string]interface{}{
+		"pdf_url":       pdfURL,
+		"thumbnail_url": job.ThumbnailURL(),
+		"metadata":      job.Metadata["metadata"],
+	}, map[string]interface{}{})["data"].(map[string]interface{}))
+
+	return nil
+}
+
+// compileSplitAnswerKey compiles separate student (answers stripped) and
+// answer key (full document) PDFs and exposes both URLs on the job
+func (q *Queue) compileSplitAnswerKey(ctx context.Context, job *Job, studentLatex, keyLatex, outputDir string, assets []latex.Asset) error {
+	id := job.ID.String()
+	versions := []struct {
+		name  string
+		latex string
+	}{
+		{"student", studentLatex},
+		{"key", keyLatex},
 	}
-	if _, ok := job.Metadata["metadata"]; !ok {
-		job.Metadata["metadata"] = map[string]interface{}{
-			"generated": time.Now().Format(time.RFC3339),
-			"source":    "pipeline",
+
+	urls := make(map[string]string, len(versions))
+	for _, v := range versions {
+		texFilename := fmt.Sprintf("%s-%s.tex", id, v.name)
+		pdfFilename := fmt.Sprintf("%s-%s.pdf", id, v.name)
+		outputPath := filepath.Join(outputDir, pdfFilename)
+
+		if _, err := latex.ConvertLatexToPDFWithAssets(v.latex, texFilename, outputPath, assets); err != nil {
+			msg := fmt.Sprintf("LaTeX compilation failed (%s version): %v", v.name, err)
+			job.SetError(msg, nil)
+			q.sendUpdate(job, "Compilation failed", q.errorData(msg))
+			return err
 		}
+		urls[v.name] = fmt.Sprintf("/vela/bucket/bucket/%s", pdfFilename)
 	}
 
-	pdfURL := fmt.Sprintf("/vela/bucket/bucket/%s", pdfFilename)
-	job.SetCompleted(pdfURL)
+	q.ensureCompileMetadata(job)
+	q.attachThumbnail(job, filepath.Join(outputDir, fmt.Sprintf("%s-student.pdf", id)))
+	// Questions are counted on the full LaTeX; pages on the key, which is the longer version
+	q.attachAnalytics(job, filepath.Join(outputDir, fmt.Sprintf("%s-key.pdf", id)))
+	q.attachAbstract(ctx, job)
+	job.Metadata["studentPdfUrl"] = urls["student"]
+	job.Metadata["keyPdfUrl"] = urls["key"]
+
+	// The student version is the primary output; the key is linked alongside it
+	job.SetCompleted(urls["student"])
+	q.runCompletionHook(job, filepath.Join(outputDir, fmt.Sprintf("%s-student.pdf", id)), filepath.Join(outputDir, fmt.Sprintf("%s-key.pdf", id)))
 
 	q.sendUpdate(job, "Compilation completed successfully", ws.Completed("Sheet generation completed", map[string]interface{}{
-		"pdf_url":  pdfURL,
-		"metadata": job.Metadata["metadata"],
+		"pdf_url":         urls["student"],
+		"student_pdf_url": urls["student"],
+		"key_pdf_url":     urls["key"],
+		"thumbnail_url":   job.ThumbnailURL(),
+		"metadata":        job.Metadata["metadata"],
 	}, map[string]interface{}{})["data"].(map[string]interface{}))
 
 	return nil
 }
 
+// ensureCompileMetadata makes sure the job carries generation metadata
+func (q *Queue) ensureCompileMetadata(job *Job) {
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]interface{})
+	}
+	if _, ok := job.Metadata["metadata"]; !ok {
+		job.Metadata["metadata"] = map[string]interface{}{
+			"generated": time.Now().Format(time.RFC3339),
+			"source":    "pipeline",
+		}
+	}
+}
+
 // sendUpdate sends a status update to the update channel
 func (q *Queue) sendUpdate(job *Job, message string, data map[string]interface{}) {
 	job.UpdatedAt = time.Now()
+	q.mu.Lock()
+	muted := q.muted[job.ID]
+	var seq uint64
+	if !muted {
+		seq = q.nextUpdateSeqLocked(job.ID)
+	}
+	q.mu.Unlock()
+	if muted {
+		return
+	}
+
 	update := StatusUpdate{
 		JobID:     job.ID,
 		Status:    job.Status,
@@ -377,6 +985,7 @@ func (q *Queue) sendUpdate(job *Job, message string, data map[string]interface{}
 		Message:   message,
 		Timestamp: job.UpdatedAt,
 		Data:      data,
+		Seq:       seq,
 	}
 
 	select {
@@ -386,11 +995,14 @@ func (q *Queue) sendUpdate(job *Job, message string, data map[string]interface{}
 	}
 
 	q.mu.Lock()
-	listener, exists := q.listeners[job.ID]
+	q.heartbeatLocked(job)
+	listeners := append([]listenerEntry(nil), q.listeners[job.ID]...)
 	q.mu.Unlock()
-	if exists && listener != nil {
-		listener(update)
+	for _, l := range listeners {
+		l.cb(update)
 	}
+
+	q.dispatchStatusWebhook(job, update)
 }
 
 // statusUpdateHandler processes status updates
@@ -448,10 +1060,23 @@ func (q *Queue) retryData(job *Job, err error) map[string]interface{} {
 }
 
 func (q *Queue) parseRequest(job *Job) (*ai.GenerationRequest, error) {
+	if held, ok := q.heldRequest(job.ID); ok {
+		ai.ApplySafeMode(held)
+		return held, nil
+	}
 	var req ai.GenerationRequest
 	if err := json.Unmarshal([]byte(job.Prompt), &req); err != nil {
 		return nil, err
 	}
+	// Jobs stored before safe mode was turned on are stripped here
+	if ai.ApplySafeMode(&req) {
+		return &req, nil
+	}
+	attachments, err := q.store.ResolveAttachments(req.Attachments)
+	if err != nil {
+		return nil, err
+	}
+	req.Attachments = attachments
 	return &req, nil
 }
 
@@ -461,105 +1086,66 @@ func (q *Queue) formatDesignPrompt(req *ai.GenerationRequest) string {
 	}
 
 	tags := strings.Join(req.Tags, ", ")
-	mode := req.Mode
-	if mode == "" {
-		mode = "notes"
-	}
+	mode := ai.ResolveMode(req)
 
-	modeInstructions := getModeInstructions(mode)
+	modeInstructions := ai.GetModeInstructions(mode)
 	attachmentContext := formatAttachmentContext(req.Attachments)
 
+	language := "(not specified)"
+	if strings.TrimSpace(req.Language) != "" {
+		language = fmt.Sprintf("%s (write all worksheet content in this language)", strings.TrimSpace(req.Language))
+	}
+
 	return fmt.Sprintf(
-		"Subject: %s\nCourse: %s\nDescription: %s\nTags: %s\nCurriculum: %s\nSpecial Instructions: %s\n\nGeneration Mode: %s\n%s\n\nAdditional Context:\n%s",
+		"Subject: %s\nCourse: %s\nDescription: %s\nTags: %s\nCurriculum: %s\nSpecial Instructions: %s\nLanguage: %s\n\nGeneration Mode: %s\n%s\n\nAdditional Context:\n%s",
 		req.Subject,
 		req.Course,
 		req.Description,
 		tags,
 		req.Curriculum,
 		req.SpecialInstructions,
+		language,
 		mode,
 		modeInstructions,
 		attachmentContext,
 	)
 }
 
+// Attachment context limits: no attachment contributes more than
+// maxAttachmentContextChars, and together they share
+// ATTACHMENT_CONTEXT_CHARS
+const (
+	maxAttachmentContextChars     = 20000
+	DefaultAttachmentContextChars = 60000
+)
+
+// formatAttachmentContext lists the attachments in priority order, sharing
+// the context budget fairly so one large file can't crowd out the rest
 func formatAttachmentContext(attachments []ai.Attachment) string {
 	if len(attachments) == 0 {
 		return "(none)"
 	}
 
+	// Attachments are listed in priority order but keep their upload
+	// number, which the attachment-N image names also use
+	order := ai.AttachmentPriorityOrder(attachments)
+	prioritized := make([]ai.Attachment, len(order))
+	for k, i := range order {
+		prioritized[k] = attachments[i]
+	}
+	budget := config.GetConfigInt("ATTACHMENT_CONTEXT_CHARS", DefaultAttachmentContextChars)
+	limits := ai.AllocateAttachmentBudget(prioritized, budget, maxAttachmentContextChars)
+
 	var b strings.Builder
-	for i, att := range attachments {
-		b.WriteString(fmt.Sprintf("[%d] %s (%s, %d bytes, %s)\n", i+1, att.Name, att.MimeType, att.Size, att.Encoding))
-		content := att.Content
-		if len(content) > 20000 {
-			content = content[:20000] + "\n[TRUNCATED]"
+	b.WriteString(ai.UntrustedAttachmentNotice + "\n")
+	for k, att := range prioritized {
+		b.WriteString(fmt.Sprintf("[%d] %s (%s, %d bytes, %s)\n", order[k]+1, att.Name, att.MimeType, att.Size, att.Encoding))
+		if label := att.Label(); label != "" {
+			b.WriteString(label + "\n")
 		}
-		b.WriteString(content)
+		b.WriteString(ai.AttachmentPromptText(att, limits[k]))
 		b.WriteString("\n---\n")
 	}
 
 	return b.String()
 }
-
-// getModeInstructions returns mode-specific AI instructions
-func getModeInstructions(mode string) string {
-	switch mode {
-	case "prep-test":
-		return `MODE: PREP TEST
-You are generating a practice test / exam paper.
-
-Requirements:
-- Create a complete test paper with clear sections
-- Include a mix of question types: multiple choice, short answer, long answer, and problem-solving
-- Vary difficulty: easy (30%), medium (50%), hard (20%)
-- Include point values for each question
-- Add a clear header with subject, course, date, and time limit
-- Include instructions section at the top
-- Add space for student name and ID
-- Provide an answer key section at the end
-- Make questions that genuinely test understanding, not just memorization
-- Include at least 15-25 questions depending on complexity
-- Group questions by topic or section
-- Use professional exam formatting`
-
-	case "super-lazy":
-		return `MODE: SUPER LAZY
-You are generating a study document optimized for maximum retention with minimum effort.
-
-Requirements:
-- Use proven memory techniques: spaced repetition cues, mnemonics, chunking, and visual anchors
-- Structure content as KEY POINTS with bold highlights for critical terms
-- Use the "explain like I'm 5" approach for complex concepts
-- Include quick-fire summary boxes at the end of each section
-- Add "Remember This" callout boxes with memory tricks and acronyms
-- Use comparison tables to contrast similar concepts
-- Include a one-page "cheat sheet" summary at the end with EVERYTHING essential
-- Create "If you only read ONE thing" highlights per section
-- Use bullet points extensively, avoid long paragraphs
-- Add visual separators between concepts
-- Include practice recall prompts ("Can you explain X without looking?")
-- Make at least 4-5 pages of content
-- Design it so someone reading it the night before an exam WILL pass with excellence
-- Prioritize the 20% of content that covers 80% of what's tested
-- Use casual, engaging tone - not dry textbook language`
-
-	default: // "notes" mode
-		return `MODE: NOTES
-You are generating comprehensive, professional study notes.
-
-Requirements:
-- Create at least 3 pages of thorough, well-structured notes
-- Use a clean, professional document design with clear hierarchy
-- Include numbered sections and subsections
-- Add definitions, theorems, and key concepts in highlighted boxes
-- Include worked examples where relevant
-- Use proper mathematical notation where applicable
-- Add summary points at the end of each major section
-- Include diagrams descriptions where they would help understanding
-- Use professional typography: proper headings, consistent spacing, clear fonts
-- Make it comprehensive enough to be a standalone study resource
-- Include a table of contents if content is substantial
-- Add page numbers and proper headers/footers`
-	}
-}
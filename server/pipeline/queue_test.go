@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// TestDeferredJobRequeuedByAnyRelease covers a deferred job whose user has
+// nothing left running when the channel frees up: another user's job
+// finishing must hand it to the workers.
+func TestDeferredJobRequeuedByAnyRelease(t *testing.T) {
+	q := NewQueue(1, nil, log.New(io.Discard, "", 0))
+	q.maxPerUser = 1
+
+	running, deferred, other := uuid.New(), uuid.New(), uuid.New()
+	if !q.acquireUserSlot("alice", running) {
+		t.Fatal("alice's first job should get a slot")
+	}
+	if q.acquireUserSlot("alice", deferred) {
+		t.Fatal("alice's second job should be deferred")
+	}
+
+	// bob's job fills the channel before alice's running job finishes, so
+	// the hand-off at that release finds no room
+	q.jobs <- other
+	q.releaseUserSlot("alice")
+	if len(q.deferred) != 1 {
+		t.Fatalf("deferred = %v, want alice's job still deferred", q.deferred)
+	}
+
+	// A worker takes bob's job and finishes it
+	if got := <-q.jobs; got != other {
+		t.Fatalf("dequeued %s, want bob's job", got)
+	}
+	if !q.acquireUserSlot("bob", other) {
+		t.Fatal("bob's job should get a slot")
+	}
+	q.releaseUserSlot("bob")
+
+	if len(q.deferred) != 0 {
+		t.Errorf("deferred = %v, want it empty", q.deferred)
+	}
+	select {
+	case got := <-q.jobs:
+		if got != deferred {
+			t.Errorf("requeued %s, want alice's deferred job %s", got, deferred)
+		}
+	default:
+		t.Error("alice's deferred job was never requeued")
+	}
+}
+
+func TestRequeueDeferredRespectsFreeSlots(t *testing.T) {
+	q := NewQueue(10, nil, log.New(io.Discard, "", 0))
+	q.maxPerUser = 1
+
+	if !q.acquireUserSlot("alice", uuid.New()) {
+		t.Fatal("alice's first job should get a slot")
+	}
+	first, second := uuid.New(), uuid.New()
+	q.acquireUserSlot("alice", first)
+	q.acquireUserSlot("alice", second)
+
+	q.releaseUserSlot("alice")
+	if len(q.jobs) != 1 || <-q.jobs != first {
+		t.Fatalf("want only alice's oldest deferred job requeued")
+	}
+	if len(q.deferred) != 1 || q.deferred[0].ID != second {
+		t.Errorf("deferred = %v, want alice's second job kept", q.deferred)
+	}
+}
@@ -0,0 +1,185 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"nadhi.dev/sarvar/fun/ai"
+)
+
+// ErrRecompileRunning is returned when a recompile batch is already in progress
+var ErrRecompileRunning = errors.New("a recompile batch is already running")
+
+// RecompileFilter selects completed jobs by the style or a tag of their
+// request. Matching is case-insensitive; when both are set, a job must match
+// both.
+type RecompileFilter struct {
+	Style string `json:"style,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+}
+
+// RecompileStats reports the progress of the latest recompile batch
+type RecompileStats struct {
+	Running    bool            `json:"running"`
+	Filter     RecompileFilter `json:"filter"`
+	Total      int             `json:"total"`
+	Done       int             `json:"done"`
+	Failed     int             `json:"failed"`
+	Skipped    int             `json:"skipped"`
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// matches reports whether a job's request fits the filter
+func (f RecompileFilter) matches(req *ai.GenerationRequest) bool {
+	if f.Style != "" && !strings.EqualFold(req.StyleName, f.Style) {
+		return false
+	}
+	if f.Tag != "" {
+		for _, tag := range req.Tags {
+			if strings.EqualFold(strings.TrimSpace(tag), f.Tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// StartRecompile re-runs only the compile step, from the stored LaTeX, for
+// every completed job matching filter. The batch runs in the background, one
+// job at a time; progress is reported in Stats. Matching jobs without stored
+// LaTeX are counted as skipped. It returns the batch's initial counts.
+func (q *Queue) StartRecompile(filter RecompileFilter) (RecompileStats, error) {
+	jobs, err := q.store.GetAllJobs()
+	if err != nil {
+		return RecompileStats{}, err
+	}
+
+	var ids []uuid.UUID
+	skipped := 0
+	for _, job := range jobs {
+		if job.Status != StatusCompleted {
+			continue
+		}
+		var req ai.GenerationRequest
+		if err := json.Unmarshal([]byte(job.Prompt), &req); err != nil || !filter.matches(&req) {
+			continue
+		}
+		if strings.TrimSpace(job.Latex) == "" {
+			skipped++
+			continue
+		}
+		ids = append(ids, job.ID)
+	}
+
+	q.mu.Lock()
+	if q.recompile != nil && q.recompile.Running {
+		q.mu.Unlock()
+		return RecompileStats{}, ErrRecompileRunning
+	}
+	q.recompile = &RecompileStats{
+		Running:   true,
+		Filter:    filter,
+		Total:     len(ids),
+		Skipped:   skipped,
+		StartedAt: time.Now(),
+	}
+	stats := *q.recompile
+	q.mu.Unlock()
+
+	go q.runRecompile(ids)
+	return stats, nil
+}
+
+// runRecompile works through a batch started by StartRecompile
+func (q *Queue) runRecompile(ids []uuid.UUID) {
+	for _, id := range ids {
+		q.mu.Lock()
+		stopped := q.stopped
+		q.mu.Unlock()
+		if stopped {
+			break
+		}
+
+		done, skipped := q.recompileJob(id)
+
+		q.mu.Lock()
+		switch {
+		case skipped:
+			q.recompile.Skipped++
+		case done:
+			q.recompile.Done++
+		default:
+			q.recompile.Failed++
+		}
+		q.mu.Unlock()
+	}
+
+	q.mu.Lock()
+	now := time.Now()
+	q.recompile.Running = false
+	q.recompile.FinishedAt = &now
+	stats := *q.recompile
+	q.mu.Unlock()
+
+	q.logger.Printf("Recompile finished: %d done, %d failed, %d skipped of %d", stats.Done, stats.Failed, stats.Skipped, stats.Total)
+}
+
+// recompileJob compiles one job's stored LaTeX again. The compile step's
+// own updates are muted; a failed compile restores the job as it was, so
+// the previous PDF stays in place. It reports whether the job was
+// recompiled, or skipped because it changed since the batch started.
+func (q *Queue) recompileJob(id uuid.UUID) (done, skipped bool) {
+	job, commit, err := q.store.GetJobForUpdate(id)
+	if err != nil {
+		return false, true
+	}
+	defer func() {
+		if err := commit(); err != nil {
+			q.logger.Printf("Failed to commit recompiled job %s: %v", id, err)
+		}
+	}()
+
+	if job.Status != StatusCompleted || strings.TrimSpace(job.Latex) == "" {
+		return false, true
+	}
+
+	before := *job
+	before.Metadata = make(map[string]interface{}, len(job.Metadata))
+	for k, v := range job.Metadata {
+		before.Metadata[k] = v
+	}
+
+	q.muteUpdates(id, true)
+	err = q.executeCompileStep(context.Background(), job)
+	q.muteUpdates(id, false)
+
+	if err != nil {
+		*job = before
+		q.logger.Printf("Recompile of job %s failed, keeping previous PDF: %v", id, err)
+		return false, false
+	}
+
+	job.Metadata["recompiledAt"] = time.Now().Format(time.RFC3339)
+	q.sendUpdate(job, "PDF recompiled", q.stageData("Compile", "Recompiled", map[string]interface{}{
+		"pdf_url":       job.PDFURL,
+		"thumbnail_url": job.ThumbnailURL(),
+	}))
+	return true, false
+}
+
+// muteUpdates stops sendUpdate from publishing updates for a job
+func (q *Queue) muteUpdates(jobID uuid.UUID, mute bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if mute {
+		q.muted[jobID] = true
+	} else {
+		delete(q.muted, jobID)
+	}
+}
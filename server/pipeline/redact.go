@@ -0,0 +1,148 @@
+package pipeline
+
+import (
+	"regexp"
+
+	"github.com/google/uuid"
+	"nadhi.dev/sarvar/fun/ai"
+	"nadhi.dev/sarvar/fun/config"
+)
+
+// piiPattern pairs a pattern with the placeholder that replaces its matches
+type piiPattern struct {
+	re          *regexp.Regexp
+	placeholder string
+}
+
+// builtinPIIPatterns catch the obvious cases: email addresses, phone
+// numbers and US social security numbers. Order matters; SSNs are checked
+// before phone numbers so they aren't half-matched.
+var builtinPIIPatterns = []piiPattern{
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[REDACTED_EMAIL]"},
+	{regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), "[REDACTED_ID]"},
+	{regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{3}\)|\b\d{3})[\s.-]?\d{3}[\s.-]?\d{4}\b`), "[REDACTED_PHONE]"},
+}
+
+// redactionEnabled reports whether REDACT_PII is set
+func redactionEnabled() bool {
+	return config.GetConfigBool("REDACT_PII", false)
+}
+
+// piiPatterns returns the built-in patterns plus any regexes listed in
+// REDACT_PII_PATTERNS (e.g. a school's student ID format). Invalid entries
+// are skipped.
+func piiPatterns() []piiPattern {
+	patterns := builtinPIIPatterns
+	extra, _ := config.GetConfigValue("REDACT_PII_PATTERNS").([]interface{})
+	for _, v := range extra {
+		expr, ok := v.(string)
+		if !ok || expr == "" {
+			continue
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			continue
+		}
+		patterns = append(patterns, piiPattern{re, "[REDACTED_ID]"})
+	}
+	return patterns
+}
+
+// RedactPII replaces emails, phone numbers and IDs in text with
+// placeholders and returns the result with the number of replacements
+func RedactPII(text string) (string, int) {
+	return redactWith(piiPatterns(), text)
+}
+
+func redactWith(patterns []piiPattern, text string) (string, int) {
+	count := 0
+	for _, p := range patterns {
+		text = p.re.ReplaceAllStringFunc(text, func(string) string {
+			count++
+			return p.placeholder
+		})
+	}
+	return text, count
+}
+
+// RedactRequest returns a copy of the request with PII scrubbed from its
+// text fields and text attachments, along with the number of redactions.
+// Binary attachments are left as they are. The original is not modified.
+func RedactRequest(req *ai.GenerationRequest) (*ai.GenerationRequest, int) {
+	patterns := piiPatterns()
+	redacted := *req
+	total := 0
+	redact := func(s string) string {
+		out, n := redactWith(patterns, s)
+		total += n
+		return out
+	}
+
+	redacted.Subject = redact(req.Subject)
+	redacted.Course = redact(req.Course)
+	redacted.Description = redact(req.Description)
+	redacted.Curriculum = redact(req.Curriculum)
+	redacted.SpecialInstructions = redact(req.SpecialInstructions)
+	redacted.WebSearchQuery = redact(req.WebSearchQuery)
+
+	redacted.Tags = make([]string, len(req.Tags))
+	for i, tag := range req.Tags {
+		redacted.Tags[i] = redact(tag)
+	}
+
+	redacted.Attachments = make([]ai.Attachment, len(req.Attachments))
+	for i, att := range req.Attachments {
+		if att.Encoding != "base64" && att.Content != "" {
+			att.Content = redact(att.Content)
+			att.Size = int64(len(att.Content))
+			att.Hash = ""
+		}
+		redacted.Attachments[i] = att
+	}
+
+	return &redacted, total
+}
+
+// PrepareRequestForStorage redacts the request when REDACT_PII is enabled.
+// It returns the copy to persist and the number of redactions. When
+// redaction is off, the request is returned unchanged.
+func PrepareRequestForStorage(req *ai.GenerationRequest) (*ai.GenerationRequest, int) {
+	if !redactionEnabled() {
+		return req, 0
+	}
+	return RedactRequest(req)
+}
+
+// HoldRequest keeps the unredacted request for a job in memory so the
+// pipeline generates from the real content while only the redacted copy is
+// stored. It is dropped once the job finishes; after a restart the job
+// continues from the redacted copy.
+func (q *Queue) HoldRequest(jobID uuid.UUID, req *ai.GenerationRequest) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.heldRequests[jobID] = req
+}
+
+// heldRequest returns a copy of the in-memory request for a job, if any
+func (q *Queue) heldRequest(jobID uuid.UUID) (*ai.GenerationRequest, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	req, ok := q.heldRequests[jobID]
+	if !ok {
+		return nil, false
+	}
+	clone := *req
+	clone.Tags = append([]string(nil), req.Tags...)
+	clone.Attachments = append([]ai.Attachment(nil), req.Attachments...)
+	return &clone, true
+}
+
+// releaseRequest drops the held request once a job can't run again
+func (q *Queue) releaseRequest(job *Job) {
+	if !job.Status.IsTerminal() {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.heldRequests, job.ID)
+}
@@ -0,0 +1,141 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"nadhi.dev/sarvar/fun/ai"
+)
+
+// DefaultRelatedLimit is how many related jobs are returned by default
+const DefaultRelatedLimit = 5
+
+// Overlap weights: a shared subject or course says more than a single tag
+const (
+	relatedSubjectWeight  = 3
+	relatedCourseWeight   = 2
+	relatedTagWeight      = 1
+	relatedNotebookWeight = 2
+)
+
+// RelatedJob is a completed job that shares material with another job
+type RelatedJob struct {
+	JobID           string     `json:"jobId"`
+	Subject         string     `json:"subject"`
+	Course          string     `json:"course"`
+	Tags            []string   `json:"tags"`
+	SharedTags      []string   `json:"sharedTags"`
+	SameSubject     bool       `json:"sameSubject"`
+	SameCourse      bool       `json:"sameCourse"`
+	SharedNotebooks []string   `json:"sharedNotebooks,omitempty"`
+	Score           int        `json:"score"`
+	PDFURL          string     `json:"pdfUrl"`
+	ThumbnailURL    string     `json:"thumbnailUrl,omitempty"`
+	CompletedAt     *time.Time `json:"completedAt,omitempty"`
+}
+
+// RelatedJobs ranks the owner's other completed jobs by how much they
+// overlap with target: same subject, same course, shared tags, and, when
+// notebooks is given, sharing a notebook. notebooks maps a PDF file name
+// to the notebooks it has been saved in. Jobs with no overlap are left
+// out; ties go to the most recently completed.
+func (s *Store) RelatedJobs(target *Job, notebooks map[string][]string, limit int) ([]RelatedJob, error) {
+	if limit < 1 {
+		limit = DefaultRelatedLimit
+	}
+
+	jobs, err := s.GetJobsByUser(target.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	want := relatedRequest(target)
+	wantTags := make(map[string]bool, len(want.Tags))
+	for _, tag := range want.Tags {
+		wantTags[normalizeRelated(tag)] = true
+	}
+	wantNotebooks := make(map[string]bool)
+	for _, name := range notebooks[path.Base(target.PDFURL)] {
+		wantNotebooks[name] = true
+	}
+
+	related := make([]RelatedJob, 0)
+	for _, job := range jobs {
+		if job.ID == target.ID || job.Status != StatusCompleted || job.PDFURL == "" {
+			continue
+		}
+
+		req := relatedRequest(job)
+		r := RelatedJob{
+			JobID:        job.ID.String(),
+			Subject:      req.Subject,
+			Course:       req.Course,
+			Tags:         req.Tags,
+			SharedTags:   []string{},
+			PDFURL:       job.PDFURL,
+			ThumbnailURL: job.ThumbnailURL(),
+			CompletedAt:  job.CompletedAt,
+		}
+
+		if subject := normalizeRelated(req.Subject); subject != "" && subject == normalizeRelated(want.Subject) {
+			r.SameSubject = true
+			r.Score += relatedSubjectWeight
+		}
+		if course := normalizeRelated(req.Course); course != "" && course == normalizeRelated(want.Course) {
+			r.SameCourse = true
+			r.Score += relatedCourseWeight
+		}
+		for _, tag := range req.Tags {
+			if wantTags[normalizeRelated(tag)] {
+				r.SharedTags = append(r.SharedTags, tag)
+				r.Score += relatedTagWeight
+			}
+		}
+		for _, name := range notebooks[path.Base(job.PDFURL)] {
+			if wantNotebooks[name] {
+				r.SharedNotebooks = append(r.SharedNotebooks, name)
+				r.Score += relatedNotebookWeight
+			}
+		}
+
+		if r.Score > 0 {
+			related = append(related, r)
+		}
+	}
+
+	sort.Slice(related, func(i, j int) bool {
+		if related[i].Score != related[j].Score {
+			return related[i].Score > related[j].Score
+		}
+		return completedAfter(related[i].CompletedAt, related[j].CompletedAt)
+	})
+
+	if len(related) > limit {
+		related = related[:limit]
+	}
+	return related, nil
+}
+
+// relatedRequest decodes the generation request a job was created from.
+// Jobs whose prompt isn't a request simply have nothing to compare.
+func relatedRequest(job *Job) ai.GenerationRequest {
+	var req ai.GenerationRequest
+	_ = json.Unmarshal([]byte(job.Prompt), &req)
+	return req
+}
+
+// normalizeRelated makes subject, course and tag comparison case-insensitive
+func normalizeRelated(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// completedAfter orders nil completion times last
+func completedAfter(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a != nil
+	}
+	return a.After(*b)
+}
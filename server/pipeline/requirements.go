@@ -0,0 +1,78 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/ai"
+)
+
+// RequirementResult is one mode requirement checked against generated LaTeX
+type RequirementResult struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Passed  bool   `json:"passed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// RequirementsCheck records which of a mode's structural requirements the
+// kept LaTeX met
+type RequirementsCheck struct {
+	Mode        string              `json:"mode"`
+	Passed      bool                `json:"passed"`
+	Checks      []RequirementResult `json:"checks"`
+	Regenerated bool                `json:"regenerated"`
+}
+
+// Missing returns the names of the requirements that failed
+func (r RequirementsCheck) Missing() []string {
+	var missing []string
+	for _, check := range r.Checks {
+		if !check.Passed {
+			missing = append(missing, check.Name)
+		}
+	}
+	return missing
+}
+
+// checkModeRequirements matches latexSrc against the mode's requirements in
+// the registry. A pattern that no longer compiles is skipped rather than
+// failing every job in the mode.
+func checkModeRequirements(mode, latexSrc string) RequirementsCheck {
+	result := RequirementsCheck{Mode: mode, Passed: true}
+	for _, req := range ai.GetModeRequirements(mode) {
+		check := RequirementResult{Name: req.Name, Pattern: req.Pattern, Passed: true}
+		re, err := regexp.Compile(req.Pattern)
+		if err != nil {
+			check.Error = err.Error()
+		} else if !re.MatchString(latexSrc) {
+			check.Passed = false
+			result.Passed = false
+		}
+		result.Checks = append(result.Checks, check)
+	}
+	return result
+}
+
+// requirementsFeedback is appended to the design when regenerating LaTeX
+// that is missing required elements
+func requirementsFeedback(result RequirementsCheck) string {
+	var b strings.Builder
+	b.WriteString("\n\nIMPORTANT: A previous attempt was missing elements this document must contain:\n")
+	for _, check := range result.Checks {
+		if !check.Passed {
+			b.WriteString(fmt.Sprintf("- %s (the LaTeX must match the pattern %s)\n", check.Name, check.Pattern))
+		}
+	}
+	b.WriteString("Include every one of them.")
+	return b.String()
+}
+
+// setRequirementsCheck stores the requirements check result on the job
+func (j *Job) setRequirementsCheck(result RequirementsCheck) {
+	if j.Metadata == nil {
+		j.Metadata = make(map[string]interface{})
+	}
+	j.Metadata["modeRequirements"] = result
+}
@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"context"
+
+	"nadhi.dev/sarvar/fun/ai"
+	"nadhi.dev/sarvar/fun/config"
+)
+
+// Model routes recorded in a job's modelRoute metadata
+const (
+	// RouteUtility runs every step on the utility model
+	RouteUtility = "utility"
+	// RouteDefault keeps the utility model for design and the main model for LaTeX
+	RouteDefault = "default"
+	// RouteMain runs every step on the main model
+	RouteMain = "main"
+)
+
+// requestSize is the size of a request in bytes: the user-written fields
+// plus every attachment
+func requestSize(req *ai.GenerationRequest) int {
+	size := len(requestBrief(req))
+	for _, att := range req.Attachments {
+		if att.Size > 0 {
+			size += int(att.Size)
+		} else {
+			size += len(att.Content)
+		}
+	}
+	return size
+}
+
+// chooseModelRoute picks a route by request size. Requests smaller than
+// MODEL_ROUTING_SMALL_BYTES go to the utility model and ones larger than
+// MODEL_ROUTING_LARGE_BYTES to the main model; 0 turns either bound off.
+func chooseModelRoute(size int) string {
+	if small := config.GetConfigInt("MODEL_ROUTING_SMALL_BYTES", 0); small > 0 && size < small {
+		return RouteUtility
+	}
+	if large := config.GetConfigInt("MODEL_ROUTING_LARGE_BYTES", 0); large > 0 && size > large {
+		return RouteMain
+	}
+	return RouteDefault
+}
+
+// modelRoute returns the job's model route, deciding it on first use and
+// recording it in metadata so retries and later steps stay on the same models
+func (q *Queue) modelRoute(job *Job, request *ai.GenerationRequest) string {
+	if m, ok := job.Metadata["modelRoute"].(map[string]interface{}); ok {
+		if route, ok := m["route"].(string); ok && route != "" {
+			return route
+		}
+	}
+
+	size := requestSize(request)
+	route := chooseModelRoute(size)
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]interface{})
+	}
+	job.Metadata["modelRoute"] = map[string]interface{}{
+		"route":        route,
+		"requestBytes": size,
+	}
+	if route != RouteDefault {
+		q.logger.Printf("Routing job %s (%d bytes) to the %s model", job.ID, size, route)
+	}
+	return route
+}
+
+// routedContext applies a model route to the AI calls of one step. Only the
+// step that would otherwise use the other model is overridden.
+func routedContext(ctx context.Context, route string, step PipelineStep) context.Context {
+	switch {
+	case route == RouteUtility && step == StepLatex:
+		return ai.WithTaskType(ctx, ai.TaskUtility)
+	case route == RouteMain && step == StepDesign:
+		return ai.WithTaskType(ctx, ai.TaskLaTeXGeneration)
+	default:
+		return ctx
+	}
+}
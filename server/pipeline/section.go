@@ -0,0 +1,219 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"nadhi.dev/sarvar/fun/ai"
+)
+
+var (
+	// ErrSectionNotFound is returned when no \section matches the identifier
+	ErrSectionNotFound = errors.New("section not found")
+	// ErrNotCompleted is returned when a job has no compiled LaTeX to edit
+	ErrNotCompleted = errors.New("job must be completed before a section can be regenerated")
+)
+
+// sectionStartPattern matches the start of a \section or \section* command, up
+// to the opening brace of its title
+var sectionStartPattern = regexp.MustCompile(`\\section\*?\s*(?:\[[^\]]*\])?\s*\{`)
+
+// LatexSection is one top-level \section of a document. Start and End are
+// byte offsets: the section runs from its \section command to the next
+// \section or \end{document}.
+type LatexSection struct {
+	Index int    `json:"index"`
+	Title string `json:"title"`
+	Start int    `json:"-"`
+	End   int    `json:"-"`
+}
+
+// SectionResult is the outcome of regenerating one section
+type SectionResult struct {
+	Section LatexSection `json:"section"`
+	Job     *Job         `json:"job"`
+}
+
+// LatexSections lists the \section commands in the document body, numbered
+// from 1. Commented-out sections are skipped.
+func LatexSections(latex string) []LatexSection {
+	bodyStart := strings.Index(latex, `\begin{document}`)
+	if bodyStart < 0 {
+		bodyStart = 0
+	}
+	bodyEnd := strings.LastIndex(latex, `\end{document}`)
+	if bodyEnd < bodyStart {
+		bodyEnd = len(latex)
+	}
+
+	var sections []LatexSection
+	for _, m := range sectionStartPattern.FindAllStringIndex(latex[bodyStart:bodyEnd], -1) {
+		start := bodyStart + m[0]
+		lineStart := strings.LastIndex(latex[:start], "\n") + 1
+		if strings.Contains(latex[lineStart:start], "%") {
+			continue
+		}
+		sections = append(sections, LatexSection{
+			Index: len(sections) + 1,
+			Title: braceContent(latex[bodyStart+m[1]:]),
+			Start: start,
+		})
+	}
+	for i := range sections {
+		if i+1 < len(sections) {
+			sections[i].End = sections[i+1].Start
+		} else {
+			sections[i].End = bodyEnd
+		}
+	}
+	return sections
+}
+
+// braceContent returns the text up to the brace closing one already opened
+func braceContent(s string) string {
+	depth := 1
+	for i, r := range s {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return strings.TrimSpace(s[:i])
+			}
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
+// FindSection picks a section by its 1-based number or, failing that, by
+// title (case-insensitive)
+func FindSection(latex, id string) (LatexSection, error) {
+	id = strings.TrimSpace(id)
+	sections := LatexSections(latex)
+	if n, err := strconv.Atoi(id); err == nil {
+		if n >= 1 && n <= len(sections) {
+			return sections[n-1], nil
+		}
+		return LatexSection{}, ErrSectionNotFound
+	}
+	for _, s := range sections {
+		if strings.EqualFold(s.Title, id) {
+			return s, nil
+		}
+	}
+	return LatexSection{}, ErrSectionNotFound
+}
+
+// RegenerateSection asks the model to rewrite one section following the
+// instruction and returns the document with the replacement spliced in.
+// The rest of the document is sent for context only and kept as it was.
+func RegenerateSection(ctx context.Context, conv *Conversation, latex string, section LatexSection, instruction string) (string, error) {
+	prompt := fmt.Sprintf(`Rewrite one section of the LaTeX document below.
+
+Instruction:
+%s
+
+Full document (for context only; do not change anything outside the section):
+%s
+
+Section to rewrite (between the markers):
+<<<SECTION
+%s
+SECTION>>>
+
+Rules:
+- Output ONLY the replacement section, starting with its \section command
+- Do not output the preamble, \begin{document} or \end{document}
+- Keep using only commands and packages the document already loads
+- Close every environment you open
+- Do not include markdown code blocks`, instruction, latex, strings.TrimSpace(latex[section.Start:section.End]))
+
+	conv.AddMessage("user", prompt)
+
+	result, err := ai.Generate(ctx, ai.TaskLaTeXGeneration, buildMessages(ctx, ai.TaskLaTeXGeneration, conv, prompt))
+	if err != nil {
+		return "", fmt.Errorf("section regeneration failed: %w", err)
+	}
+
+	replacement := postProcessLatex(result)
+	replacement = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(replacement, "<<<SECTION"), "SECTION>>>"))
+	if !sectionStartPattern.MatchString(replacement) {
+		return "", fmt.Errorf("section regeneration failed: response has no \\section")
+	}
+	if strings.Contains(replacement, `\documentclass`) || strings.Contains(replacement, `\end{document}`) {
+		return "", fmt.Errorf("section regeneration failed: response is a whole document, not a section")
+	}
+
+	conv.AddMessage("assistant", replacement)
+
+	return latex[:section.Start] + replacement + "\n\n" + latex[section.End:], nil
+}
+
+// RegenerateSection rewrites one section of a completed job's LaTeX and
+// compiles the result. If generation or compilation fails the job is left
+// as it was, previous PDF included.
+func (q *Queue) RegenerateSection(ctx context.Context, jobID uuid.UUID, sectionID, instruction string) (*SectionResult, error) {
+	job, commit, err := q.store.GetJobForUpdate(jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := commit(); err != nil {
+			q.logger.Printf("Failed to commit job %s: %v", jobID, err)
+		}
+	}()
+
+	if job.Status != StatusCompleted || strings.TrimSpace(job.Latex) == "" {
+		return nil, ErrNotCompleted
+	}
+	section, err := FindSection(job.Latex, sectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	conv, convErr := q.store.GetConversationByJobID(job.ID)
+	if convErr != nil {
+		conv = NewConversation(job.ID)
+	}
+
+	usage := ai.NewUsageTracker()
+	latex, err := RegenerateSection(ai.WithUsageTracker(ctx, usage), conv, job.Latex, section, instruction)
+	job.AddUsage(usage)
+	if err != nil {
+		return nil, err
+	}
+	_ = q.store.SaveConversation(conv)
+
+	before := *job
+	before.Metadata = make(map[string]interface{}, len(job.Metadata))
+	for k, v := range job.Metadata {
+		before.Metadata[k] = v
+	}
+
+	// The compile step's own updates are muted so a failure doesn't report
+	// the job as errored; it is restored instead
+	job.Latex = latex
+	q.muteUpdates(jobID, true)
+	err = q.executeCompileStep(ctx, job)
+	q.muteUpdates(jobID, false)
+	if err != nil {
+		*job = before
+		return nil, fmt.Errorf("recompile failed, keeping previous version: %w", err)
+	}
+
+	job.Metadata["sectionRegeneratedAt"] = time.Now().Format(time.RFC3339)
+	q.sendUpdate(job, fmt.Sprintf("Section %d regenerated", section.Index), q.stageData("Compile", "Section regenerated", map[string]interface{}{
+		"section":       section,
+		"pdf_url":       job.PDFURL,
+		"thumbnail_url": job.ThumbnailURL(),
+	}))
+
+	return &SectionResult{Section: section, Job: job}, nil
+}
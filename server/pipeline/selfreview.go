@@ -0,0 +1,127 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/ai"
+	"nadhi.dev/sarvar/fun/config"
+)
+
+// maxSelfReviewChars caps how much LaTeX is sent for review
+const maxSelfReviewChars = 40000
+
+// selfReviewInstruction asks the utility model to judge generated LaTeX
+// against the request. Only gross mismatches should fail.
+const selfReviewInstruction = `Review the LaTeX worksheet below against the request it was written for.
+
+Request:
+%s
+
+Fail the document ONLY for serious problems a teacher would reject it for:
+- It covers the wrong subject or topic
+- It ignores the requested mode (e.g. notes instead of a test)
+- A required answer key is missing
+- It ignores explicit special instructions or the requested language
+- Large parts are empty, repeated or unfinished
+
+Do not fail it for style, wording or minor omissions.
+
+Respond with a single JSON object and nothing else:
+{"pass": true or false, "issues": ["short description of each problem"]}
+
+LaTeX:
+%s`
+
+// SelfReview is the model's verdict on its own LaTeX. Issues are those
+// found in the first attempt; Regenerated is set when they triggered a
+// second one. A review that couldn't be run or parsed passes with Error set.
+type SelfReview struct {
+	Passed      bool     `json:"passed"`
+	Issues      []string `json:"issues,omitempty"`
+	Regenerated bool     `json:"regenerated"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// wantsSelfReview reports whether the request, or SELF_REVIEW for every
+// job, asks for a self-review
+func wantsSelfReview(req *ai.GenerationRequest) bool {
+	return req.SelfReview || config.GetConfigBool("SELF_REVIEW", false)
+}
+
+// ReviewLatex asks the utility model whether latexSrc meets the request
+func ReviewLatex(ctx context.Context, request *ai.GenerationRequest, latexSrc string) SelfReview {
+	if len(latexSrc) > maxSelfReviewChars {
+		latexSrc = latexSrc[:maxSelfReviewChars] + "\n% ... (truncated for review)"
+	}
+	brief := requestBrief(request)
+	if wantsSplitAnswerKey(request) {
+		brief += "\nAnswer Key: required"
+	}
+
+	result, err := ai.Generate(ctx, ai.TaskUtility, []ai.Message{
+		{Role: "system", Content: "You are a strict but fair reviewer of educational worksheets."},
+		{Role: "user", Content: fmt.Sprintf(selfReviewInstruction, brief, latexSrc)},
+	})
+	if err != nil {
+		return SelfReview{Passed: true, Error: fmt.Sprintf("self-review failed: %v", err)}
+	}
+
+	review, err := parseSelfReview(result)
+	if err != nil {
+		return SelfReview{Passed: true, Error: err.Error()}
+	}
+	return review
+}
+
+// parseSelfReview decodes the verdict from raw model output
+func parseSelfReview(raw string) (SelfReview, error) {
+	start := strings.Index(raw, "{")
+	end := strings.LastIndex(raw, "}")
+	if start < 0 || end <= start {
+		return SelfReview{}, fmt.Errorf("no JSON object found in self-review output")
+	}
+
+	var verdict struct {
+		Pass   *bool    `json:"pass"`
+		Issues []string `json:"issues"`
+	}
+	if err := json.Unmarshal([]byte(raw[start:end+1]), &verdict); err != nil {
+		return SelfReview{}, fmt.Errorf("invalid self-review JSON: %w", err)
+	}
+	if verdict.Pass == nil {
+		return SelfReview{}, fmt.Errorf("self-review output has no verdict")
+	}
+
+	review := SelfReview{Passed: *verdict.Pass}
+	for _, issue := range verdict.Issues {
+		if issue = strings.TrimSpace(issue); issue != "" {
+			review.Issues = append(review.Issues, issue)
+		}
+	}
+	return review, nil
+}
+
+// selfReviewCritique is appended to the design when regenerating LaTeX that
+// failed self-review
+func selfReviewCritique(review SelfReview) string {
+	var b strings.Builder
+	b.WriteString("\n\nIMPORTANT: A review of a previous attempt found these problems. Fix all of them:\n")
+	for _, issue := range review.Issues {
+		b.WriteString("- " + issue + "\n")
+	}
+	if len(review.Issues) == 0 {
+		b.WriteString("- The document did not match the request\n")
+	}
+	return b.String()
+}
+
+// setSelfReview stores the self-review result on the job
+func (j *Job) setSelfReview(review SelfReview) {
+	if j.Metadata == nil {
+		j.Metadata = make(map[string]interface{})
+	}
+	j.Metadata["selfReview"] = review
+}
@@ -0,0 +1,27 @@
+package pipeline
+
+import "github.com/google/uuid"
+
+// nextUpdateSeqLocked returns the sequence number for a job's next status
+// update. Numbers start at 1 and increase by one per update for as long as
+// the server runs. Callers hold q.mu.
+func (q *Queue) nextUpdateSeqLocked(jobID uuid.UUID) uint64 {
+	q.updateSeq[jobID]++
+	return q.updateSeq[jobID]
+}
+
+// LastUpdateSeq returns the sequence number of the job's latest status
+// update, or 0 if it hasn't sent one since the server started. A client
+// that reads the job's state can drop updates at or below it.
+func (q *Queue) LastUpdateSeq(jobID uuid.UUID) uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.updateSeq[jobID]
+}
+
+// forgetUpdateSeq drops a deleted job's counter
+func (q *Queue) forgetUpdateSeq(jobID uuid.UUID) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.updateSeq, jobID)
+}
@@ -0,0 +1,94 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/ai"
+	"nadhi.dev/sarvar/fun/config"
+)
+
+// DefaultMinRequestSignalWords is how many words the description and special
+// instructions need between them, when there are no attachments, before
+// the design step runs; 0 disables the check
+const DefaultMinRequestSignalWords = 3
+
+// requestSignalWords counts the words describing what the sheet should cover
+func requestSignalWords(req *ai.GenerationRequest) int {
+	return len(strings.Fields(req.Description)) + len(strings.Fields(req.SpecialInstructions))
+}
+
+// hasEnoughSignal reports whether a request says enough to design a sheet
+// from: attachments, or at least MIN_REQUEST_SIGNAL_WORDS words of
+// description and special instructions
+func hasEnoughSignal(req *ai.GenerationRequest) bool {
+	min := config.GetConfigInt("MIN_REQUEST_SIGNAL_WORDS", DefaultMinRequestSignalWords)
+	return min <= 0 || len(req.Attachments) > 0 || requestSignalWords(req) >= min
+}
+
+// parkUnderspecified stops a job whose request is too vague to design from
+// and asks the user for more detail. Auto-approved jobs have no one to ask,
+// so they fail with the same message, which is returned as the error.
+func (q *Queue) parkUnderspecified(job *Job, req *ai.GenerationRequest) error {
+	msg := "The request needs more detail: describe what the sheet should cover, or attach material to work from"
+	if job.IsAutoApprove() {
+		job.SetError(msg, nil)
+		q.sendUpdate(job, "Design generation failed", q.errorData(msg))
+		return errors.New(msg)
+	}
+	job.SetWaitingManual(msg)
+	q.sendUpdate(job, msg, q.stageData("Design", "Needs more detail", map[string]interface{}{
+		"needsDetails": true,
+		"words":        requestSignalWords(req),
+		"minWords":     config.GetConfigInt("MIN_REQUEST_SIGNAL_WORDS", DefaultMinRequestSignalWords),
+	}))
+	return nil
+}
+
+// AddRequestDetails appends details to the description of a job's request,
+// in the stored copy and any held one, and sends the job back to the design
+// step. The caller saves and enqueues the job.
+func (q *Queue) AddRequestDetails(job *Job, details string) error {
+	details = strings.TrimSpace(details)
+	if details == "" {
+		return fmt.Errorf("details required")
+	}
+
+	var stored ai.GenerationRequest
+	if err := json.Unmarshal([]byte(job.Prompt), &stored); err != nil {
+		return fmt.Errorf("invalid stored request: %w", err)
+	}
+	storedDetails := details
+	if redactionEnabled() {
+		storedDetails, _ = RedactPII(details)
+	}
+	stored.Description = appendDetails(stored.Description, storedDetails)
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	if held, ok := q.heldRequests[job.ID]; ok {
+		held.Description = appendDetails(held.Description, details)
+	}
+	q.mu.Unlock()
+
+	job.Prompt = string(data)
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]interface{})
+	}
+	job.Metadata["request"] = &stored
+	job.ResetToStep(StepDesign)
+	return nil
+}
+
+// appendDetails adds details to the end of a description
+func appendDetails(description, details string) string {
+	if strings.TrimSpace(description) == "" {
+		return details
+	}
+	return strings.TrimRight(description, " \t\n") + "\n\n" + details
+}
@@ -0,0 +1,60 @@
+package pipeline
+
+import "time"
+
+// QueueStats is a snapshot of the queue for operators
+type QueueStats struct {
+	Queued   int            `json:"queued"`
+	Running  int            `json:"running"`
+	Deferred int            `json:"deferred"`
+	Active   map[string]int `json:"activeByUser"`
+	Stuck    StuckJobStats  `json:"stuck"`
+
+	// Recompile is the latest bulk recompile batch, if any has run
+	Recompile *RecompileStats `json:"recompile,omitempty"`
+}
+
+// StuckJobStats counts jobs caught by the heartbeat monitor
+type StuckJobStats struct {
+	// Current is how many running jobs are flagged and still winding down
+	Current   int    `json:"current"`
+	Detected  int    `json:"detected"`
+	Requeued  int    `json:"requeued"`
+	Failed    int    `json:"failed"`
+	Threshold string `json:"threshold"`
+	Enabled   bool   `json:"enabled"`
+}
+
+// Stats returns the queue's current counts. Stuck totals are counted since
+// the process started.
+func (q *Queue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := QueueStats{
+		Queued:   len(q.jobs),
+		Running:  len(q.running),
+		Deferred: len(q.deferred),
+		Active:   make(map[string]int, len(q.active)),
+		Stuck: StuckJobStats{
+			Detected:  q.stuckDetected,
+			Requeued:  q.stuckRequeued,
+			Failed:    q.stuckFailed,
+			Threshold: q.stuckAfter.Round(time.Second).String(),
+			Enabled:   q.stuckAfter > 0,
+		},
+	}
+	if q.recompile != nil {
+		recompile := *q.recompile
+		stats.Recompile = &recompile
+	}
+	for user, n := range q.active {
+		stats.Active[user] = n
+	}
+	for _, r := range q.running {
+		if r.stuck {
+			stats.Stuck.Current++
+		}
+	}
+	return stats
+}
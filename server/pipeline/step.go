@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"nadhi.dev/sarvar/fun/ai"
+)
+
+var (
+	// ErrJobRunning is returned when a job being stepped is already processing
+	ErrJobRunning = errors.New("job is currently running")
+	// ErrJobDone is returned when a job has no steps left to run
+	ErrJobDone = errors.New("job has no remaining steps")
+)
+
+// StepResult is the outcome of running a single step in debug mode
+type StepResult struct {
+	Step     PipelineStep `json:"step"`
+	NextStep PipelineStep `json:"nextStep"`
+	Job      *Job         `json:"job"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// ExecuteStep runs exactly the job's current step and stops, without
+// enqueueing the job or advancing through the rest of the pipeline. It is
+// a troubleshooting aid: a job that errored or is waiting for review has its
+// current step re-run. A step that fails is reported in the result rather
+// than as an error, since inspecting the failure is the point.
+func (q *Queue) ExecuteStep(ctx context.Context, jobID uuid.UUID) (*StepResult, error) {
+	// Check before locking: a running job holds the store lock until it finishes
+	if job, err := q.store.GetJob(jobID); err != nil {
+		return nil, err
+	} else if job.Status == StatusRunning {
+		return nil, ErrJobRunning
+	}
+
+	job, commit, err := q.store.GetJobForUpdate(jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock job: %w", err)
+	}
+	defer func() {
+		if err := commit(); err != nil {
+			q.logger.Printf("Failed to commit job %s: %v", jobID, err)
+		}
+	}()
+
+	if job.Status == StatusRunning {
+		return nil, ErrJobRunning
+	}
+	if job.CurrentStep == StepDone {
+		return nil, ErrJobDone
+	}
+
+	usage := ai.NewUsageTracker()
+	ctx = ai.WithUsageTracker(ctx, usage)
+
+	step := job.CurrentStep
+	job.ResetToStep(step)
+	job.Status = StatusRunning
+	q.logger.Printf("Debug: running step %s of job %s", step, jobID)
+
+	result := &StepResult{Step: step, Job: job}
+	if err := q.runStep(ctx, job); err != nil {
+		result.Error = err.Error()
+	}
+	job.AddUsage(usage)
+	q.fileInNotebook(job)
+
+	// A step that advanced leaves the job pending; it stays parked there
+	// until it is stepped again or retried
+	result.NextStep = job.CurrentStep
+	return result, nil
+}
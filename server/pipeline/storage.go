@@ -0,0 +1,254 @@
+package pipeline
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultStorageQuotaMB is the per-user artifact quota; 0 means unlimited
+const DefaultStorageQuotaMB = 0
+
+// StorageUsage reports how much disk a user's job artifacts take up
+type StorageUsage struct {
+	UsedBytes   int64 `json:"usedBytes"`
+	QuotaBytes  int64 `json:"quotaBytes"`
+	Jobs        int   `json:"jobs"`
+	EvictedJobs int   `json:"evictedJobs"`
+	OverQuota   bool  `json:"overQuota"`
+	Unlimited   bool  `json:"unlimited"`
+	// MaxJobs is the stored job cap Jobs counts against; 0 means unlimited
+	MaxJobs   int    `json:"maxJobs"`
+	JobPolicy string `json:"jobPolicy,omitempty"`
+}
+
+// SetStorageQuotaMB sets how much disk a single user's PDFs and generated
+// sources may use. Once exceeded, the oldest completed jobs have their
+// artifacts evicted. Values below 1 disable the quota.
+func (q *Queue) SetStorageQuotaMB(mb int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if mb < 0 {
+		mb = 0
+	}
+	q.storageQuota = int64(mb) * 1024 * 1024
+}
+
+// StorageQuota returns the per-user quota in bytes, or 0 when unlimited
+func (q *Queue) StorageQuota() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.storageQuota
+}
+
+// jobArtifactPaths lists the files and directories a job may have written:
+// the PDF (or student/key pair) and thumbnail in the bucket and its
+// generated sources
+func jobArtifactPaths(jobID uuid.UUID) []string {
+	id := jobID.String()
+	bucket := filepath.Join("./storage", "bucket")
+	return []string{
+		filepath.Join(bucket, id+".pdf"),
+		filepath.Join(bucket, id+"-student.pdf"),
+		filepath.Join(bucket, id+"-key.pdf"),
+		filepath.Join(bucket, id+"-thumb.png"),
+		filepath.Join("./generated", id),
+	}
+}
+
+// JobStorageBytes returns the on-disk size of a job's artifacts
+func JobStorageBytes(jobID uuid.UUID) int64 {
+	var total int64
+	for _, path := range jobArtifactPaths(jobID) {
+		_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+			return nil
+		})
+	}
+	return total
+}
+
+// userJobs returns every job the user owns, archived ones included, and
+// which of them are archived. Archived jobs still have artifacts on disk, so
+// they count toward the storage quota and the stored job cap.
+func (q *Queue) userJobs(userID string) ([]*Job, map[uuid.UUID]bool, error) {
+	jobs, err := q.store.GetJobsByUser(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	archived, err := q.store.GetArchivedJobsByUser(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	isArchived := make(map[uuid.UUID]bool, len(archived))
+	for _, job := range archived {
+		isArchived[job.ID] = true
+	}
+	return append(jobs, archived...), isArchived, nil
+}
+
+// UserStorageUsage totals the artifact sizes of every job the user owns,
+// archived jobs included
+func (q *Queue) UserStorageUsage(userID string) (StorageUsage, error) {
+	jobs, _, err := q.userJobs(userID)
+	if err != nil {
+		return StorageUsage{}, err
+	}
+
+	usage := StorageUsage{QuotaBytes: q.StorageQuota()}
+	usage.Unlimited = usage.QuotaBytes == 0
+	usage.MaxJobs, usage.JobPolicy = q.StoredJobLimit()
+	if usage.MaxJobs == 0 {
+		usage.JobPolicy = ""
+	}
+
+	for _, job := range jobs {
+		usage.Jobs++
+		if artifactsEvicted(job) {
+			usage.EvictedJobs++
+			continue
+		}
+		usage.UsedBytes += JobStorageBytes(job.ID)
+	}
+	usage.OverQuota = !usage.Unlimited && usage.UsedBytes > usage.QuotaBytes
+
+	return usage, nil
+}
+
+// artifactsEvicted reports whether the job's files were removed by the quota
+func artifactsEvicted(job *Job) bool {
+	if job.Metadata == nil {
+		return false
+	}
+	evicted, _ := job.Metadata["artifactsEvicted"].(bool)
+	return evicted
+}
+
+// EnforceStorageQuota evicts artifacts of the user's oldest completed jobs
+// until they are back under quota. Used after jobs are added outside the
+// queue, such as by a library import.
+func (q *Queue) EnforceStorageQuota(userID string) {
+	q.enforceStorageQuota(userID, uuid.Nil)
+}
+
+// enforceStorageQuota evicts the artifacts of the user's oldest completed
+// jobs until they are back under quota. The job record itself is kept so
+// history, prompts and LaTeX stay available. keep is never evicted, so the
+// job that just finished always has its PDF. Must not be called while the
+// store lock is held.
+func (q *Queue) enforceStorageQuota(userID string, keep uuid.UUID) {
+	quota := q.StorageQuota()
+	if quota == 0 || userID == "" {
+		return
+	}
+
+	jobs, archived, err := q.userJobs(userID)
+	if err != nil {
+		q.logger.Printf("Storage quota: failed to load jobs for %s: %v", userID, err)
+		return
+	}
+
+	var used int64
+	var candidates []*Job
+	for _, job := range jobs {
+		if artifactsEvicted(job) {
+			continue
+		}
+		used += JobStorageBytes(job.ID)
+		if job.Status == StatusCompleted && job.ID != keep {
+			candidates = append(candidates, job)
+		}
+	}
+	if used <= quota {
+		return
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return completedTime(candidates[i]).Before(completedTime(candidates[j]))
+	})
+
+	for _, candidate := range candidates {
+		if used <= quota {
+			break
+		}
+		evict := q.evictJobArtifacts
+		if archived[candidate.ID] {
+			evict = q.evictArchivedJobArtifacts
+		}
+		freed, err := evict(candidate.ID)
+		if err != nil {
+			q.logger.Printf("Storage quota: failed to evict job %s: %v", candidate.ID, err)
+			continue
+		}
+		used -= freed
+		q.logger.Printf("Storage quota: evicted artifacts of job %s for %s (%d bytes freed)", candidate.ID, userID, freed)
+	}
+
+	if used > quota {
+		q.logger.Printf("Storage quota: %s still uses %d of %d bytes after eviction", userID, used, quota)
+	}
+}
+
+// completedTime orders jobs for eviction, falling back to creation time
+func completedTime(job *Job) time.Time {
+	if job.CompletedAt != nil {
+		return *job.CompletedAt
+	}
+	return job.CreatedAt
+}
+
+// evictJobArtifacts deletes a job's PDFs and generated sources and marks the
+// job so clients know the download is gone. It returns the bytes freed.
+func (q *Queue) evictJobArtifacts(jobID uuid.UUID) (int64, error) {
+	job, commit, rollback, err := q.store.lockJobForUpdate(jobID, true)
+	if err != nil {
+		return 0, err
+	}
+
+	freed := JobStorageBytes(jobID)
+	for _, path := range jobArtifactPaths(jobID) {
+		if err := os.RemoveAll(path); err != nil {
+			rollback()
+			return 0, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+
+	markArtifactsEvicted(job)
+
+	return freed, commit()
+}
+
+// evictArchivedJobArtifacts is evictJobArtifacts for an archived job, whose
+// record lives in its archive file rather than the jobs file
+func (q *Queue) evictArchivedJobArtifacts(jobID uuid.UUID) (int64, error) {
+	freed := JobStorageBytes(jobID)
+	for _, path := range jobArtifactPaths(jobID) {
+		if err := os.RemoveAll(path); err != nil {
+			return 0, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	return freed, q.store.UpdateArchivedJob(jobID, markArtifactsEvicted)
+}
+
+// markArtifactsEvicted records on a job that its downloads are gone
+func markArtifactsEvicted(job *Job) {
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]interface{})
+	}
+	job.Metadata["artifactsEvicted"] = true
+	job.Metadata["artifactsEvictedAt"] = time.Now().Format(time.RFC3339)
+	delete(job.Metadata, "studentPdfUrl")
+	delete(job.Metadata, "keyPdfUrl")
+	delete(job.Metadata, "thumbnailUrl")
+	job.PDFURL = ""
+}
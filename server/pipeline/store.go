@@ -2,50 +2,213 @@ package pipeline
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
+	"syscall"
 
 	"github.com/google/uuid"
 )
 
-// Store provides thread-safe persistence for jobs and conversations
+// ErrJobBusy is returned by SaveJob when the job is held by GetJobForUpdate,
+// e.g. while a worker is processing it
+var ErrJobBusy = errors.New("job is being processed; try again when it finishes")
+
+// ErrStaleJob is returned by SaveJob when the job was saved by someone else
+// after the caller read it
+var ErrStaleJob = errors.New("job was modified since it was read; reload and try again")
+
+// Store provides thread-safe persistence for jobs and conversations.
+//
+// Locking contract:
+//   - jobsMu guards the jobs file and label index. It is only held for the
+//     length of one load or save, never across a pipeline step or AI call.
+//   - Each job also has its own lock (jobLock), held by GetJobForUpdate
+//     until commit. A worker holds it for the whole time it processes the
+//     job, so code running under it (steps, status listeners, webhooks)
+//     must not call GetJobForUpdate for the same job. SaveJob doesn't wait
+//     for it and returns ErrJobBusy instead.
+//   - Lock order is job lock, then jobsMu, then Queue.mu. Never take a job
+//     lock or jobsMu while holding Queue.mu.
+//   - Every save bumps Job.Revision, and SaveJob rejects a copy older than
+//     the stored one with ErrStaleJob, so a handler's read-modify-write
+//     can't overwrite a worker's commit.
 type Store struct {
-	jobsPath          string
-	conversationsPath string
-	jobsBackupPath    string
-	convBackupPath    string
-	jobsMu            sync.RWMutex
-	convMu            sync.RWMutex
+	jobsPath       string
+	jobsBackupPath string
+	jobsMu         sync.RWMutex
+
+	// jobLocks serialises updates to each job; see jobLock. Entries are
+	// reference-counted and removed once unused, so a lock can't be
+	// replaced while someone holds or waits for it.
+	jobLocks   map[uuid.UUID]*jobLockEntry
+	jobLocksMu sync.Mutex
+
+	// Conversations are stored one file per conversation under convDir, with
+	// an index mapping job ID to its current conversation ID
+	convDir       string
+	convIndexPath string
+	convIndex     map[string]string
+	convMu        sync.RWMutex
+
+	// repairMu serialises backup repairs, which can happen under a read lock
+	repairMu sync.Mutex
+
+	// attachmentsDir holds attachment bytes named by their SHA-256
+	attachmentsDir string
+
+	// Write-behind mode (see EnableWriteBehind): jobsData is the current
+	// jobs file contents, written to disk by the flusher when jobsDirty
+	writeBehind bool
+	jobsData    []byte
+	jobsDirty   bool
+	flushStop   chan struct{}
+	flushDone   chan struct{}
+
+	// labelIndex maps each label to the IDs of the jobs carrying it. It is
+	// rebuilt whenever the jobs are saved and guarded by jobsMu.
+	labelIndex map[string]map[string]bool
+
+	// Archival (see SetArchiveDir and StartArchiving): archived jobs live
+	// one file per job under archiveDir, outside the jobs file
+	archiveDir  string
+	archiveStop chan struct{}
+	archiveDone chan struct{}
+	// archivedOwners maps each archived job to its user, so per-user counts
+	// can include archived jobs without reading every archive file.
+	// Guarded by jobsMu.
+	archivedOwners map[uuid.UUID]string
+
+	// cache holds the parsed jobs between writes; see SetJobCache
+	cache jobCache
 }
 
 // NewStore creates a new store with the given base directory
 func NewStore(baseDir string) (*Store, error) {
 	jobsPath := filepath.Join(baseDir, "jobs.json")
-	conversationsPath := filepath.Join(baseDir, "conversations.json")
 	jobsBackupPath := filepath.Join(baseDir, "jobs.json.bak")
-	conversationsBackupPath := filepath.Join(baseDir, "conversations.json.bak")
+	convDir := filepath.Join(baseDir, "conversations")
+	attachmentsDir := filepath.Join(baseDir, "attachments")
 
-	// Ensure directory exists
-	if err := os.MkdirAll(baseDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	// Ensure directories exist
+	for _, dir := range []string{convDir, attachmentsDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create store directory: %w", err)
+		}
 	}
 
 	// Initialize files if they don't exist
 	if err := initFileIfNotExists(jobsPath, "{}"); err != nil {
 		return nil, err
 	}
-	if err := initFileIfNotExists(conversationsPath, "{}"); err != nil {
+
+	store := &Store{
+		jobsPath:       jobsPath,
+		jobsBackupPath: jobsBackupPath,
+		convDir:        convDir,
+		convIndexPath:  filepath.Join(convDir, "index.json"),
+		attachmentsDir: attachmentsDir,
+		cache:          jobCache{enabled: true},
+	}
+
+	if err := initFileIfNotExists(store.convIndexPath, "{}"); err != nil {
+		return nil, err
+	}
+
+	if err := store.CheckIntegrity(); err != nil {
+		return nil, err
+	}
+
+	if err := store.loadLabelIndex(); err != nil {
 		return nil, err
 	}
 
-	return &Store{
-		jobsPath:          jobsPath,
-		conversationsPath: conversationsPath,
-		jobsBackupPath:    jobsBackupPath,
-		convBackupPath:    conversationsBackupPath,
-	}, nil
+	if err := store.loadConversationIndex(); err != nil {
+		return nil, err
+	}
+
+	if err := store.migrateLegacyConversations(filepath.Join(baseDir, "conversations.json")); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// CheckIntegrity verifies that the jobs file and conversation index (and
+// their backups) parse. A corrupt main file is repaired from a good backup, and a
+// corrupt backup is refreshed from a good main file. It only fails when
+// neither copy of a file can be read.
+func (s *Store) CheckIntegrity() error {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	s.convMu.Lock()
+	defer s.convMu.Unlock()
+
+	var jobs map[string]*Job
+	if err := checkFilePair(s.jobsPath, s.jobsBackupPath, &jobs); err != nil {
+		return fmt.Errorf("jobs store integrity check failed: %w", err)
+	}
+	// A repair may have rewritten the file
+	s.invalidateJobCache()
+
+	var index map[string]string
+	if err := checkFilePair(s.convIndexPath, s.convIndexPath+".bak", &index); err != nil {
+		return fmt.Errorf("conversation index integrity check failed: %w", err)
+	}
+
+	return nil
+}
+
+// checkFilePair validates a main/backup pair, repairing whichever side is bad
+func checkFilePair(path, backupPath string, v interface{}) error {
+	mainOK := parsesAs(path, v)
+	_, statErr := os.Stat(backupPath)
+	backupExists := statErr == nil
+	backupOK := backupExists && parsesAs(backupPath, v)
+
+	switch {
+	case mainOK && backupExists && !backupOK:
+		log.Printf("Warning: backup %s is corrupt, refreshing from %s", backupPath, path)
+		return copyFileSync(path, backupPath)
+	case mainOK:
+		return nil
+	case backupOK:
+		log.Printf("Warning: %s is corrupt, restoring from backup %s", path, backupPath)
+		data, err := os.ReadFile(backupPath)
+		if err != nil {
+			return err
+		}
+		return atomicWriteFile(path, backupPath, data)
+	default:
+		return fmt.Errorf("%s is corrupt and no valid backup exists", path)
+	}
+}
+
+// parsesAs reports whether the file at path is non-empty JSON decodable into v
+func parsesAs(path string, v interface{}) bool {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+// repairFromBackup rewrites a corrupt main file with the recovered backup
+// bytes so later saves aren't built on a bad read
+func (s *Store) repairFromBackup(path, backupPath string, backup []byte) {
+	s.repairMu.Lock()
+	defer s.repairMu.Unlock()
+
+	log.Printf("Warning: corruption detected in %s, restoring from backup", path)
+	if err := atomicWriteFile(path, backupPath, backup); err != nil {
+		log.Printf("Warning: failed to repair %s from backup: %v", path, err)
+		return
+	}
+	log.Printf("Repaired %s from backup", path)
 }
 
 func initFileIfNotExists(path, initialContent string) error {
@@ -55,8 +218,17 @@ func initFileIfNotExists(path, initialContent string) error {
 	return nil
 }
 
-// SaveJob persists a job to disk (with write lock)
+// SaveJob persists a job to disk (with write lock). It fails with
+// ErrJobBusy while the job is held by GetJobForUpdate, and with ErrStaleJob
+// if the job was saved since the caller read it.
 func (s *Store) SaveJob(job *Job) error {
+	lock := s.jobLock(job.ID)
+	if !lock.TryLock() {
+		s.releaseJobLock(job.ID)
+		return ErrJobBusy
+	}
+	defer s.unlockJob(job.ID, lock)
+
 	s.jobsMu.Lock()
 	defer s.jobsMu.Unlock()
 
@@ -65,9 +237,26 @@ func (s *Store) SaveJob(job *Job) error {
 		return err
 	}
 
+	var before JobStatus
+	prev, active := jobs[job.ID.String()]
+	if active {
+		if job.Revision < prev.Revision {
+			return ErrStaleJob
+		}
+		before = prev.Status
+	}
+	job.Revision++
 	jobs[job.ID.String()] = job
 
-	return s.saveJobsUnsafe(jobs)
+	// Saving an archived job brings it back into the active store
+	unarchived := !active && s.isArchived(job.ID)
+	if err := s.saveJobsUnsafe(jobs, enteredTerminal(before, job) || unarchived); err != nil {
+		return err
+	}
+	if unarchived {
+		s.removeArchivedJob(job.ID)
+	}
+	return nil
 }
 
 // GetJob retrieves a job by ID (with read lock)
@@ -75,13 +264,14 @@ func (s *Store) GetJob(id uuid.UUID) (*Job, error) {
 	s.jobsMu.RLock()
 	defer s.jobsMu.RUnlock()
 
-	jobs, err := s.loadJobsUnsafe()
+	job, exists, err := s.loadJobUnsafe(id)
 	if err != nil {
 		return nil, err
 	}
-
-	job, exists := jobs[id.String()]
 	if !exists {
+		if archived, err := s.loadArchivedJob(id); err == nil {
+			return archived, nil
+		}
 		return nil, fmt.Errorf("job not found: %s", id)
 	}
 
@@ -89,32 +279,111 @@ func (s *Store) GetJob(id uuid.UUID) (*Job, error) {
 }
 
 // GetJobForUpdate retrieves a job with exclusive write lock
-// This simulates SELECT ... FOR UPDATE in SQL
+// This simulates SELECT ... FOR UPDATE in SQL. Only the job's own lock is
+// held until commit, so other jobs can be read and saved meanwhile.
 func (s *Store) GetJobForUpdate(id uuid.UUID) (*Job, func() error, error) {
-	s.jobsMu.Lock()
+	job, commit, _, err := s.lockJobForUpdate(id, true)
+	return job, commit, err
+}
+
+// lockJobForUpdate is GetJobForUpdate with the choice of failing with
+// ErrJobBusy instead of waiting for the job's lock, and a rollback that
+// releases the lock without saving. The caller must call exactly one of
+// commit and rollback.
+func (s *Store) lockJobForUpdate(id uuid.UUID, wait bool) (*Job, func() error, func(), error) {
+	lock := s.jobLock(id)
+	if wait {
+		lock.Lock()
+	} else if !lock.TryLock() {
+		s.releaseJobLock(id)
+		return nil, nil, nil, ErrJobBusy
+	}
 	// Don't unlock yet - caller must call commit/rollback
+	unlock := func() { s.unlockJob(id, lock) }
 
-	jobs, err := s.loadJobsUnsafe()
+	s.jobsMu.RLock()
+	job, exists, err := s.loadJobUnsafe(id)
+	s.jobsMu.RUnlock()
 	if err != nil {
-		s.jobsMu.Unlock()
-		return nil, nil, err
+		unlock()
+		return nil, nil, nil, err
 	}
-
-	job, exists := jobs[id.String()]
 	if !exists {
-		s.jobsMu.Unlock()
-		return nil, nil, fmt.Errorf("job not found: %s", id)
+		unlock()
+		return nil, nil, nil, fmt.Errorf("job not found: %s", id)
 	}
 
-	// Return commit function that saves and unlocks
+	// Return commit function that saves and unlocks. Other jobs may have
+	// changed since the read, so the jobs are loaded again and only this
+	// one is replaced.
+	before := job.Status
 	commit := func() error {
-		jobs[id.String()] = job
-		err := s.saveJobsUnsafe(jobs)
-		s.jobsMu.Unlock()
-		return err
+		defer unlock()
+		s.jobsMu.Lock()
+		defer s.jobsMu.Unlock()
+
+		current, err := s.loadJobsUnsafe()
+		if err != nil {
+			return err
+		}
+		stored, ok := current[id.String()]
+		if !ok {
+			// Deleted while held; don't bring it back
+			return nil
+		}
+		job.Revision = stored.Revision + 1
+		current[id.String()] = job
+		return s.saveJobsUnsafe(current, enteredTerminal(before, job))
+	}
+
+	return job, commit, unlock, nil
+}
+
+// jobLockEntry is a job's lock and the number of callers using it
+type jobLockEntry struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// jobLock returns the lock that serialises updates to one job. Every call
+// must be paired with releaseJobLock (or unlockJob once it was locked), so
+// the entry can be dropped when no one is using it.
+func (s *Store) jobLock(id uuid.UUID) *sync.Mutex {
+	s.jobLocksMu.Lock()
+	defer s.jobLocksMu.Unlock()
+
+	if s.jobLocks == nil {
+		s.jobLocks = make(map[uuid.UUID]*jobLockEntry)
+	}
+	entry, ok := s.jobLocks[id]
+	if !ok {
+		entry = &jobLockEntry{}
+		s.jobLocks[id] = entry
 	}
+	entry.refs++
+	return &entry.mu
+}
+
+// releaseJobLock gives up a reference taken by jobLock, removing the entry
+// once it was the last one
+func (s *Store) releaseJobLock(id uuid.UUID) {
+	s.jobLocksMu.Lock()
+	defer s.jobLocksMu.Unlock()
 
-	return job, commit, nil
+	entry, ok := s.jobLocks[id]
+	if !ok {
+		return
+	}
+	entry.refs--
+	if entry.refs <= 0 {
+		delete(s.jobLocks, id)
+	}
+}
+
+// unlockJob unlocks a job lock taken by jobLock and releases it
+func (s *Store) unlockJob(id uuid.UUID, lock *sync.Mutex) {
+	lock.Unlock()
+	s.releaseJobLock(id)
 }
 
 // GetAllJobs returns all jobs (with read lock)
@@ -177,64 +446,55 @@ func (s *Store) DeleteJob(id uuid.UUID) error {
 
 	delete(jobs, id.String())
 
-	return s.saveJobsUnsafe(jobs)
-}
-
-// SaveConversation persists a conversation to disk
-func (s *Store) SaveConversation(conv *Conversation) error {
-	s.convMu.Lock()
-	defer s.convMu.Unlock()
-
-	convs, err := s.loadConversationsUnsafe()
-	if err != nil {
+	if err := s.saveJobsUnsafe(jobs, false); err != nil {
 		return err
 	}
-
-	convs[conv.ID.String()] = conv
-
-	return s.saveConversationsUnsafe(convs)
+	s.removeArchivedJob(id)
+	return nil
 }
 
-// GetConversation retrieves a conversation by ID
-func (s *Store) GetConversation(id uuid.UUID) (*Conversation, error) {
-	s.convMu.RLock()
-	defer s.convMu.RUnlock()
+// Internal unsafe methods (must be called with lock held)
 
-	convs, err := s.loadConversationsUnsafe()
+func (s *Store) loadJobsUnsafe() (map[string]*Job, error) {
+	if jobs, ok := s.cachedJobs(); ok {
+		return jobs, nil
+	}
+	jobs, err := s.decodeJobsUnsafe()
 	if err != nil {
 		return nil, err
 	}
-
-	conv, exists := convs[id.String()]
-	if !exists {
-		return nil, fmt.Errorf("conversation not found: %s", id)
-	}
-
-	return conv, nil
+	s.fillJobCache(jobs)
+	return jobs, nil
 }
 
-// GetConversationByJobID retrieves a conversation by job ID
-func (s *Store) GetConversationByJobID(jobID uuid.UUID) (*Conversation, error) {
-	s.convMu.RLock()
-	defer s.convMu.RUnlock()
-
-	convs, err := s.loadConversationsUnsafe()
+// decodeJobsUnsafe reads and parses the jobs, bypassing the cache
+// loadJobUnsafe loads one job, cloning only that job on a cache hit
+func (s *Store) loadJobUnsafe(id uuid.UUID) (*Job, bool, error) {
+	if job, found, hit := s.cachedJob(id); hit {
+		return job, found, nil
+	}
+	jobs, err := s.loadJobsUnsafe()
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
+	job, ok := jobs[id.String()]
+	return job, ok, nil
+}
 
-	for _, conv := range convs {
-		if conv.JobID == jobID {
-			return conv, nil
+func (s *Store) decodeJobsUnsafe() (map[string]*Job, error) {
+	// Decode rather than share the in-memory copy, so callers still get
+	// jobs they own, exactly as when reading from disk
+	if s.writeBehind {
+		var jobs map[string]*Job
+		if err := json.Unmarshal(s.jobsData, &jobs); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal jobs")
 		}
+		if jobs == nil {
+			jobs = make(map[string]*Job)
+		}
+		return jobs, nil
 	}
 
-	return nil, fmt.Errorf("conversation not found for job: %s", jobID)
-}
-
-// Internal unsafe methods (must be called with lock held)
-
-func (s *Store) loadJobsUnsafe() (map[string]*Job, error) {
 	data, err := os.ReadFile(s.jobsPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read jobs file: %w", err)
@@ -242,9 +502,11 @@ func (s *Store) loadJobsUnsafe() (map[string]*Job, error) {
 
 	var jobs map[string]*Job
 	if len(data) == 0 || json.Unmarshal(data, &jobs) != nil {
+		jobs = nil
 		backup, berr := os.ReadFile(s.jobsBackupPath)
 		if berr == nil && len(backup) > 0 {
 			if json.Unmarshal(backup, &jobs) == nil {
+				s.repairFromBackup(s.jobsPath, s.jobsBackupPath, backup)
 				return jobs, nil
 			}
 		}
@@ -258,56 +520,38 @@ func (s *Store) loadJobsUnsafe() (map[string]*Job, error) {
 	return jobs, nil
 }
 
-func (s *Store) saveJobsUnsafe(jobs map[string]*Job) error {
+// saveJobsUnsafe persists jobs. In write-behind mode the write is deferred
+// to the flusher unless flush is set.
+func (s *Store) saveJobsUnsafe(jobs map[string]*Job, flush bool) error {
 	data, err := json.MarshalIndent(jobs, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal jobs: %w", err)
 	}
+	s.indexLabelsUnsafe(jobs)
+	s.cacheSavedJobs(data)
 
-	if err := atomicWriteFile(s.jobsPath, s.jobsBackupPath, data); err != nil {
-		return fmt.Errorf("failed to write jobs file: %w", err)
-	}
-
-	return nil
-}
-
-func (s *Store) loadConversationsUnsafe() (map[string]*Conversation, error) {
-	data, err := os.ReadFile(s.conversationsPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read conversations file: %w", err)
-	}
-
-	var convs map[string]*Conversation
-	if len(data) == 0 || json.Unmarshal(data, &convs) != nil {
-		backup, berr := os.ReadFile(s.convBackupPath)
-		if berr == nil && len(backup) > 0 {
-			if json.Unmarshal(backup, &convs) == nil {
-				return convs, nil
-			}
+	if s.writeBehind {
+		s.jobsData = data
+		s.jobsDirty = true
+		if flush {
+			return s.flushJobsUnsafe()
 		}
-		return nil, fmt.Errorf("failed to unmarshal conversations")
-	}
-
-	if convs == nil {
-		convs = make(map[string]*Conversation)
-	}
-
-	return convs, nil
-}
-
-func (s *Store) saveConversationsUnsafe(convs map[string]*Conversation) error {
-	data, err := json.MarshalIndent(convs, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal conversations: %w", err)
+		return nil
 	}
 
-	if err := atomicWriteFile(s.conversationsPath, s.convBackupPath, data); err != nil {
-		return fmt.Errorf("failed to write conversations file: %w", err)
+	if err := atomicWriteFile(s.jobsPath, s.jobsBackupPath, data); err != nil {
+		return fmt.Errorf("failed to write jobs file: %w", err)
 	}
 
 	return nil
 }
 
+// atomicWriteFile replaces path with data without ever leaving it missing:
+// write temp, fsync, rename temp over the live file, then refresh the backup
+// from the new live file. The backup is only touched once the live write has
+// succeeded, so a failure at any point leaves either the old or the new
+// contents at path and a readable backup beside it. An empty backupPath
+// skips the backup.
 func atomicWriteFile(path, backupPath string, data []byte) error {
 	dir := filepath.Dir(path)
 	tmp, err := os.CreateTemp(dir, "tmp-*")
@@ -320,7 +564,7 @@ func atomicWriteFile(path, backupPath string, data []byte) error {
 		tmp.Close()
 		return err
 	}
-	if err := tmp.Sync(); err != nil {
+	if err := syncFile(tmp); err != nil {
 		tmp.Close()
 		return err
 	}
@@ -328,13 +572,62 @@ func atomicWriteFile(path, backupPath string, data []byte) error {
 		return err
 	}
 
-	if _, err := os.Stat(path); err == nil {
-		_ = os.Rename(path, backupPath)
+	if err := renameFile(tmp.Name(), path); err != nil {
+		// Rename can't cross filesystems; fall back to copying in place
+		if !errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+		if err := copyFileSync(tmp.Name(), path); err != nil {
+			return fmt.Errorf("cross-device copy failed: %w", err)
+		}
 	}
+	syncDir(dir)
 
-	if err := os.Rename(tmp.Name(), path); err != nil {
-		return err
+	// The live file is good; a failed backup refresh must not fail the write
+	if backupPath != "" {
+		_ = copyFileSync(path, backupPath)
 	}
 
 	return nil
 }
+
+// syncFile and renameFile are the fsync and rename atomicWriteFile uses,
+// swappable so tests can simulate disk and cross-device failures
+var (
+	syncFile   = func(f *os.File) error { return f.Sync() }
+	renameFile = os.Rename
+)
+
+// copyFileSync copies src to dst and fsyncs dst before returning
+func copyFileSync(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir fsyncs a directory so a completed rename survives a crash.
+// Not every platform supports this, so errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	d.Close()
+}
@@ -0,0 +1,431 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func readString(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+// noTempFiles fails if atomicWriteFile left a temp file behind in dir
+func noTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	matches, _ := filepath.Glob(filepath.Join(dir, "tmp-*"))
+	if len(matches) > 0 {
+		t.Errorf("temp files left behind: %v", matches)
+	}
+}
+
+func TestAtomicWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jobs.json")
+	backup := path + ".bak"
+	if err := os.WriteFile(backup, []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := atomicWriteFile(path, backup, []byte("new")); err != nil {
+		t.Fatalf("atomicWriteFile: %v", err)
+	}
+	if got := readString(t, path); got != "new" {
+		t.Errorf("live file = %q, want %q", got, "new")
+	}
+	if got := readString(t, backup); got != "new" {
+		t.Errorf("backup = %q, want it refreshed to %q", got, "new")
+	}
+	noTempFiles(t, dir)
+}
+
+func TestAtomicWriteFileWithoutBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jobs.json")
+
+	if err := atomicWriteFile(path, "", []byte("new")); err != nil {
+		t.Fatalf("atomicWriteFile: %v", err)
+	}
+	if got := readString(t, path); got != "new" {
+		t.Errorf("live file = %q, want %q", got, "new")
+	}
+	if _, err := os.Stat(path + ".bak"); !os.IsNotExist(err) {
+		t.Errorf("backup written with an empty backupPath")
+	}
+}
+
+func TestAtomicWriteFileFailures(t *testing.T) {
+	errDisk := errors.New("disk failure")
+	tests := []struct {
+		name   string
+		sync   func(*os.File) error
+		rename func(string, string) error
+	}{
+		{
+			name: "fsync fails",
+			sync: func(*os.File) error { return errDisk },
+		},
+		{
+			name:   "rename fails",
+			rename: func(string, string) error { return errDisk },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "jobs.json")
+			backup := path + ".bak"
+			for _, p := range []string{path, backup} {
+				if err := os.WriteFile(p, []byte("old"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			origSync, origRename := syncFile, renameFile
+			defer func() { syncFile, renameFile = origSync, origRename }()
+			if tt.sync != nil {
+				syncFile = tt.sync
+			}
+			if tt.rename != nil {
+				renameFile = tt.rename
+			}
+
+			err := atomicWriteFile(path, backup, []byte("new"))
+			if !errors.Is(err, errDisk) {
+				t.Fatalf("err = %v, want %v", err, errDisk)
+			}
+			if got := readString(t, path); got != "old" {
+				t.Errorf("live file = %q, want it left at %q", got, "old")
+			}
+			if got := readString(t, backup); got != "old" {
+				t.Errorf("backup = %q, want it left at %q", got, "old")
+			}
+			noTempFiles(t, dir)
+		})
+	}
+}
+
+func TestAtomicWriteFileCrossDevice(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jobs.json")
+	backup := path + ".bak"
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	origRename := renameFile
+	defer func() { renameFile = origRename }()
+	renameFile = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+
+	if err := atomicWriteFile(path, backup, []byte("new")); err != nil {
+		t.Fatalf("atomicWriteFile: %v", err)
+	}
+	if got := readString(t, path); got != "new" {
+		t.Errorf("live file = %q, want %q", got, "new")
+	}
+	if got := readString(t, backup); got != "new" {
+		t.Errorf("backup = %q, want %q", got, "new")
+	}
+	noTempFiles(t, dir)
+}
+
+func TestAtomicWriteFileBackupFailureKeepsWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jobs.json")
+	backup := filepath.Join(dir, "missing", "jobs.json.bak")
+
+	if err := atomicWriteFile(path, backup, []byte("new")); err != nil {
+		t.Fatalf("a failed backup refresh should not fail the write: %v", err)
+	}
+	if got := readString(t, path); got != "new" {
+		t.Errorf("live file = %q, want %q", got, "new")
+	}
+}
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	return store
+}
+
+func TestJobLocksArePruned(t *testing.T) {
+	store := newTestStore(t)
+	job := NewJob("alice", "prompt", 1)
+	if err := store.SaveJob(job); err != nil {
+		t.Fatalf("SaveJob: %v", err)
+	}
+
+	held, commit, err := store.GetJobForUpdate(job.ID)
+	if err != nil {
+		t.Fatalf("GetJobForUpdate: %v", err)
+	}
+	if err := store.SaveJob(held); !errors.Is(err, ErrJobBusy) {
+		t.Fatalf("SaveJob on a held job = %v, want ErrJobBusy", err)
+	}
+	if _, err := store.UpdateJobLabels(job.ID, []string{"busy"}, nil); !errors.Is(err, ErrJobBusy) {
+		t.Fatalf("UpdateJobLabels on a held job = %v, want ErrJobBusy", err)
+	}
+	if err := commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if _, err := store.UpdateJobLabels(job.ID, []string{"done"}, nil); err != nil {
+		t.Fatalf("UpdateJobLabels: %v", err)
+	}
+	if err := store.DeleteJob(job.ID); err != nil {
+		t.Fatalf("DeleteJob: %v", err)
+	}
+
+	store.jobLocksMu.Lock()
+	defer store.jobLocksMu.Unlock()
+	if len(store.jobLocks) != 0 {
+		t.Errorf("jobLocks has %d entries after every lock was released", len(store.jobLocks))
+	}
+}
+
+// TestEnqueueAndSaveJobConcurrently drives Enqueue, handler-style SaveJob
+// read-modify-writes and a worker-style GetJobForUpdate on one job at once.
+// Run it with -race; every accepted write must bump Revision exactly once.
+func TestEnqueueAndSaveJobConcurrently(t *testing.T) {
+	const rounds = 50
+
+	store := newTestStore(t)
+	queue := NewQueue(rounds, store, log.New(io.Discard, "", 0))
+	job := NewJob("alice", "prompt", 1)
+	if err := store.SaveJob(job); err != nil {
+		t.Fatalf("SaveJob: %v", err)
+	}
+
+	var writes atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			if err := queue.Enqueue(job.ID); err != nil {
+				t.Errorf("Enqueue: %v", err)
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			current, err := store.GetJob(job.ID)
+			if err != nil {
+				t.Errorf("GetJob: %v", err)
+				return
+			}
+			current.Labels = []string{"handler"}
+			switch err := store.SaveJob(current); {
+			case err == nil:
+				writes.Add(1)
+			case errors.Is(err, ErrJobBusy), errors.Is(err, ErrStaleJob):
+			default:
+				t.Errorf("SaveJob: %v", err)
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			held, commit, err := store.GetJobForUpdate(job.ID)
+			if err != nil {
+				t.Errorf("GetJobForUpdate: %v", err)
+				return
+			}
+			held.Status = StatusRunning
+			if err := commit(); err != nil {
+				t.Errorf("commit: %v", err)
+				return
+			}
+			writes.Add(1)
+		}
+	}()
+
+	wg.Wait()
+
+	final, err := store.GetJob(job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if want := 1 + int(writes.Load()); final.Revision != want {
+		t.Errorf("Revision = %d after %d writes, want %d", final.Revision, writes.Load(), want)
+	}
+	if got := len(queue.jobs); got != rounds {
+		t.Errorf("queue holds %d entries, want %d", got, rounds)
+	}
+}
+
+// TestAbortRunningJob aborts a job while a worker holds it. SaveJob can't
+// touch the job then, so the abort goes through the queue and the worker
+// must save the job as aborted. Run it with -race.
+func TestAbortRunningJob(t *testing.T) {
+	started := make(chan struct{})
+	origGraph := pipelineGraph
+	defer func() { pipelineGraph = origGraph }()
+	pipelineGraph = []StepNode{{Name: StepPrompt, Run: func(q *Queue, ctx context.Context, job *Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}}}
+
+	store := newTestStore(t)
+	queue := NewQueue(1, store, log.New(io.Discard, "", 0))
+	job := NewJob("alice", "prompt", 1)
+	if err := store.SaveJob(job); err != nil {
+		t.Fatalf("SaveJob: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := queue.processJob(context.Background(), job.ID); err != nil {
+			t.Errorf("processJob: %v", err)
+		}
+	}()
+	<-started
+
+	current, err := store.GetJob(job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	current.Status = StatusAborted
+	if err := store.SaveJob(current); !errors.Is(err, ErrJobBusy) {
+		t.Fatalf("SaveJob on a running job = %v, want ErrJobBusy", err)
+	}
+	if !queue.AbortRunningJob(job.ID) {
+		t.Fatal("AbortRunningJob found no running job")
+	}
+	<-done
+
+	final, err := store.GetJob(job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if final.Status != StatusAborted {
+		t.Errorf("status = %s, want %s", final.Status, StatusAborted)
+	}
+	if queue.AbortRunningJob(job.ID) {
+		t.Error("AbortRunningJob still finds the job after the worker finished")
+	}
+}
+
+func TestJobCacheAfterSave(t *testing.T) {
+	store := newTestStore(t)
+	job := NewJob("alice", "prompt", 1)
+	job.Metadata = map[string]interface{}{"designSpec": &DesignSpec{Title: "Fractions"}}
+	if err := store.SaveJob(job); err != nil {
+		t.Fatalf("SaveJob: %v", err)
+	}
+
+	// The save refills the cache from what was written, not the caller's job
+	cached, found, hit := store.cachedJob(job.ID)
+	if !hit || !found {
+		t.Fatalf("cachedJob after save: found=%v hit=%v, want a hit", found, hit)
+	}
+	if _, typed := cached.Metadata["designSpec"].(*DesignSpec); typed {
+		t.Error("cache holds the caller's typed metadata instead of decoded JSON")
+	}
+
+	// Each read gets its own copy
+	got, err := store.GetJob(job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	got.Metadata["designSpec"] = "changed"
+	again, err := store.GetJob(job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if spec, ok := DesignSpecFromJob(again); !ok || spec.Title != "Fractions" {
+		t.Errorf("changing one read leaked into the next: %+v", again.Metadata["designSpec"])
+	}
+}
+
+// TestArchivedJobsCountTowardLimits archives a finished job and checks the
+// storage quota and stored job cap still see it and its artifacts
+func TestArchivedJobsCountTowardLimits(t *testing.T) {
+	t.Chdir(t.TempDir())
+	store := newTestStore(t)
+	if err := store.SetArchiveDir(filepath.Join(t.TempDir(), "archive")); err != nil {
+		t.Fatalf("SetArchiveDir: %v", err)
+	}
+	queue := NewQueue(1, store, log.New(io.Discard, "", 0))
+
+	old := NewJob("alice", "prompt", 1)
+	old.SetCompleted("/storage/bucket/" + old.ID.String() + ".pdf")
+	if err := store.SaveJob(old); err != nil {
+		t.Fatalf("SaveJob: %v", err)
+	}
+	pdf := jobArtifactPaths(old.ID)[0]
+	if err := os.MkdirAll(filepath.Dir(pdf), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pdf, make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := store.ArchiveJobs(-time.Hour); err != nil || n != 1 {
+		t.Fatalf("ArchiveJobs = %d, %v; want 1 archived", n, err)
+	}
+
+	usage, err := queue.UserStorageUsage("alice")
+	if err != nil {
+		t.Fatalf("UserStorageUsage: %v", err)
+	}
+	if usage.Jobs != 1 || usage.UsedBytes != 100 {
+		t.Errorf("usage = %d jobs, %d bytes; want the archived job's 1 job, 100 bytes", usage.Jobs, usage.UsedBytes)
+	}
+
+	queue.SetStoredJobLimit(1, StoredJobsReject)
+	if err := queue.MakeRoomForJob("alice"); !errors.Is(err, ErrStoredJobLimit) {
+		t.Errorf("MakeRoomForJob at the cap = %v, want ErrStoredJobLimit", err)
+	}
+
+	// Quota eviction reaches the archived job's artifacts
+	queue.storageQuota = 50
+	queue.enforceStorageQuota("alice", uuid.Nil)
+	if _, err := os.Stat(pdf); !os.IsNotExist(err) {
+		t.Errorf("archived job's PDF still on disk after eviction")
+	}
+	archived, err := store.GetJob(old.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if !artifactsEvicted(archived) {
+		t.Error("archived job not marked as evicted")
+	}
+
+	// The evict policy deletes the archived job to make room
+	queue.SetStoredJobLimit(1, StoredJobsEvict)
+	if err := queue.MakeRoomForJob("alice"); err != nil {
+		t.Fatalf("MakeRoomForJob with evict: %v", err)
+	}
+	if jobs, _ := store.GetArchivedJobsByUser("alice"); len(jobs) != 0 {
+		t.Errorf("archived jobs left after eviction: %d", len(jobs))
+	}
+}
@@ -0,0 +1,41 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"nadhi.dev/sarvar/fun/ai"
+)
+
+// streamProgressInterval is the least time between streamed progress
+// updates for a job, so a fast stream doesn't flood listeners
+const streamProgressInterval = 2 * time.Second
+
+// stepStages names the stage streamed progress is reported under
+var stepStages = map[PipelineStep]string{
+	StepDesign: "Design",
+	StepLatex:  "LaTeX",
+}
+
+// withStreamProgress returns a context whose streamed generations report
+// how much has been written as "Streaming" updates for the job's current
+// step. The updates also keep the job's heartbeat fresh during long calls.
+// Steps that don't generate text get ctx back unchanged.
+func (q *Queue) withStreamProgress(ctx context.Context, job *Job) context.Context {
+	stage, ok := stepStages[job.CurrentStep]
+	if !ok {
+		return ctx
+	}
+
+	var last time.Time
+	return ai.WithChunkHandler(ctx, func(chunk, text string) {
+		if time.Since(last) < streamProgressInterval {
+			return
+		}
+		last = time.Now()
+		q.sendUpdate(job, fmt.Sprintf("Generating %s (%d characters so far)", stage, len(text)), q.stageData(stage, "Streaming", map[string]interface{}{
+			"chars": len(text),
+		}))
+	})
+}
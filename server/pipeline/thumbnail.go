@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"nadhi.dev/sarvar/fun/latex"
+)
+
+// SetThumbnailsEnabled turns PNG previews of compiled PDFs on or off. The
+// thumbnail tool is detected here, so enabling without pdftoppm or
+// Ghostscript installed logs once and leaves thumbnails off.
+func (q *Queue) SetThumbnailsEnabled(enabled bool) {
+	if enabled {
+		if tool := latex.DetectThumbnailer(); tool == "" {
+			q.logger.Println("PDF thumbnails disabled: neither pdftoppm nor gs was found")
+			enabled = false
+		} else {
+			q.logger.Printf("PDF thumbnails enabled using %s", tool)
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.thumbnails = enabled
+}
+
+// attachThumbnail renders the first page of the job's PDF to
+// <id>-thumb.png in the bucket and records its URL. Failures only cost
+// the preview, never the job.
+func (q *Queue) attachThumbnail(job *Job, pdfPath string) {
+	q.mu.Lock()
+	enabled := q.thumbnails
+	q.mu.Unlock()
+	if !enabled {
+		return
+	}
+
+	thumbFilename := fmt.Sprintf("%s-thumb.png", job.ID.String())
+	thumbPath := filepath.Join(filepath.Dir(pdfPath), thumbFilename)
+	if err := latex.GenerateThumbnail(pdfPath, thumbPath); err != nil {
+		q.logger.Printf("Thumbnail generation failed for job %s: %v", job.ID, err)
+		return
+	}
+
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]interface{})
+	}
+	job.Metadata["thumbnailUrl"] = fmt.Sprintf("/vela/bucket/bucket/%s", thumbFilename)
+}
+
+// ThumbnailURL returns the URL of the job's PDF preview image, if any
+func (j *Job) ThumbnailURL() string {
+	if j.Metadata == nil {
+		return ""
+	}
+	url, _ := j.Metadata["thumbnailUrl"].(string)
+	return url
+}
@@ -19,6 +19,11 @@ const (
 	StatusAborted       JobStatus = "aborted"
 )
 
+// IsTerminal reports whether a job in this status will receive no further updates
+func (s JobStatus) IsTerminal() bool {
+	return s == StatusCompleted || s == StatusError || s == StatusAborted
+}
+
 // PipelineStep represents a stage in the generation pipeline
 type PipelineStep string
 
@@ -49,6 +54,9 @@ type Job struct {
 	UpdatedAt      time.Time              `json:"updatedAt"`
 	CompletedAt    *time.Time             `json:"completedAt,omitempty"`
 	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	Labels         []string               `json:"labels,omitempty"`
+	// Revision counts saves; SaveJob rejects copies older than the stored one
+	Revision int `json:"revision"`
 }
 
 // Conversation represents a persistent dialogue thread for a job
@@ -58,6 +66,14 @@ type Conversation struct {
 	Messages  []Message `json:"messages"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
+
+	// SeededMessages is how many leading messages were copied from a
+	// parent job's conversation
+	SeededMessages int `json:"seededMessages,omitempty"`
+
+	// EvictedMessages counts messages dropped to stay within the
+	// conversation size caps
+	EvictedMessages int `json:"evictedMessages,omitempty"`
 }
 
 // Message represents a single message in a conversation
@@ -82,6 +98,9 @@ type StatusUpdate struct {
 	Message   string                 `json:"message"`
 	Data      map[string]interface{} `json:"data,omitempty"`
 	Timestamp time.Time              `json:"timestamp"`
+	// Seq numbers a job's updates in the order they were sent, so clients
+	// can put them back in order or drop stale ones
+	Seq uint64 `json:"seq"`
 }
 
 // NewJob creates a new job with initial state
@@ -114,13 +133,15 @@ func NewConversation(jobID uuid.UUID) *Conversation {
 	}
 }
 
-// AddMessage adds a message to the conversation
+// AddMessage adds a message to the conversation, evicting the oldest
+// non-system messages if it grows past the configured caps
 func (c *Conversation) AddMessage(role, content string) {
 	c.Messages = append(c.Messages, Message{
 		Role:      role,
 		Content:   content,
 		Timestamp: time.Now(),
 	})
+	c.enforceLimits()
 	c.UpdatedAt = time.Now()
 }
 
@@ -150,6 +171,15 @@ func (j *Job) SetWaitingManual(message string) {
 	j.UpdatedAt = time.Now()
 }
 
+// IsAutoApprove reports whether the job was submitted with manual review gates disabled
+func (j *Job) IsAutoApprove() bool {
+	if j.Metadata == nil {
+		return false
+	}
+	auto, _ := j.Metadata["autoApprove"].(bool)
+	return auto
+}
+
 // SetCompleted marks the job as completed
 func (j *Job) SetCompleted(pdfURL string) {
 	j.Status = StatusCompleted
@@ -160,18 +190,9 @@ func (j *Job) SetCompleted(pdfURL string) {
 	j.UpdatedAt = now
 }
 
-// AdvanceStep moves the job to the next pipeline step
+// AdvanceStep moves the job to the next step in the pipeline graph
 func (j *Job) AdvanceStep() {
-	switch j.CurrentStep {
-	case StepPrompt:
-		j.CurrentStep = StepDesign
-	case StepDesign:
-		j.CurrentStep = StepLatex
-	case StepLatex:
-		j.CurrentStep = StepCompile
-	case StepCompile:
-		j.CurrentStep = StepDone
-	}
+	j.CurrentStep = nextStep(j)
 	j.UpdatedAt = time.Now()
 }
 
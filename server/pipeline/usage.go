@@ -0,0 +1,27 @@
+package pipeline
+
+import "nadhi.dev/sarvar/fun/ai"
+
+// UsageFromJob returns the token usage accumulated on a job so far
+func UsageFromJob(job *Job) ai.UsageReport {
+	report, _ := metadataAs[ai.UsageReport](job, "usage")
+	return report
+}
+
+// AddUsage adds the usage recorded by tracker to the job's running total
+func (j *Job) AddUsage(tracker *ai.UsageTracker) {
+	if tracker == nil {
+		return
+	}
+	recorded := tracker.Report()
+	if recorded.Calls == 0 {
+		return
+	}
+
+	report := UsageFromJob(j)
+	report.Add(recorded)
+	if j.Metadata == nil {
+		j.Metadata = make(map[string]interface{})
+	}
+	j.Metadata["usage"] = report
+}
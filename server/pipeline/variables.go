@@ -0,0 +1,29 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"nadhi.dev/sarvar/fun/ai"
+)
+
+// applyTemplateVariables fills {{name}} placeholders in the request from the
+// job owner's stored variables. Unknown names stay literal and are reported
+// in a status update rather than failing the job.
+func (q *Queue) applyTemplateVariables(job *Job, request *ai.GenerationRequest) {
+	missing := ai.ApplyTemplateVariables(request, ai.UserVariables(job.UserID))
+	if len(missing) == 0 {
+		return
+	}
+
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]interface{})
+	}
+	job.Metadata["unresolvedVariables"] = missing
+
+	msg := fmt.Sprintf("Unknown template variables left as written: %s", strings.Join(missing, ", "))
+	q.sendUpdate(job, msg, q.stageData("Design", "Unresolved variables", map[string]interface{}{
+		"unresolvedVariables": missing,
+		"warning":             true,
+	}))
+}
@@ -0,0 +1,162 @@
+package pipeline
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// statusWebhookBuffer is how many undelivered updates a job may have
+	// queued before new ones are dropped
+	statusWebhookBuffer = 32
+	// statusWebhookInterval is the minimum gap between deliveries for one job
+	statusWebhookInterval = 500 * time.Millisecond
+	// statusWebhookIdle is how long a delivery goroutine waits for more
+	// updates before exiting
+	statusWebhookIdle = time.Minute
+
+	// StatusWebhookSignatureHeader carries the hex HMAC-SHA256 of the body,
+	// keyed with the configured webhook secret, as "sha256=<hex>"
+	StatusWebhookSignatureHeader = "X-AIotate-Signature"
+)
+
+var statusWebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// statusWebhook delivers one job's status updates in order
+type statusWebhook struct {
+	url      string
+	updates  chan StatusUpdate
+	lastHash string
+}
+
+// StatusWebhookURL returns the per-job status webhook set at creation, if any
+func (j *Job) StatusWebhookURL() string {
+	if j.Metadata == nil {
+		return ""
+	}
+	url, _ := j.Metadata["statusWebhookUrl"].(string)
+	return url
+}
+
+// SetWebhookSecret sets the key used to sign status webhook payloads.
+// An empty secret sends payloads unsigned.
+func (q *Queue) SetWebhookSecret(secret string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.webhookSecret = secret
+}
+
+// dispatchStatusWebhook queues an update for the job's status webhook.
+// Identical consecutive updates are skipped, and when the endpoint falls
+// behind the update is dropped rather than blocking the pipeline.
+func (q *Queue) dispatchStatusWebhook(job *Job, update StatusUpdate) {
+	url := job.StatusWebhookURL()
+	if url == "" {
+		return
+	}
+
+	hashInput := fmt.Sprintf("%s|%s|%v", update.Status, update.Message, update.Data)
+	hash := fmt.Sprintf("%x", md5.Sum([]byte(hashInput)))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stopped {
+		return
+	}
+
+	hook, exists := q.webhooks[job.ID]
+	if !exists {
+		hook = &statusWebhook{url: url, updates: make(chan StatusUpdate, statusWebhookBuffer)}
+		q.webhooks[job.ID] = hook
+		go q.runStatusWebhook(job.ID, hook)
+	}
+	if hook.lastHash == hash {
+		return
+	}
+	hook.lastHash = hash
+
+	select {
+	case hook.updates <- update:
+	default:
+		q.logger.Printf("Warning: status webhook for job %s is falling behind, dropping update", job.ID)
+	}
+}
+
+// runStatusWebhook posts queued updates, throttled, until the job goes quiet
+func (q *Queue) runStatusWebhook(jobID uuid.UUID, hook *statusWebhook) {
+	idle := time.NewTimer(statusWebhookIdle)
+	defer idle.Stop()
+
+	for {
+		select {
+		case update := <-hook.updates:
+			if err := q.postStatusWebhook(hook.url, update); err != nil {
+				q.logger.Printf("Status webhook for job %s failed: %v", jobID, err)
+			}
+			time.Sleep(statusWebhookInterval)
+			idle.Reset(statusWebhookIdle)
+
+		case <-idle.C:
+			// Dispatch sends under q.mu, so an empty channel here means
+			// nothing can be in flight
+			q.mu.Lock()
+			if len(hook.updates) == 0 {
+				delete(q.webhooks, jobID)
+				q.mu.Unlock()
+				return
+			}
+			q.mu.Unlock()
+			idle.Reset(statusWebhookIdle)
+		}
+	}
+}
+
+// postStatusWebhook sends a single signed update
+func (q *Queue) postStatusWebhook(url string, update StatusUpdate) error {
+	body, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-AIotate-Event", "job.status")
+
+	q.mu.Lock()
+	secret := q.webhookSecret
+	q.mu.Unlock()
+	if secret != "" {
+		req.Header.Set(StatusWebhookSignatureHeader, "sha256="+signWebhookBody(secret, body))
+	}
+
+	resp, err := statusWebhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signWebhookBody returns the hex HMAC-SHA256 of body keyed with secret
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"nadhi.dev/sarvar/fun/websearch"
+)
+
+// Job metadata keys for web research: the results the design step's
+// search found, and the URLs the user picked from them
+const (
+	webSourcesKey         = "webSources"
+	webSourceSelectionKey = "webSourceSelection"
+)
+
+// WebSourcesFromJob returns the search results saved by the job's design
+// step, if it searched
+func WebSourcesFromJob(job *Job) ([]websearch.SearchResult, bool) {
+	return metadataAs[[]websearch.SearchResult](job, webSourcesKey)
+}
+
+// selectedWebSources returns the saved results the user kept, in the order
+// they were found, when a selection was made
+func selectedWebSources(job *Job) ([]websearch.SearchResult, bool) {
+	urls, ok := metadataAs[[]string](job, webSourceSelectionKey)
+	if !ok {
+		return nil, false
+	}
+	sources, _ := WebSourcesFromJob(job)
+	keep := make(map[string]bool, len(urls))
+	for _, u := range urls {
+		keep[u] = true
+	}
+	selected := []websearch.SearchResult{}
+	for _, source := range sources {
+		if keep[source.URL] {
+			selected = append(selected, source)
+		}
+	}
+	return selected, true
+}
+
+// SelectWebSources records which of the job's saved search results the
+// design step should use, and sends the job back to it. Every URL must be
+// one of the saved results; an empty list designs without web research.
+// The caller saves and enqueues the job.
+func SelectWebSources(job *Job, urls []string) error {
+	sources, ok := WebSourcesFromJob(job)
+	if !ok {
+		return fmt.Errorf("job has no web sources to choose from")
+	}
+	known := make(map[string]bool, len(sources))
+	for _, source := range sources {
+		known[source.URL] = true
+	}
+	for _, u := range urls {
+		if !known[u] {
+			return fmt.Errorf("%s is not one of the job's web sources", u)
+		}
+	}
+
+	job.Metadata[webSourceSelectionKey] = append([]string{}, urls...)
+	job.ResetToStep(StepDesign)
+	return nil
+}
@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DefaultFlushInterval is how often write-behind mode flushes jobs to disk
+const DefaultFlushInterval = 5 * time.Second
+
+// EnableWriteBehind switches job persistence from write-through to
+// write-behind: saves update an in-memory copy of the jobs file and a
+// background ticker writes it out every interval. A job reaching a
+// terminal state (completed, error, aborted) is flushed immediately, so
+// at most an interval of in-flight progress is lost in a crash. Call
+// Close on shutdown to flush the rest. Conversations are unaffected.
+func (s *Store) EnableWriteBehind(interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+
+	if s.writeBehind {
+		return nil
+	}
+
+	// Seed the in-memory copy from disk so reads never fall through to a
+	// file that is behind
+	jobs, err := s.loadJobsUnsafe()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal jobs: %w", err)
+	}
+
+	s.writeBehind = true
+	s.jobsData = data
+	s.flushStop = make(chan struct{})
+	s.flushDone = make(chan struct{})
+	go s.flushLoop(interval, s.flushStop, s.flushDone)
+
+	return nil
+}
+
+// flushLoop writes pending job changes to disk every interval until stopped
+func (s *Store) flushLoop(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				log.Printf("Warning: failed to flush jobs: %v", err)
+			}
+		}
+	}
+}
+
+// Flush writes any pending job changes to disk. It is a no-op in the
+// default write-through mode.
+func (s *Store) Flush() error {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	return s.flushJobsUnsafe()
+}
+
+// Close stops the write-behind flusher, if running, and flushes pending changes
+func (s *Store) Close() error {
+	s.jobsMu.Lock()
+	stop, done := s.flushStop, s.flushDone
+	s.flushStop, s.flushDone = nil, nil
+	s.jobsMu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	s.stopArchiving()
+	return s.Flush()
+}
+
+// flushJobsUnsafe writes the in-memory jobs to disk if they changed
+func (s *Store) flushJobsUnsafe() error {
+	if !s.jobsDirty {
+		return nil
+	}
+	if err := atomicWriteFile(s.jobsPath, s.jobsBackupPath, s.jobsData); err != nil {
+		return fmt.Errorf("failed to write jobs file: %w", err)
+	}
+	s.jobsDirty = false
+	return nil
+}
+
+// enteredTerminal reports whether a save moves a job into a terminal state,
+// which write-behind mode persists immediately
+func enteredTerminal(before JobStatus, job *Job) bool {
+	return job.Status.IsTerminal() && job.Status != before
+}
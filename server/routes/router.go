@@ -21,6 +21,9 @@ func SetAssetsPath(path string) {
 }
 
 func Register() {
+	// CORS must run before every other handler, including preflight checks
+	server.EnableCORS()
+
 	// Register all routes
 	index()
 	health()
@@ -33,11 +36,18 @@ func Register() {
 	api.VelaIndex()
 	api.SheetsIndex()
 	api.StylesIndex()
+	api.PreferencesIndex()
+	api.VariablesIndex()
+	api.ModesIndex()
+	api.AIIndex()
 	api.PipelineIndex()
+	api.UsageIndex()
+	api.AuditIndex()
 	api.ToolsIndex()
 	api.LatexIndex()
 	api.RegisterWebsocketRoutes()
 	api.Notebooks()
+	api.LibraryIndex()
 }
 
 func index() {
@@ -47,4 +47,16 @@ func init() {
 	if err := db.InitStylesDB(); err != nil {
 		logg.Error("Failed to initialize styles DB: ")
 	}
+	if err := db.InitLockoutsDB(); err != nil {
+		logg.Error("Failed to initialize lockouts DB: ")
+	}
+	if err := db.InitModesDB(); err != nil {
+		logg.Error("Failed to initialize modes DB: ")
+	}
+	if err := db.InitAPIKeysDB(); err != nil {
+		logg.Error("Failed to initialize API keys DB: ")
+	}
+	if err := db.InitAuditDB(); err != nil {
+		logg.Error("Failed to initialize audit DB: ")
+	}
 }
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	config "nadhi.dev/sarvar/fun/config"
+	logg "nadhi.dev/sarvar/fun/logs"
+)
+
+// Defaults used when CORS is enabled but methods/headers aren't configured
+const (
+	defaultCORSMethods = "GET,POST,PUT,DELETE,OPTIONS"
+	defaultCORSHeaders = "Origin,Content-Type,Accept,Authorization"
+)
+
+// EnableCORS installs the CORS middleware when CORS_ALLOWED_ORIGINS lists
+// any origins. With no origins configured nothing is installed, so browsers
+// keep the default same-origin policy (which is all the webview needs).
+// Must be called before any routes are registered.
+func EnableCORS() {
+	origins := normalizeCORSList(config.GetConfigString("CORS_ALLOWED_ORIGINS", ""))
+	if origins == "" {
+		return
+	}
+
+	Route.Use(cors.New(cors.Config{
+		AllowOrigins: origins,
+		AllowMethods: normalizeCORSList(config.GetConfigString("CORS_ALLOWED_METHODS", defaultCORSMethods)),
+		AllowHeaders: normalizeCORSList(config.GetConfigString("CORS_ALLOWED_HEADERS", defaultCORSHeaders)),
+	}))
+	logg.Info(fmt.Sprintf("CORS enabled for origins: %s", origins))
+}
+
+// normalizeCORSList trims a comma-separated config value and drops empties
+func normalizeCORSList(value string) string {
+	parts := strings.Split(value, ",")
+	kept := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, ",")
+}
@@ -14,10 +14,8 @@ func (sq *SheetQueue) DeleteJob(id string) error {
     defer sq.mu.Unlock()
     log.Printf("DeleteJob: locked")
 
-    // Stop job listener if exists
-    if listener, ok := sq.jobListeners[id]; ok && listener != nil {
-        delete(sq.jobListeners, id)
-    }
+    // Stop job listeners if any
+    delete(sq.jobListeners, id)
     log.Printf("DeleteJob: loading jobs")
     jobs, err := sq.loadJobs()
     if err != nil {
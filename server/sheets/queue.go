@@ -109,7 +109,7 @@ func NewSheetQueue(logger *log.Logger, queueDir string) (*SheetQueue, error) {
 		queueFile:     queueFile,
 		statusUpdates: make(chan StatusUpdate, 100),
 		logger:        logger,
-		jobListeners:  make(map[string]func(StatusUpdate)),
+		jobListeners:  make(map[string][]listenerEntry),
 	}, nil
 }
 
@@ -435,10 +435,10 @@ func (sq *SheetQueue) statusHandler(ctx context.Context) {
 					sq.logger.Printf("Failed to save jobs after status update: %v", err)
 				}
 
-				// Notify job-specific listener
+				// Notify job-specific listeners
 				sq.mu.Lock()
-				if listener, ok := sq.jobListeners[update.ID]; ok && listener != nil {
-					listener(update)
+				for _, l := range sq.jobListeners[update.ID] {
+					l.cb(update)
 				}
 				sq.mu.Unlock()
 
@@ -458,11 +458,32 @@ func (sq *SheetQueue) updateJobStatus(id, status string, result interface{}) {
 	}
 }
 
-// RegisterJobListener allows registering a callback for job status updates
-func (sq *SheetQueue) RegisterJobListener(jobID string, cb func(StatusUpdate)) {
+// RegisterJobListener adds a callback for job status updates alongside any
+// already registered, and returns its ID for UnregisterJobListener
+func (sq *SheetQueue) RegisterJobListener(jobID string, cb func(StatusUpdate)) int {
 	sq.mu.Lock()
 	defer sq.mu.Unlock()
-	sq.jobListeners[jobID] = cb
+	id := sq.nextListener
+	sq.nextListener++
+	sq.jobListeners[jobID] = append(sq.jobListeners[jobID], listenerEntry{id: id, cb: cb})
+	return id
+}
+
+// UnregisterJobListener removes a callback added by RegisterJobListener
+func (sq *SheetQueue) UnregisterJobListener(jobID string, listenerID int) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	kept := make([]listenerEntry, 0, len(sq.jobListeners[jobID]))
+	for _, l := range sq.jobListeners[jobID] {
+		if l.id != listenerID {
+			kept = append(kept, l)
+		}
+	}
+	if len(kept) == 0 {
+		delete(sq.jobListeners, jobID)
+		return
+	}
+	sq.jobListeners[jobID] = kept
 }
 
 // GetJobsByUser returns all jobs for a specific user
@@ -0,0 +1,92 @@
+package sheet
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	store "nadhi.dev/sarvar/fun/database"
+	"nadhi.dev/sarvar/fun/db"
+)
+
+// newTestSheetQueue returns a queue backed by a queue DB in a temp directory
+// with its status handler running
+func newTestSheetQueue(t *testing.T) *SheetQueue {
+	t.Helper()
+	prevDB := db.QueueDB
+	db.QueueDB = &store.DB{Path: t.TempDir()}
+	t.Cleanup(func() { db.QueueDB = prevDB })
+
+	sq, err := NewSheetQueue(log.New(io.Discard, "", 0), t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSheetQueue: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sq.wg.Add(1)
+	go sq.statusHandler(ctx)
+	t.Cleanup(func() {
+		cancel()
+		sq.wg.Wait()
+	})
+	return sq
+}
+
+func waitForUpdate(t *testing.T, ch <-chan StatusUpdate, who string) StatusUpdate {
+	t.Helper()
+	select {
+	case update := <-ch:
+		return update
+	case <-time.After(2 * time.Second):
+		t.Fatalf("%s received no update", who)
+		return StatusUpdate{}
+	}
+}
+
+func TestJobListenersFanOut(t *testing.T) {
+	sq := newTestSheetQueue(t)
+	const jobID = "job-1"
+	if err := store.AddQueuedJob(db.QueueDB, store.QueuedJob{ID: jobID, UserID: "alice", Status: "pending"}); err != nil {
+		t.Fatalf("AddQueuedJob: %v", err)
+	}
+
+	// Two subscribers register at the same time, as two websockets would
+	var chans [2]chan StatusUpdate
+	var ids [2]int
+	var wg sync.WaitGroup
+	for i := range chans {
+		chans[i] = make(chan StatusUpdate, 4)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ch := chans[i]
+			ids[i] = sq.RegisterJobListener(jobID, func(update StatusUpdate) { ch <- update })
+		}(i)
+	}
+	wg.Wait()
+	if ids[0] == ids[1] {
+		t.Fatalf("both listeners got ID %d", ids[0])
+	}
+
+	sq.updateJobStatus(jobID, "processing", nil)
+	for i, ch := range chans {
+		if got := waitForUpdate(t, ch, fmt.Sprintf("listener %d", i)); got.Status != "processing" {
+			t.Errorf("listener %d got status %q, want %q", i, got.Status, "processing")
+		}
+	}
+
+	// Once one subscriber leaves, the other still gets updates
+	sq.UnregisterJobListener(jobID, ids[0])
+	sq.updateJobStatus(jobID, "completed", nil)
+	if got := waitForUpdate(t, chans[1], "remaining listener"); got.Status != "completed" {
+		t.Errorf("remaining listener got status %q, want %q", got.Status, "completed")
+	}
+	select {
+	case update := <-chans[0]:
+		t.Errorf("unregistered listener got update %q", update.Status)
+	default:
+	}
+}
@@ -21,5 +21,12 @@ type SheetQueue struct {
 	wg            sync.WaitGroup
 	logger        *log.Logger
 	mu            sync.Mutex
-	jobListeners  map[string]func(StatusUpdate)
+	jobListeners  map[string][]listenerEntry
+	nextListener  int
+}
+
+// listenerEntry is a callback registered for one job's status updates
+type listenerEntry struct {
+	id int
+	cb func(StatusUpdate)
 }
\ No newline at end of file
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
@@ -12,16 +13,55 @@ import (
 	"time"
 
 	"golang.org/x/net/html"
+	"nadhi.dev/sarvar/fun/config"
+	"nadhi.dev/sarvar/fun/httpclient"
 )
 
+// ErrWebSearchDisabled is returned by every search and fetch when LOCAL_ONLY is set
+var ErrWebSearchDisabled = fmt.Errorf("web search is %w", config.ErrLocalOnly)
+
 const (
 	defaultLimit       = 3
+	maxLimit           = 5
 	maxExtractChars    = 20000
 	maxUserAgent       = "Mozilla/5.0 (compatible; NightwaysBot/1.0)"
 	duckDuckGoEndpoint = "https://api.duckduckgo.com/"
 	serpAPIEndpoint    = "https://serpapi.com/search.json"
 )
 
+// ErrRateLimited matches (via errors.Is) any error caused by a search
+// provider throttling us
+var ErrRateLimited = errors.New("web search rate limited")
+
+// errNoResults is returned by a provider whose search found nothing
+var errNoResults = errors.New("no results found")
+
+// DefaultMinResults is how many results SerpAPI must return before
+// DuckDuckGo is no longer asked to make up the rest
+const DefaultMinResults = 2
+
+// ErrNoContent is returned by SearchAndExtract when no result yielded any
+// text, so callers don't pass an empty header along as context
+var ErrNoContent = errors.New("web search returned no usable content")
+
+// RateLimitError reports that a search provider throttled the request
+type RateLimitError struct {
+	Provider   string
+	RetryAfter string
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter != "" {
+		return fmt.Sprintf("%s rate limited the search (retry after %s)", e.Provider, e.RetryAfter)
+	}
+	return fmt.Sprintf("%s rate limited the search", e.Provider)
+}
+
+// Is lets errors.Is(err, ErrRateLimited) match any RateLimitError
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
 type SearchResult struct {
 	Title   string `json:"title"`
 	URL     string `json:"url"`
@@ -31,23 +71,123 @@ type SearchResult struct {
 
 // Search performs a web search. If SERPAPI_KEY is configured, it uses Google via SerpAPI.
 // Otherwise it falls back to DuckDuckGo Instant Answer API.
+//
+// When SerpAPI returns fewer than WEB_SEARCH_MIN_RESULTS results (default
+// 2, never more than limit; 0 turns this off), DuckDuckGo is searched too
+// and its results are added after SerpAPI's, skipping URLs already found.
+// A throttled SerpAPI falls back to DuckDuckGo alone.
 func Search(query string, limit int) ([]SearchResult, error) {
+	if config.IsLocalOnly() {
+		return nil, ErrWebSearchDisabled
+	}
 	q := strings.TrimSpace(query)
 	if q == "" {
 		return nil, errors.New("query is required")
 	}
-	if limit <= 0 {
-		limit = defaultLimit
+	limit = ClampLimit(limit)
+
+	apiKey := strings.TrimSpace(os.Getenv("SERPAPI_KEY"))
+	if apiKey == "" {
+		return searchDuckDuckGo(q, limit)
 	}
-	if limit > 5 {
-		limit = 5
+
+	results, err := searchSerpAPI(q, apiKey, limit)
+	if errors.Is(err, ErrRateLimited) {
+		log.Printf("[WEBSEARCH] %v, trying the next provider", err)
+		return searchDuckDuckGo(q, limit)
+	}
+	min := minResults(limit)
+	if errors.Is(err, errNoResults) && min > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(results) >= min {
+		return results, nil
 	}
 
-	if apiKey := strings.TrimSpace(os.Getenv("SERPAPI_KEY")); apiKey != "" {
-		return searchSerpAPI(q, apiKey, limit)
+	log.Printf("[WEBSEARCH] serpapi returned %d of %d wanted results, adding duckduckgo", len(results), min)
+	extra, err := searchDuckDuckGo(q, limit)
+	if err != nil {
+		if len(results) > 0 {
+			return results, nil
+		}
+		return nil, err
 	}
+	return mergeResults(results, extra, limit), nil
+}
 
-	return searchDuckDuckGo(q, limit)
+// minResults returns how many results the first provider must find before
+// the next is skipped, from WEB_SEARCH_MIN_RESULTS capped at limit
+func minResults(limit int) int {
+	min := config.GetConfigInt("WEB_SEARCH_MIN_RESULTS", DefaultMinResults)
+	if min < 0 {
+		return 0
+	}
+	if min > limit {
+		return limit
+	}
+	return min
+}
+
+// mergeResults appends extra to results, dropping URLs already present,
+// up to limit results in all
+func mergeResults(results, extra []SearchResult, limit int) []SearchResult {
+	seen := make(map[string]bool, len(results))
+	for _, res := range results {
+		seen[normalizeResultURL(res.URL)] = true
+	}
+	for _, res := range extra {
+		if len(results) >= limit {
+			break
+		}
+		key := normalizeResultURL(res.URL)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		results = append(results, res)
+	}
+	return results
+}
+
+// normalizeResultURL reduces a URL to what identifies the page, so the
+// same page found by two providers is counted once
+func normalizeResultURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme == "http" {
+		u.Scheme = "https"
+	}
+	u.Host = strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	u.Fragment = ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u.String()
+}
+
+// ClampLimit returns the number of results a search for limit will fetch:
+// the default of 3 when limit is 0 or less, and never more than 5
+func ClampLimit(limit int) int {
+	if limit <= 0 {
+		return defaultLimit
+	}
+	if limit > maxLimit {
+		return maxLimit
+	}
+	return limit
+}
+
+// isThrottled reports whether an HTTP status means the provider is rate limiting.
+// DuckDuckGo signals throttling with 202 or 403 as well as 429.
+func isThrottled(provider string, status int) bool {
+	if status == http.StatusTooManyRequests {
+		return true
+	}
+	return provider == "duckduckgo" && (status == http.StatusAccepted || status == http.StatusForbidden)
 }
 
 // SearchAndExtract performs search and fetches text content from top results.
@@ -57,20 +197,42 @@ func SearchAndExtract(query string, limit int) (string, []SearchResult, error) {
 		return "", nil, err
 	}
 
+	text, err := ExtractResults(results)
+	if err != nil {
+		return "", results, fmt.Errorf("%w for %q", err, query)
+	}
+	return text, results, nil
+}
+
+// ExtractResults fetches the pages of results and formats their text as
+// research context for a prompt. It fails with ErrNoContent when none of
+// them can be read.
+func ExtractResults(results []SearchResult) (string, error) {
 	var b strings.Builder
 	b.WriteString("Web Research Results:\n")
 
+	extracted := 0
 	for i, res := range results {
 		text, err := ExtractTextFromURL(res.URL)
 		if err != nil {
-			continue
+			// Pages can throttle or fail too; keep the snippet rather than
+			// losing the result entirely
+			if res.Snippet == "" {
+				continue
+			}
+			text = res.Snippet
 		}
 		b.WriteString(fmt.Sprintf("\n[%d] %s\nURL: %s\n", i+1, res.Title, res.URL))
 		b.WriteString(text)
 		b.WriteString("\n---\n")
+		extracted++
+	}
+
+	if extracted == 0 {
+		return "", fmt.Errorf("%w: %d result(s), none readable", ErrNoContent, len(results))
 	}
 
-	return b.String(), results, nil
+	return b.String(), nil
 }
 
 func searchDuckDuckGo(query string, limit int) ([]SearchResult, error) {
@@ -81,12 +243,15 @@ func searchDuckDuckGo(query string, limit int) ([]SearchResult, error) {
 	params.Set("no_html", "1")
 
 	reqURL := duckDuckGoEndpoint + "?" + params.Encode()
-	resp, err := http.Get(reqURL)
+	resp, err := httpclient.New(20 * time.Second).Get(reqURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if isThrottled("duckduckgo", resp.StatusCode) {
+		return nil, &RateLimitError{Provider: "duckduckgo", RetryAfter: resp.Header.Get("Retry-After")}
+	}
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("duckduckgo error: %s", string(body))
@@ -126,7 +291,7 @@ func searchDuckDuckGo(query string, limit int) ([]SearchResult, error) {
 	}
 
 	if len(results) == 0 {
-		return nil, errors.New("no results found")
+		return nil, errNoResults
 	}
 
 	return results, nil
@@ -162,7 +327,7 @@ func searchSerpAPI(query, apiKey string, limit int) ([]SearchResult, error) {
 
 	reqURL := serpAPIEndpoint + "?" + params.Encode()
 
-	client := &http.Client{Timeout: 20 * time.Second}
+	client := httpclient.New(20 * time.Second)
 	req, err := http.NewRequest("GET", reqURL, nil)
 	if err != nil {
 		return nil, err
@@ -174,6 +339,9 @@ func searchSerpAPI(query, apiKey string, limit int) ([]SearchResult, error) {
 	}
 	defer resp.Body.Close()
 
+	if isThrottled("serpapi", resp.StatusCode) {
+		return nil, &RateLimitError{Provider: "serpapi", RetryAfter: resp.Header.Get("Retry-After")}
+	}
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("serpapi error: %s", string(body))
@@ -201,7 +369,7 @@ func searchSerpAPI(query, apiKey string, limit int) ([]SearchResult, error) {
 	}
 
 	if len(results) == 0 {
-		return nil, errors.New("no results found")
+		return nil, errNoResults
 	}
 
 	return results, nil
@@ -209,11 +377,14 @@ func searchSerpAPI(query, apiKey string, limit int) ([]SearchResult, error) {
 
 // ExtractTextFromURL fetches a URL and extracts readable text from HTML.
 func ExtractTextFromURL(rawURL string) (string, error) {
+	if config.IsLocalOnly() {
+		return "", ErrWebSearchDisabled
+	}
 	if rawURL == "" {
 		return "", errors.New("url is required")
 	}
 
-	client := &http.Client{Timeout: 20 * time.Second}
+	client := httpclient.New(20 * time.Second)
 	req, err := http.NewRequest("GET", rawURL, nil)
 	if err != nil {
 		return "", err
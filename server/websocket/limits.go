@@ -0,0 +1,30 @@
+package websocket
+
+// TryOpen counts a new websocket unless max are already open, in which case
+// it reports false and the connection should be refused. max below 1 means
+// no limit. Every successful TryOpen must be paired with Closed.
+func (usm *UserSocketManager) TryOpen(max int) bool {
+	usm.mu.Lock()
+	defer usm.mu.Unlock()
+	if max > 0 && usm.open >= max {
+		return false
+	}
+	usm.open++
+	return true
+}
+
+// Closed uncounts a websocket counted by TryOpen
+func (usm *UserSocketManager) Closed() {
+	usm.mu.Lock()
+	defer usm.mu.Unlock()
+	if usm.open > 0 {
+		usm.open--
+	}
+}
+
+// OpenConnections returns how many websockets are open
+func (usm *UserSocketManager) OpenConnections() int {
+	usm.mu.RLock()
+	defer usm.mu.RUnlock()
+	return usm.open
+}
@@ -23,6 +23,10 @@ type UserSocketManager struct {
     connections map[string][]*Connection // map[userID][]Connection
     mu          sync.RWMutex
     logger      *log.Logger
+
+    // open counts every websocket the server holds, notification and job
+    // sockets alike; see TryOpen
+    open int
 }
 
 // NewUserSocketManager creates a new UserSocketManager
@@ -227,6 +231,7 @@ func (usm *UserSocketManager) Info() map[string]interface{} {
         "users":               userCount,
         "totalConnections":    totalConnections,
         "connectionsPerUser":  userConnections,
+        "openConnections":     usm.open,
         "timestamp":           time.Now(),
     }
 }